@@ -10,9 +10,13 @@ import (
 	"syscall"
 	"time"
 
+	"sadbhavana/tree-project/pkgs/auth"
 	"sadbhavana/tree-project/pkgs/cli"
 	"sadbhavana/tree-project/pkgs/conf"
 	"sadbhavana/tree-project/pkgs/db"
+	"sadbhavana/tree-project/pkgs/donorupdate"
+	"sadbhavana/tree-project/pkgs/locker"
+	"sadbhavana/tree-project/pkgs/whatsapp"
 	"sadbhavana/tree-project/web"
 
 	"github.com/danielgtaylor/huma/v2"
@@ -46,9 +50,11 @@ func main() {
 	router.Use(middleware.Recoverer)
 	router.Use(middleware.Compress(5))
 
-	// Serve static files
+	// Serve the site's assets. Uploaded files also live under ./static, so only
+	// the asset folders are public; the rest is served through signed links.
 	fs := http.FileServer(http.Dir("./static"))
-	router.Handle("/static/*", http.StripPrefix("/static/", fs))
+	router.Handle("/static/css/*", http.StripPrefix("/static/", fs))
+	router.Handle("/static/js/*", http.StripPrefix("/static/", fs))
 
 	// Serve index.html at root
 	router.Get("/map", func(w http.ResponseWriter, r *http.Request) {
@@ -71,8 +77,38 @@ func main() {
 		log.Fatalf("Failed to register Admin handlers: %v", err)
 	}
 
+	if err := web.RegisterAuthHandlers(router); err != nil {
+		log.Fatalf("Failed to register auth handlers: %v", err)
+	}
+
+	if err := web.RegisterFileHandlers(router); err != nil {
+		log.Fatalf("Failed to register file handlers: %v", err)
+	}
+
 	log.Println("✅ API handlers registered successfully")
 
+	// Start WhatsApp ingestion workers
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	workers := whatsapp.StartWorkers(workerCtx, cfg.WhatsappConfig)
+
+	// Refresh provider tokens ahead of expiry
+	tokens, err := auth.DefaultTokenManager()
+	if err != nil {
+		log.Fatalf("Failed to set up provider tokens: %v", err)
+	}
+	go tokens.Run(workerCtx, cfg.OAuth.TokenRefreshInterval)
+
+	// Optionally run the donor update dispatcher in-process
+	if cfg.DonorUpdate.Enabled {
+		channel, err := donorupdate.NewChannel(cfg.DonorUpdate.Channel, cfg)
+		if err != nil {
+			log.Fatalf("Failed to create donor update channel: %v", err)
+		}
+		dispatcher := donorupdate.NewDispatcher(channel, locker.NewRedisLocker(workerCtx, "donorupdate:"), cfg.DonorUpdate.BatchSize, cfg.DonorUpdate.PhotoBaseURL, cfg.DonorUpdate.PhotoLinkExpiry)
+		go dispatcher.Run(workerCtx, cfg.DonorUpdate.Interval)
+		log.Printf("Donor update dispatcher started (channel: %s)", channel.Name())
+	}
+
 	// Server configuration
 	port := cfg.BaseConfig.Port
 	if port == 0 {
@@ -109,5 +145,8 @@ func main() {
 		log.Fatalf("Server forced to shutdown: %v", err)
 	}
 
+	stopWorkers()
+	workers.Wait()
+
 	log.Println("Server stopped")
 }
@@ -0,0 +1,170 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"sadbhavana/tree-project/pkgs/cache"
+	"sadbhavana/tree-project/pkgs/conf"
+	"sadbhavana/tree-project/pkgs/db"
+	"sadbhavana/tree-project/pkgs/providers"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+const authCodeStateKey = "oauth_state:"
+
+var ErrInvalidState = errors.New("sign-in state is unknown or has expired")
+
+var (
+	connectHooksMu sync.Mutex
+	connectHooks   = map[providers.ProviderType][]func(){}
+)
+
+// OnConnect registers fn to run each time an account is connected for the
+// provider, so state kept for the account it replaces can be dropped
+func OnConnect(provider providers.ProviderType, fn func()) {
+	connectHooksMu.Lock()
+	defer connectHooksMu.Unlock()
+	connectHooks[provider] = append(connectHooks[provider], fn)
+}
+
+func runConnectHooks(provider providers.ProviderType) {
+	connectHooksMu.Lock()
+	hooks := connectHooks[provider]
+	connectHooksMu.Unlock()
+	for _, fn := range hooks {
+		fn()
+	}
+}
+
+// AuthCodeState is kept in Redis from the start of a connection until the
+// provider sends the admin back, so the callback only accepts codes from a
+// connection this server started
+type AuthCodeState struct {
+	Provider  string    `json:"provider" validate:"required"`
+	StartedAt time.Time `json:"started_at"`
+}
+
+// UserOAuth2ConfigFor is the OAuth2 client configured for connecting a
+// user's account with the provider
+func UserOAuth2ConfigFor(provider providers.ProviderType, cfg conf.OAuthConfig) (*db.OAuth2Config, error) {
+	redirectURI := strings.TrimSuffix(cfg.RedirectBaseURL, "/") + "/auth/" + string(provider) + "/callback"
+	switch provider {
+	case providers.GOOGLE_PROVIDER:
+		if cfg.GoogleClientID == "" || cfg.GoogleClientSecret == "" {
+			return nil, errors.New("GOOGLE_OAUTH_CLIENT_ID and GOOGLE_OAUTH_CLIENT_SECRET must be set")
+		}
+		return &db.OAuth2Config{
+			ProviderType: string(provider),
+			ClientId:     cfg.GoogleClientID,
+			ClientSecret: cfg.GoogleClientSecret,
+			RedirectUri:  redirectURI,
+			Scopes:       cfg.GoogleScopes,
+		}, nil
+	}
+	return nil, errors.New("unsupported provider type for user oauth2: " + string(provider))
+}
+
+func newState() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// StartAuthCodeFlow records a new state for the provider and returns it with
+// the URL of the provider's consent page
+func StartAuthCodeFlow(ctx context.Context, states cache.Cache[AuthCodeState], provider providers.ProviderType, cfg conf.OAuthConfig) (string, string, error) {
+	oauth2Config, err := UserOAuth2ConfigFor(provider, cfg)
+	if err != nil {
+		return "", "", err
+	}
+	authorizer, err := NewUserOAuth2Authorizer(oauth2Config)
+	if err != nil {
+		return "", "", err
+	}
+
+	state, err := newState()
+	if err != nil {
+		return "", "", errors.Annotatef(err, "failed to generate state")
+	}
+	expiry := cfg.StateExpiry
+	err = states.Set(ctx, authCodeStateKey+state, AuthCodeState{Provider: string(provider), StartedAt: time.Now()}, &expiry)
+	if err != nil {
+		return "", "", errors.Annotatef(err, "failed to store state")
+	}
+
+	authURL, err := authorizer.AuthCodeUrl(state)
+	if err != nil {
+		return "", "", err
+	}
+	return authURL, state, nil
+}
+
+// ConsumeState checks that a state was issued for the provider and removes
+// it, so each one is accepted once
+func ConsumeState(ctx context.Context, states cache.Cache[AuthCodeState], provider providers.ProviderType, state string) error {
+	if state == "" {
+		return ErrInvalidState
+	}
+	saved, err := states.Take(ctx, authCodeStateKey+state)
+	if err != nil {
+		return errors.Annotatef(err, "failed to read state")
+	}
+	if saved == nil || saved.Provider != string(provider) {
+		return ErrInvalidState
+	}
+	return nil
+}
+
+// FinishAuthCodeFlow exchanges the code the provider sent back for a token
+// and saves it, with the client it was issued to, as the provider's auth.
+// The token is refreshed from then on like any other provider's.
+func FinishAuthCodeFlow(ctx context.Context, q *db.Queries, states cache.Cache[AuthCodeState], tokens *TokenManager, provider providers.ProviderType, state, code string, cfg conf.OAuthConfig) error {
+	if err := ConsumeState(ctx, states, provider, state); err != nil {
+		return err
+	}
+	if code == "" {
+		return errors.New("provider did not return a code")
+	}
+
+	oauth2Config, err := UserOAuth2ConfigFor(provider, cfg)
+	if err != nil {
+		return err
+	}
+	authorizer, err := NewUserOAuth2Authorizer(oauth2Config)
+	if err != nil {
+		return err
+	}
+	token, err := authorizer.ExchangeCode(ctx, code)
+	if err != nil {
+		return errors.Annotatef(err, "failed to exchange code for provider %s", provider)
+	}
+
+	authData, err := sealStruct(db.AuthData{
+		ProviderName: string(provider),
+		AuthConfig: &db.AuthConfig{
+			AuthType:     db.AuthTypeUserOAuth2,
+			Oauth2Config: oauth2Config,
+		},
+		ActiveToken: token,
+	})
+	if err != nil {
+		return errors.Annotatef(err, "failed to encrypt auth for provider %s", provider)
+	}
+	if err := db.CreateAuthForProvider(ctx, q, authData); err != nil {
+		return errors.Annotatef(err, "failed to save auth for provider %s", provider)
+	}
+
+	// Replace any token cached for the account this replaces
+	if tokens != nil {
+		tokens.Put(ctx, provider, token)
+	}
+	runConnectHooks(provider)
+	return nil
+}
@@ -12,6 +12,8 @@ func GetOAuth2Client(auth *db.AuthConfig) (OAuth2, error) {
 	switch auth.AuthType {
 	case db.AuthTypeClientCredentials:
 		return NewClientCredentialsAuthorizer(auth.ClientCredentialsConfig)
+	case db.AuthTypeUserOAuth2:
+		return NewUserOAuth2Authorizer(auth.Oauth2Config)
 	default:
 		return nil, errors.New("auth type currently unsupported: " + string(auth.AuthType))
 	}
@@ -2,13 +2,12 @@ package auth
 
 import (
 	"context"
-	"sadbhavana/tree-project/pkgs/db"
 
 	"golang.org/x/oauth2"
 )
 
 type UserOAuth2 interface {
-	AuthCodeUrl(state db.OAuth2Config) (string, error)
+	AuthCodeUrl(state string) (string, error)
 	ExchangeCode(ctx context.Context, code string) (*oauth2.Token, error)
 	OAuth2
 }
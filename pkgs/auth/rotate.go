@@ -0,0 +1,110 @@
+package auth
+
+import (
+	"context"
+	"sadbhavana/tree-project/pkgs/db"
+
+	"github.com/juju/errors"
+)
+
+// RotateResult counts the stored auth and provider settings a rotation looked
+// at and how many of them it re-encrypted
+type RotateResult struct {
+	AuthChecked      int
+	AuthUpdated      int
+	ProvidersChecked int
+	ProvidersUpdated int
+}
+
+// RotateSecrets re-encrypts every secret in core.Authentication and
+// stp.U_Provider with the keyring's current master key. Plaintext secrets left
+// from before encryption are sealed, and secrets sealed under a previous
+// master key are rewrapped; data keys and ciphertexts are otherwise kept. All
+// rows are updated in one transaction, and none are with dryRun set. The
+// database then refuses plaintext provider secrets (see SaveProviders).
+func RotateSecrets(ctx context.Context, keyring *Keyring, dryRun bool) (RotateResult, error) {
+	var result RotateResult
+	if keyring == nil || keyring.current == nil {
+		return result, ErrNoMasterKey
+	}
+
+	q, tx, err := db.NewQueriesWithTx(ctx)
+	if err != nil {
+		return result, errors.Annotatef(err, "failed to get database queries")
+	}
+	defer tx.Rollback(ctx)
+
+	auths, err := q.ListAuthSecrets(ctx)
+	if err != nil {
+		return result, errors.Annotatef(err, "failed to list stored auth")
+	}
+	for _, row := range auths {
+		result.AuthChecked++
+		authConfig, authChanged, err := keyring.RewrapJSON(row.AuthConfig)
+		if err != nil {
+			return result, errors.Annotatef(err, "auth config for provider %s", row.ProviderName)
+		}
+		activeToken, tokenChanged, err := keyring.RewrapJSON(row.ActiveToken)
+		if err != nil {
+			return result, errors.Annotatef(err, "active token for provider %s", row.ProviderName)
+		}
+		if !authChanged && !tokenChanged {
+			continue
+		}
+		result.AuthUpdated++
+		if dryRun {
+			continue
+		}
+		err = q.UpdateAuthSecrets(ctx, db.UpdateAuthSecretsParams{
+			AuthConfig:   authConfig,
+			ActiveToken:  activeToken,
+			ProviderName: row.ProviderName,
+		})
+		if err != nil {
+			return result, errors.Annotatef(err, "failed to update auth for provider %s", row.ProviderName)
+		}
+	}
+
+	settings, err := q.ListProviderSecrets(ctx)
+	if err != nil {
+		return result, errors.Annotatef(err, "failed to list provider settings")
+	}
+	for _, row := range settings {
+		result.ProvidersChecked++
+		authConfig, authChanged, err := keyring.RewrapJSON(row.Authconfig)
+		if err != nil {
+			return result, errors.Annotatef(err, "auth config for provider %s", row.Providername)
+		}
+		tokenConfig, tokenChanged, err := keyring.RewrapJSON(row.Tokenconfig)
+		if err != nil {
+			return result, errors.Annotatef(err, "token config for provider %s", row.Providername)
+		}
+		if !authChanged && !tokenChanged {
+			continue
+		}
+		result.ProvidersUpdated++
+		if dryRun {
+			continue
+		}
+		err = q.UpdateProviderSecrets(ctx, db.UpdateProviderSecretsParams{
+			AuthConfig:  authConfig,
+			TokenConfig: tokenConfig,
+			ProviderIdn: row.Provideridn,
+		})
+		if err != nil {
+			return result, errors.Annotatef(err, "failed to update settings for provider %s", row.Providername)
+		}
+	}
+
+	if dryRun {
+		return result, nil
+	}
+	// From now on P_SaveProvider only accepts sealed secrets
+	if err := q.MarkSecretsSealed(ctx, keyring.current.id); err != nil {
+		return result, errors.Annotatef(err, "failed to record that secrets are encrypted")
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return result, errors.Annotatef(err, "failed to commit rotated secrets")
+	}
+	return result, nil
+}
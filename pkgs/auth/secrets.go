@@ -0,0 +1,455 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sadbhavana/tree-project/pkgs/conf"
+	"sadbhavana/tree-project/pkgs/db"
+	"strings"
+	"sync"
+
+	"github.com/juju/errors"
+)
+
+// Secrets are sealed with envelope encryption: each value is encrypted with
+// its own random data key, and the data key is encrypted ("wrapped") with the
+// master key. A sealed value is a string of the form
+//
+//	enc:v1:<master key id>:<wrapped data key>:<ciphertext>
+//
+// so it fits in the string fields the plaintext used to. Rotating the master
+// key only rewraps the data keys.
+const sealedPrefix = "enc:v1:"
+
+const masterKeySize = 32
+
+// secretFields are the JSON keys whose string values are sealed wherever they
+// appear in stored auth. core.F_RedactSecrets redacts the same keys.
+var secretFields = map[string]bool{
+	"access_token":      true,
+	"api_key":           true,
+	"client_secret":     true,
+	"password":          true,
+	"private_key":       true,
+	"refresh_token":     true,
+	"secret_access_key": true,
+	"session_token":     true,
+}
+
+// redactedValue stands in for secrets in DbApi responses. Settings read back
+// and saved again keep it, and P_SaveProvider restores the stored secret.
+const redactedValue = "[REDACTED]"
+
+var ErrNoMasterKey = errors.New("SECRETS_MASTER_KEY is not set")
+
+type masterKey struct {
+	id   string
+	aead cipher.AEAD
+}
+
+// Keyring seals secrets with the current master key and opens secrets sealed
+// with it or with a previous one
+type Keyring struct {
+	current *masterKey
+	keys    map[string]*masterKey
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func parseMasterKey(encoded string) (*masterKey, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, errors.Annotatef(err, "master key is not valid base64")
+	}
+	if len(key) != masterKeySize {
+		return nil, errors.Errorf("master key is %d bytes, want %d", len(key), masterKeySize)
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(key)
+	return &masterKey{id: hex.EncodeToString(sum[:4]), aead: aead}, nil
+}
+
+// NewKeyring builds a keyring from base64 master keys. Without a current key
+// secrets can still be opened with the previous keys, but not sealed.
+func NewKeyring(current string, previous []string) (*Keyring, error) {
+	k := &Keyring{keys: map[string]*masterKey{}}
+	if current != "" {
+		mk, err := parseMasterKey(current)
+		if err != nil {
+			return nil, err
+		}
+		k.current = mk
+		k.keys[mk.id] = mk
+	}
+	for _, encoded := range previous {
+		if encoded == "" {
+			continue
+		}
+		mk, err := parseMasterKey(encoded)
+		if err != nil {
+			return nil, errors.Annotatef(err, "previous master key")
+		}
+		if _, ok := k.keys[mk.id]; !ok {
+			k.keys[mk.id] = mk
+		}
+	}
+	return k, nil
+}
+
+func KeyringFromConfig(cfg conf.SecretsConfig) (*Keyring, error) {
+	return NewKeyring(cfg.MasterKey, cfg.PreviousMasterKeys)
+}
+
+// GenerateMasterKey returns a new random master key, base64 encoded
+func GenerateMasterKey() (string, error) {
+	key := make([]byte, masterKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+var (
+	defaultKeyringOnce sync.Once
+	defaultKeyring     *Keyring
+	defaultKeyringErr  error
+)
+
+// DefaultKeyring is the keyring built from the loaded config
+func DefaultKeyring() (*Keyring, error) {
+	defaultKeyringOnce.Do(func() {
+		defaultKeyring, defaultKeyringErr = KeyringFromConfig(conf.GetConfig().Secrets)
+		if defaultKeyringErr == nil && defaultKeyring.current == nil {
+			log.Println("Warning: SECRETS_MASTER_KEY is not set; provider credentials are stored unencrypted")
+		}
+	})
+	return defaultKeyring, defaultKeyringErr
+}
+
+func IsSealed(value string) bool {
+	return strings.HasPrefix(value, sealedPrefix)
+}
+
+func encrypt(aead cipher.AEAD, plaintext, additionalData []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+func decrypt(aead cipher.AEAD, sealed, additionalData []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("sealed value is too short")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, additionalData)
+}
+
+type sealedValue struct {
+	keyID      string
+	wrappedKey []byte
+	ciphertext []byte
+}
+
+func parseSealed(value string) (sealedValue, error) {
+	parts := strings.Split(strings.TrimPrefix(value, sealedPrefix), ":")
+	if len(parts) != 3 {
+		return sealedValue{}, errors.New("sealed value is malformed")
+	}
+	wrappedKey, err := base64.RawStdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return sealedValue{}, errors.Annotatef(err, "sealed value has a malformed key")
+	}
+	ciphertext, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return sealedValue{}, errors.Annotatef(err, "sealed value has malformed ciphertext")
+	}
+	return sealedValue{keyID: parts[0], wrappedKey: wrappedKey, ciphertext: ciphertext}, nil
+}
+
+func (s sealedValue) String() string {
+	return sealedPrefix + s.keyID + ":" +
+		base64.RawStdEncoding.EncodeToString(s.wrappedKey) + ":" +
+		base64.RawStdEncoding.EncodeToString(s.ciphertext)
+}
+
+// Seal encrypts a secret with a new data key wrapped by the current master key
+func (k *Keyring) Seal(plaintext string) (string, error) {
+	if k.current == nil {
+		return "", ErrNoMasterKey
+	}
+	dataKey := make([]byte, masterKeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", err
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return "", err
+	}
+	ciphertext, err := encrypt(aead, []byte(plaintext), nil)
+	if err != nil {
+		return "", err
+	}
+	// The key id is bound to the wrapped key, so it cannot be swapped
+	wrappedKey, err := encrypt(k.current.aead, dataKey, []byte(k.current.id))
+	if err != nil {
+		return "", err
+	}
+	return sealedValue{keyID: k.current.id, wrappedKey: wrappedKey, ciphertext: ciphertext}.String(), nil
+}
+
+func (k *Keyring) unwrap(s sealedValue) ([]byte, error) {
+	mk, ok := k.keys[s.keyID]
+	if !ok {
+		return nil, errors.Errorf("secret was sealed with unknown master key %s", s.keyID)
+	}
+	dataKey, err := decrypt(mk.aead, s.wrappedKey, []byte(s.keyID))
+	if err != nil {
+		return nil, errors.Annotatef(err, "failed to unwrap data key")
+	}
+	return dataKey, nil
+}
+
+// Open decrypts a sealed secret. Values that are not sealed are returned
+// unchanged.
+func (k *Keyring) Open(value string) (string, error) {
+	if !IsSealed(value) {
+		return value, nil
+	}
+	s, err := parseSealed(value)
+	if err != nil {
+		return "", err
+	}
+	dataKey, err := k.unwrap(s)
+	if err != nil {
+		return "", err
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := decrypt(aead, s.ciphertext, nil)
+	if err != nil {
+		return "", errors.Annotatef(err, "failed to decrypt secret")
+	}
+	return string(plaintext), nil
+}
+
+// Rewrap brings a secret up to date with the current master key: plaintext is
+// sealed and a data key wrapped by a previous master key is rewrapped. It
+// reports whether the value changed.
+func (k *Keyring) Rewrap(value string) (string, bool, error) {
+	if k.current == nil {
+		return "", false, ErrNoMasterKey
+	}
+	if !IsSealed(value) {
+		sealed, err := k.Seal(value)
+		return sealed, err == nil, err
+	}
+	s, err := parseSealed(value)
+	if err != nil {
+		return "", false, err
+	}
+	if s.keyID == k.current.id {
+		return value, false, nil
+	}
+	dataKey, err := k.unwrap(s)
+	if err != nil {
+		return "", false, err
+	}
+	s.wrappedKey, err = encrypt(k.current.aead, dataKey, []byte(k.current.id))
+	if err != nil {
+		return "", false, err
+	}
+	s.keyID = k.current.id
+	return s.String(), true, nil
+}
+
+// transformSecrets applies fn to the string value of every secret field in a
+// JSON document, at any depth. When all is set every string value is passed
+// to fn, wherever it is. It reports whether fn changed anything.
+func transformSecrets(doc []byte, all bool, fn func(string) (string, bool, error)) ([]byte, bool, error) {
+	trimmed := bytes.TrimSpace(doc)
+	if len(trimmed) == 0 || bytes.Equal(trimmed, []byte("null")) {
+		return doc, false, nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(doc))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, false, errors.Annotatef(err, "failed to parse stored auth")
+	}
+
+	changed := false
+	var walk func(v any, secret bool) (any, error)
+	walk = func(v any, secret bool) (any, error) {
+		switch t := v.(type) {
+		case map[string]any:
+			for key, child := range t {
+				out, err := walk(child, secretFields[strings.ToLower(key)])
+				if err != nil {
+					return nil, errors.Annotatef(err, "field %s", key)
+				}
+				t[key] = out
+			}
+		case []any:
+			for i, child := range t {
+				out, err := walk(child, secret)
+				if err != nil {
+					return nil, err
+				}
+				t[i] = out
+			}
+		case string:
+			if (secret || all) && t != "" {
+				out, c, err := fn(t)
+				if err != nil {
+					return nil, err
+				}
+				changed = changed || c
+				return out, nil
+			}
+		}
+		return v, nil
+	}
+	out, err := walk(v, false)
+	if err != nil {
+		return nil, false, err
+	}
+	if !changed {
+		return doc, false, nil
+	}
+	encoded, err := json.Marshal(out)
+	return encoded, true, err
+}
+
+// SealJSON seals the secret fields of a JSON document that are not sealed yet
+// or redacted
+func (k *Keyring) SealJSON(doc []byte) ([]byte, error) {
+	out, _, err := transformSecrets(doc, false, func(v string) (string, bool, error) {
+		if IsSealed(v) || v == redactedValue {
+			return v, false, nil
+		}
+		sealed, err := k.Seal(v)
+		return sealed, true, err
+	})
+	return out, err
+}
+
+// openJSON opens every sealed value in a JSON document
+func (k *Keyring) openJSON(doc []byte) ([]byte, error) {
+	out, _, err := transformSecrets(doc, true, func(v string) (string, bool, error) {
+		if !IsSealed(v) {
+			return v, false, nil
+		}
+		opened, err := k.Open(v)
+		return opened, true, err
+	})
+	return out, err
+}
+
+// RewrapJSON brings every secret field of a JSON document up to date with the
+// current master key, reporting whether anything changed
+func (k *Keyring) RewrapJSON(doc []byte) ([]byte, bool, error) {
+	return transformSecrets(doc, false, k.Rewrap)
+}
+
+// sealStruct seals the secret fields of a value stored as JSON. Without a
+// master key the value is returned as is.
+func sealStruct[T any](v T) (T, error) {
+	k, err := DefaultKeyring()
+	if err != nil {
+		return v, err
+	}
+	return sealStructWith(k, v)
+}
+
+func sealStructWith[T any](k *Keyring, v T) (T, error) {
+	if k == nil || k.current == nil {
+		return v, nil
+	}
+	return convertStruct(v, k.SealJSON)
+}
+
+// openStruct opens the sealed fields of a value read from the database
+func openStruct[T any](v T) (T, error) {
+	k, err := DefaultKeyring()
+	if err != nil {
+		return v, err
+	}
+	return openStructWith(k, v)
+}
+
+func openStructWith[T any](k *Keyring, v T) (T, error) {
+	if k == nil {
+		return v, nil
+	}
+	return convertStruct(v, k.openJSON)
+}
+
+func convertStruct[T any](v T, fn func([]byte) ([]byte, error)) (T, error) {
+	var out T
+	doc, err := json.Marshal(v)
+	if err != nil {
+		return out, err
+	}
+	doc, err = fn(doc)
+	if err != nil {
+		return out, err
+	}
+	if err := json.Unmarshal(doc, &out); err != nil {
+		return out, err
+	}
+	return out, nil
+}
+
+// SaveProviders saves stp.U_Provider rows, sealing their secret fields first.
+// Once `secrets rotate` has run, P_SaveProvider refuses secrets that are not
+// sealed, so providers are saved through here rather than db.SaveProvider.
+func SaveProviders(ctx context.Context, q *db.Queries, providers []db.SaveProviderInput) ([]db.DbProvider, error) {
+	sealed := make([]db.SaveProviderInput, len(providers))
+	for i, p := range providers {
+		s, err := sealStruct(p)
+		if err != nil {
+			return nil, errors.Annotatef(err, "failed to encrypt secrets of provider %s", p.ProviderName)
+		}
+		sealed[i] = s
+	}
+	return db.SaveProvider(ctx, q, sealed)
+}
+
+// OpenProviderSettings decrypts the sealed values in a stp.U_Provider
+// AuthConfig or TokenConfig document
+func OpenProviderSettings(doc []byte) ([]byte, error) {
+	if !bytes.Contains(doc, []byte(sealedPrefix)) {
+		return doc, nil
+	}
+	k, err := DefaultKeyring()
+	if err != nil {
+		return nil, err
+	}
+	out, err := k.openJSON(doc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt provider settings: %w", err)
+	}
+	return out, nil
+}
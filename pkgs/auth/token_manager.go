@@ -0,0 +1,382 @@
+package auth
+
+import (
+	"context"
+	"log"
+	"sadbhavana/tree-project/pkgs/cache"
+	"sadbhavana/tree-project/pkgs/conf"
+	"sadbhavana/tree-project/pkgs/db"
+	"sadbhavana/tree-project/pkgs/locker"
+	"sadbhavana/tree-project/pkgs/providers"
+	"sync"
+	"time"
+
+	"github.com/juju/errors"
+	"golang.org/x/oauth2"
+)
+
+const (
+	tokenLockKey   = "auth_token_lock:"
+	sharedTokenKey = "auth_token:"
+	// Tokens with less than this left are refreshed before being handed out
+	tokenExpiryDelta = time.Minute
+	// tokenLockWait bounds the wait for another instance's refresh
+	tokenLockWait = 30 * time.Second
+	tokenLockPoll = 250 * time.Millisecond
+)
+
+// TokenStore keeps each provider's auth and its latest token
+type TokenStore interface {
+	GetAuth(ctx context.Context, provider providers.ProviderType) (db.AuthData, error)
+	SaveToken(ctx context.Context, provider providers.ProviderType, token oauth2.Token) error
+}
+
+// dbTokenStore keeps auth in core.Authentication, sealed with the default
+// keyring
+type dbTokenStore struct{}
+
+func (dbTokenStore) GetAuth(ctx context.Context, provider providers.ProviderType) (db.AuthData, error) {
+	q, err := db.NewQueries(ctx)
+	if err != nil {
+		return db.AuthData{}, errors.Annotatef(err, "failed to get database queries")
+	}
+	authData, err := db.GetAuthForProvider(ctx, q, string(provider))
+	if err != nil {
+		return authData, errors.Annotatef(err, "failed to get auth for provider %s", provider)
+	}
+	authData, err = openStruct(authData)
+	if err != nil {
+		return authData, errors.Annotatef(err, "failed to decrypt auth for provider %s", provider)
+	}
+	return authData, nil
+}
+
+func (dbTokenStore) SaveToken(ctx context.Context, provider providers.ProviderType, token oauth2.Token) error {
+	q, err := db.NewQueries(ctx)
+	if err != nil {
+		return errors.Annotatef(err, "failed to get database queries")
+	}
+	params, err := sealStruct(db.UpdateAuthTokenParams{
+		ProviderName: string(provider),
+		NewToken:     token,
+	})
+	if err != nil {
+		return errors.Annotatef(err, "failed to encrypt token for provider %s", provider)
+	}
+	if err := db.UpdateTokenForProvider(ctx, q, params); err != nil {
+		return errors.Annotatef(err, "failed to update token for provider %s", provider)
+	}
+	return nil
+}
+
+// TokenManager hands out each provider's access token, refreshing it when it
+// is about to expire. Tokens are cached in memory and, sealed, in a cache
+// shared with the other instances, so a token one instance refreshes is used
+// by all of them. A Redis lock makes sure only one instance refreshes a
+// provider's token at a time.
+type TokenManager struct {
+	store   TokenStore
+	shared  cache.Cache[oauth2.Token]
+	locker  *locker.RedisLocker
+	keyring *Keyring
+	// RefreshBefore is how long before it expires Run refreshes a token
+	RefreshBefore time.Duration
+
+	newClient func(*db.AuthConfig) (OAuth2, error)
+
+	mu         sync.Mutex
+	tokens     map[providers.ProviderType]*oauth2.Token
+	refreshing map[providers.ProviderType]*sync.Mutex
+}
+
+// NewTokenManager builds a token manager. Without a shared cache or locker,
+// tokens are only cached and refreshed within this process.
+func NewTokenManager(store TokenStore, shared cache.Cache[oauth2.Token], lck *locker.RedisLocker, keyring *Keyring, refreshBefore time.Duration) *TokenManager {
+	return &TokenManager{
+		store:         store,
+		shared:        shared,
+		locker:        lck,
+		keyring:       keyring,
+		RefreshBefore: refreshBefore,
+		newClient:     GetOAuth2Client,
+		tokens:        map[providers.ProviderType]*oauth2.Token{},
+		refreshing:    map[providers.ProviderType]*sync.Mutex{},
+	}
+}
+
+var (
+	defaultTokensOnce sync.Once
+	defaultTokens     *TokenManager
+	defaultTokensErr  error
+)
+
+// DefaultTokenManager is the token manager for the loaded config, backed by
+// core.Authentication and Redis
+func DefaultTokenManager() (*TokenManager, error) {
+	defaultTokensOnce.Do(func() {
+		keyring, err := DefaultKeyring()
+		if err != nil {
+			defaultTokensErr = err
+			return
+		}
+		shared, err := cache.NewRedisFromEnv[oauth2.Token]()
+		if err != nil {
+			defaultTokensErr = errors.Annotatef(err, "failed to connect to redis for tokens")
+			return
+		}
+		lck := locker.NewRedisLocker(context.Background(), tokenLockKey)
+		defaultTokens = NewTokenManager(dbTokenStore{}, shared, lck, keyring, conf.GetConfig().OAuth.TokenRefreshBefore)
+	})
+	return defaultTokens, defaultTokensErr
+}
+
+// freshToken reports whether a token has more than margin left
+func freshToken(t *oauth2.Token, margin time.Duration) bool {
+	if t == nil || t.AccessToken == "" {
+		return false
+	}
+	return t.Expiry.IsZero() || time.Until(t.Expiry) > margin
+}
+
+func (m *TokenManager) cached(provider providers.ProviderType) *oauth2.Token {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.tokens[provider]
+}
+
+func (m *TokenManager) providerLock(provider providers.ProviderType) *sync.Mutex {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	l, ok := m.refreshing[provider]
+	if !ok {
+		l = &sync.Mutex{}
+		m.refreshing[provider] = l
+	}
+	return l
+}
+
+// loadShared gets the token another instance shared, if any. The shared cache
+// is only a shortcut, so failures to read it are logged and skipped.
+func (m *TokenManager) loadShared(ctx context.Context, provider providers.ProviderType) *oauth2.Token {
+	if m.shared == nil {
+		return nil
+	}
+	sealed, err := m.shared.Get(ctx, sharedTokenKey+string(provider))
+	if err != nil || sealed == nil {
+		if err != nil {
+			log.Printf("Failed to read shared token for provider %s: %v", provider, err)
+		}
+		return nil
+	}
+	token, err := openStructWith(m.keyring, *sealed)
+	if err != nil {
+		log.Printf("Failed to decrypt shared token for provider %s: %v", provider, err)
+		return nil
+	}
+	return &token
+}
+
+// keep caches a token in memory and shares it until it expires. The refresh
+// token is left out of the shared copy; refreshing reads it from the store.
+func (m *TokenManager) keep(ctx context.Context, provider providers.ProviderType, token *oauth2.Token) {
+	m.mu.Lock()
+	m.tokens[provider] = token
+	m.mu.Unlock()
+
+	if m.shared == nil {
+		return
+	}
+	ttl := cache.DefaultDuration
+	if !token.Expiry.IsZero() {
+		ttl = time.Until(token.Expiry)
+	}
+	if ttl <= 0 {
+		return
+	}
+	shared := *token
+	shared.RefreshToken = ""
+	sealed, err := sealStructWith(m.keyring, shared)
+	if err == nil {
+		err = m.shared.Set(ctx, sharedTokenKey+string(provider), sealed, &ttl)
+	}
+	if err != nil {
+		log.Printf("Failed to share token for provider %s: %v", provider, err)
+	}
+}
+
+// lookup finds a token with more than margin left in the shared cache or the
+// store. When there is none it returns the stored auth to refresh with.
+func (m *TokenManager) lookup(ctx context.Context, provider providers.ProviderType, margin time.Duration) (*oauth2.Token, db.AuthData, error) {
+	if token := m.loadShared(ctx, provider); freshToken(token, margin) {
+		return token, db.AuthData{}, nil
+	}
+	authData, err := m.store.GetAuth(ctx, provider)
+	if err != nil {
+		return nil, authData, err
+	}
+	if freshToken(authData.ActiveToken, margin) {
+		return authData.ActiveToken, authData, nil
+	}
+	return nil, authData, nil
+}
+
+// lockProvider takes the lock on refreshing a provider's token across
+// instances, waiting while another instance holds it
+func (m *TokenManager) lockProvider(ctx context.Context, provider providers.ProviderType) (func(), error) {
+	if m.locker == nil {
+		return func() {}, nil
+	}
+	deadline := time.Now().Add(tokenLockWait)
+	for {
+		lock, err := m.locker.Obtain(ctx, string(provider), nil)
+		if err != nil {
+			return nil, errors.Annotatef(err, "failed to obtain redis lock")
+		}
+		if lock != nil {
+			return func() { lock.Release(context.WithoutCancel(ctx)) }, nil
+		}
+		if time.Now().After(deadline) {
+			return nil, errors.Errorf("timed out waiting for another instance to refresh the token for provider %s", provider)
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(tokenLockPoll):
+		}
+	}
+}
+
+// token returns a token with more than margin left, refreshing it if needed
+func (m *TokenManager) token(ctx context.Context, provider providers.ProviderType, margin time.Duration) (*oauth2.Token, error) {
+	if token := m.cached(provider); freshToken(token, margin) {
+		return token, nil
+	}
+
+	// Callers in this process wait for a single refresh
+	pl := m.providerLock(provider)
+	pl.Lock()
+	defer pl.Unlock()
+	if token := m.cached(provider); freshToken(token, margin) {
+		return token, nil
+	}
+
+	token, _, err := m.lookup(ctx, provider, margin)
+	if err != nil {
+		return nil, err
+	}
+	if token != nil {
+		m.keep(ctx, provider, token)
+		return token, nil
+	}
+
+	unlock, err := m.lockProvider(ctx, provider)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	// Another instance may have refreshed the token while we waited
+	token, authData, err := m.lookup(ctx, provider, margin)
+	if err != nil {
+		return nil, err
+	}
+	if token != nil {
+		m.keep(ctx, provider, token)
+		return token, nil
+	}
+
+	oauth2Client, err := m.newClient(authData.AuthConfig)
+	if err != nil {
+		return nil, errors.Annotatef(err, "failed to get OAuth2 client")
+	}
+	refreshToken := ""
+	if authData.ActiveToken != nil {
+		refreshToken = authData.ActiveToken.RefreshToken
+	}
+	newToken, err := oauth2Client.RefreshToken(ctx, refreshToken)
+	if err != nil {
+		return nil, errors.Annotatef(err, "failed to refresh token")
+	}
+	if newToken == nil {
+		return nil, errors.New("refreshed token is nil")
+	}
+	if err := m.store.SaveToken(ctx, provider, *newToken); err != nil {
+		return nil, err
+	}
+
+	m.keep(ctx, provider, newToken)
+	return newToken, nil
+}
+
+// Token returns the provider's access token, refreshing it if it is about to
+// expire
+func (m *TokenManager) Token(ctx context.Context, provider providers.ProviderType) (oauth2.Token, error) {
+	token, err := m.token(ctx, provider, tokenExpiryDelta)
+	if err != nil {
+		return oauth2.Token{}, err
+	}
+	return *token, nil
+}
+
+// Put replaces the provider's token everywhere it is cached, as when the
+// account is reconnected. The token must already be saved to the store.
+func (m *TokenManager) Put(ctx context.Context, provider providers.ProviderType, token *oauth2.Token) {
+	pl := m.providerLock(provider)
+	pl.Lock()
+	defer pl.Unlock()
+	m.keep(ctx, provider, token)
+}
+
+// RefreshDue refreshes the tokens this process has used that expire within
+// RefreshBefore
+func (m *TokenManager) RefreshDue(ctx context.Context) {
+	m.mu.Lock()
+	var due []providers.ProviderType
+	for provider, token := range m.tokens {
+		if !freshToken(token, m.RefreshBefore) {
+			due = append(due, provider)
+		}
+	}
+	m.mu.Unlock()
+
+	for _, provider := range due {
+		if _, err := m.token(ctx, provider, m.RefreshBefore); err != nil {
+			log.Printf("Failed to refresh token for provider %s: %v", provider, err)
+		}
+	}
+}
+
+// Run refreshes tokens ahead of their expiry every interval until ctx is
+// done, so callers rarely wait on a refresh
+func (m *TokenManager) Run(ctx context.Context, interval time.Duration) {
+	for {
+		m.RefreshDue(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// managedTokenSource adapts a TokenManager to oauth2.TokenSource
+type managedTokenSource struct {
+	ctx      context.Context
+	manager  *TokenManager
+	provider providers.ProviderType
+}
+
+func (s managedTokenSource) Token() (*oauth2.Token, error) {
+	token, err := s.manager.Token(s.ctx, s.provider)
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// TokenSource is the provider's token as an oauth2.TokenSource, for use with
+// oauth2.NewClient. Each request gets the manager's current token.
+func (m *TokenManager) TokenSource(ctx context.Context, provider providers.ProviderType) oauth2.TokenSource {
+	return managedTokenSource{ctx: ctx, manager: m, provider: provider}
+}
@@ -0,0 +1,205 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"sadbhavana/tree-project/pkgs/db"
+	"sadbhavana/tree-project/pkgs/providers"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+)
+
+// memoryTokens stands in for the Redis token cache shared between instances
+type memoryTokens struct {
+	mu     sync.Mutex
+	tokens map[string]oauth2.Token
+}
+
+func newMemoryTokens() *memoryTokens {
+	return &memoryTokens{tokens: map[string]oauth2.Token{}}
+}
+
+func (m *memoryTokens) Set(ctx context.Context, key string, val oauth2.Token, duration *time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.tokens[key] = val
+	return nil
+}
+
+func (m *memoryTokens) Get(ctx context.Context, key string) (*oauth2.Token, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	val, ok := m.tokens[key]
+	if !ok {
+		return nil, nil
+	}
+	return &val, nil
+}
+
+func (m *memoryTokens) Take(ctx context.Context, key string) (*oauth2.Token, error) {
+	val, err := m.Get(ctx, key)
+	m.mu.Lock()
+	delete(m.tokens, key)
+	m.mu.Unlock()
+	return val, err
+}
+
+func (m *memoryTokens) Close() error { return nil }
+
+// memoryTokenStore stands in for core.Authentication
+type memoryTokenStore struct {
+	mu    sync.Mutex
+	token *oauth2.Token
+	saves int
+}
+
+func (s *memoryTokenStore) GetAuth(ctx context.Context, provider providers.ProviderType) (db.AuthData, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var token *oauth2.Token
+	if s.token != nil {
+		t := *s.token
+		token = &t
+	}
+	return db.AuthData{
+		ProviderName: string(provider),
+		AuthConfig:   &db.AuthConfig{AuthType: db.AuthTypeUserOAuth2},
+		ActiveToken:  token,
+	}, nil
+}
+
+func (s *memoryTokenStore) SaveToken(ctx context.Context, provider providers.ProviderType, token oauth2.Token) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.token = &token
+	s.saves++
+	return nil
+}
+
+// countingRefresher issues numbered access tokens valid for an hour
+type countingRefresher struct {
+	calls atomic.Int32
+}
+
+func (c *countingRefresher) RefreshToken(ctx context.Context, refreshToken string) (*oauth2.Token, error) {
+	n := c.calls.Add(1)
+	// Give concurrent callers a chance to pile up behind the refresh
+	time.Sleep(10 * time.Millisecond)
+	return &oauth2.Token{
+		AccessToken:  fmt.Sprintf("access-%d", n),
+		RefreshToken: refreshToken,
+		Expiry:       time.Now().Add(time.Hour),
+	}, nil
+}
+
+func newTestTokenManager(t *testing.T, store TokenStore, shared *memoryTokens, refresher OAuth2) *TokenManager {
+	keyring, err := NewKeyring(newTestKey(t), nil)
+	require.NoError(t, err)
+	m := NewTokenManager(store, shared, nil, keyring, 5*time.Minute)
+	m.newClient = func(*db.AuthConfig) (OAuth2, error) { return refresher, nil }
+	return m
+}
+
+func TestTokenManager_RefreshesExpiredToken(t *testing.T) {
+	ctx := context.Background()
+	store := &memoryTokenStore{token: &oauth2.Token{AccessToken: "old", RefreshToken: "rt", Expiry: time.Now().Add(-time.Minute)}}
+	shared := newMemoryTokens()
+	refresher := &countingRefresher{}
+	m := newTestTokenManager(t, store, shared, refresher)
+
+	// Concurrent callers share a single refresh
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			token, err := m.Token(ctx, providers.GOOGLE_PROVIDER)
+			assert.NoError(t, err)
+			assert.Equal(t, "access-1", token.AccessToken)
+		}()
+	}
+	wg.Wait()
+	assert.EqualValues(t, 1, refresher.calls.Load())
+	assert.Equal(t, 1, store.saves)
+	assert.Equal(t, "rt", store.token.RefreshToken)
+
+	// The shared copy is sealed and has no refresh token
+	sealed := shared.tokens[sharedTokenKey+string(providers.GOOGLE_PROVIDER)]
+	assert.True(t, IsSealed(sealed.AccessToken))
+	assert.Empty(t, sealed.RefreshToken)
+}
+
+func TestTokenManager_UsesSharedToken(t *testing.T) {
+	ctx := context.Background()
+	store := &memoryTokenStore{token: &oauth2.Token{AccessToken: "old", RefreshToken: "rt", Expiry: time.Now().Add(-time.Minute)}}
+	shared := newMemoryTokens()
+	keyring, err := NewKeyring(newTestKey(t), nil)
+	require.NoError(t, err)
+
+	// Two instances share the cache and the master key
+	first := NewTokenManager(store, shared, nil, keyring, 5*time.Minute)
+	firstRefresher := &countingRefresher{}
+	first.newClient = func(*db.AuthConfig) (OAuth2, error) { return firstRefresher, nil }
+	second := NewTokenManager(store, shared, nil, keyring, 5*time.Minute)
+	secondRefresher := &countingRefresher{}
+	second.newClient = func(*db.AuthConfig) (OAuth2, error) { return secondRefresher, nil }
+
+	token, err := first.Token(ctx, providers.GOOGLE_PROVIDER)
+	require.NoError(t, err)
+	assert.Equal(t, "access-1", token.AccessToken)
+
+	// The store still has the stale token; the second instance finds the
+	// refreshed one in the shared cache
+	store.token = &oauth2.Token{AccessToken: "old", RefreshToken: "rt", Expiry: time.Now().Add(-time.Minute)}
+	token, err = second.Token(ctx, providers.GOOGLE_PROVIDER)
+	require.NoError(t, err)
+	assert.Equal(t, "access-1", token.AccessToken)
+	assert.EqualValues(t, 0, secondRefresher.calls.Load())
+}
+
+func TestTokenManager_RefreshDue(t *testing.T) {
+	ctx := context.Background()
+	store := &memoryTokenStore{token: &oauth2.Token{AccessToken: "current", RefreshToken: "rt", Expiry: time.Now().Add(3 * time.Minute)}}
+	refresher := &countingRefresher{}
+	m := newTestTokenManager(t, store, newMemoryTokens(), refresher)
+
+	// A token with a few minutes left is still handed out as is
+	token, err := m.Token(ctx, providers.GOOGLE_PROVIDER)
+	require.NoError(t, err)
+	assert.Equal(t, "current", token.AccessToken)
+	assert.EqualValues(t, 0, refresher.calls.Load())
+
+	// but is refreshed ahead of its expiry in the background
+	m.RefreshDue(ctx)
+	assert.EqualValues(t, 1, refresher.calls.Load())
+	token, err = m.Token(ctx, providers.GOOGLE_PROVIDER)
+	require.NoError(t, err)
+	assert.Equal(t, "access-1", token.AccessToken)
+
+	// Tokens with time left are not refreshed again
+	m.RefreshDue(ctx)
+	assert.EqualValues(t, 1, refresher.calls.Load())
+}
+
+func TestTokenManager_TokenSource(t *testing.T) {
+	ctx := context.Background()
+	store := &memoryTokenStore{token: &oauth2.Token{AccessToken: "current", Expiry: time.Now().Add(time.Hour)}}
+	m := newTestTokenManager(t, store, newMemoryTokens(), &countingRefresher{})
+
+	src := m.TokenSource(ctx, providers.GOOGLE_PROVIDER)
+	token, err := src.Token()
+	require.NoError(t, err)
+	assert.Equal(t, "current", token.AccessToken)
+
+	// Put replaces the cached token, as when the account is reconnected
+	m.Put(ctx, providers.GOOGLE_PROVIDER, &oauth2.Token{AccessToken: "reconnected", Expiry: time.Now().Add(time.Hour)})
+	token, err = src.Token()
+	require.NoError(t, err)
+	assert.Equal(t, "reconnected", token.AccessToken)
+}
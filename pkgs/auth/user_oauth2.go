@@ -0,0 +1,72 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"sadbhavana/tree-project/pkgs/db"
+	"sadbhavana/tree-project/pkgs/providers"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+func NewUserOAuth2Authorizer(config *db.OAuth2Config) (UserOAuth2, error) {
+	if config == nil {
+		return nil, errors.New("oauth2 config is nil")
+	}
+	switch providers.ProviderType(config.ProviderType) {
+	case providers.GOOGLE_PROVIDER:
+		return &UserOAuth2Impl{
+			Config: &oauth2.Config{
+				ClientID:     config.ClientId,
+				ClientSecret: config.ClientSecret,
+				RedirectURL:  config.RedirectUri,
+				Scopes:       config.Scopes,
+				Endpoint:     google.Endpoint,
+			},
+		}, nil
+	}
+	return nil, errors.New("unsupported provider type for user oauth2: " + config.ProviderType)
+}
+
+// UserOAuth2Impl acts for a user who signed in to the provider and granted
+// this app access
+type UserOAuth2Impl struct {
+	Config *oauth2.Config
+}
+
+// AuthCodeUrl is the provider's consent page. Offline access with a forced
+// consent prompt makes the provider issue a refresh token every time, so a
+// reconnected account keeps working after its first access token expires.
+func (u *UserOAuth2Impl) AuthCodeUrl(state string) (string, error) {
+	if state == "" {
+		return "", errors.New("state is empty")
+	}
+	return u.Config.AuthCodeURL(state, oauth2.AccessTypeOffline, oauth2.ApprovalForce), nil
+}
+
+func (u *UserOAuth2Impl) ExchangeCode(ctx context.Context, code string) (*oauth2.Token, error) {
+	token, err := u.Config.Exchange(ctx, code)
+	if err != nil {
+		return nil, err
+	}
+	if token.RefreshToken == "" {
+		return nil, errors.New("provider did not return a refresh token")
+	}
+	return token, nil
+}
+
+func (u *UserOAuth2Impl) RefreshToken(ctx context.Context, refreshToken string) (*oauth2.Token, error) {
+	if refreshToken == "" {
+		return nil, errors.New("no refresh token to refresh with")
+	}
+	token, err := u.Config.TokenSource(ctx, &oauth2.Token{RefreshToken: refreshToken}).Token()
+	if err != nil {
+		return nil, err
+	}
+	// Refresh responses usually leave the refresh token out; it stays valid
+	if token.RefreshToken == "" {
+		token.RefreshToken = refreshToken
+	}
+	return token, nil
+}
@@ -0,0 +1,131 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sadbhavana/tree-project/pkgs/conf"
+	"sadbhavana/tree-project/pkgs/providers"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/oauth2"
+)
+
+// memoryStates stands in for Redis
+type memoryStates map[string]AuthCodeState
+
+func (m memoryStates) Set(ctx context.Context, key string, val AuthCodeState, duration *time.Duration) error {
+	m[key] = val
+	return nil
+}
+
+func (m memoryStates) Get(ctx context.Context, key string) (*AuthCodeState, error) {
+	val, ok := m[key]
+	if !ok {
+		return nil, nil
+	}
+	return &val, nil
+}
+
+func (m memoryStates) Take(ctx context.Context, key string) (*AuthCodeState, error) {
+	val, err := m.Get(ctx, key)
+	delete(m, key)
+	return val, err
+}
+
+func (m memoryStates) Close() error { return nil }
+
+var testOAuthConfig = conf.OAuthConfig{
+	RedirectBaseURL:    "https://trees.example.org/",
+	StateExpiry:        10 * time.Minute,
+	GoogleClientID:     "client-id",
+	GoogleClientSecret: "client-secret",
+	GoogleScopes:       []string{"https://www.googleapis.com/auth/drive.file"},
+}
+
+func TestStartAuthCodeFlow(t *testing.T) {
+	ctx := context.Background()
+	states := memoryStates{}
+
+	authURL, state, err := StartAuthCodeFlow(ctx, states, providers.GOOGLE_PROVIDER, testOAuthConfig)
+	if err != nil {
+		t.Fatalf("StartAuthCodeFlow failed: %v", err)
+	}
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatalf("invalid auth url %q: %v", authURL, err)
+	}
+	assert.Equal(t, "accounts.google.com", u.Host)
+	assert.Equal(t, state, u.Query().Get("state"))
+	assert.Equal(t, "client-id", u.Query().Get("client_id"))
+	assert.Equal(t, "https://trees.example.org/auth/google/callback", u.Query().Get("redirect_uri"))
+	assert.Equal(t, "offline", u.Query().Get("access_type"))
+	assert.Equal(t, "consent", u.Query().Get("prompt"))
+
+	// Each state is accepted once, and only for its provider
+	assert.ErrorIs(t, ConsumeState(ctx, states, providers.AWS_PROVIDER, state), ErrInvalidState)
+	_, state, _ = StartAuthCodeFlow(ctx, states, providers.GOOGLE_PROVIDER, testOAuthConfig)
+	assert.NoError(t, ConsumeState(ctx, states, providers.GOOGLE_PROVIDER, state))
+	assert.ErrorIs(t, ConsumeState(ctx, states, providers.GOOGLE_PROVIDER, state), ErrInvalidState)
+	assert.ErrorIs(t, ConsumeState(ctx, states, providers.GOOGLE_PROVIDER, ""), ErrInvalidState)
+}
+
+func TestStartAuthCodeFlow_NotConfigured(t *testing.T) {
+	cfg := testOAuthConfig
+	cfg.GoogleClientSecret = ""
+	_, _, err := StartAuthCodeFlow(context.Background(), memoryStates{}, providers.GOOGLE_PROVIDER, cfg)
+	assert.ErrorContains(t, err, "GOOGLE_OAUTH_CLIENT_SECRET")
+
+	_, _, err = StartAuthCodeFlow(context.Background(), memoryStates{}, providers.AWS_PROVIDER, testOAuthConfig)
+	assert.ErrorContains(t, err, "unsupported provider")
+}
+
+func TestUserOAuth2_ExchangeAndRefresh(t *testing.T) {
+	var grants []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		grants = append(grants, r.Form.Get("grant_type"))
+		w.Header().Set("Content-Type", "application/json")
+		switch r.Form.Get("grant_type") {
+		case "authorization_code":
+			json.NewEncoder(w).Encode(map[string]any{
+				"access_token": "access-1", "refresh_token": "refresh-1", "token_type": "Bearer", "expires_in": 3600,
+			})
+		case "refresh_token":
+			// Refreshes leave the refresh token out
+			json.NewEncoder(w).Encode(map[string]any{
+				"access_token": "access-2", "token_type": "Bearer", "expires_in": 3600,
+			})
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	u := &UserOAuth2Impl{Config: &oauth2.Config{
+		ClientID:     "client-id",
+		ClientSecret: "client-secret",
+		Endpoint:     oauth2.Endpoint{TokenURL: srv.URL, AuthStyle: oauth2.AuthStyleInParams},
+	}}
+	ctx := context.Background()
+
+	token, err := u.ExchangeCode(ctx, "code")
+	if err != nil {
+		t.Fatalf("ExchangeCode failed: %v", err)
+	}
+	assert.Equal(t, "access-1", token.AccessToken)
+	assert.Equal(t, "refresh-1", token.RefreshToken)
+
+	token, err = u.RefreshToken(ctx, token.RefreshToken)
+	if err != nil {
+		t.Fatalf("RefreshToken failed: %v", err)
+	}
+	assert.Equal(t, "access-2", token.AccessToken)
+	assert.Equal(t, "refresh-1", token.RefreshToken)
+	assert.Equal(t, []string{"authorization_code", "refresh_token"}, grants)
+
+	_, err = u.RefreshToken(ctx, "")
+	assert.Error(t, err)
+}
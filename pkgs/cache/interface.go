@@ -10,6 +10,8 @@ import (
 type Cache[T any] interface {
 	Set(ctx context.Context, key string, val T, duration *time.Duration) error
 	Get(ctx context.Context, key string) (*T, error)
+	// Take gets a value and deletes it, so only one caller ever sees it
+	Take(ctx context.Context, key string) (*T, error)
 	Close() error
 }
 
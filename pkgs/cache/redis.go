@@ -63,7 +63,11 @@ func (r RedisImpl[T]) Set(ctx context.Context, key string, val T, duration *time
 	}
 
 	// Store in Redis with expiration
-	return r.client.Set(ctx, key, data, DefaultDuration).Err()
+	expiration := DefaultDuration
+	if duration != nil {
+		expiration = *duration
+	}
+	return r.client.Set(ctx, key, data, expiration).Err()
 }
 
 // Get retrieves and deserializes a value from Redis
@@ -87,6 +91,24 @@ func (r RedisImpl[T]) Get(ctx context.Context, key string) (*T, error) {
 	return &val, nil
 }
 
+// Take retrieves a value and deletes it in one step
+func (r RedisImpl[T]) Take(ctx context.Context, key string) (*T, error) {
+	data, err := r.client.GetDel(ctx, key).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var val T
+	if err := json.Unmarshal([]byte(data), &val); err != nil {
+		return nil, err
+	}
+
+	return &val, nil
+}
+
 // Close closes the Redis connection
 func (r RedisImpl[T]) Close() error {
 	return r.client.Close()
@@ -7,8 +7,7 @@ import (
 	urfave "github.com/urfave/cli/v2"
 )
 
-// RunCLI starts the CLI application. Currently it provides a single
-// noop command for testing and placeholder usage.
+// RunCLI starts the CLI application.
 func RunCLI() {
 	app := &urfave.App{
 		Name:  "tree-project",
@@ -20,6 +19,10 @@ func RunCLI() {
 				Aliases:     []string{"int", "i"},
 				Subcommands: []*urfave.Command{},
 			},
+			donorUpdateCommand(),
+			filesCommand(),
+			llmCommand(),
+			secretsCommand(),
 		},
 	}
 
@@ -0,0 +1,71 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os/signal"
+	"syscall"
+
+	"sadbhavana/tree-project/pkgs/conf"
+	"sadbhavana/tree-project/pkgs/donorupdate"
+	"sadbhavana/tree-project/pkgs/locker"
+
+	urfave "github.com/urfave/cli/v2"
+)
+
+func donorUpdateCommand() *urfave.Command {
+	return &urfave.Command{
+		Name:  "donor-update",
+		Usage: "Send tree photo updates to donors",
+		Subcommands: []*urfave.Command{
+			{
+				Name:  "dispatch",
+				Usage: "Drain pending donor updates and send them",
+				Flags: []urfave.Flag{
+					&urfave.StringFlag{Name: "channel", Usage: "delivery channel: log, whatsapp or email (defaults to DONOR_UPDATE_CHANNEL)"},
+					&urfave.IntFlag{Name: "batch-size", Usage: "updates per batch (defaults to DONOR_UPDATE_BATCH_SIZE)"},
+					&urfave.BoolFlag{Name: "once", Usage: "dispatch a single batch and exit"},
+				},
+				Action: dispatchDonorUpdates,
+			},
+		},
+	}
+}
+
+func dispatchDonorUpdates(c *urfave.Context) error {
+	if err := conf.Load(); err != nil {
+		return err
+	}
+	cfg := conf.GetConfig()
+
+	channelName := cfg.DonorUpdate.Channel
+	if c.IsSet("channel") {
+		channelName = c.String("channel")
+	}
+	batchSize := cfg.DonorUpdate.BatchSize
+	if c.IsSet("batch-size") {
+		batchSize = c.Int("batch-size")
+	}
+
+	channel, err := donorupdate.NewChannel(channelName, cfg)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	dispatcher := donorupdate.NewDispatcher(channel, locker.NewRedisLocker(ctx, "donorupdate:"), batchSize, cfg.DonorUpdate.PhotoBaseURL, cfg.DonorUpdate.PhotoLinkExpiry)
+
+	if c.Bool("once") {
+		result, err := dispatcher.RunOnce(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Sent %d, failed %d\n", result.Sent, result.Failed)
+		return nil
+	}
+
+	dispatcher.Run(ctx, cfg.DonorUpdate.Interval)
+	return nil
+}
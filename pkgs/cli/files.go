@@ -0,0 +1,170 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"path"
+	"syscall"
+	"text/tabwriter"
+
+	"sadbhavana/tree-project/pkgs/conf"
+	"sadbhavana/tree-project/pkgs/db"
+	"sadbhavana/tree-project/pkgs/file"
+
+	urfave "github.com/urfave/cli/v2"
+)
+
+func filesCommand() *urfave.Command {
+	return &urfave.Command{
+		Name:  "files",
+		Usage: "Manage stored files",
+		Subcommands: []*urfave.Command{
+			{
+				Name:  "migrate",
+				Usage: "Copy files from one store to another, verifying each copy by SHA-256",
+				Flags: []urfave.Flag{
+					&urfave.StringFlag{Name: "from", Required: true, Usage: "store the files are in, e.g. local"},
+					&urfave.StringFlag{Name: "to", Required: true, Usage: "store to copy the files to, e.g. google or s3"},
+					&urfave.StringFlag{Name: "folder", Usage: "folder to save the copies in (defaults to each file's own folder)"},
+					&urfave.IntFlag{Name: "batch-size", Value: 50, Usage: "file rows to read at a time"},
+					&urfave.IntFlag{Name: "limit", Usage: "stop after this many files (0 for all)"},
+					&urfave.BoolFlag{Name: "delete-source", Usage: "delete each original once its copy is recorded"},
+					&urfave.BoolFlag{Name: "dry-run", Usage: "checksum the files that would be copied without copying them"},
+				},
+				Action: migrateFiles,
+			},
+			{
+				Name:  "verify",
+				Usage: "Re-hash stored files and report missing or corrupted ones",
+				Flags: []urfave.Flag{
+					&urfave.StringSliceFlag{Name: "store", Usage: "store to scan, repeatable (defaults to every registered store)"},
+					&urfave.IntFlag{Name: "batch-size", Value: 50, Usage: "file rows to read at a time"},
+					&urfave.IntFlag{Name: "limit", Usage: "stop after this many files per store (0 for all)"},
+					&urfave.BoolFlag{Name: "backfill", Usage: "record checksums of files stored before checksums were kept"},
+				},
+				Action: verifyFiles,
+			},
+			{
+				Name:  "derivatives",
+				Usage: "Make the missing thumbnail and web-size copies of tree photos",
+				Flags: []urfave.Flag{
+					&urfave.StringFlag{Name: "folder", Usage: "folder to save the copies in (defaults to the WhatsApp media folder's derived folder)"},
+					&urfave.IntFlag{Name: "batch-size", Value: 50, Usage: "file rows to read at a time"},
+					&urfave.IntFlag{Name: "limit", Usage: "stop after this many files (0 for all)"},
+				},
+				Action: backfillDerivatives,
+			},
+		},
+	}
+}
+
+func migrateFiles(c *urfave.Context) error {
+	if err := conf.Load(); err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	q, err := db.NewQueries(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get database queries: %w", err)
+	}
+
+	result, err := file.MigrateFiles(ctx, q, file.MigrateOptions{
+		From:         c.String("from"),
+		To:           c.String("to"),
+		Folder:       c.String("folder"),
+		BatchSize:    c.Int("batch-size"),
+		Limit:        c.Int("limit"),
+		DeleteSource: c.Bool("delete-source"),
+		DryRun:       c.Bool("dry-run"),
+	})
+	verb := "Copied"
+	if c.Bool("dry-run") {
+		verb = "Would copy"
+	}
+	fmt.Printf("%s %d files (%d bytes), failed %d, deleted %d originals\n", verb, result.Copied, result.Bytes, result.Failed, result.Deleted)
+	return err
+}
+
+func verifyFiles(c *urfave.Context) error {
+	if err := conf.Load(); err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	q, err := db.NewQueries(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get database queries: %w", err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "FILE\tSTORE\tNAME\tSTATUS\tDETAIL")
+	result, err := file.VerifyFiles(ctx, q, file.VerifyOptions{
+		Stores:    c.StringSlice("store"),
+		BatchSize: c.Int("batch-size"),
+		Limit:     c.Int("limit"),
+		Backfill:  c.Bool("backfill"),
+	}, func(r file.VerifyReport) {
+		detail := ""
+		switch {
+		case r.Err != nil:
+			detail = r.Err.Error()
+		case r.Status == file.VerifyCorrupted:
+			detail = fmt.Sprintf("sha256 %s, recorded %s", r.Actual, r.Expected)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", r.FileID, r.Store, r.FileName, r.Status, detail)
+	})
+	if ferr := w.Flush(); ferr != nil && err == nil {
+		err = ferr
+	}
+
+	fmt.Printf("\nChecked %d files: %d ok, %d missing, %d corrupted, %d unchecked (%d backfilled)\n",
+		result.Checked, result.OK, result.Missing, result.Corrupted, result.Unchecked, result.Backfilled)
+	if err != nil {
+		return err
+	}
+	if result.Missing > 0 || result.Corrupted > 0 {
+		return fmt.Errorf("found %d missing and %d corrupted files", result.Missing, result.Corrupted)
+	}
+	return nil
+}
+
+func backfillDerivatives(c *urfave.Context) error {
+	if err := conf.Load(); err != nil {
+		return err
+	}
+	cfg := conf.GetConfig()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	q, err := db.NewQueries(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get database queries: %w", err)
+	}
+
+	folder := c.String("folder")
+	if folder == "" {
+		folder = path.Join(cfg.WhatsappConfig.MediaFolder, "derived")
+	}
+	result, err := file.BackfillDerivatives(ctx, q, file.DerivativeOptions{
+		Folder:    folder,
+		BatchSize: c.Int("batch-size"),
+		Limit:     c.Int("limit"),
+		Image:     file.ImageOptionsFromConfig(cfg.Image),
+	})
+	fmt.Printf("Checked %d files: made %d copies, failed %d\n", result.Checked, result.Created, result.Failed)
+	if err != nil {
+		return err
+	}
+	if result.Failed > 0 {
+		return fmt.Errorf("failed to make copies of %d files", result.Failed)
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"sadbhavana/tree-project/pkgs/conf"
+	"sadbhavana/tree-project/pkgs/db"
+	"sadbhavana/tree-project/pkgs/llm"
+
+	urfave "github.com/urfave/cli/v2"
+)
+
+func llmCommand() *urfave.Command {
+	return &urfave.Command{
+		Name:  "llm",
+		Usage: "Inspect LLM usage",
+		Subcommands: []*urfave.Command{
+			{
+				Name:  "usage",
+				Usage: "Summarise token spend by day, action and model",
+				Flags: []urfave.Flag{
+					&urfave.IntFlag{Name: "days", Value: 7, Usage: "number of UTC days to include, counting today"},
+				},
+				Action: reportLlmUsage,
+			},
+		},
+	}
+}
+
+func reportLlmUsage(c *urfave.Context) error {
+	if err := conf.Load(); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	q, err := db.NewQueries(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get database queries: %w", err)
+	}
+
+	rows, err := q.GetLlmUsageReport(ctx, llm.UsageReportSince(c.Int("days")))
+	if err != nil {
+		return fmt.Errorf("failed to get LLM usage report: %w", err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "DAY\tACTION\tMODEL\tCALLS\tFAILED\tRETRIES\tPROMPT\tCOMPLETION\tTOTAL\tCOST (USD)\tAVG MS")
+	var totalTokens int64
+	var totalCost float64
+	for _, r := range rows {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\t%d\t%d\t%d\t%d\t%.4f\t%.0f\n",
+			r.UsageDay.Time.Format("2006-01-02"), r.Action, r.Model, r.CallCount, r.FailureCount, r.RetryCount,
+			r.PromptTokens, r.CompletionTokens, r.TotalTokens, r.CostUsd, r.AvgLatencyMs)
+		totalTokens += r.TotalTokens
+		totalCost += r.CostUsd
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Printf("\nTotal: %d tokens, $%.4f\n", totalTokens, totalCost)
+	return nil
+}
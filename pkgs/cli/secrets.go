@@ -0,0 +1,70 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os/signal"
+	"syscall"
+
+	"sadbhavana/tree-project/pkgs/auth"
+	"sadbhavana/tree-project/pkgs/conf"
+
+	urfave "github.com/urfave/cli/v2"
+)
+
+func secretsCommand() *urfave.Command {
+	return &urfave.Command{
+		Name:  "secrets",
+		Usage: "Manage the encryption of stored provider secrets",
+		Subcommands: []*urfave.Command{
+			{
+				Name:   "generate-key",
+				Usage:  "Print a new random master key for SECRETS_MASTER_KEY",
+				Action: generateMasterKey,
+			},
+			{
+				Name:  "rotate",
+				Usage: "Re-encrypt stored secrets with SECRETS_MASTER_KEY, sealing any still in plaintext",
+				Flags: []urfave.Flag{
+					&urfave.BoolFlag{Name: "dry-run", Usage: "count the rows that would be re-encrypted without changing them"},
+				},
+				Action: rotateSecrets,
+			},
+		},
+	}
+}
+
+func generateMasterKey(c *urfave.Context) error {
+	key, err := auth.GenerateMasterKey()
+	if err != nil {
+		return err
+	}
+	fmt.Println(key)
+	return nil
+}
+
+func rotateSecrets(c *urfave.Context) error {
+	if err := conf.Load(); err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	keyring, err := auth.KeyringFromConfig(conf.GetConfig().Secrets)
+	if err != nil {
+		return err
+	}
+
+	result, err := auth.RotateSecrets(ctx, keyring, c.Bool("dry-run"))
+	if err != nil {
+		return err
+	}
+	verb := "Re-encrypted"
+	if c.Bool("dry-run") {
+		verb = "Would re-encrypt"
+	}
+	fmt.Printf("%s %d of %d provider auth rows and %d of %d provider settings rows\n",
+		verb, result.AuthUpdated, result.AuthChecked, result.ProvidersUpdated, result.ProvidersChecked)
+	return nil
+}
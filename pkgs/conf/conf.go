@@ -7,6 +7,7 @@ import (
 	"path/filepath"
 	"sadbhavana/tree-project/pkgs/utils"
 	"strings"
+	"time"
 
 	"github.com/sethvargo/go-envconfig"
 )
@@ -15,9 +16,19 @@ type Config struct {
 	Version        int
 	BaseConfig     BaseConfig
 	GeminiConfig   GeminiConfig
+	OpenAIConfig   OpenAIConfig
+	LLMConfig      LLMConfig
 	PostgresConfig PostgresConfig
 	WhatsappConfig WhatsappConfig
 	RedisConfig    RedisConfig
+	EmailConfig    EmailConfig
+	DonorUpdate    DonorUpdateConfig
+	Image          ImageConfig
+	S3             S3Config
+	FileURL        FileURLConfig
+	OAuth          OAuthConfig
+	Secrets        SecretsConfig
+	Admin          AdminConfig
 }
 
 type BaseConfig struct {
@@ -37,14 +48,148 @@ type PostgresConfig struct {
 type WhatsappConfig struct {
 	AccessToken string `env:"WHATSAPP_ACCESS_TOKEN,required" validate:"required"`
 	VerifyToken string `env:"WHATSAPP_VERIFY_TOKEN,required" validate:"required"`
+	AppSecret   string `env:"WHATSAPP_APP_SECRET"`
+
+	// Graph API settings for media downloads and outbound messages
+	PhoneNumberID string `env:"WHATSAPP_PHONE_NUMBER_ID"`
+	GraphBaseURL  string `env:"WHATSAPP_GRAPH_BASE_URL,default=https://graph.facebook.com" validate:"url"`
+	GraphVersion  string `env:"WHATSAPP_GRAPH_VERSION,default=v18.0"`
+
+	// Ingestion worker settings for the webhook inbox
+	WorkerConcurrency int           `env:"WHATSAPP_WORKER_CONCURRENCY,default=2" validate:"min=1"`
+	MaxAttempts       int           `env:"WHATSAPP_MAX_ATTEMPTS,default=5" validate:"min=1"`
+	RetryBaseDelay    time.Duration `env:"WHATSAPP_RETRY_BASE_DELAY,default=30s"`
+	RetryMaxDelay     time.Duration `env:"WHATSAPP_RETRY_MAX_DELAY,default=1h"`
+	PollInterval      time.Duration `env:"WHATSAPP_POLL_INTERVAL,default=2s"`
+	LockTimeout       time.Duration `env:"WHATSAPP_LOCK_TIMEOUT,default=15m"`
+	LedgerRetention   time.Duration `env:"WHATSAPP_LEDGER_RETENTION,default=720h"`
+
+	// File store provider that received media is saved to, and the folder in it
+	MediaStore  string `env:"WHATSAPP_MEDIA_STORE,default=local"`
+	MediaFolder string `env:"WHATSAPP_MEDIA_FOLDER,default=whatsapp"`
 }
 
 type RedisConfig struct {
 	URL string `env:"REDIS_URL,required" validate:"required,url"`
 }
 
+type EmailConfig struct {
+	SMTPHost     string `env:"SMTP_HOST"`
+	SMTPPort     int    `env:"SMTP_PORT,default=587"`
+	SMTPUser     string `env:"SMTP_USER"`
+	SMTPPassword string `env:"SMTP_PASSWORD"`
+	FromAddress  string `env:"EMAIL_FROM_ADDRESS" validate:"omitempty,email"`
+}
+
+type DonorUpdateConfig struct {
+	Enabled   bool          `env:"DONOR_UPDATE_ENABLED,default=false"`
+	Channel   string        `env:"DONOR_UPDATE_CHANNEL,default=log" validate:"oneof=log whatsapp email"`
+	BatchSize int           `env:"DONOR_UPDATE_BATCH_SIZE,default=100" validate:"min=1,max=1000"`
+	Interval  time.Duration `env:"DONOR_UPDATE_INTERVAL,default=5m"`
+	// PhotoBaseURL is the site's public address, which links to locally
+	// stored photos are made below. Links are signed to last PhotoLinkExpiry,
+	// as donors open them well after they are sent; S3 allows at most 7 days.
+	PhotoBaseURL    string        `env:"DONOR_UPDATE_PHOTO_BASE_URL" validate:"omitempty,url"`
+	PhotoLinkExpiry time.Duration `env:"DONOR_UPDATE_PHOTO_LINK_EXPIRY,default=168h"`
+	// Donors have not messaged the business number, so WhatsApp only
+	// delivers an approved template to them: an image header with the tree
+	// photo and a body taking the donor name, tree ID and credit name
+	WhatsappTemplate         string `env:"DONOR_UPDATE_WHATSAPP_TEMPLATE,default=tree_photo_update"`
+	WhatsappTemplateLanguage string `env:"DONOR_UPDATE_WHATSAPP_TEMPLATE_LANGUAGE,default=en"`
+}
+
+// ImageConfig sizes the resized copies made of uploaded photos. Sizes are
+// the longest side in pixels.
+type ImageConfig struct {
+	ThumbnailSize int `env:"IMAGE_THUMBNAIL_SIZE,default=320" validate:"min=16"`
+	WebSize       int `env:"IMAGE_WEB_SIZE,default=1280" validate:"min=16"`
+	JPEGQuality   int `env:"IMAGE_JPEG_QUALITY,default=82" validate:"min=1,max=100"`
+	// HEICConverter converts HEIC photos to JPEG when run as
+	// "<command> <input> <output>", e.g. heif-convert from libheif
+	HEICConverter string `env:"IMAGE_HEIC_CONVERTER,default=heif-convert"`
+	// MaxPixels refuses to decode larger images, which would otherwise be
+	// held in memory whole; 50 million pixels is about 200MB decoded
+	MaxPixels int `env:"IMAGE_MAX_PIXELS,default=50000000" validate:"min=0"`
+	// DuplicateMaxDistance is how many of the 64 pHash bits may differ for
+	// two photos to be flagged as duplicates
+	DuplicateMaxDistance int `env:"IMAGE_DUPLICATE_MAX_DISTANCE,default=8" validate:"min=0,max=32"`
+}
+
+// FileURLConfig signs the links pages use for locally stored files. Without a
+// secret a random one is made at startup, so links stop working on restart.
+type FileURLConfig struct {
+	Secret string        `env:"FILE_URL_SECRET"`
+	Expiry time.Duration `env:"FILE_URL_EXPIRY,default=1h"`
+}
+
+// OAuthConfig is the OAuth2 client an admin connects their own provider
+// account with, such as a personal Google Drive. RedirectBaseURL is the
+// public address of this server; the provider sends the admin back to
+// <RedirectBaseURL>/auth/<provider>/callback, which must be registered with it.
+// Provider tokens are refreshed TokenRefreshBefore they expire, checked every
+// TokenRefreshInterval.
+type OAuthConfig struct {
+	RedirectBaseURL    string        `env:"OAUTH_REDIRECT_BASE_URL,default=http://localhost:8080" validate:"url"`
+	StateExpiry        time.Duration `env:"OAUTH_STATE_EXPIRY,default=10m"`
+	GoogleClientID     string        `env:"GOOGLE_OAUTH_CLIENT_ID"`
+	GoogleClientSecret string        `env:"GOOGLE_OAUTH_CLIENT_SECRET"`
+	GoogleScopes       []string      `env:"GOOGLE_OAUTH_SCOPES,default=https://www.googleapis.com/auth/drive.file"`
+
+	TokenRefreshBefore   time.Duration `env:"OAUTH_TOKEN_REFRESH_BEFORE,default=5m"`
+	TokenRefreshInterval time.Duration `env:"OAUTH_TOKEN_REFRESH_INTERVAL,default=1m"`
+}
+
+// AdminConfig lists who may sign in to the admin actions that are recorded
+// against a person, such as photo review decisions, as name:password pairs,
+// e.g. "asha:first-password,ravi:second-password". With none set those
+// actions are refused.
+type AdminConfig struct {
+	Users map[string]string `env:"ADMIN_USERS"`
+}
+
+// SecretsConfig holds the master key provider credentials are encrypted with
+// at rest: 32 random bytes, base64 encoded. To rotate it, move the old key to
+// SECRETS_PREVIOUS_MASTER_KEYS, set the new one and run `secrets rotate`.
+// Once it has run, provider settings saved with plaintext secrets are refused.
+type SecretsConfig struct {
+	MasterKey          string   `env:"SECRETS_MASTER_KEY"`
+	PreviousMasterKeys []string `env:"SECRETS_PREVIOUS_MASTER_KEYS"`
+}
+
+// S3Config points the s3 file store at AWS S3 or an S3-compatible server
+// such as MinIO. Leave the endpoint empty for AWS.
+type S3Config struct {
+	Endpoint        string        `env:"S3_ENDPOINT" validate:"omitempty,url"`
+	Region          string        `env:"S3_REGION,default=us-east-1"`
+	Bucket          string        `env:"S3_BUCKET"`
+	AccessKeyID     string        `env:"S3_ACCESS_KEY_ID"`
+	SecretAccessKey string        `env:"S3_SECRET_ACCESS_KEY"`
+	UsePathStyle    bool          `env:"S3_USE_PATH_STYLE,default=false"`
+	Prefix          string        `env:"S3_PREFIX"`
+	PresignExpiry   time.Duration `env:"S3_PRESIGN_EXPIRY,default=1h"`
+	PartSize        int64         `env:"S3_PART_SIZE,default=8388608" validate:"min=5242880"`
+}
+
 type GeminiConfig struct {
-	APIKey string `env:"GEMINI_API_KEY,required" validate:"required"`
+	APIKey string `env:"GEMINI_API_KEY"`
+}
+
+// OpenAIConfig configures any OpenAI-compatible chat completions server,
+// including local ones such as llama.cpp or Ollama
+type OpenAIConfig struct {
+	BaseURL string `env:"OPENAI_BASE_URL,default=https://api.openai.com/v1" validate:"url"`
+	APIKey  string `env:"OPENAI_API_KEY"`
+}
+
+// LLMConfig selects the provider and model used by the ingestion pipeline
+type LLMConfig struct {
+	Provider string `env:"LLM_PROVIDER,default=GEMINI" validate:"oneof=GEMINI OPENAI"`
+	Model    string `env:"LLM_MODEL,default=gemini-2.5-pro" validate:"required"`
+	// DailyTokenBudget caps tokens per UTC day across all calls; 0 disables it
+	DailyTokenBudget int64 `env:"LLM_DAILY_TOKEN_BUDGET,default=0" validate:"min=0"`
+	// Prices in USD per million tokens, used to cost each call in the ledger
+	PromptTokenPrice     float64 `env:"LLM_PROMPT_TOKEN_PRICE,default=0" validate:"min=0"`
+	CompletionTokenPrice float64 `env:"LLM_COMPLETION_TOKEN_PRICE,default=0" validate:"min=0"`
 }
 
 func (a *PostgresConfig) DBURI() string {
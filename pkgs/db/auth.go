@@ -16,7 +16,7 @@ const (
 )
 
 type AuthConfig struct {
-	AuthType                AuthType                 `json:"auth_type" validate:"required,oneof=basic oauth2 client_credentials"`
+	AuthType                AuthType                 `json:"auth_type" validate:"required,oneof=basic user_oauth2 client_credentials"`
 	BasicAuthConfig         *BasicAuthConfig         `json:"basic,omitempty"`
 	Oauth2Config            *OAuth2Config            `json:"oauth2,omitempty"`
 	ClientCredentialsConfig *ClientCredentialsConfig `json:"client_credentials,omitempty"`
@@ -66,10 +66,13 @@ type DbDonorUpdate struct {
 	PhotoTs                string         `json:"photo_ts"`
 	PhotoLocationLatitude  float64        `json:"photo_location_latitude"`
 	PhotoLocationLongitude float64        `json:"photo_location_longitude"`
+	FileStore              string         `json:"file_store"`
 	FileStoreId            string         `json:"file_store_id"`
 	FileName               string         `json:"file_name"`
 	FilePath               string         `json:"file_path"`
 	FileType               string         `json:"file_type"`
+	AttemptCnt             int            `json:"attempt_cnt,omitempty"`
+	LastError              string         `json:"last_error,omitempty"`
 	PropertyList           map[string]any `json:"property_list"`
 }
 
@@ -77,16 +80,43 @@ func GetDonorUpdate(ctx context.Context, q *Queries, input GetDonorUpdateInput)
 	return callDbApi[GetDonorUpdateInput, []DbDonorUpdate](ctx, q, "GetDonorUpdate", input)
 }
 
+func GetDonorUpdateRetry(ctx context.Context, q *Queries, input GetDonorUpdateInput) ([]DbDonorUpdate, error) {
+	return callDbApi[GetDonorUpdateInput, []DbDonorUpdate](ctx, q, "GetDonorUpdateRetry", input)
+}
+
 type PostDonorUpdateInput struct {
 	Idn        int    `json:"idn" validate:"required"`
 	SendStatus string `json:"send_status" validate:"required,oneof=sent failed"`
+	ErrorMsg   string `json:"error_msg,omitempty"`
 }
 
 type PostDonorUpdateResponse struct {
 	UpdatedCount     int  `json:"updated_count"`
+	RetryCount       int  `json:"retry_count"`
+	AbandonedCount   int  `json:"abandoned_count"`
 	NewHighWaterMark *int `json:"new_high_water_mark"`
 }
 
 func PostDonorUpdate(ctx context.Context, q *Queries, input []PostDonorUpdateInput) (PostDonorUpdateResponse, error) {
 	return callDbApi[[]PostDonorUpdateInput, PostDonorUpdateResponse](ctx, q, "PostDonorUpdate", input)
 }
+
+type GetDonorUpdateFailedInput struct {
+	Limit int `json:"limit,omitempty"`
+}
+
+type DbDonorUpdateFailed struct {
+	Idn         int    `json:"idn"`
+	TreeIdn     int    `json:"tree_idn"`
+	TreeId      string `json:"tree_id"`
+	DonorName   string `json:"donor_name"`
+	DonorEmail  string `json:"donor_email"`
+	DonorMobile string `json:"donor_mobile"`
+	UploadTs    string `json:"upload_ts"`
+	AttemptCnt  int    `json:"attempt_cnt"`
+	LastError   string `json:"last_error"`
+}
+
+func GetDonorUpdateFailed(ctx context.Context, q *Queries, input GetDonorUpdateFailedInput) ([]DbDonorUpdateFailed, error) {
+	return callDbApi[GetDonorUpdateFailedInput, []DbDonorUpdateFailed](ctx, q, "GetDonorUpdateFailed", input)
+}
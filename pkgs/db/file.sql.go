@@ -11,10 +11,30 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+const countStoreFilesWithChecksum = `-- name: CountStoreFilesWithChecksum :one
+SELECT COUNT(*) FROM core.file
+WHERE file_store = $1 AND sha256 = $2
+`
+
+type CountStoreFilesWithChecksumParams struct {
+	FileStore string      `json:"file_store"`
+	Sha256    pgtype.Text `json:"sha256"`
+}
+
+// Files in a store sharing content, and so a blob in content-addressed stores
+func (q *Queries) CountStoreFilesWithChecksum(ctx context.Context, arg CountStoreFilesWithChecksumParams) (int64, error) {
+	row := q.db.QueryRow(ctx, countStoreFilesWithChecksum, arg.FileStore, arg.Sha256)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
 const getLatestTreeUpdateFile = `-- name: GetLatestTreeUpdateFile :one
-SELECT tu.update_date, f.id, f.file_store, f.file_store_id, f.file_path, f.file_name, f.file_type, f.file_url, f.file_expiration
+SELECT tu.update_date, tu.photo_ts, tu.geofence_status, tu.distance_m, wf.file_url AS web_url, f.id, f.file_store, f.file_store_id, f.file_path, f.file_name, f.file_type, f.file_url, f.file_expiration, f.sha256, f.size_bytes
 FROM core.file AS f
     JOIN core.tree_update AS tu ON f.id = tu.file_id
+    LEFT JOIN core.file_derivative AS wd ON wd.source_file_id = f.id AND wd.variant = 'web'
+    LEFT JOIN core.file AS wf ON wf.id = wd.file_id
 WHERE tu.tree_id = $1
 ORDER BY tu.update_date DESC
 LIMIT 1
@@ -22,6 +42,10 @@ LIMIT 1
 
 type GetLatestTreeUpdateFileRow struct {
 	UpdateDate     pgtype.Timestamptz `json:"update_date"`
+	PhotoTs        pgtype.Timestamptz `json:"photo_ts"`
+	GeofenceStatus pgtype.Text        `json:"geofence_status"`
+	DistanceM      pgtype.Float8      `json:"distance_m"`
+	WebUrl         pgtype.Text        `json:"web_url"`
 	ID             string             `json:"id"`
 	FileStore      string             `json:"file_store"`
 	FileStoreID    pgtype.Text        `json:"file_store_id"`
@@ -30,6 +54,8 @@ type GetLatestTreeUpdateFileRow struct {
 	FileType       pgtype.Text        `json:"file_type"`
 	FileUrl        pgtype.Text        `json:"file_url"`
 	FileExpiration pgtype.Timestamptz `json:"file_expiration"`
+	Sha256         pgtype.Text        `json:"sha256"`
+	SizeBytes      pgtype.Int8        `json:"size_bytes"`
 }
 
 func (q *Queries) GetLatestTreeUpdateFile(ctx context.Context, treeID string) (GetLatestTreeUpdateFileRow, error) {
@@ -37,6 +63,10 @@ func (q *Queries) GetLatestTreeUpdateFile(ctx context.Context, treeID string) (G
 	var i GetLatestTreeUpdateFileRow
 	err := row.Scan(
 		&i.UpdateDate,
+		&i.PhotoTs,
+		&i.GeofenceStatus,
+		&i.DistanceM,
+		&i.WebUrl,
 		&i.ID,
 		&i.FileStore,
 		&i.FileStoreID,
@@ -45,10 +75,121 @@ func (q *Queries) GetLatestTreeUpdateFile(ctx context.Context, treeID string) (G
 		&i.FileType,
 		&i.FileUrl,
 		&i.FileExpiration,
+		&i.Sha256,
+		&i.SizeBytes,
 	)
 	return i, err
 }
 
+const listStoreFiles = `-- name: ListStoreFiles :many
+SELECT id, file_store, file_store_id, file_path, file_name, file_type, file_url, file_expiration, sha256, size_bytes FROM core.file
+WHERE file_store = $1 AND id > $2
+ORDER BY id
+LIMIT $3
+`
+
+type ListStoreFilesParams struct {
+	FileStore string `json:"file_store"`
+	AfterID   string `json:"after_id"`
+	RowLimit  int32  `json:"row_limit"`
+}
+
+// Page through the files kept in a store, in ID order
+func (q *Queries) ListStoreFiles(ctx context.Context, arg ListStoreFilesParams) ([]CoreFile, error) {
+	rows, err := q.db.Query(ctx, listStoreFiles, arg.FileStore, arg.AfterID, arg.RowLimit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []CoreFile{}
+	for rows.Next() {
+		var i CoreFile
+		if err := rows.Scan(
+			&i.ID,
+			&i.FileStore,
+			&i.FileStoreID,
+			&i.FilePath,
+			&i.FileName,
+			&i.FileType,
+			&i.FileUrl,
+			&i.FileExpiration,
+			&i.Sha256,
+			&i.SizeBytes,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const moveFile = `-- name: MoveFile :execrows
+UPDATE core.file
+SET file_store = $1,
+    file_store_id = $2,
+    file_path = $3,
+    file_name = $4,
+    file_url = $5,
+    file_expiration = $6,
+    sha256 = $7,
+    size_bytes = $8
+WHERE id = $9 AND file_store = $10
+`
+
+type MoveFileParams struct {
+	ToStore        string             `json:"to_store"`
+	FileStoreID    pgtype.Text        `json:"file_store_id"`
+	FilePath       pgtype.Text        `json:"file_path"`
+	FileName       pgtype.Text        `json:"file_name"`
+	FileUrl        pgtype.Text        `json:"file_url"`
+	FileExpiration pgtype.Timestamptz `json:"file_expiration"`
+	Sha256         pgtype.Text        `json:"sha256"`
+	SizeBytes      pgtype.Int8        `json:"size_bytes"`
+	ID             string             `json:"id"`
+	FromStore      string             `json:"from_store"`
+}
+
+// Point a file at its copy in another store, unless it has moved already
+func (q *Queries) MoveFile(ctx context.Context, arg MoveFileParams) (int64, error) {
+	result, err := q.db.Exec(ctx, moveFile,
+		arg.ToStore,
+		arg.FileStoreID,
+		arg.FilePath,
+		arg.FileName,
+		arg.FileUrl,
+		arg.FileExpiration,
+		arg.Sha256,
+		arg.SizeBytes,
+		arg.ID,
+		arg.FromStore,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const setFileChecksum = `-- name: SetFileChecksum :exec
+UPDATE core.file
+SET sha256 = $1, size_bytes = $2
+WHERE id = $3
+`
+
+type SetFileChecksumParams struct {
+	Sha256    pgtype.Text `json:"sha256"`
+	SizeBytes pgtype.Int8 `json:"size_bytes"`
+	ID        string      `json:"id"`
+}
+
+// Record the checksum of a file stored before checksums were kept
+func (q *Queries) SetFileChecksum(ctx context.Context, arg SetFileChecksumParams) error {
+	_, err := q.db.Exec(ctx, setFileChecksum, arg.Sha256, arg.SizeBytes, arg.ID)
+	return err
+}
+
 const upsertFile = `-- name: UpsertFile :one
 INSERT INTO core.file (
     file_store,
@@ -57,7 +198,9 @@ INSERT INTO core.file (
     file_name,
     file_url,
     file_type,
-    file_expiration
+    file_expiration,
+    sha256,
+    size_bytes
 )
 VALUES (
     $1,
@@ -66,7 +209,9 @@ VALUES (
     $4,
     $5,
     $6,
-    $7
+    $7,
+    $8,
+    $9
 )
 ON CONFLICT (file_store_id) DO UPDATE SET
     file_store = EXCLUDED.file_store,
@@ -74,7 +219,9 @@ ON CONFLICT (file_store_id) DO UPDATE SET
     file_name = EXCLUDED.file_name,
     file_url = EXCLUDED.file_url,
     file_type = EXCLUDED.file_type,
-    file_expiration = EXCLUDED.file_expiration
+    file_expiration = EXCLUDED.file_expiration,
+    sha256 = EXCLUDED.sha256,
+    size_bytes = EXCLUDED.size_bytes
 RETURNING 
     id,
     (xmax != 0) AS was_updated
@@ -88,6 +235,8 @@ type UpsertFileParams struct {
 	FileUrl        pgtype.Text        `json:"file_url"`
 	FileType       pgtype.Text        `json:"file_type"`
 	FileExpiration pgtype.Timestamptz `json:"file_expiration"`
+	Sha256         pgtype.Text        `json:"sha256"`
+	SizeBytes      pgtype.Int8        `json:"size_bytes"`
 }
 
 type UpsertFileRow struct {
@@ -104,6 +253,8 @@ func (q *Queries) UpsertFile(ctx context.Context, arg UpsertFileParams) (UpsertF
 		arg.FileUrl,
 		arg.FileType,
 		arg.FileExpiration,
+		arg.Sha256,
+		arg.SizeBytes,
 	)
 	var i UpsertFileRow
 	err := row.Scan(&i.ID, &i.WasUpdated)
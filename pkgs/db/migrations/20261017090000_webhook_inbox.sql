@@ -0,0 +1,30 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+
+-- Durable inbox for WhatsApp webhook deliveries. The webhook handler only
+-- persists the raw payload here; the ingestion workers claim rows and do the
+-- media download, tree-ID extraction and linking outside the HTTP request.
+CREATE TABLE IF NOT EXISTS core.webhook_inbox (
+    id CHAR(21) PRIMARY KEY DEFAULT core.generate_nanoid('WHI'),
+    payload JSONB NOT NULL,
+    status VARCHAR(16) NOT NULL DEFAULT 'pending',
+    attempts INT NOT NULL DEFAULT 0,
+    last_error TEXT,
+    received_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    locked_at TIMESTAMPTZ,
+    processed_at TIMESTAMPTZ,
+    CHECK (status IN ('pending', 'processing', 'done', 'dead'))
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_inbox_ready
+    ON core.webhook_inbox (status, next_attempt_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+DROP INDEX IF EXISTS core.idx_webhook_inbox_ready;
+DROP TABLE IF EXISTS core.webhook_inbox;
+-- +goose StatementEnd
@@ -0,0 +1,31 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+
+-- Ledger of WhatsApp messages that have already been ingested. Meta delivers
+-- webhooks at least once, so a message is claimed here before it is ingested
+-- and redeliveries conflict on the message ID (or the media hash) and are
+-- acknowledged without downloading or extracting again.
+CREATE TABLE IF NOT EXISTS core.whatsapp_message (
+    message_id VARCHAR(128) PRIMARY KEY,
+    media_sha256 VARCHAR(128),
+    sender VARCHAR(32) NOT NULL,
+    message_type VARCHAR(16) NOT NULL,
+    processed_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_whatsapp_message_media_sha256
+    ON core.whatsapp_message (media_sha256)
+    WHERE media_sha256 IS NOT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_whatsapp_message_processed_at
+    ON core.whatsapp_message (processed_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+DROP INDEX IF EXISTS core.idx_whatsapp_message_processed_at;
+DROP INDEX IF EXISTS core.idx_whatsapp_message_media_sha256;
+DROP TABLE IF EXISTS core.whatsapp_message;
+-- +goose StatementEnd
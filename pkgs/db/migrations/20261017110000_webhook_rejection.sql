@@ -0,0 +1,21 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+
+-- Webhook deliveries refused because the X-Hub-Signature-256 header was
+-- missing or did not match the app secret. Kept for auditing forged traffic.
+CREATE TABLE IF NOT EXISTS core.webhook_rejection (
+    id CHAR(21) PRIMARY KEY DEFAULT core.generate_nanoid('WHR'),
+    reason VARCHAR(64) NOT NULL,
+    signature TEXT,
+    remote_addr VARCHAR(128),
+    payload BYTEA,
+    received_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+DROP TABLE IF EXISTS core.webhook_rejection;
+-- +goose StatementEnd
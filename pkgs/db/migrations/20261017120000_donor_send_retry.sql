@@ -0,0 +1,27 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+
+---------------------------------------------------------
+-- U_DonorSendLog retry tracking
+---------------------------------------------------------
+-- Failed sends are retried with exponential backoff until the configured
+-- maximum number of attempts, after which they are marked 'abandoned'.
+ALTER TABLE stp.u_donorsendlog
+    ADD COLUMN IF NOT EXISTS attemptcnt    integer NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS nextattemptts timestamptz,
+    ADD COLUMN IF NOT EXISTS lasterror     text;
+
+CREATE INDEX IF NOT EXISTS xie1u_donorsendlog
+    ON stp.u_donorsendlog (sendstatus, nextattemptts);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+DROP INDEX IF EXISTS stp.xie1u_donorsendlog;
+ALTER TABLE stp.u_donorsendlog
+    DROP COLUMN IF EXISTS lasterror,
+    DROP COLUMN IF EXISTS nextattemptts,
+    DROP COLUMN IF EXISTS attemptcnt;
+-- +goose StatementEnd
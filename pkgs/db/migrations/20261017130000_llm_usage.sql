@@ -0,0 +1,32 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+
+-- One row per LLM call, successful or not. Used for the daily token budget
+-- and the spend report; cost is priced at call time from the configured rates.
+CREATE TABLE IF NOT EXISTS core.llm_usage (
+    id CHAR(21) PRIMARY KEY DEFAULT core.generate_nanoid('LLU'),
+    provider VARCHAR(32) NOT NULL,
+    model VARCHAR(64) NOT NULL,
+    action VARCHAR(64) NOT NULL,
+    attempt INT NOT NULL DEFAULT 1,
+    prompt_tokens INT NOT NULL DEFAULT 0,
+    completion_tokens INT NOT NULL DEFAULT 0,
+    total_tokens INT NOT NULL DEFAULT 0,
+    latency_ms INT NOT NULL DEFAULT 0,
+    success BOOLEAN NOT NULL,
+    error TEXT,
+    cost_usd DOUBLE PRECISION NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_llm_usage_created_at
+    ON core.llm_usage (created_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+DROP INDEX IF EXISTS core.idx_llm_usage_created_at;
+DROP TABLE IF EXISTS core.llm_usage;
+-- +goose StatementEnd
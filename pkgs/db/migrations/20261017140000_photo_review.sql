@@ -0,0 +1,43 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+
+-- Photos the WhatsApp pipeline could not link to a tree on its own. Each row
+-- keeps the model's readings and the resolver's matches so a reviewer can
+-- assign the photo to a tree, reject it, or re-run extraction. Re-running
+-- calls the model, so the review page only queues the request in the
+-- rerun_requested_* columns and the WhatsApp workers pick it up.
+CREATE TABLE IF NOT EXISTS core.photo_review (
+    id CHAR(21) PRIMARY KEY DEFAULT core.generate_nanoid('PRV'),
+    file_id CHAR(21) NOT NULL REFERENCES core.file(id),
+    message_id VARCHAR(128),
+    sender VARCHAR(32),
+    reason TEXT NOT NULL,
+    extracted JSONB NOT NULL DEFAULT '{}',
+    matches JSONB NOT NULL DEFAULT '[]',
+    status VARCHAR(16) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'assigned', 'rejected')),
+    tree_id CHAR(21) REFERENCES core.tree(id),
+    decided_by VARCHAR(255),
+    decided_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    rerun_requested_by VARCHAR(255),
+    rerun_requested_at TIMESTAMPTZ,
+    UNIQUE(file_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_photo_review_status_created_at
+    ON core.photo_review (status, created_at);
+
+CREATE INDEX IF NOT EXISTS idx_photo_review_rerun_requested_at
+    ON core.photo_review (rerun_requested_at)
+    WHERE rerun_requested_at IS NOT NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+DROP INDEX IF EXISTS core.idx_photo_review_rerun_requested_at;
+DROP INDEX IF EXISTS core.idx_photo_review_status_created_at;
+DROP TABLE IF EXISTS core.photo_review;
+-- +goose StatementEnd
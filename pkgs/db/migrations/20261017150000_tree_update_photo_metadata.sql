@@ -0,0 +1,21 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+
+-- Capture time, GPS position and raw EXIF/XMP tags read from the photo,
+-- mirroring PhotoTs, PhotoLocation and PropertyList on stp.U_TreePhoto.
+-- Location and time stay NULL for photos that carry no metadata.
+ALTER TABLE core.tree_update
+    ADD COLUMN IF NOT EXISTS photo_ts TIMESTAMPTZ,
+    ADD COLUMN IF NOT EXISTS photo_location GEOGRAPHY(Point, 4326),
+    ADD COLUMN IF NOT EXISTS property_list JSONB NOT NULL DEFAULT '{}';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+ALTER TABLE core.tree_update
+    DROP COLUMN IF EXISTS property_list,
+    DROP COLUMN IF EXISTS photo_location,
+    DROP COLUMN IF EXISTS photo_ts;
+-- +goose StatementEnd
@@ -0,0 +1,32 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+
+-- Result of comparing a photo's GPS position with its tree's location when
+-- the photo is linked: ok, far (outside the project's radius) or no_gps.
+ALTER TABLE core.tree_update
+    ADD COLUMN IF NOT EXISTS geofence_status VARCHAR(16) CHECK (geofence_status IN ('ok', 'far', 'no_gps')),
+    ADD COLUMN IF NOT EXISTS distance_m DOUBLE PRECISION,
+    ADD COLUMN IF NOT EXISTS geofence_radius_m DOUBLE PRECISION;
+
+CREATE INDEX IF NOT EXISTS idx_tree_update_geofence_status
+    ON core.tree_update (geofence_status, update_date)
+    WHERE geofence_status <> 'ok';
+
+-- Allowed distance in metres between a photo and its tree. project_radius_m
+-- overrides the default per project code, e.g. {"AB": 250}.
+INSERT INTO core.U_Config (ConfigName, ConfigValue, UserIdn, Ts)
+VALUES ('PhotoGeofence', '{"default_radius_m": 100, "project_radius_m": {}}'::jsonb, 1, now())
+ON CONFLICT (ConfigName) DO NOTHING;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+DELETE FROM core.U_Config WHERE ConfigName = 'PhotoGeofence';
+DROP INDEX IF EXISTS core.idx_tree_update_geofence_status;
+ALTER TABLE core.tree_update
+    DROP COLUMN IF EXISTS geofence_radius_m,
+    DROP COLUMN IF EXISTS distance_m,
+    DROP COLUMN IF EXISTS geofence_status;
+-- +goose StatementEnd
@@ -0,0 +1,25 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+
+-- Resized JPEG copies of an uploaded image. Each derivative is a core.file of
+-- its own; this table says which original it was made from and at what size.
+CREATE TABLE IF NOT EXISTS core.file_derivative (
+    source_file_id CHAR(21) NOT NULL REFERENCES core.file(id) ON DELETE CASCADE,
+    variant VARCHAR(16) NOT NULL CHECK (variant IN ('thumbnail', 'web')),
+    file_id CHAR(21) NOT NULL REFERENCES core.file(id) ON DELETE CASCADE,
+    width INTEGER NOT NULL,
+    height INTEGER NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (source_file_id, variant)
+);
+
+CREATE INDEX IF NOT EXISTS idx_file_derivative_file_id
+    ON core.file_derivative (file_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+DROP TABLE IF EXISTS core.file_derivative;
+-- +goose StatementEnd
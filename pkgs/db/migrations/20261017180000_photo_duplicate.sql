@@ -0,0 +1,36 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+
+-- Perceptual hashes of image files, stored as the signed form of the 64-bit
+-- hash. Near-identical images have hashes a few bits apart.
+CREATE TABLE IF NOT EXISTS core.file_hash (
+    file_id CHAR(21) PRIMARY KEY REFERENCES core.file(id) ON DELETE CASCADE,
+    dhash BIGINT NOT NULL,
+    phash BIGINT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Tree photos that look like a photo already linked to the same tree or to
+-- another tree, found when the photo was linked
+CREATE TABLE IF NOT EXISTS core.photo_duplicate (
+    file_id CHAR(21) NOT NULL REFERENCES core.file(id) ON DELETE CASCADE,
+    tree_id CHAR(21) NOT NULL REFERENCES core.tree(id),
+    duplicate_file_id CHAR(21) NOT NULL REFERENCES core.file(id) ON DELETE CASCADE,
+    duplicate_tree_id CHAR(21) NOT NULL REFERENCES core.tree(id),
+    phash_distance INTEGER NOT NULL,
+    dhash_distance INTEGER NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (file_id, duplicate_file_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_photo_duplicate_created_at
+    ON core.photo_duplicate (created_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+DROP TABLE IF EXISTS core.photo_duplicate;
+DROP TABLE IF EXISTS core.file_hash;
+-- +goose StatementEnd
@@ -0,0 +1,23 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+
+-- SHA-256 and size of each file's content, computed while it is uploaded.
+-- Files stored before this have neither until an integrity scan fills them in.
+ALTER TABLE core.file
+    ADD COLUMN IF NOT EXISTS sha256 CHAR(64),
+    ADD COLUMN IF NOT EXISTS size_bytes BIGINT;
+
+CREATE INDEX IF NOT EXISTS idx_file_sha256
+    ON core.file (file_store, sha256)
+    WHERE sha256 IS NOT NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+DROP INDEX IF EXISTS core.idx_file_sha256;
+ALTER TABLE core.file
+    DROP COLUMN IF EXISTS size_bytes,
+    DROP COLUMN IF EXISTS sha256;
+-- +goose StatementEnd
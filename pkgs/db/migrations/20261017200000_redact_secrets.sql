@@ -0,0 +1,72 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+
+-- Replaces the value of every secret field in a JSON document, at any depth,
+-- so run logs and DbApi responses never carry provider credentials. The field
+-- names match the ones the auth package encrypts.
+CREATE OR REPLACE FUNCTION core.F_RedactSecrets(p_Json JSONB)
+RETURNS JSONB
+LANGUAGE plpgsql IMMUTABLE AS
+$BODY$
+BEGIN
+    CASE jsonb_typeof(p_Json)
+    WHEN 'object' THEN
+        RETURN (
+            SELECT COALESCE(jsonb_object_agg(
+                e.key,
+                CASE
+                    WHEN lower(e.key) IN ('access_token', 'api_key', 'client_secret', 'password',
+                                          'private_key', 'refresh_token', 'secret_access_key', 'session_token')
+                         AND jsonb_typeof(e.value) <> 'null'
+                    THEN '"[REDACTED]"'::jsonb
+                    ELSE core.F_RedactSecrets(e.value)
+                END
+            ), '{}'::jsonb)
+            FROM jsonb_each(p_Json) AS e
+        );
+    WHEN 'array' THEN
+        RETURN (
+            SELECT COALESCE(jsonb_agg(core.F_RedactSecrets(a.value) ORDER BY a.idx), '[]'::jsonb)
+            FROM jsonb_array_elements(p_Json) WITH ORDINALITY AS a(value, idx)
+        );
+    ELSE
+        RETURN p_Json;
+    END CASE;
+END;
+$BODY$;
+
+-- Puts the stored value back wherever a document saved by a DbApi client still
+-- holds "[REDACTED]", so settings read through P_GetProvider can be edited and
+-- saved without wiping their secrets.
+CREATE OR REPLACE FUNCTION core.F_KeepRedactedSecrets(p_New JSONB, p_Old JSONB)
+RETURNS JSONB
+LANGUAGE plpgsql IMMUTABLE AS
+$BODY$
+BEGIN
+    IF p_New = '"[REDACTED]"'::jsonb THEN
+        RETURN p_Old;
+    END IF;
+    IF jsonb_typeof(p_New) IS DISTINCT FROM 'object' OR jsonb_typeof(p_Old) IS DISTINCT FROM 'object' THEN
+        RETURN p_New;
+    END IF;
+    RETURN (
+        SELECT COALESCE(jsonb_object_agg(e.key, core.F_KeepRedactedSecrets(e.value, p_Old->e.key)), '{}'::jsonb)
+        FROM jsonb_each(p_New) AS e
+    );
+END;
+$BODY$;
+
+UPDATE core.U_RunLog
+SET InputJson = core.F_RedactSecrets(InputJson),
+    OutputJson = core.F_RedactSecrets(OutputJson)
+WHERE InputJson IS DISTINCT FROM core.F_RedactSecrets(InputJson)
+   OR OutputJson IS DISTINCT FROM core.F_RedactSecrets(OutputJson);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+DROP FUNCTION IF EXISTS core.F_KeepRedactedSecrets(JSONB, JSONB);
+DROP FUNCTION IF EXISTS core.F_RedactSecrets(JSONB);
+-- +goose StatementEnd
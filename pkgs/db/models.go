@@ -23,6 +23,68 @@ type CoreFile struct {
 	FileType       pgtype.Text        `json:"file_type"`
 	FileUrl        pgtype.Text        `json:"file_url"`
 	FileExpiration pgtype.Timestamptz `json:"file_expiration"`
+	Sha256         pgtype.Text        `json:"sha256"`
+	SizeBytes      pgtype.Int8        `json:"size_bytes"`
+}
+
+type CoreFileDerivative struct {
+	SourceFileID string             `json:"source_file_id"`
+	Variant      string             `json:"variant"`
+	FileID       string             `json:"file_id"`
+	Width        int32              `json:"width"`
+	Height       int32              `json:"height"`
+	CreatedAt    pgtype.Timestamptz `json:"created_at"`
+}
+
+type CoreFileHash struct {
+	FileID    string             `json:"file_id"`
+	Dhash     int64              `json:"dhash"`
+	Phash     int64              `json:"phash"`
+	CreatedAt pgtype.Timestamptz `json:"created_at"`
+}
+
+type CoreLlmUsage struct {
+	ID               string             `json:"id"`
+	Provider         string             `json:"provider"`
+	Model            string             `json:"model"`
+	Action           string             `json:"action"`
+	Attempt          int32              `json:"attempt"`
+	PromptTokens     int32              `json:"prompt_tokens"`
+	CompletionTokens int32              `json:"completion_tokens"`
+	TotalTokens      int32              `json:"total_tokens"`
+	LatencyMs        int32              `json:"latency_ms"`
+	Success          bool               `json:"success"`
+	Error            pgtype.Text        `json:"error"`
+	CostUsd          float64            `json:"cost_usd"`
+	CreatedAt        pgtype.Timestamptz `json:"created_at"`
+}
+
+type CorePhotoDuplicate struct {
+	FileID          string             `json:"file_id"`
+	TreeID          string             `json:"tree_id"`
+	DuplicateFileID string             `json:"duplicate_file_id"`
+	DuplicateTreeID string             `json:"duplicate_tree_id"`
+	PhashDistance   int32              `json:"phash_distance"`
+	DhashDistance   int32              `json:"dhash_distance"`
+	CreatedAt       pgtype.Timestamptz `json:"created_at"`
+}
+
+type CorePhotoReview struct {
+	ID               string             `json:"id"`
+	FileID           string             `json:"file_id"`
+	MessageID        pgtype.Text        `json:"message_id"`
+	Sender           pgtype.Text        `json:"sender"`
+	Reason           string             `json:"reason"`
+	Extracted        []byte             `json:"extracted"`
+	Matches          []byte             `json:"matches"`
+	Status           string             `json:"status"`
+	TreeID           pgtype.Text        `json:"tree_id"`
+	DecidedBy        pgtype.Text        `json:"decided_by"`
+	DecidedAt        pgtype.Timestamptz `json:"decided_at"`
+	CreatedAt        pgtype.Timestamptz `json:"created_at"`
+	UpdatedAt        pgtype.Timestamptz `json:"updated_at"`
+	RerunRequestedBy pgtype.Text        `json:"rerun_requested_by"`
+	RerunRequestedAt pgtype.Timestamptz `json:"rerun_requested_at"`
 }
 
 type CoreProject struct {
@@ -43,7 +105,42 @@ type CoreTree struct {
 }
 
 type CoreTreeUpdate struct {
-	TreeID     string             `json:"tree_id"`
-	UpdateDate pgtype.Timestamptz `json:"update_date"`
-	FileID     string             `json:"file_id"`
+	TreeID          string             `json:"tree_id"`
+	UpdateDate      pgtype.Timestamptz `json:"update_date"`
+	FileID          string             `json:"file_id"`
+	PhotoTs         pgtype.Timestamptz `json:"photo_ts"`
+	PhotoLocation   interface{}        `json:"photo_location"`
+	PropertyList    []byte             `json:"property_list"`
+	GeofenceStatus  pgtype.Text        `json:"geofence_status"`
+	DistanceM       pgtype.Float8      `json:"distance_m"`
+	GeofenceRadiusM pgtype.Float8      `json:"geofence_radius_m"`
+}
+
+type CoreWebhookInbox struct {
+	ID            string             `json:"id"`
+	Payload       []byte             `json:"payload"`
+	Status        string             `json:"status"`
+	Attempts      int32              `json:"attempts"`
+	LastError     pgtype.Text        `json:"last_error"`
+	ReceivedAt    pgtype.Timestamptz `json:"received_at"`
+	NextAttemptAt pgtype.Timestamptz `json:"next_attempt_at"`
+	LockedAt      pgtype.Timestamptz `json:"locked_at"`
+	ProcessedAt   pgtype.Timestamptz `json:"processed_at"`
+}
+
+type CoreWebhookRejection struct {
+	ID         string             `json:"id"`
+	Reason     string             `json:"reason"`
+	Signature  pgtype.Text        `json:"signature"`
+	RemoteAddr pgtype.Text        `json:"remote_addr"`
+	Payload    []byte             `json:"payload"`
+	ReceivedAt pgtype.Timestamptz `json:"received_at"`
+}
+
+type CoreWhatsappMessage struct {
+	MessageID   string             `json:"message_id"`
+	MediaSha256 pgtype.Text        `json:"media_sha256"`
+	Sender      string             `json:"sender"`
+	MessageType string             `json:"message_type"`
+	ProcessedAt pgtype.Timestamptz `json:"processed_at"`
 }
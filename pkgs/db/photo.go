@@ -0,0 +1,27 @@
+package db
+
+import "context"
+
+type UploadTreePhotoInput struct {
+	TreeId            string         `json:"tree_id" validate:"required"`
+	ProviderName      string         `json:"provider_name" validate:"required"`
+	FileStoreId       string         `json:"file_store_id" validate:"required"`
+	FilePath          string         `json:"file_path,omitempty"`
+	FileName          string         `json:"file_name" validate:"required"`
+	FileType          string         `json:"file_type" validate:"required"`
+	PhotoLatitude     *float64       `json:"photo_latitude,omitempty" validate:"omitempty,min=-90,max=90"`
+	PhotoLongitude    *float64       `json:"photo_longitude,omitempty" validate:"omitempty,min=-180,max=180"`
+	PhotoTs           string         `json:"photo_ts,omitempty"`
+	PhotoPropertyList map[string]any `json:"photo_property_list,omitempty"`
+	UploadTs          string         `json:"upload_ts,omitempty"`
+}
+
+type UploadTreePhotoOutput struct {
+	FilesCreated    int `json:"files_created"`
+	PhotosProcessed int `json:"photos_processed"`
+	TotalRecords    int `json:"total_records"`
+}
+
+func UploadTreePhoto(ctx context.Context, q *Queries, input []UploadTreePhotoInput) (UploadTreePhotoOutput, error) {
+	return callDbApi[[]UploadTreePhotoInput, UploadTreePhotoOutput](ctx, q, "UploadTreePhoto", input)
+}
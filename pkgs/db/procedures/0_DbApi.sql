@@ -200,8 +200,8 @@ BEGIN
 
     v_UserIdn := coalesce((p_InputJson->>'user_idn')::INT,0);
 
-    -- Start logging and get RunLogIdn
-    v_RunLogIdn := core.F_RunLogStart(v_HandlerName, v_UserIdn, p_InputJson);
+    -- Start logging and get RunLogIdn; secrets in the request are not logged
+    v_RunLogIdn := core.F_RunLogStart(v_HandlerName, v_UserIdn, core.F_RedactSecrets(p_InputJson));
 
     v_RequestJson = p_InputJson->'request';
     CALL core.P_Step(v_RunLogIdn, NULL, 'Extract request JSON');
@@ -228,8 +228,8 @@ BEGIN
     INTO p_OutputJson;
     CALL core.P_Step(v_RunLogIdn, NULL, 'Built response JSON');
 
-    -- Mark run as complete
-    PERFORM core.F_RunLogEnd(v_RunLogIdn, p_OutputJson, TRUE);
+    -- Mark run as complete; the caller gets the response as is, the log does not
+    PERFORM core.F_RunLogEnd(v_RunLogIdn, core.F_RedactSecrets(p_OutputJson), TRUE);
 
 EXCEPTION
     WHEN others THEN
@@ -249,7 +249,7 @@ EXCEPTION
 				)
 		    INTO p_OutputJson;
 
-            PERFORM core.F_RunLogEnd(v_RunLogIdn,p_OutputJson,FALSE);
+            PERFORM core.F_RunLogEnd(v_RunLogIdn,core.F_RedactSecrets(p_OutputJson),FALSE);
 		ELSE 
 			RAISE;
         END IF;
@@ -8,8 +8,16 @@
 -- Key Features:
 -- - Batch retrieval of pending donor notifications
 -- - High water mark tracking to prevent duplicate processing
--- - Status tracking (pending/sent/failed) for each notification
+-- - Status tracking (pending/sent/failed/abandoned) for each notification
+-- - Retry of failed sends with exponential backoff, up to a maximum attempt count
 -- - Complete donor and tree information for notification generation
+--
+-- Retry Policy (core.U_Config 'DonorUpdRetry', all optional):
+--   {
+--     "max_attempts": <number>,    // default 5, after which the send is 'abandoned'
+--     "base_delay_sec": <number>,  // default 300, doubled after each failed attempt
+--     "max_delay_sec": <number>    // default 86400
+--   }
 
 -- =====================================================================================
 -- P_GetDonorUpdate
@@ -100,7 +108,7 @@ BEGIN
     --   - Donor contact information (name, email, mobile)
     --   - Project context (project name)
     --   - Photo metadata (timestamp, location)
-    --   - File storage details (path, name, type)
+    --   - File storage details (store, path, name, type)
     --
     -- Note: Currently filters to pledges with tree_cnt_pledged <= 3
     -- TODO: Consider making this filter configurable or removing it
@@ -119,6 +127,7 @@ BEGIN
                 'photo_ts', tp.PhotoTs,
                 'photo_location_latitude', ST_Y(tp.PhotoLocation::geometry)::FLOAT,
                 'photo_location_longitude', ST_X(tp.PhotoLocation::geometry)::FLOAT,
+                'file_store', pv.ProviderName,
                 'file_store_id', f.FileStoreId,
                 'file_name', f.FileName,
                 'file_path', f.FilePath,
@@ -141,7 +150,9 @@ BEGIN
             ON dub.TreeIdn = tp.TreeIdn 
             AND dub.UploadTs = tp.UploadTs
         JOIN stp.U_File f 
-            ON tp.FileIdn = f.FileIdn;
+            ON tp.FileIdn = f.FileIdn
+        JOIN stp.U_Provider pv
+            ON f.ProviderIdn = pv.ProviderIdn;
 
     GET DIAGNOSTICS v_Rc = ROW_COUNT;
     CALL core.P_Step(p_RunLogIdn, v_Rc, 'Build donor update JSON');
@@ -160,7 +171,8 @@ $BODY$;
 --   p_InputJson: [
 --     {
 --       "idn": <number>,           // U_DonorSendLog.Idn
---       "send_status": <string>    // 'sent' or 'failed'
+--       "send_status": <string>,   // 'sent' or 'failed'
+--       "error_msg": <string>      // Optional, reason for a failed send
 --     },
 --     ...
 --   ]
@@ -170,11 +182,13 @@ $BODY$;
 --
 -- Send Status Values:
 --   - 'sent': Notification successfully delivered to donor
---   - 'failed': Notification delivery failed (can be retried)
+--   - 'failed': Notification delivery failed, retried after NextAttemptTs
+--   - 'abandoned': Stored instead of 'failed' once AttemptCnt reaches max_attempts
 --   - 'pending': Initial state (not accepted as input here)
 --
 -- High Water Mark Update:
---   Updated to the maximum Idn from the input batch, enabling resumable processing
+--   Advanced to the maximum Idn from the input batch, enabling resumable processing.
+--   Never moves backwards, so posting results for retried rows is safe.
 -- =====================================================================================
 
 CREATE OR REPLACE PROCEDURE stp.P_PostDonorUpdate(
@@ -189,19 +203,33 @@ AS $BODY$
 DECLARE
     v_Rc INTEGER;
     v_NewHighWaterMark INT;
+    v_RetryConfig JSONB;
+    v_MaxAttempts INT;
+    v_BaseDelaySec INT;
+    v_MaxDelaySec INT;
+    v_RetryCnt INT;
+    v_AbandonedCnt INT;
 BEGIN
+    -- Load retry policy, falling back to defaults
+    v_RetryConfig := COALESCE(core.F_GetConfig('DonorUpdRetry'), '{}'::jsonb);
+    v_MaxAttempts := COALESCE((v_RetryConfig->>'max_attempts')::INT, 5);
+    v_BaseDelaySec := COALESCE((v_RetryConfig->>'base_delay_sec')::INT, 300);
+    v_MaxDelaySec := COALESCE((v_RetryConfig->>'max_delay_sec')::INT, 86400);
+
     -- Create temporary table for batch status updates
     CREATE TEMP TABLE T_DonorSendUpdate (
         Idn INT,
-        SendStatus VARCHAR(64)
+        SendStatus VARCHAR(64),
+        ErrorMsg TEXT
     ) ON COMMIT DROP;
 
     -- Parse input JSON array into temporary table
     -- Each element should contain an Idn and new send_status
-    INSERT INTO T_DonorSendUpdate (Idn, SendStatus)
+    INSERT INTO T_DonorSendUpdate (Idn, SendStatus, ErrorMsg)
     SELECT 
         (T->>'idn')::INT,
-        T->>'send_status'
+        T->>'send_status',
+        T->>'error_msg'
     FROM jsonb_array_elements(p_InputJson) AS T
     WHERE T->>'idn' IS NOT NULL;  -- Skip any malformed entries
     GET DIAGNOSTICS v_Rc = ROW_COUNT;
@@ -224,24 +252,54 @@ BEGIN
 
     -- Update status in donor send log
     -- For 'sent' status, also record the timestamp of successful delivery
-    -- For 'failed' status, preserve any existing SendTs (for retry tracking)
+    -- For 'failed' status, preserve any existing SendTs and schedule the next attempt
+    -- with exponential backoff, or abandon the send once max_attempts is reached
     UPDATE stp.U_DonorSendLog dsl
-    SET SendStatus = tsu.SendStatus,
+    SET SendStatus = 
+            CASE 
+                WHEN tsu.SendStatus = 'sent' THEN 'sent'
+                WHEN dsl.AttemptCnt + 1 >= v_MaxAttempts THEN 'abandoned'
+                ELSE 'failed'
+            END,
         SendTs = 
             CASE 
                 WHEN tsu.SendStatus = 'sent' THEN P_AnchorTs
                 ELSE dsl.SendTs  -- Preserve existing timestamp for failed attempts
+            END,
+        AttemptCnt = dsl.AttemptCnt + 1,
+        NextAttemptTs = 
+            CASE 
+                WHEN tsu.SendStatus = 'failed' AND dsl.AttemptCnt + 1 < v_MaxAttempts
+                THEN P_AnchorTs + LEAST(v_BaseDelaySec * POWER(2, dsl.AttemptCnt), v_MaxDelaySec) * INTERVAL '1 second'
+                ELSE NULL
+            END,
+        LastError = 
+            CASE 
+                WHEN tsu.SendStatus = 'failed' THEN tsu.ErrorMsg
+                ELSE NULL
             END
     FROM T_DonorSendUpdate tsu
     WHERE dsl.Idn = tsu.Idn;
     GET DIAGNOSTICS v_Rc = ROW_COUNT;
     CALL core.P_Step(p_RunLogIdn, v_Rc, 'UPDATE stp.U_DonorSendLog');
 
+    SELECT 
+        COUNT(*) FILTER (WHERE dsl.SendStatus = 'failed'),
+        COUNT(*) FILTER (WHERE dsl.SendStatus = 'abandoned')
+    INTO v_RetryCnt, v_AbandonedCnt
+    FROM stp.U_DonorSendLog dsl
+        JOIN T_DonorSendUpdate tsu 
+            ON dsl.Idn = tsu.Idn;
+    CALL core.P_Step(p_RunLogIdn, v_AbandonedCnt, 'Abandoned after ' || v_MaxAttempts || ' attempts');
+
     -- Update high water mark to track processing progress
-    -- Uses the maximum Idn from this batch
+    -- Uses the maximum Idn from this batch, never moving backwards
     -- This allows processing to resume from this point if interrupted
     IF v_Rc > 0 THEN
-        SELECT MAX(Idn)
+        SELECT GREATEST(
+            MAX(Idn),
+            COALESCE((core.F_GetControl('DonorUpdHwm')->>'idn')::INT, 0)
+        )
         INTO v_NewHighWaterMark
         FROM T_DonorSendUpdate;
 
@@ -264,11 +322,196 @@ BEGIN
     -- Return summary of operation
     p_OutputJson := jsonb_build_object(
         'updated_count', v_Rc,
+        'retry_count', v_RetryCnt,
+        'abandoned_count', v_AbandonedCnt,
         'new_high_water_mark', v_NewHighWaterMark
     );
 END;
 $BODY$;
 
+-- =====================================================================================
+-- P_GetDonorUpdateRetry
+-- =====================================================================================
+-- Purpose: Retrieve failed donor notifications whose backoff has elapsed
+--
+-- Failed sends sit behind the high water mark, so P_GetDonorUpdate never returns
+-- them again. This procedure returns them in the same shape, plus the attempt
+-- count and last error, so the dispatcher can resend and post the result back
+-- through P_PostDonorUpdate.
+--
+-- Input Parameters:
+--   p_InputJson: {
+--     "batch_size": <number>  // Optional, default 100, max 1000
+--   }
+--
+-- Output:
+--   Array of donor update records due for another attempt
+-- =====================================================================================
+
+CREATE OR REPLACE PROCEDURE stp.P_GetDonorUpdateRetry(
+    IN      P_AnchorTs      TIMESTAMPTZ,
+    IN      P_UserIdn       INT,
+    IN      P_RunLogIdn     INT,
+    IN      p_InputJson     JSONB,
+    INOUT   p_OutputJson    JSONB
+)
+LANGUAGE plpgsql
+AS $BODY$
+DECLARE
+    v_Rc INTEGER;
+    v_BatchSize INT;
+BEGIN
+    -- Extract and validate batch size (default: 100, max: 1000)
+    v_BatchSize := COALESCE((p_InputJson->>'batch_size')::INT, 100);
+
+    IF v_BatchSize <= 0 OR v_BatchSize > 1000 THEN
+        RAISE EXCEPTION 'batch_size must be between 1 and 1000';
+    END IF;
+    CALL core.P_Step(p_RunLogIdn, NULL, 'Batch Size: ' || v_BatchSize);
+
+    CREATE TEMP TABLE T_DonorUpdateRetryBatch (
+        Idn INT PRIMARY KEY,
+        TreeIdn INT,
+        UploadTs TIMESTAMPTZ,
+        AttemptCnt INT,
+        LastError TEXT
+    ) ON COMMIT DROP;
+
+    -- Select failed sends whose next attempt is due, oldest first
+    INSERT INTO T_DonorUpdateRetryBatch (Idn, TreeIdn, UploadTs, AttemptCnt, LastError)
+    SELECT Idn, TreeIdn, UploadTs, AttemptCnt, LastError
+    FROM stp.U_DonorSendLog
+    WHERE SendStatus = 'failed'
+      AND NextAttemptTs <= P_AnchorTs
+    ORDER BY NextAttemptTs, Idn
+    LIMIT v_BatchSize;
+    GET DIAGNOSTICS v_Rc = ROW_COUNT;
+    CALL core.P_Step(p_RunLogIdn, v_Rc, 'SELECT due retries from U_DonorSendLog');
+
+    IF v_Rc = 0 THEN
+        p_OutputJson := '[]'::jsonb;
+        CALL core.P_Step(p_RunLogIdn, NULL, 'No retries due');
+        RETURN;
+    END IF;
+
+    SELECT COALESCE(
+        jsonb_agg(
+            jsonb_build_object(
+                'idn', drb.Idn,
+                'tree_idn', drb.TreeIdn,
+                'tree_id', t.TreeId,
+                'credit_name', t.CreditName,
+                'upload_ts', drb.UploadTs,
+                'donor_name', d.DonorName,
+                'donor_email', d.EmailAddr,
+                'donor_mobile', d.MobileNumber,
+                'project_name', pr.ProjectName,
+                'photo_ts', tp.PhotoTs,
+                'photo_location_latitude', ST_Y(tp.PhotoLocation::geometry)::FLOAT,
+                'photo_location_longitude', ST_X(tp.PhotoLocation::geometry)::FLOAT,
+                'file_store', pv.ProviderName,
+                'file_store_id', f.FileStoreId,
+                'file_name', f.FileName,
+                'file_path', f.FilePath,
+                'file_type', f.FileType,
+                'attempt_cnt', drb.AttemptCnt,
+                'last_error', drb.LastError
+            ) ORDER BY drb.Idn
+        ), '[]'::jsonb
+    )
+    INTO p_OutputJson
+    FROM T_DonorUpdateRetryBatch drb
+        JOIN stp.U_Tree t 
+            ON drb.TreeIdn = t.TreeIdn
+        JOIN stp.U_Pledge p 
+            ON t.PledgeIdn = p.PledgeIdn
+        JOIN stp.U_Donor d 
+            ON p.DonorIdn = d.DonorIdn
+        JOIN stp.U_Project pr 
+            ON p.ProjectIdn = pr.ProjectIdn
+        JOIN stp.U_TreePhoto tp 
+            ON drb.TreeIdn = tp.TreeIdn 
+            AND drb.UploadTs = tp.UploadTs
+        JOIN stp.U_File f 
+            ON tp.FileIdn = f.FileIdn
+        JOIN stp.U_Provider pv
+            ON f.ProviderIdn = pv.ProviderIdn;
+
+    GET DIAGNOSTICS v_Rc = ROW_COUNT;
+    CALL core.P_Step(p_RunLogIdn, v_Rc, 'Build donor update retry JSON');
+END;
+$BODY$;
+
+-- =====================================================================================
+-- P_GetDonorUpdateFailed
+-- =====================================================================================
+-- Purpose: List donor notifications that were abandoned after max_attempts
+--
+-- Input Parameters:
+--   p_InputJson: {
+--     "limit": <number>  // Optional, default 100, max 1000
+--   }
+--
+-- Output:
+--   Array of abandoned sends, most recently attempted first
+-- =====================================================================================
+
+CREATE OR REPLACE PROCEDURE stp.P_GetDonorUpdateFailed(
+    IN      P_AnchorTs      TIMESTAMPTZ,
+    IN      P_UserIdn       INT,
+    IN      P_RunLogIdn     INT,
+    IN      p_InputJson     JSONB,
+    INOUT   p_OutputJson    JSONB
+)
+LANGUAGE plpgsql
+AS $BODY$
+DECLARE
+    v_Rc INTEGER;
+    v_Limit INT;
+BEGIN
+    v_Limit := COALESCE((p_InputJson->>'limit')::INT, 100);
+
+    IF v_Limit <= 0 OR v_Limit > 1000 THEN
+        RAISE EXCEPTION 'limit must be between 1 and 1000';
+    END IF;
+
+    -- Left joins so a send is still listed if its donor or pledge has since changed
+    SELECT COALESCE(
+        jsonb_agg(
+            jsonb_build_object(
+                'idn', x.Idn,
+                'tree_idn', x.TreeIdn,
+                'tree_id', x.TreeId,
+                'donor_name', x.DonorName,
+                'donor_email', x.EmailAddr,
+                'donor_mobile', x.MobileNumber,
+                'upload_ts', x.UploadTs,
+                'attempt_cnt', x.AttemptCnt,
+                'last_error', x.LastError
+            ) ORDER BY x.Idn DESC
+        ), '[]'::jsonb
+    )
+    INTO p_OutputJson
+    FROM (
+        SELECT dsl.Idn, dsl.TreeIdn, t.TreeId, d.DonorName, d.EmailAddr, d.MobileNumber,
+               dsl.UploadTs, dsl.AttemptCnt, dsl.LastError
+        FROM stp.U_DonorSendLog dsl
+            LEFT JOIN stp.U_Tree t 
+                ON dsl.TreeIdn = t.TreeIdn
+            LEFT JOIN stp.U_Pledge p 
+                ON t.PledgeIdn = p.PledgeIdn
+            LEFT JOIN stp.U_Donor d 
+                ON p.DonorIdn = d.DonorIdn
+        WHERE dsl.SendStatus = 'abandoned'
+        ORDER BY dsl.Idn DESC
+        LIMIT v_Limit
+    ) x;
+
+    GET DIAGNOSTICS v_Rc = ROW_COUNT;
+    CALL core.P_Step(p_RunLogIdn, v_Rc, 'Build abandoned donor update JSON');
+END;
+$BODY$;
+
 -- =====================================================================================
 -- Service Registration
 -- =====================================================================================
@@ -294,9 +537,29 @@ CALL core.P_DbApi (
                     "handler_name": "P_PostDonorUpdate",
                     "property_list": {
                         "description": "Mark donor notifications as sent/failed and update processing high water mark",
-                        "version": "1.0",
+                        "version": "1.1",
                         "permissions": ["write"]
                     }
+                },
+                {
+                    "db_api_name": "GetDonorUpdateRetry",
+                    "schema_name": "stp",
+                    "handler_name": "P_GetDonorUpdateRetry",
+                    "property_list": {
+                        "description": "Retrieve failed donor notifications that are due for another attempt",
+                        "version": "1.0",
+                        "permissions": ["read"]
+                    }
+                },
+                {
+                    "db_api_name": "GetDonorUpdateFailed",
+                    "schema_name": "stp",
+                    "handler_name": "P_GetDonorUpdateFailed",
+                    "property_list": {
+                        "description": "List donor notifications abandoned after the maximum number of attempts",
+                        "version": "1.0",
+                        "permissions": ["read"]
+                    }
                 }
             ]
         }
@@ -470,11 +733,38 @@ CALL core.P_DbApi(
     NULL
 );
 
--- Example 5: Check current high water mark
+-- Example 5: Get failed notifications whose backoff has elapsed and resend them
+CALL core.P_DbApi(
+    '{
+        "db_api_name": "GetDonorUpdateRetry",
+        "request": {
+            "batch_size": 10
+        }
+    }'::jsonb,
+    NULL
+);
+
+-- List notifications abandoned after the maximum number of attempts
+CALL core.P_DbApi(
+    '{
+        "db_api_name": "GetDonorUpdateFailed",
+        "request": {}
+    }'::jsonb,
+    NULL
+);
+
+-- Tune the retry policy
+CALL core.P_SetConfig(
+    'DonorUpdRetry',
+    '{"max_attempts": 5, "base_delay_sec": 300, "max_delay_sec": 86400}'::jsonb,
+    1
+);
+
+-- Example 6: Check current high water mark
 -- Shows the last processed Idn, useful for monitoring progress
 SELECT core.F_GetControl('DonorUpdHwm');
 
--- Example 6: Verify the queue is empty after processing
+-- Example 7: Verify the queue is empty after processing
 CALL core.P_DbApi(
     '{
         "db_api_name": "GetDonorUpdate",
@@ -483,8 +773,8 @@ CALL core.P_DbApi(
     NULL
 );
 
--- Example 7: Check send log status
-SELECT Idn, TreeIdn, SendStatus, SendTs, UploadTs 
+-- Example 8: Check send log status
+SELECT Idn, TreeIdn, SendStatus, SendTs, UploadTs, AttemptCnt, NextAttemptTs, LastError 
 FROM stp.U_DonorSendLog 
 ORDER BY Idn;
 
@@ -502,7 +792,7 @@ CALL core.P_SetControl(
 
 -- Reset all notifications to pending (for testing)
 UPDATE stp.U_DonorSendLog 
-SET SendStatus = 'pending', SendTs = NULL;
+SET SendStatus = 'pending', SendTs = NULL, AttemptCnt = 0, NextAttemptTs = NULL, LastError = NULL;
 
 -- =====================================================================================
 -- CLEANUP: Remove Test Data
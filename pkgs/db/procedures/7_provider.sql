@@ -25,8 +25,8 @@ BEGIN
                 'provider_idn', ProviderIdn,
                 'provider_name', ProviderName,
                 'auth_type', AuthType,
-                'auth_config', AuthConfig,
-                'token_config', TokenConfig
+                'auth_config', core.F_RedactSecrets(AuthConfig),
+                'token_config', core.F_RedactSecrets(TokenConfig)
             ) ORDER BY ProviderName
         ), '[]'::jsonb
     )
@@ -39,7 +39,46 @@ BEGIN
 END;
 $BODY$;
 
+-- F_HasPlaintextSecrets - Whether a JSON document holds a secret field, at any
+-- depth, that is neither sealed by the auth package ("enc:v1:...") nor the
+-- "[REDACTED]" placeholder P_GetProvider returns. The field names match
+-- core.F_RedactSecrets.
+CREATE OR REPLACE FUNCTION core.F_HasPlaintextSecrets(p_Json JSONB)
+RETURNS BOOLEAN
+LANGUAGE plpgsql IMMUTABLE AS
+$BODY$
+BEGIN
+    CASE jsonb_typeof(p_Json)
+    WHEN 'object' THEN
+        RETURN EXISTS (
+            SELECT 1
+            FROM jsonb_each(p_Json) AS e
+            WHERE CASE
+                WHEN lower(e.key) IN ('access_token', 'api_key', 'client_secret', 'password',
+                                      'private_key', 'refresh_token', 'secret_access_key', 'session_token')
+                     AND jsonb_typeof(e.value) = 'string'
+                THEN (e.value #>> '{}') NOT LIKE 'enc:v1:%'
+                     AND (e.value #>> '{}') NOT IN ('', '[REDACTED]')
+                ELSE core.F_HasPlaintextSecrets(e.value)
+            END
+        );
+    WHEN 'array' THEN
+        RETURN EXISTS (
+            SELECT 1
+            FROM jsonb_array_elements(p_Json) AS a
+            WHERE core.F_HasPlaintextSecrets(a.value)
+        );
+    ELSE
+        RETURN FALSE;
+    END CASE;
+END;
+$BODY$;
+
 -- SaveProvider - Insert/Update providers with validation
+--
+-- Once `secrets rotate` has sealed the stored secrets it sets the
+-- 'SecretsSealed' control, after which secrets must arrive sealed too: save
+-- providers through the app (auth.SaveProviders), which encrypts them first.
 CREATE OR REPLACE PROCEDURE stp.P_SaveProvider(
     IN      P_AnchorTs      TIMESTAMPTZ,
     IN      P_UserIdn       INT,
@@ -52,6 +91,7 @@ AS $BODY$
 DECLARE
     v_Rc INTEGER;
     v_DuplicateProviderNames TEXT;
+    v_PlaintextProviderNames TEXT;
 BEGIN
     -- Create temp table for input providers
     CREATE TEMP TABLE T_Provider (
@@ -79,6 +119,19 @@ BEGIN
         RAISE EXCEPTION 'Missing required fields: provider_name and auth_type are mandatory';
     END IF;
 
+    -- Refuse plaintext secrets once stored secrets are encrypted
+    IF COALESCE((core.F_GetControl('SecretsSealed')->>'sealed')::BOOLEAN, FALSE) THEN
+        SELECT string_agg(ProviderName, ', ')
+        INTO v_PlaintextProviderNames
+        FROM T_Provider
+        WHERE core.F_HasPlaintextSecrets(AuthConfig)
+           OR core.F_HasPlaintextSecrets(TokenConfig);
+
+        IF v_PlaintextProviderNames IS NOT NULL THEN
+            RAISE EXCEPTION 'Unencrypted secrets for provider(s): %. Save providers through the app so their secrets are encrypted.', v_PlaintextProviderNames;
+        END IF;
+    END IF;
+
     -- Check for duplicate ProviderName within input batch
     SELECT string_agg(DISTINCT ProviderName, ', ')
     INTO v_DuplicateProviderNames
@@ -109,8 +162,8 @@ BEGIN
     UPDATE stp.U_Provider up
     SET ProviderName = tp.ProviderName,
         AuthType = tp.AuthType,
-        AuthConfig = tp.AuthConfig,
-        TokenConfig = tp.TokenConfig
+        AuthConfig = core.F_KeepRedactedSecrets(tp.AuthConfig, up.AuthConfig),
+        TokenConfig = core.F_KeepRedactedSecrets(tp.TokenConfig, up.TokenConfig)
     FROM T_Provider tp
     WHERE up.ProviderIdn = tp.ProviderIdn
       AND tp.ProviderIdn IS NOT NULL;
@@ -136,8 +189,8 @@ BEGIN
                 'provider_idn', up.ProviderIdn,
                 'provider_name', up.ProviderName,
                 'auth_type', up.AuthType,
-                'auth_config', up.AuthConfig,
-                'token_config', up.TokenConfig
+                'auth_config', core.F_RedactSecrets(up.AuthConfig),
+                'token_config', core.F_RedactSecrets(up.TokenConfig)
             )
         ), '[]'::jsonb
     )
@@ -0,0 +1,34 @@
+package db
+
+import "context"
+
+type GetProviderInput struct {
+	ProviderIdn int `json:"provider_idn,omitempty"`
+}
+
+// DbProvider is a stp.U_Provider row. Secret fields come back redacted.
+type DbProvider struct {
+	ProviderIdn  int            `json:"provider_idn" validate:"required"`
+	ProviderName string         `json:"provider_name" validate:"required"`
+	AuthType     string         `json:"auth_type" validate:"required"`
+	AuthConfig   map[string]any `json:"auth_config"`
+	TokenConfig  map[string]any `json:"token_config"`
+}
+
+func GetProvider(ctx context.Context, q *Queries, input GetProviderInput) ([]DbProvider, error) {
+	return callDbApi[GetProviderInput, []DbProvider](ctx, q, "GetProvider", input)
+}
+
+type SaveProviderInput struct {
+	ProviderIdn  int            `json:"provider_idn,omitempty" validate:"optional"`
+	ProviderName string         `json:"provider_name" validate:"required"`
+	AuthType     string         `json:"auth_type" validate:"required"`
+	AuthConfig   map[string]any `json:"auth_config,omitempty"`
+	TokenConfig  map[string]any `json:"token_config,omitempty"`
+}
+
+// SaveProvider saves providers as given. Use auth.SaveProviders, which
+// encrypts their secrets first.
+func SaveProvider(ctx context.Context, q *Queries, input []SaveProviderInput) ([]DbProvider, error) {
+	return callDbApi[[]SaveProviderInput, []DbProvider](ctx, q, "SaveProvider", input)
+}
@@ -11,26 +11,109 @@ import (
 )
 
 type Querier interface {
+	// Compare a linked photo's location with its tree's, using the project's radius from the PhotoGeofence config
+	CheckTreeUpdateGeofence(ctx context.Context, arg CheckTreeUpdateGeofenceParams) (CheckTreeUpdateGeofenceRow, error)
+	// Take the oldest queued re-run, clearing the request so it runs once
+	ClaimPhotoReviewRerun(ctx context.Context) (ClaimPhotoReviewRerunRow, error)
+	// Claim the oldest ready inbox row, including rows abandoned by a crashed worker
+	ClaimWebhookInbox(ctx context.Context, staleBefore pgtype.Timestamptz) (CoreWebhookInbox, error)
+	// Claim a message for ingestion. No row is inserted when the message, or the
+	// same media under another message ID, is already claimed; a claim still
+	// being ingested blocks until its transaction ends.
+	ClaimWhatsappMessage(ctx context.Context, arg ClaimWhatsappMessageParams) (int64, error)
+	CompleteWebhookInbox(ctx context.Context, id string) error
+	// Files in a store sharing content, and so a blob in content-addressed stores
+	CountStoreFilesWithChecksum(ctx context.Context, arg CountStoreFilesWithChecksumParams) (int64, error)
 	// Insert a new donor
 	CreateDonor(ctx context.Context, arg CreateDonorParams) (CoreDonor, error)
+	// Queue a photo for manual review, refreshing the guesses while it is still pending
+	CreatePhotoReview(ctx context.Context, arg CreatePhotoReviewParams) error
 	CreateProject(ctx context.Context, arg CreateProjectParams) (CoreProject, error)
 	// Insert a new tree
 	CreateTree(ctx context.Context, arg CreateTreeParams) (CreateTreeRow, error)
-	// Insert a new tree update
-	CreateTreeUpdate(ctx context.Context, arg CreateTreeUpdateParams) (CoreTreeUpdate, error)
+	// Insert a new tree update with the capture time, location and tags read from the photo
+	CreateTreeUpdate(ctx context.Context, arg CreateTreeUpdateParams) (CreateTreeUpdateRow, error)
+	// Record a reviewer's decision on a pending photo
+	DecidePhotoReview(ctx context.Context, arg DecidePhotoReviewParams) (int64, error)
+	// Retention cleanup for the processed-message ledger
+	DeleteWhatsappMessagesBefore(ctx context.Context, cutoff pgtype.Timestamptz) (int64, error)
+	// Persist a raw webhook payload for asynchronous processing
+	EnqueueWebhook(ctx context.Context, payload []byte) (string, error)
+	// Record a failed attempt, either rescheduling it or moving it to the dead-letter state
+	FailWebhookInbox(ctx context.Context, arg FailWebhookInboxParams) error
+	// Linked tree photos whose pHash is within max_distance bits of the given one
+	FindSimilarTreePhotos(ctx context.Context, arg FindSimilarTreePhotosParams) ([]FindSimilarTreePhotosRow, error)
 	// Get detailed statistics for a project cluster
 	GetClusterDetail(ctx context.Context, projectCode string) (GetClusterDetailRow, error)
+	GetFileHash(ctx context.Context, fileID string) (CoreFileHash, error)
+	// Get the settings a file store is built from, by provider name
+	GetFileStoreProvider(ctx context.Context, providerName string) (GetFileStoreProviderRow, error)
 	// Get the most recent update for a tree
 	GetLatestTreeUpdate(ctx context.Context, treeID string) (GetLatestTreeUpdateRow, error)
 	GetLatestTreeUpdateFile(ctx context.Context, treeID string) (GetLatestTreeUpdateFileRow, error)
+	// Tokens consumed since the given time, for the daily budget check
+	GetLlmTokensUsedSince(ctx context.Context, since pgtype.Timestamptz) (int64, error)
+	// Spend summarised by UTC day, action and model
+	GetLlmUsageReport(ctx context.Context, since pgtype.Timestamptz) ([]GetLlmUsageReportRow, error)
+	GetPhotoReview(ctx context.Context, id string) (GetPhotoReviewRow, error)
 	// Get a single tree by ID with full details
 	GetTreeByID(ctx context.Context, id string) (GetTreeByIDRow, error)
 	// Get a single tree by project code and tree number
 	GetTreeByProjectCodeAndNumber(ctx context.Context, arg GetTreeByProjectCodeAndNumberParams) (GetTreeByProjectCodeAndNumberRow, error)
+	GetWebhookInboxStats(ctx context.Context) ([]GetWebhookInboxStatsRow, error)
+	// Get every provider's stored auth, so its secrets can be re-encrypted
+	ListAuthSecrets(ctx context.Context) ([]ListAuthSecretsRow, error)
+	// Resized copies made from an image
+	ListFileDerivatives(ctx context.Context, sourceFileID string) ([]ListFileDerivativesRow, error)
+	// Page through tree photos without both resized copies, in ID order
+	ListFilesMissingDerivatives(ctx context.Context, arg ListFilesMissingDerivativesParams) ([]CoreFile, error)
+	// Photos taken away from their tree or without GPS, newest first
+	ListGeofenceFlaggedTreeUpdates(ctx context.Context, arg ListGeofenceFlaggedTreeUpdatesParams) ([]ListGeofenceFlaggedTreeUpdatesRow, error)
+	// Suspected duplicate photos, newest first. scope is all, same_tree or other_tree.
+	ListPhotoDuplicates(ctx context.Context, arg ListPhotoDuplicatesParams) ([]ListPhotoDuplicatesRow, error)
+	// Review queue by status, oldest first
+	ListPhotoReviews(ctx context.Context, arg ListPhotoReviewsParams) ([]ListPhotoReviewsRow, error)
+	// Known project codes with the range of tree numbers planted in each
+	ListProjectTreeRanges(ctx context.Context) ([]ListProjectTreeRangesRow, error)
+	// Get every provider's settings, so their secrets can be re-encrypted
+	ListProviderSecrets(ctx context.Context) ([]ListProviderSecretsRow, error)
+	// Page through the files kept in a store, in ID order
+	ListStoreFiles(ctx context.Context, arg ListStoreFilesParams) ([]CoreFile, error)
+	// Candidate trees for tree-ID resolution, with the names to match against the sign
+	ListTreesByProjectCodesAndNumbers(ctx context.Context, arg ListTreesByProjectCodesAndNumbersParams) ([]ListTreesByProjectCodesAndNumbersRow, error)
+	ListWebhookInboxByStatus(ctx context.Context, arg ListWebhookInboxByStatusParams) ([]ListWebhookInboxByStatusRow, error)
+	// Record that stored secrets are encrypted, so P_SaveProvider refuses plaintext ones
+	MarkSecretsSealed(ctx context.Context, masterKeyID string) error
+	// Point a file at its copy in another store, unless it has moved already
+	MoveFile(ctx context.Context, arg MoveFileParams) (int64, error)
+	// Point a stp.U_File row at the copy of its file in another store
+	MoveProviderFile(ctx context.Context, arg MoveProviderFileParams) (int64, error)
+	// Append one LLM call to the usage ledger
+	RecordLlmUsage(ctx context.Context, arg RecordLlmUsageParams) error
+	// Flag a newly linked photo as looking like an earlier one
+	RecordPhotoDuplicate(ctx context.Context, arg RecordPhotoDuplicateParams) error
+	// Audit a webhook delivery that failed signature verification
+	RecordWebhookRejection(ctx context.Context, arg RecordWebhookRejectionParams) error
+	// Queue a pending photo for another extraction run
+	RequestPhotoReviewRerun(ctx context.Context, arg RequestPhotoReviewRerunParams) (int64, error)
+	// Move a dead-lettered row back to pending with a fresh attempt budget
+	RequeueWebhookInbox(ctx context.Context, id string) (int64, error)
 	// Search donors by name or phone number
 	SearchDonors(ctx context.Context, dollar_1 pgtype.Text) ([]CoreDonor, error)
 	SearchProjects(ctx context.Context, dollar_1 pgtype.Text) ([]CoreProject, error)
+	// Record the checksum of a file stored before checksums were kept
+	SetFileChecksum(ctx context.Context, arg SetFileChecksumParams) error
+	// Replace a provider's stored auth with its re-encrypted copy
+	UpdateAuthSecrets(ctx context.Context, arg UpdateAuthSecretsParams) error
+	// Replace the guesses on a pending photo after extraction is re-run
+	UpdatePhotoReviewExtraction(ctx context.Context, arg UpdatePhotoReviewExtractionParams) (int64, error)
+	// Replace a provider's settings with their re-encrypted copy
+	UpdateProviderSecrets(ctx context.Context, arg UpdateProviderSecretsParams) error
 	UpsertFile(ctx context.Context, arg UpsertFileParams) (UpsertFileRow, error)
+	// Record a resized copy of an image, replacing any earlier one of the same variant
+	UpsertFileDerivative(ctx context.Context, arg UpsertFileDerivativeParams) error
+	// Record the perceptual hashes of an image file
+	UpsertFileHash(ctx context.Context, arg UpsertFileHashParams) error
 }
 
 var _ Querier = (*Queries)(nil)
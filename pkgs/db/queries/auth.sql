@@ -0,0 +1,12 @@
+-- name: ListAuthSecrets :many
+-- Get every provider's stored auth, so its secrets can be re-encrypted
+SELECT provider_name, auth_config, active_token
+FROM core.authentication
+ORDER BY provider_name;
+
+-- name: UpdateAuthSecrets :exec
+-- Replace a provider's stored auth with its re-encrypted copy
+UPDATE core.authentication
+SET auth_config = sqlc.arg(auth_config),
+    active_token = sqlc.arg(active_token)
+WHERE provider_name = sqlc.arg(provider_name);
@@ -6,7 +6,9 @@ INSERT INTO core.file (
     file_name,
     file_url,
     file_type,
-    file_expiration
+    file_expiration,
+    sha256,
+    size_bytes
 )
 VALUES (
     sqlc.arg(file_store),
@@ -15,7 +17,9 @@ VALUES (
     sqlc.arg(file_name),
     sqlc.arg(file_url),
     sqlc.arg(file_type),
-    sqlc.arg(file_expiration)
+    sqlc.arg(file_expiration),
+    sqlc.arg(sha256),
+    sqlc.arg(size_bytes)
 )
 ON CONFLICT (file_store_id) DO UPDATE SET
     file_store = EXCLUDED.file_store,
@@ -23,15 +27,49 @@ ON CONFLICT (file_store_id) DO UPDATE SET
     file_name = EXCLUDED.file_name,
     file_url = EXCLUDED.file_url,
     file_type = EXCLUDED.file_type,
-    file_expiration = EXCLUDED.file_expiration
+    file_expiration = EXCLUDED.file_expiration,
+    sha256 = EXCLUDED.sha256,
+    size_bytes = EXCLUDED.size_bytes
 RETURNING 
     id,
     (xmax != 0) AS was_updated;
 
 -- name: GetLatestTreeUpdateFile :one
-SELECT tu.update_date, f.*
+SELECT tu.update_date, tu.photo_ts, tu.geofence_status, tu.distance_m, wf.file_url AS web_url, f.*
 FROM core.file AS f
     JOIN core.tree_update AS tu ON f.id = tu.file_id
+    LEFT JOIN core.file_derivative AS wd ON wd.source_file_id = f.id AND wd.variant = 'web'
+    LEFT JOIN core.file AS wf ON wf.id = wd.file_id
 WHERE tu.tree_id = sqlc.arg(tree_id)
 ORDER BY tu.update_date DESC
-LIMIT 1;
\ No newline at end of file
+LIMIT 1;
+-- name: ListStoreFiles :many
+-- Page through the files kept in a store, in ID order
+SELECT * FROM core.file
+WHERE file_store = sqlc.arg(file_store) AND id > sqlc.arg(after_id)
+ORDER BY id
+LIMIT sqlc.arg(row_limit);
+
+-- name: MoveFile :execrows
+-- Point a file at its copy in another store, unless it has moved already
+UPDATE core.file
+SET file_store = sqlc.arg(to_store),
+    file_store_id = sqlc.arg(file_store_id),
+    file_path = sqlc.arg(file_path),
+    file_name = sqlc.arg(file_name),
+    file_url = sqlc.arg(file_url),
+    file_expiration = sqlc.arg(file_expiration),
+    sha256 = sqlc.arg(sha256),
+    size_bytes = sqlc.arg(size_bytes)
+WHERE id = sqlc.arg(id) AND file_store = sqlc.arg(from_store);
+
+-- name: SetFileChecksum :exec
+-- Record the checksum of a file stored before checksums were kept
+UPDATE core.file
+SET sha256 = sqlc.arg(sha256), size_bytes = sqlc.arg(size_bytes)
+WHERE id = sqlc.arg(id);
+
+-- name: CountStoreFilesWithChecksum :one
+-- Files in a store sharing content, and so a blob in content-addressed stores
+SELECT COUNT(*) FROM core.file
+WHERE file_store = sqlc.arg(file_store) AND sha256 = sqlc.arg(sha256);
@@ -0,0 +1,43 @@
+-- name: UpsertFileDerivative :exec
+-- Record a resized copy of an image, replacing any earlier one of the same variant
+INSERT INTO core.file_derivative (
+    source_file_id,
+    variant,
+    file_id,
+    width,
+    height
+)
+VALUES (
+    sqlc.arg(source_file_id),
+    sqlc.arg(variant),
+    sqlc.arg(file_id),
+    sqlc.arg(width),
+    sqlc.arg(height)
+)
+ON CONFLICT (source_file_id, variant) DO UPDATE SET
+    file_id = EXCLUDED.file_id,
+    width = EXCLUDED.width,
+    height = EXCLUDED.height,
+    created_at = CURRENT_TIMESTAMP;
+
+-- name: ListFileDerivatives :many
+-- Resized copies made from an image
+SELECT sqlc.embed(fd), sqlc.embed(f)
+FROM core.file_derivative AS fd
+    JOIN core.file AS f ON f.id = fd.file_id
+WHERE fd.source_file_id = sqlc.arg(source_file_id)
+ORDER BY fd.variant;
+
+-- name: ListFilesMissingDerivatives :many
+-- Page through tree photos without both resized copies, in ID order
+SELECT f.*
+FROM core.file AS f
+WHERE f.id > sqlc.arg(after_id)
+    AND EXISTS (SELECT 1 FROM core.tree_update AS tu WHERE tu.file_id = f.id)
+    AND (
+        SELECT count(*)
+        FROM core.file_derivative AS fd
+        WHERE fd.source_file_id = f.id AND fd.variant IN ('thumbnail', 'web')
+    ) < 2
+ORDER BY f.id
+LIMIT sqlc.arg(row_limit);
@@ -0,0 +1,12 @@
+-- name: GetFileHash :one
+SELECT * FROM core.file_hash
+WHERE file_id = sqlc.arg(file_id);
+
+-- name: UpsertFileHash :exec
+-- Record the perceptual hashes of an image file
+INSERT INTO core.file_hash (file_id, dhash, phash)
+VALUES (sqlc.arg(file_id), sqlc.arg(dhash), sqlc.arg(phash))
+ON CONFLICT (file_id) DO UPDATE SET
+    dhash = EXCLUDED.dhash,
+    phash = EXCLUDED.phash,
+    created_at = CURRENT_TIMESTAMP;
@@ -0,0 +1,32 @@
+-- name: RecordLlmUsage :exec
+-- Append one LLM call to the usage ledger
+INSERT INTO core.llm_usage (
+    provider, model, action, attempt, prompt_tokens, completion_tokens,
+    total_tokens, latency_ms, success, error, cost_usd
+)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11);
+
+-- name: GetLlmTokensUsedSince :one
+-- Tokens consumed since the given time, for the daily budget check
+SELECT COALESCE(SUM(total_tokens), 0)::bigint AS tokens_used
+FROM core.llm_usage
+WHERE created_at >= sqlc.arg(since);
+
+-- name: GetLlmUsageReport :many
+-- Spend summarised by UTC day, action and model
+SELECT
+    (created_at AT TIME ZONE 'UTC')::date AS usage_day,
+    action,
+    model,
+    COUNT(*) AS call_count,
+    COUNT(*) FILTER (WHERE NOT success) AS failure_count,
+    COUNT(*) FILTER (WHERE attempt > 1) AS retry_count,
+    COALESCE(SUM(prompt_tokens), 0)::bigint AS prompt_tokens,
+    COALESCE(SUM(completion_tokens), 0)::bigint AS completion_tokens,
+    COALESCE(SUM(total_tokens), 0)::bigint AS total_tokens,
+    COALESCE(SUM(cost_usd), 0)::float8 AS cost_usd,
+    COALESCE(AVG(latency_ms), 0)::float8 AS avg_latency_ms
+FROM core.llm_usage
+WHERE created_at >= sqlc.arg(since)
+GROUP BY usage_day, action, model
+ORDER BY usage_day DESC, action, model;
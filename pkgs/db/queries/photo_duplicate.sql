@@ -0,0 +1,71 @@
+-- name: FindSimilarTreePhotos :many
+-- Linked tree photos whose pHash is within max_distance bits of the given one
+SELECT
+    fh.file_id,
+    tu.tree_id,
+    d.phash_distance::int AS phash_distance,
+    d.dhash_distance::int AS dhash_distance
+FROM core.file_hash AS fh
+    JOIN core.tree_update AS tu ON tu.file_id = fh.file_id
+    CROSS JOIN LATERAL (
+        SELECT
+            length(replace(((fh.phash # sqlc.arg(phash)::bigint)::bit(64))::text, '0', '')) AS phash_distance,
+            length(replace(((fh.dhash # sqlc.arg(dhash)::bigint)::bit(64))::text, '0', '')) AS dhash_distance
+    ) AS d
+WHERE fh.file_id <> sqlc.arg(file_id)
+    AND d.phash_distance <= sqlc.arg(max_distance)::int
+ORDER BY d.phash_distance, d.dhash_distance
+LIMIT 20;
+
+-- name: RecordPhotoDuplicate :exec
+-- Flag a newly linked photo as looking like an earlier one
+INSERT INTO core.photo_duplicate (
+    file_id,
+    tree_id,
+    duplicate_file_id,
+    duplicate_tree_id,
+    phash_distance,
+    dhash_distance
+)
+VALUES (
+    sqlc.arg(file_id),
+    sqlc.arg(tree_id),
+    sqlc.arg(duplicate_file_id),
+    sqlc.arg(duplicate_tree_id),
+    sqlc.arg(phash_distance),
+    sqlc.arg(dhash_distance)
+)
+ON CONFLICT (file_id, duplicate_file_id) DO NOTHING;
+
+-- name: ListPhotoDuplicates :many
+-- Suspected duplicate photos, newest first. scope is all, same_tree or other_tree.
+SELECT
+    pd.file_id,
+    (t.project_code || lpad(t.tree_number::text, 6, '0'))::text AS tree_label,
+    pd.tree_id,
+    f.file_url,
+    tf.file_url AS thumbnail_url,
+    pd.duplicate_file_id,
+    (dt.project_code || lpad(dt.tree_number::text, 6, '0'))::text AS duplicate_tree_label,
+    pd.duplicate_tree_id,
+    df.file_url AS duplicate_file_url,
+    dtf.file_url AS duplicate_thumbnail_url,
+    pd.phash_distance,
+    pd.dhash_distance,
+    pd.created_at
+FROM core.photo_duplicate AS pd
+    JOIN core.tree AS t ON t.id = pd.tree_id
+    JOIN core.tree AS dt ON dt.id = pd.duplicate_tree_id
+    JOIN core.file AS f ON f.id = pd.file_id
+    JOIN core.file AS df ON df.id = pd.duplicate_file_id
+    LEFT JOIN core.file_derivative AS td ON td.source_file_id = f.id AND td.variant = 'thumbnail'
+    LEFT JOIN core.file AS tf ON tf.id = td.file_id
+    LEFT JOIN core.file_derivative AS dtd ON dtd.source_file_id = df.id AND dtd.variant = 'thumbnail'
+    LEFT JOIN core.file AS dtf ON dtf.id = dtd.file_id
+WHERE pd.created_at >= sqlc.arg(since)
+    AND (
+        sqlc.arg(scope)::text = 'all'
+        OR (pd.tree_id = pd.duplicate_tree_id) = (sqlc.arg(scope)::text = 'same_tree')
+    )
+ORDER BY pd.created_at DESC
+LIMIT sqlc.arg(row_limit);
@@ -0,0 +1,85 @@
+-- name: CreatePhotoReview :exec
+-- Queue a photo for manual review, refreshing the guesses while it is still pending
+INSERT INTO core.photo_review (file_id, message_id, sender, reason, extracted, matches)
+VALUES (
+    sqlc.arg(file_id),
+    sqlc.narg(message_id),
+    sqlc.narg(sender),
+    sqlc.arg(reason),
+    sqlc.arg(extracted),
+    sqlc.arg(matches)
+)
+ON CONFLICT (file_id) DO UPDATE SET
+    reason = EXCLUDED.reason,
+    extracted = EXCLUDED.extracted,
+    matches = EXCLUDED.matches,
+    updated_at = CURRENT_TIMESTAMP
+WHERE core.photo_review.status = 'pending';
+
+-- name: GetPhotoReview :one
+SELECT sqlc.embed(pr), sqlc.embed(f)
+FROM core.photo_review AS pr
+    JOIN core.file AS f ON f.id = pr.file_id
+WHERE pr.id = sqlc.arg(id);
+
+-- name: ListPhotoReviews :many
+-- Review queue by status, oldest first
+SELECT
+    sqlc.embed(pr),
+    sqlc.embed(f),
+    COALESCE(t.project_code || lpad(t.tree_number::text, 6, '0'), '')::text AS tree_label,
+    tf.file_url AS thumbnail_url
+FROM core.photo_review AS pr
+    JOIN core.file AS f ON f.id = pr.file_id
+    LEFT JOIN core.tree AS t ON t.id = pr.tree_id
+    LEFT JOIN core.file_derivative AS td ON td.source_file_id = f.id AND td.variant = 'thumbnail'
+    LEFT JOIN core.file AS tf ON tf.id = td.file_id
+WHERE pr.status = sqlc.arg(status)
+ORDER BY pr.created_at
+LIMIT sqlc.arg(row_limit);
+
+-- name: DecidePhotoReview :execrows
+-- Record a reviewer's decision on a pending photo
+UPDATE core.photo_review
+SET
+    status = sqlc.arg(status),
+    tree_id = sqlc.narg(tree_id),
+    decided_by = sqlc.arg(decided_by),
+    decided_at = CURRENT_TIMESTAMP,
+    updated_at = CURRENT_TIMESTAMP
+WHERE id = sqlc.arg(id) AND status = 'pending';
+
+-- name: UpdatePhotoReviewExtraction :execrows
+-- Replace the guesses on a pending photo after extraction is re-run
+UPDATE core.photo_review
+SET
+    reason = sqlc.arg(reason),
+    extracted = sqlc.arg(extracted),
+    matches = sqlc.arg(matches),
+    updated_at = CURRENT_TIMESTAMP
+WHERE id = sqlc.arg(id) AND status = 'pending';
+
+-- name: RequestPhotoReviewRerun :execrows
+-- Queue a pending photo for another extraction run
+UPDATE core.photo_review
+SET
+    rerun_requested_by = sqlc.arg(requested_by),
+    rerun_requested_at = CURRENT_TIMESTAMP,
+    updated_at = CURRENT_TIMESTAMP
+WHERE id = sqlc.arg(id) AND status = 'pending';
+
+-- name: ClaimPhotoReviewRerun :one
+-- Take the oldest queued re-run, clearing the request so it runs once
+UPDATE core.photo_review
+SET
+    rerun_requested_at = NULL,
+    updated_at = CURRENT_TIMESTAMP
+WHERE id = (
+    SELECT id
+    FROM core.photo_review
+    WHERE status = 'pending' AND rerun_requested_at IS NOT NULL
+    ORDER BY rerun_requested_at
+    LIMIT 1
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING id, rerun_requested_by;
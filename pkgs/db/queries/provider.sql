@@ -0,0 +1,38 @@
+-- name: GetFileStoreProvider :one
+-- Get the settings a file store is built from, by provider name
+SELECT providername, authconfig, tokenconfig
+FROM stp.u_provider
+WHERE providername = sqlc.arg(provider_name);
+
+-- name: ListProviderSecrets :many
+-- Get every provider's settings, so their secrets can be re-encrypted
+SELECT provideridn, providername, authconfig, tokenconfig
+FROM stp.u_provider
+ORDER BY provideridn;
+
+-- name: MarkSecretsSealed :exec
+-- Record that stored secrets are encrypted, so P_SaveProvider refuses plaintext ones
+CALL core.P_SetControl('SecretsSealed', jsonb_build_object('sealed', true, 'master_key_id', sqlc.arg(master_key_id)::text), 1);
+
+-- name: MoveProviderFile :execrows
+-- Point a stp.U_File row at the copy of its file in another store
+UPDATE stp.u_file AS uf
+SET provideridn = dst.provideridn,
+    filestoreid = sqlc.arg(new_file_store_id),
+    filepath = sqlc.arg(new_file_path),
+    filename = sqlc.arg(new_file_name),
+    ts = CURRENT_TIMESTAMP
+FROM stp.u_provider AS src, stp.u_provider AS dst
+WHERE src.providername = sqlc.arg(from_store)
+    AND dst.providername = sqlc.arg(to_store)
+    AND uf.provideridn = src.provideridn
+    AND uf.filestoreid = sqlc.arg(file_store_id)
+    AND uf.filepath = sqlc.arg(file_path)
+    AND uf.filename = sqlc.arg(file_name);
+
+-- name: UpdateProviderSecrets :exec
+-- Replace a provider's settings with their re-encrypted copy
+UPDATE stp.u_provider
+SET authconfig = sqlc.arg(auth_config),
+    tokenconfig = sqlc.arg(token_config)
+WHERE provideridn = sqlc.arg(provider_idn);
@@ -63,4 +63,28 @@ SELECT
 FROM core.project tw
 LEFT JOIN core.tree t ON tw.project_code = t.project_code
 WHERE tw.project_code = sqlc.arg(project_code)
-GROUP BY tw.project_code, tw.project_name, tw.metadata;
\ No newline at end of file
+GROUP BY tw.project_code, tw.project_name, tw.metadata;
+
+-- name: ListProjectTreeRanges :many
+-- Known project codes with the range of tree numbers planted in each
+SELECT
+    p.project_code,
+    COALESCE(MIN(t.tree_number), 0)::int AS min_tree_number,
+    COALESCE(MAX(t.tree_number), 0)::int AS max_tree_number
+FROM core.project p
+LEFT JOIN core.tree t ON t.project_code = p.project_code
+GROUP BY p.project_code
+ORDER BY p.project_code;
+
+-- name: ListTreesByProjectCodesAndNumbers :many
+-- Candidate trees for tree-ID resolution, with the names to match against the sign
+SELECT
+    t.id,
+    t.project_code,
+    t.tree_number,
+    d.donor_name,
+    COALESCE(t.metadata->>'credit_name', '')::text AS credit_name
+FROM core.tree t
+JOIN core.donor d ON t.donor_id = d.id
+WHERE t.project_code = ANY(sqlc.arg(project_codes)::text[])
+    AND t.tree_number = ANY(sqlc.arg(tree_numbers)::int[]);
@@ -1,8 +1,17 @@
 -- name: CreateTreeUpdate :one
--- Insert a new tree update
+-- Insert a new tree update with the capture time, location and tags read from the photo
 INSERT INTO
-    core.tree_update (tree_id, file_id)
-VALUES ($1, $2) ON CONFLICT (file_id) DO
+    core.tree_update (tree_id, file_id, photo_ts, photo_location, property_list)
+VALUES (
+    sqlc.arg(tree_id),
+    sqlc.arg(file_id),
+    sqlc.narg(photo_ts),
+    CASE
+        WHEN sqlc.narg(photo_latitude)::float8 IS NOT NULL AND sqlc.narg(photo_longitude)::float8 IS NOT NULL
+        THEN ST_SetSRID(ST_MakePoint(sqlc.narg(photo_longitude)::float8, sqlc.narg(photo_latitude)::float8), 4326)::geography
+    END,
+    sqlc.arg(property_list)
+) ON CONFLICT (file_id) DO
 UPDATE
 SET
     file_id = EXCLUDED.file_id RETURNING tree_id,
@@ -17,4 +26,63 @@ FROM core.tree_update tu
 WHERE
     tu.tree_id = $1
 ORDER BY tu.update_date DESC
-LIMIT 1;
\ No newline at end of file
+LIMIT 1;
+
+-- name: CheckTreeUpdateGeofence :one
+-- Compare a linked photo's location with its tree's, using the project's radius from the PhotoGeofence config
+WITH cfg AS (
+    SELECT COALESCE(
+        (SELECT c.ConfigValue FROM core.U_Config AS c WHERE c.ConfigName = 'PhotoGeofence'),
+        '{}'::jsonb
+    ) AS v
+), checked AS (
+    SELECT
+        tu.file_id,
+        ST_Distance(tu.photo_location, t.tree_location) AS distance_m,
+        COALESCE(
+            (cfg.v->'project_radius_m'->>t.project_code::text)::float8,
+            (cfg.v->>'default_radius_m')::float8,
+            sqlc.arg(default_radius_m)::float8
+        ) AS radius_m
+    FROM core.tree_update AS tu
+        JOIN core.tree AS t ON t.id = tu.tree_id
+        CROSS JOIN cfg
+    WHERE tu.file_id = sqlc.arg(file_id)
+)
+UPDATE core.tree_update AS tu
+SET
+    distance_m = c.distance_m,
+    geofence_radius_m = c.radius_m,
+    geofence_status = CASE
+        WHEN c.distance_m IS NULL THEN 'no_gps'
+        WHEN c.distance_m > c.radius_m THEN 'far'
+        ELSE 'ok'
+    END
+FROM checked AS c
+WHERE tu.file_id = c.file_id
+RETURNING tu.geofence_status::text, tu.distance_m, tu.geofence_radius_m::float8;
+
+-- name: ListGeofenceFlaggedTreeUpdates :many
+-- Photos taken away from their tree or without GPS, newest first
+SELECT
+    tu.tree_id,
+    t.project_code,
+    t.tree_number,
+    d.donor_name,
+    tu.update_date,
+    tu.photo_ts,
+    tu.geofence_status::text AS geofence_status,
+    tu.distance_m,
+    tu.geofence_radius_m,
+    f.file_url,
+    tf.file_url AS thumbnail_url
+FROM core.tree_update AS tu
+    JOIN core.tree AS t ON t.id = tu.tree_id
+    JOIN core.donor AS d ON d.id = t.donor_id
+    JOIN core.file AS f ON f.id = tu.file_id
+    LEFT JOIN core.file_derivative AS td ON td.source_file_id = f.id AND td.variant = 'thumbnail'
+    LEFT JOIN core.file AS tf ON tf.id = td.file_id
+WHERE tu.geofence_status = ANY(sqlc.arg(statuses)::text[])
+    AND tu.update_date >= sqlc.arg(since)
+ORDER BY tu.update_date DESC
+LIMIT sqlc.arg(row_limit);
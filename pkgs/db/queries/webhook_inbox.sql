@@ -0,0 +1,68 @@
+-- name: EnqueueWebhook :one
+-- Persist a raw webhook payload for asynchronous processing
+INSERT INTO core.webhook_inbox (payload)
+VALUES ($1)
+RETURNING id;
+
+-- name: ClaimWebhookInbox :one
+-- Claim the oldest ready inbox row, including rows abandoned by a crashed worker
+UPDATE core.webhook_inbox
+SET
+    status = 'processing',
+    attempts = attempts + 1,
+    locked_at = CURRENT_TIMESTAMP
+WHERE id = (
+    SELECT wi.id
+    FROM core.webhook_inbox AS wi
+    WHERE (wi.status = 'pending' AND wi.next_attempt_at <= CURRENT_TIMESTAMP)
+        OR (wi.status = 'processing' AND wi.locked_at < sqlc.arg(stale_before))
+    ORDER BY wi.received_at
+    LIMIT 1
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING *;
+
+-- name: CompleteWebhookInbox :exec
+UPDATE core.webhook_inbox
+SET
+    status = 'done',
+    last_error = NULL,
+    locked_at = NULL,
+    processed_at = CURRENT_TIMESTAMP
+WHERE id = sqlc.arg(id);
+
+-- name: FailWebhookInbox :exec
+-- Record a failed attempt, either rescheduling it or moving it to the dead-letter state
+UPDATE core.webhook_inbox
+SET
+    status = sqlc.arg(status),
+    last_error = sqlc.arg(last_error),
+    next_attempt_at = sqlc.arg(next_attempt_at),
+    locked_at = NULL
+WHERE id = sqlc.arg(id);
+
+-- name: RequeueWebhookInbox :execrows
+-- Move a dead-lettered row back to pending with a fresh attempt budget
+UPDATE core.webhook_inbox
+SET
+    status = 'pending',
+    attempts = 0,
+    next_attempt_at = CURRENT_TIMESTAMP,
+    locked_at = NULL
+WHERE id = sqlc.arg(id) AND status = 'dead';
+
+-- name: GetWebhookInboxStats :many
+SELECT
+    status,
+    COUNT(*) AS item_count,
+    MIN(received_at)::timestamptz AS oldest_received_at
+FROM core.webhook_inbox
+GROUP BY status
+ORDER BY status;
+
+-- name: ListWebhookInboxByStatus :many
+SELECT id, status, attempts, last_error, received_at, next_attempt_at
+FROM core.webhook_inbox
+WHERE status = sqlc.arg(status)
+ORDER BY received_at DESC
+LIMIT sqlc.arg(row_limit);
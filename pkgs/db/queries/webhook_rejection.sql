@@ -0,0 +1,4 @@
+-- name: RecordWebhookRejection :exec
+-- Audit a webhook delivery that failed signature verification
+INSERT INTO core.webhook_rejection (reason, signature, remote_addr, payload)
+VALUES (sqlc.arg(reason), sqlc.narg(signature), sqlc.narg(remote_addr), sqlc.arg(payload));
@@ -0,0 +1,12 @@
+-- name: ClaimWhatsappMessage :execrows
+-- Claim a message for ingestion. No row is inserted when the message, or the
+-- same media under another message ID, is already claimed; a claim still
+-- being ingested blocks until its transaction ends.
+INSERT INTO core.whatsapp_message (message_id, media_sha256, sender, message_type)
+VALUES (sqlc.arg(message_id), sqlc.narg(media_sha256), sqlc.arg(sender), sqlc.arg(message_type))
+ON CONFLICT DO NOTHING;
+
+-- name: DeleteWhatsappMessagesBefore :execrows
+-- Retention cleanup for the processed-message ledger
+DELETE FROM core.whatsapp_message
+WHERE processed_at < sqlc.arg(cutoff);
@@ -224,3 +224,94 @@ func (q *Queries) GetTreeByProjectCodeAndNumber(ctx context.Context, arg GetTree
 	)
 	return i, err
 }
+
+const listProjectTreeRanges = `-- name: ListProjectTreeRanges :many
+SELECT
+    p.project_code,
+    COALESCE(MIN(t.tree_number), 0)::int AS min_tree_number,
+    COALESCE(MAX(t.tree_number), 0)::int AS max_tree_number
+FROM core.project p
+LEFT JOIN core.tree t ON t.project_code = p.project_code
+GROUP BY p.project_code
+ORDER BY p.project_code
+`
+
+type ListProjectTreeRangesRow struct {
+	ProjectCode   string `json:"project_code"`
+	MinTreeNumber int32  `json:"min_tree_number"`
+	MaxTreeNumber int32  `json:"max_tree_number"`
+}
+
+// Known project codes with the range of tree numbers planted in each
+func (q *Queries) ListProjectTreeRanges(ctx context.Context) ([]ListProjectTreeRangesRow, error) {
+	rows, err := q.db.Query(ctx, listProjectTreeRanges)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListProjectTreeRangesRow{}
+	for rows.Next() {
+		var i ListProjectTreeRangesRow
+		if err := rows.Scan(&i.ProjectCode, &i.MinTreeNumber, &i.MaxTreeNumber); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listTreesByProjectCodesAndNumbers = `-- name: ListTreesByProjectCodesAndNumbers :many
+SELECT
+    t.id,
+    t.project_code,
+    t.tree_number,
+    d.donor_name,
+    COALESCE(t.metadata->>'credit_name', '')::text AS credit_name
+FROM core.tree t
+JOIN core.donor d ON t.donor_id = d.id
+WHERE t.project_code = ANY($1::text[])
+    AND t.tree_number = ANY($2::int[])
+`
+
+type ListTreesByProjectCodesAndNumbersParams struct {
+	ProjectCodes []string `json:"project_codes"`
+	TreeNumbers  []int32  `json:"tree_numbers"`
+}
+
+type ListTreesByProjectCodesAndNumbersRow struct {
+	ID          string `json:"id"`
+	ProjectCode string `json:"project_code"`
+	TreeNumber  int32  `json:"tree_number"`
+	DonorName   string `json:"donor_name"`
+	CreditName  string `json:"credit_name"`
+}
+
+// Candidate trees for tree-ID resolution, with the names to match against the sign
+func (q *Queries) ListTreesByProjectCodesAndNumbers(ctx context.Context, arg ListTreesByProjectCodesAndNumbersParams) ([]ListTreesByProjectCodesAndNumbersRow, error) {
+	rows, err := q.db.Query(ctx, listTreesByProjectCodesAndNumbers, arg.ProjectCodes, arg.TreeNumbers)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListTreesByProjectCodesAndNumbersRow{}
+	for rows.Next() {
+		var i ListTreesByProjectCodesAndNumbersRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.ProjectCode,
+			&i.TreeNumber,
+			&i.DonorName,
+			&i.CreditName,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
@@ -11,10 +11,72 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+const checkTreeUpdateGeofence = `-- name: CheckTreeUpdateGeofence :one
+WITH cfg AS (
+    SELECT COALESCE(
+        (SELECT c.ConfigValue FROM core.U_Config AS c WHERE c.ConfigName = 'PhotoGeofence'),
+        '{}'::jsonb
+    ) AS v
+), checked AS (
+    SELECT
+        tu.file_id,
+        ST_Distance(tu.photo_location, t.tree_location) AS distance_m,
+        COALESCE(
+            (cfg.v->'project_radius_m'->>t.project_code::text)::float8,
+            (cfg.v->>'default_radius_m')::float8,
+            $1::float8
+        ) AS radius_m
+    FROM core.tree_update AS tu
+        JOIN core.tree AS t ON t.id = tu.tree_id
+        CROSS JOIN cfg
+    WHERE tu.file_id = $2
+)
+UPDATE core.tree_update AS tu
+SET
+    distance_m = c.distance_m,
+    geofence_radius_m = c.radius_m,
+    geofence_status = CASE
+        WHEN c.distance_m IS NULL THEN 'no_gps'
+        WHEN c.distance_m > c.radius_m THEN 'far'
+        ELSE 'ok'
+    END
+FROM checked AS c
+WHERE tu.file_id = c.file_id
+RETURNING tu.geofence_status::text, tu.distance_m, tu.geofence_radius_m::float8
+`
+
+type CheckTreeUpdateGeofenceParams struct {
+	DefaultRadiusM float64 `json:"default_radius_m"`
+	FileID         string  `json:"file_id"`
+}
+
+type CheckTreeUpdateGeofenceRow struct {
+	TuGeofenceStatus  string        `json:"tu_geofence_status"`
+	DistanceM         pgtype.Float8 `json:"distance_m"`
+	TuGeofenceRadiusM float64       `json:"tu_geofence_radius_m"`
+}
+
+// Compare a linked photo's location with its tree's, using the project's radius from the PhotoGeofence config
+func (q *Queries) CheckTreeUpdateGeofence(ctx context.Context, arg CheckTreeUpdateGeofenceParams) (CheckTreeUpdateGeofenceRow, error) {
+	row := q.db.QueryRow(ctx, checkTreeUpdateGeofence, arg.DefaultRadiusM, arg.FileID)
+	var i CheckTreeUpdateGeofenceRow
+	err := row.Scan(&i.TuGeofenceStatus, &i.DistanceM, &i.TuGeofenceRadiusM)
+	return i, err
+}
+
 const createTreeUpdate = `-- name: CreateTreeUpdate :one
 INSERT INTO
-    core.tree_update (tree_id, file_id)
-VALUES ($1, $2) ON CONFLICT (file_id) DO
+    core.tree_update (tree_id, file_id, photo_ts, photo_location, property_list)
+VALUES (
+    $1,
+    $2,
+    $3,
+    CASE
+        WHEN $4::float8 IS NOT NULL AND $5::float8 IS NOT NULL
+        THEN ST_SetSRID(ST_MakePoint($5::float8, $4::float8), 4326)::geography
+    END,
+    $6
+) ON CONFLICT (file_id) DO
 UPDATE
 SET
     file_id = EXCLUDED.file_id RETURNING tree_id,
@@ -23,14 +85,31 @@ SET
 `
 
 type CreateTreeUpdateParams struct {
-	TreeID string `json:"tree_id"`
-	FileID string `json:"file_id"`
+	TreeID         string             `json:"tree_id"`
+	FileID         string             `json:"file_id"`
+	PhotoTs        pgtype.Timestamptz `json:"photo_ts"`
+	PhotoLatitude  pgtype.Float8      `json:"photo_latitude"`
+	PhotoLongitude pgtype.Float8      `json:"photo_longitude"`
+	PropertyList   []byte             `json:"property_list"`
 }
 
-// Insert a new tree update
-func (q *Queries) CreateTreeUpdate(ctx context.Context, arg CreateTreeUpdateParams) (CoreTreeUpdate, error) {
-	row := q.db.QueryRow(ctx, createTreeUpdate, arg.TreeID, arg.FileID)
-	var i CoreTreeUpdate
+type CreateTreeUpdateRow struct {
+	TreeID     string             `json:"tree_id"`
+	UpdateDate pgtype.Timestamptz `json:"update_date"`
+	FileID     string             `json:"file_id"`
+}
+
+// Insert a new tree update with the capture time, location and tags read from the photo
+func (q *Queries) CreateTreeUpdate(ctx context.Context, arg CreateTreeUpdateParams) (CreateTreeUpdateRow, error) {
+	row := q.db.QueryRow(ctx, createTreeUpdate,
+		arg.TreeID,
+		arg.FileID,
+		arg.PhotoTs,
+		arg.PhotoLatitude,
+		arg.PhotoLongitude,
+		arg.PropertyList,
+	)
+	var i CreateTreeUpdateRow
 	err := row.Scan(&i.TreeID, &i.UpdateDate, &i.FileID)
 	return i, err
 }
@@ -74,3 +153,81 @@ func (q *Queries) GetLatestTreeUpdate(ctx context.Context, treeID string) (GetLa
 	)
 	return i, err
 }
+
+const listGeofenceFlaggedTreeUpdates = `-- name: ListGeofenceFlaggedTreeUpdates :many
+SELECT
+    tu.tree_id,
+    t.project_code,
+    t.tree_number,
+    d.donor_name,
+    tu.update_date,
+    tu.photo_ts,
+    tu.geofence_status::text AS geofence_status,
+    tu.distance_m,
+    tu.geofence_radius_m,
+    f.file_url,
+    tf.file_url AS thumbnail_url
+FROM core.tree_update AS tu
+    JOIN core.tree AS t ON t.id = tu.tree_id
+    JOIN core.donor AS d ON d.id = t.donor_id
+    JOIN core.file AS f ON f.id = tu.file_id
+    LEFT JOIN core.file_derivative AS td ON td.source_file_id = f.id AND td.variant = 'thumbnail'
+    LEFT JOIN core.file AS tf ON tf.id = td.file_id
+WHERE tu.geofence_status = ANY($1::text[])
+    AND tu.update_date >= $2
+ORDER BY tu.update_date DESC
+LIMIT $3
+`
+
+type ListGeofenceFlaggedTreeUpdatesParams struct {
+	Statuses []string           `json:"statuses"`
+	Since    pgtype.Timestamptz `json:"since"`
+	RowLimit int32              `json:"row_limit"`
+}
+
+type ListGeofenceFlaggedTreeUpdatesRow struct {
+	TreeID          string             `json:"tree_id"`
+	ProjectCode     string             `json:"project_code"`
+	TreeNumber      int32              `json:"tree_number"`
+	DonorName       string             `json:"donor_name"`
+	UpdateDate      pgtype.Timestamptz `json:"update_date"`
+	PhotoTs         pgtype.Timestamptz `json:"photo_ts"`
+	GeofenceStatus  string             `json:"geofence_status"`
+	DistanceM       pgtype.Float8      `json:"distance_m"`
+	GeofenceRadiusM pgtype.Float8      `json:"geofence_radius_m"`
+	FileUrl         pgtype.Text        `json:"file_url"`
+	ThumbnailUrl    pgtype.Text        `json:"thumbnail_url"`
+}
+
+// Photos taken away from their tree or without GPS, newest first
+func (q *Queries) ListGeofenceFlaggedTreeUpdates(ctx context.Context, arg ListGeofenceFlaggedTreeUpdatesParams) ([]ListGeofenceFlaggedTreeUpdatesRow, error) {
+	rows, err := q.db.Query(ctx, listGeofenceFlaggedTreeUpdates, arg.Statuses, arg.Since, arg.RowLimit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListGeofenceFlaggedTreeUpdatesRow{}
+	for rows.Next() {
+		var i ListGeofenceFlaggedTreeUpdatesRow
+		if err := rows.Scan(
+			&i.TreeID,
+			&i.ProjectCode,
+			&i.TreeNumber,
+			&i.DonorName,
+			&i.UpdateDate,
+			&i.PhotoTs,
+			&i.GeofenceStatus,
+			&i.DistanceM,
+			&i.GeofenceRadiusM,
+			&i.FileUrl,
+			&i.ThumbnailUrl,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
@@ -0,0 +1,176 @@
+package donorupdate
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"mime"
+	"net/smtp"
+	"strings"
+
+	"sadbhavana/tree-project/pkgs/conf"
+	"sadbhavana/tree-project/pkgs/whatsapp"
+)
+
+// Channel delivers a rendered donor notification
+type Channel interface {
+	Name() string
+	Send(ctx context.Context, n Notification) error
+}
+
+const (
+	ChannelLog      = "log"
+	ChannelWhatsapp = "whatsapp"
+	ChannelEmail    = "email"
+)
+
+// NewChannel builds the delivery channel configured by name
+func NewChannel(name string, cfg *conf.Config) (Channel, error) {
+	switch name {
+	case ChannelLog:
+		return &LogChannel{}, nil
+	case ChannelWhatsapp:
+		sender, err := whatsapp.NewSender(cfg.WhatsappConfig)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create WhatsApp sender: %w", err)
+		}
+		return &WhatsappChannel{
+			sender:   sender,
+			template: cfg.DonorUpdate.WhatsappTemplate,
+			language: cfg.DonorUpdate.WhatsappTemplateLanguage,
+		}, nil
+	case ChannelEmail:
+		if cfg.EmailConfig.SMTPHost == "" || cfg.EmailConfig.FromAddress == "" {
+			return nil, fmt.Errorf("SMTP_HOST and EMAIL_FROM_ADDRESS are required for the email channel")
+		}
+		return &EmailChannel{config: cfg.EmailConfig}, nil
+	default:
+		return nil, fmt.Errorf("unsupported donor update channel: %s", name)
+	}
+}
+
+// LogChannel only logs notifications, useful for dry runs
+type LogChannel struct{}
+
+func (c *LogChannel) Name() string {
+	return ChannelLog
+}
+
+func (c *LogChannel) Send(ctx context.Context, n Notification) error {
+	log.Printf("Donor update %d for %s (%s): %s", n.Update.Idn, n.Update.DonorName, n.Update.TreeId, n.Body)
+	return nil
+}
+
+// WhatsappChannel sends the tree photo through an approved message template.
+// Donors have not messaged the business number, so free-form messages to
+// them fall outside WhatsApp's 24-hour window and are rejected.
+type WhatsappChannel struct {
+	sender   *whatsapp.Sender
+	template string
+	language string
+}
+
+func (c *WhatsappChannel) Name() string {
+	return ChannelWhatsapp
+}
+
+func (c *WhatsappChannel) Send(ctx context.Context, n Notification) error {
+	to := normalizeMobile(n.Update.DonorMobile)
+	if to == "" {
+		return fmt.Errorf("donor %s has no mobile number", n.Update.DonorName)
+	}
+	if n.PhotoURL == "" {
+		return fmt.Errorf("donor update %d has no photo link to send", n.Update.Idn)
+	}
+
+	_, err := c.sender.SendTemplate(ctx, to, c.photoTemplate(n))
+	return err
+}
+
+// photoTemplate fills the template: the photo as the header image, then the
+// donor's name, the tree ID and the name the tree was planted in
+func (c *WhatsappChannel) photoTemplate(n Notification) whatsapp.OutboundTemplate {
+	creditName := n.Update.CreditName
+	if creditName == "" {
+		creditName = n.Update.DonorName
+	}
+	return whatsapp.OutboundTemplate{
+		Name:     c.template,
+		Language: whatsapp.TemplateLanguage{Code: c.language},
+		Components: []whatsapp.TemplateComponent{
+			{
+				Type: "header",
+				Parameters: []whatsapp.TemplateParameter{
+					{Type: "image", Image: &whatsapp.OutboundMedia{Link: n.PhotoURL}},
+				},
+			},
+			{
+				Type: "body",
+				Parameters: []whatsapp.TemplateParameter{
+					{Type: "text", Text: n.Update.DonorName},
+					{Type: "text", Text: n.Update.TreeId},
+					{Type: "text", Text: creditName},
+				},
+			},
+		},
+	}
+}
+
+// normalizeMobile strips formatting from a stored number, e.g. "+91-9999888877"
+// becomes "919999888877" as expected by the Graph API
+func normalizeMobile(mobile string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, mobile)
+}
+
+// EmailChannel sends the notification over SMTP
+type EmailChannel struct {
+	config conf.EmailConfig
+}
+
+func (c *EmailChannel) Name() string {
+	return ChannelEmail
+}
+
+func (c *EmailChannel) Send(ctx context.Context, n Notification) error {
+	if n.Update.DonorEmail == "" {
+		return fmt.Errorf("donor %s has no email address", n.Update.DonorName)
+	}
+
+	msg := emailMessage(c.config.FromAddress, n)
+
+	var auth smtp.Auth
+	if c.config.SMTPUser != "" {
+		auth = smtp.PlainAuth("", c.config.SMTPUser, c.config.SMTPPassword, c.config.SMTPHost)
+	}
+	addr := fmt.Sprintf("%s:%d", c.config.SMTPHost, c.config.SMTPPort)
+	return smtp.SendMail(addr, auth, c.config.FromAddress, []string{n.Update.DonorEmail}, msg)
+}
+
+// emailMessage formats the notification as a plain-text email. Header values
+// come from donor records, so line breaks are removed from them and the
+// subject is encoded, keeping them from adding headers of their own.
+func emailMessage(from string, n Notification) []byte {
+	body := n.Body
+	if n.PhotoURL != "" {
+		body += "\r\n\r\n" + n.PhotoURL
+	}
+	return []byte(strings.Join([]string{
+		"From: " + headerValue(from),
+		"To: " + headerValue(n.Update.DonorEmail),
+		"Subject: " + mime.QEncoding.Encode("UTF-8", headerValue(n.Subject)),
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=UTF-8",
+		"",
+		body,
+	}, "\r\n"))
+}
+
+// headerValue folds any line breaks in a header value into spaces
+func headerValue(v string) string {
+	return strings.Join(strings.Fields(v), " ")
+}
@@ -0,0 +1,53 @@
+package donorupdate
+
+import (
+	"sadbhavana/tree-project/pkgs/db"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeMobile(t *testing.T) {
+	assert.Equal(t, "919999888877", normalizeMobile("+91-9999888877"))
+	assert.Equal(t, "16505551234", normalizeMobile("1 (650) 555-1234"))
+	assert.Equal(t, "", normalizeMobile(""))
+}
+
+func TestEmailMessage_HeaderInjection(t *testing.T) {
+	n := Notification{
+		Update:  db.DbDonorUpdate{DonorEmail: "donor@example.org\r\nBcc: victim@example.org"},
+		Subject: "Your tree\r\nBcc: victim@example.org",
+		Body:    "Hello",
+	}
+	msg := string(emailMessage("trees@example.org", n))
+
+	headers, body, found := strings.Cut(msg, "\r\n\r\n")
+	assert.True(t, found)
+	assert.Equal(t, "Hello", body)
+	for _, line := range strings.Split(headers, "\r\n") {
+		assert.False(t, strings.HasPrefix(line, "Bcc:"), line)
+	}
+	assert.Contains(t, headers, "To: donor@example.org Bcc: victim@example.org")
+}
+
+func TestPhotoTemplate(t *testing.T) {
+	c := &WhatsappChannel{template: "tree_photo_update", language: "en"}
+	n := Notification{
+		Update:   db.DbDonorUpdate{DonorName: "Asha", TreeId: "AB000123"},
+		PhotoURL: "https://trees.example.org/photo.jpg",
+	}
+
+	tmpl := c.photoTemplate(n)
+	assert.Equal(t, "tree_photo_update", tmpl.Name)
+	assert.Equal(t, "en", tmpl.Language.Code)
+	assert.Len(t, tmpl.Components, 2)
+	assert.Equal(t, "https://trees.example.org/photo.jpg", tmpl.Components[0].Parameters[0].Image.Link)
+
+	// Without a credit name the tree is credited to the donor
+	var texts []string
+	for _, p := range tmpl.Components[1].Parameters {
+		texts = append(texts, p.Text)
+	}
+	assert.Equal(t, []string{"Asha", "AB000123", "Asha"}, texts)
+}
@@ -0,0 +1,152 @@
+package donorupdate
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"sadbhavana/tree-project/pkgs/db"
+	"sadbhavana/tree-project/pkgs/file"
+	"sadbhavana/tree-project/pkgs/locker"
+)
+
+const (
+	lockKey = "dispatcher"
+	// lockTTL only has to outlast one send; RunOnce refreshes it before each
+	lockTTL = 10 * time.Minute
+)
+
+// Dispatcher drains the donor update outbox (GetDonorUpdate, then any due
+// retries from GetDonorUpdateRetry), sends each notification through its
+// channel and posts the outcome back (PostDonorUpdate). A Redis lock makes
+// sure only one instance sends at a time.
+type Dispatcher struct {
+	channel         Channel
+	locker          *locker.RedisLocker
+	batchSize       int
+	photoBaseURL    string
+	photoLinkExpiry time.Duration
+}
+
+func NewDispatcher(channel Channel, lck *locker.RedisLocker, batchSize int, photoBaseURL string, photoLinkExpiry time.Duration) *Dispatcher {
+	return &Dispatcher{
+		channel:         channel,
+		locker:          lck,
+		batchSize:       batchSize,
+		photoBaseURL:    photoBaseURL,
+		photoLinkExpiry: photoLinkExpiry,
+	}
+}
+
+// BatchResult summarises one dispatched batch
+type BatchResult struct {
+	Sent      int
+	Failed    int
+	Abandoned int // Failed sends that reached the maximum number of attempts
+}
+
+// RunOnce dispatches a single batch. It returns a zero result without error
+// when another instance holds the lock or there is nothing to send.
+func (d *Dispatcher) RunOnce(ctx context.Context) (BatchResult, error) {
+	var result BatchResult
+
+	ttl := lockTTL
+	lock, err := d.locker.Obtain(ctx, lockKey, &ttl)
+	if err != nil {
+		return result, fmt.Errorf("failed to obtain donor update lock: %w", err)
+	}
+	if lock == nil {
+		log.Println("Donor update dispatcher is running elsewhere, skipping batch")
+		return result, nil
+	}
+	defer lock.Release(context.WithoutCancel(ctx))
+
+	q, err := db.NewQueries(ctx)
+	if err != nil {
+		return result, fmt.Errorf("failed to get database queries: %w", err)
+	}
+
+	updates, err := db.GetDonorUpdate(ctx, q, db.GetDonorUpdateInput{BatchSize: d.batchSize})
+	if err != nil {
+		return result, fmt.Errorf("failed to get donor updates: %w", err)
+	}
+
+	// Previously failed sends whose backoff has elapsed share the batch
+	if remaining := d.batchSize - len(updates); remaining > 0 {
+		retries, err := db.GetDonorUpdateRetry(ctx, q, db.GetDonorUpdateInput{BatchSize: remaining})
+		if err != nil {
+			return result, fmt.Errorf("failed to get donor update retries: %w", err)
+		}
+		updates = append(updates, retries...)
+	}
+	if len(updates) == 0 {
+		return result, nil
+	}
+
+	statuses := make([]db.PostDonorUpdateInput, 0, len(updates))
+	var lockErr error
+	for _, update := range updates {
+		// Hold the lock for as long as the sends take. Once it has lapsed
+		// another instance may send the same updates, so stop; the unsent
+		// ones are still pending for the next batch.
+		if err := lock.Refresh(ctx, lockTTL, nil); err != nil {
+			lockErr = fmt.Errorf("lost donor update lock after %d sends: %w", len(statuses), err)
+			break
+		}
+		status := db.PostDonorUpdateInput{Idn: update.Idn, SendStatus: "sent"}
+		if err := d.channel.Send(ctx, Render(update, d.photoURL(ctx, q, update))); err != nil {
+			log.Printf("Failed to send donor update %d via %s (attempt %d): %v", update.Idn, d.channel.Name(), update.AttemptCnt+1, err)
+			status.SendStatus = "failed"
+			status.ErrorMsg = err.Error()
+			result.Failed++
+		} else {
+			result.Sent++
+		}
+		statuses = append(statuses, status)
+	}
+
+	// Post back even if we are shutting down so sent notifications are not resent
+	resp, err := db.PostDonorUpdate(context.WithoutCancel(ctx), q, statuses)
+	if err != nil {
+		return result, fmt.Errorf("failed to post donor update status: %w", err)
+	}
+	result.Abandoned = resp.AbandonedCount
+
+	log.Printf("Donor update batch via %s: %d sent, %d failed (%d abandoned)", d.channel.Name(), result.Sent, result.Failed, result.Abandoned)
+	return result, lockErr
+}
+
+// photoURL links to an update's photo through the file store holding it. The
+// update is still sent without a photo when no link can be made.
+func (d *Dispatcher) photoURL(ctx context.Context, q *db.Queries, update db.DbDonorUpdate) string {
+	if update.FileName == "" {
+		return ""
+	}
+	link, err := file.ShareURL(ctx, q, photoFile(update), d.photoLinkExpiry)
+	if err != nil {
+		log.Printf("Failed to link photo of donor update %d: %v", update.Idn, err)
+		return ""
+	}
+	return absoluteURL(link, d.photoBaseURL)
+}
+
+// Run dispatches batches until ctx is cancelled. Full batches are followed
+// immediately by the next one; otherwise it waits for interval.
+func (d *Dispatcher) Run(ctx context.Context, interval time.Duration) {
+	for {
+		result, err := d.RunOnce(ctx)
+		if err != nil {
+			log.Printf("Donor update dispatcher: %v", err)
+		}
+		if err == nil && result.Sent+result.Failed >= d.batchSize {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
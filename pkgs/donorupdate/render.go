@@ -0,0 +1,79 @@
+package donorupdate
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+
+	"sadbhavana/tree-project/pkgs/db"
+	"sadbhavana/tree-project/pkgs/file"
+)
+
+// Notification is a donor update rendered for delivery
+type Notification struct {
+	Update   db.DbDonorUpdate
+	Subject  string
+	Body     string
+	PhotoURL string
+}
+
+// Render builds the per-donor message for a photo update, linking to the
+// photo at photoURL when it is set
+func Render(update db.DbDonorUpdate, photoURL string) Notification {
+	name := update.CreditName
+	if name == "" {
+		name = update.DonorName
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Dear %s,\n\n", update.DonorName)
+	fmt.Fprintf(&b, "There is a new photo of tree %s", update.TreeId)
+	if update.CreditName != "" {
+		fmt.Fprintf(&b, ", planted in the name of %s", update.CreditName)
+	}
+	if update.ProjectName != "" {
+		fmt.Fprintf(&b, " at %s", update.ProjectName)
+	}
+	b.WriteString(".\n\nThank you for helping us grow a greener future.\nSadbhavana")
+
+	return Notification{
+		Update:   update,
+		Subject:  fmt.Sprintf("A new photo of %s's tree %s", name, update.TreeId),
+		Body:     b.String(),
+		PhotoURL: photoURL,
+	}
+}
+
+// photoFile locates an update's photo in the file store it was saved to
+func photoFile(update db.DbDonorUpdate) file.FileInfo {
+	return file.FileInfo{
+		FileStore: update.FileStore,
+		FileID:    update.FileStoreId,
+		FilePath:  path.Join(update.FilePath, update.FileName),
+		FileName:  update.FileName,
+	}
+}
+
+// absoluteURL makes a link from the file layer absolute. Stores that serve
+// files themselves, like S3, give absolute links; locally stored files are
+// served by this site, so they are only linked when its base URL is known.
+func absoluteURL(link, baseURL string) string {
+	u, err := url.Parse(link)
+	if err != nil || link == "" {
+		return ""
+	}
+	if u.IsAbs() {
+		return link
+	}
+	if baseURL == "" {
+		return ""
+	}
+	base, err := url.Parse(baseURL)
+	if err != nil {
+		return ""
+	}
+	base.Path = path.Join(base.Path, u.Path)
+	base.RawQuery = u.RawQuery
+	return base.String()
+}
@@ -0,0 +1,55 @@
+package donorupdate
+
+import (
+	"testing"
+
+	"sadbhavana/tree-project/pkgs/db"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRender(t *testing.T) {
+	update := db.DbDonorUpdate{
+		Idn:         1,
+		TreeId:      "TESTDONOR000001",
+		CreditName:  "Asha Mehta",
+		DonorName:   "Test Donor",
+		ProjectName: "Test Donor Notification Project",
+		FilePath:    "/test/photos",
+		FileName:    "tree_001.jpg",
+	}
+
+	n := Render(update, "https://trees.example.org/files/test/photos/tree_001.jpg?expires=1&signature=x")
+	assert.Contains(t, n.Body, "Dear Test Donor")
+	assert.Contains(t, n.Body, "TESTDONOR000001")
+	assert.Contains(t, n.Body, "in the name of Asha Mehta")
+	assert.Contains(t, n.Body, "at Test Donor Notification Project")
+	assert.Contains(t, n.Subject, "Asha Mehta")
+	assert.Equal(t, "https://trees.example.org/files/test/photos/tree_001.jpg?expires=1&signature=x", n.PhotoURL)
+
+	n = Render(update, "")
+	assert.Empty(t, n.PhotoURL)
+}
+
+func TestPhotoFile(t *testing.T) {
+	f := photoFile(db.DbDonorUpdate{
+		FileStore:   "s3",
+		FileStoreId: "trees/whatsapp/tree_001.jpg",
+		FilePath:    "/test/photos",
+		FileName:    "tree_001.jpg",
+	})
+	assert.Equal(t, "s3", f.FileStore)
+	assert.Equal(t, "trees/whatsapp/tree_001.jpg", f.FileID)
+	assert.Equal(t, "/test/photos/tree_001.jpg", f.FilePath)
+}
+
+func TestAbsoluteURL(t *testing.T) {
+	local := "/files/blobs/ab/cd/abcd?expires=1&signature=x"
+	assert.Equal(t, "https://trees.example.org/files/blobs/ab/cd/abcd?expires=1&signature=x", absoluteURL(local, "https://trees.example.org"))
+	assert.Equal(t, "https://example.org/trees/files/blobs/ab/cd/abcd?expires=1&signature=x", absoluteURL(local, "https://example.org/trees/"))
+	assert.Empty(t, absoluteURL(local, ""), "local links need the site's address")
+
+	presigned := "https://photos.s3.amazonaws.com/trees/ab17.jpg?X-Amz-Signature=x"
+	assert.Equal(t, presigned, absoluteURL(presigned, ""))
+	assert.Empty(t, absoluteURL("", "https://trees.example.org"))
+}
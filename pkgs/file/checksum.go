@@ -0,0 +1,41 @@
+package file
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+)
+
+// hashingReader computes the SHA-256 and length of everything read through
+// it, so uploads are checksummed while they stream
+type hashingReader struct {
+	r    io.Reader
+	hash hash.Hash
+	size int64
+}
+
+func newHashingReader(r io.Reader) *hashingReader {
+	return &hashingReader{r: r, hash: sha256.New()}
+}
+
+func (h *hashingReader) Read(p []byte) (int, error) {
+	n, err := h.r.Read(p)
+	h.hash.Write(p[:n])
+	h.size += int64(n)
+	return n, err
+}
+
+// Sum is the hex SHA-256 of the data read so far
+func (h *hashingReader) Sum() string {
+	return hex.EncodeToString(h.hash.Sum(nil))
+}
+
+// checksum is the hex SHA-256 and length of a stream
+func checksum(r io.Reader) (string, int64, error) {
+	h := newHashingReader(r)
+	if _, err := io.Copy(io.Discard, h); err != nil {
+		return "", h.size, err
+	}
+	return h.Sum(), h.size, nil
+}
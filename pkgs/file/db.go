@@ -33,6 +33,10 @@ func (f *FileInfo) SaveToDB(ctx context.Context, q *db.Queries) (string, bool, e
 	if f.FileName != "" {
 		dbFile.FileName = pgtype.Text{String: f.FileName, Valid: true}
 	}
+	if f.SHA256 != "" {
+		dbFile.Sha256 = pgtype.Text{String: f.SHA256, Valid: true}
+		dbFile.SizeBytes = pgtype.Int8{Int64: f.Size, Valid: true}
+	}
 
 	upsertedFile, err := q.UpsertFile(ctx, dbFile)
 	if err != nil {
@@ -61,5 +65,7 @@ func ExtractFileInfoFromDB(dbFile db.CoreFile) (FileInfo, error) {
 		FileName:   dbFile.FileName.String,
 		MimeType:   mimeType,
 		Expiration: expiration,
+		SHA256:     dbFile.Sha256.String,
+		Size:       dbFile.SizeBytes.Int64,
 	}, nil
 }
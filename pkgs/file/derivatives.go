@@ -0,0 +1,107 @@
+package file
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+
+	"sadbhavana/tree-project/pkgs/db"
+)
+
+// DerivativeOptions controls a backfill of resized copies
+type DerivativeOptions struct {
+	// Folder the copies are saved in, in the source file's store
+	Folder string
+	// BatchSize is the number of file rows read at a time
+	BatchSize int
+	// Limit stops after this many files; 0 backfills them all
+	Limit int
+	Image ImageOptions
+}
+
+// DerivativeResult counts the files a backfill went through
+type DerivativeResult struct {
+	Checked int
+	Created int
+	Failed  int
+}
+
+// BackfillDerivatives makes the missing thumbnail and web-size copies of tree
+// photos stored before copies were made, or whose copies failed. Files that
+// fail are logged and skipped.
+func BackfillDerivatives(ctx context.Context, q *db.Queries, opts DerivativeOptions) (DerivativeResult, error) {
+	var result DerivativeResult
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = defaultMigrateBatchSize
+	}
+	folder := FolderInfo{FolderPath: opts.Folder}
+	stores := map[string]FileStore{}
+
+	var afterID string
+	for opts.Limit == 0 || result.Checked < opts.Limit {
+		batchSize := opts.BatchSize
+		if opts.Limit > 0 {
+			batchSize = min(batchSize, opts.Limit-result.Checked)
+		}
+		rows, err := q.ListFilesMissingDerivatives(ctx, db.ListFilesMissingDerivativesParams{
+			AfterID:  afterID,
+			RowLimit: int32(batchSize),
+		})
+		if err != nil {
+			return result, fmt.Errorf("failed to list files missing derivatives: %w", err)
+		}
+		if len(rows) == 0 {
+			return result, nil
+		}
+
+		for _, row := range rows {
+			if err := ctx.Err(); err != nil {
+				return result, err
+			}
+			afterID = row.ID
+			result.Checked++
+
+			created, err := backfillFile(ctx, q, stores, folder, row, opts.Image)
+			result.Created += created
+			if err != nil {
+				log.Printf("Failed to make derivatives of file %s: %v", row.ID, err)
+				result.Failed++
+			}
+		}
+	}
+	return result, nil
+}
+
+// backfillFile makes the missing copies of one file in the file's own store
+func backfillFile(ctx context.Context, q *db.Queries, stores map[string]FileStore, folder FolderInfo, row db.CoreFile, opts ImageOptions) (int, error) {
+	source, err := ExtractFileInfoFromDB(row)
+	if err != nil {
+		return 0, err
+	}
+	if !source.MimeType.IsImage() {
+		return 0, fmt.Errorf("file is %s, not an image", source.MimeType)
+	}
+
+	store, ok := stores[row.FileStore]
+	if !ok {
+		store, err = OpenFileStore(ctx, q, row.FileStore)
+		if err != nil {
+			return 0, fmt.Errorf("failed to open store %s: %w", row.FileStore, err)
+		}
+		stores[row.FileStore] = store
+	}
+
+	reader, cleanup, err := store.DownloadFile(ctx, source)
+	if err != nil {
+		return 0, fmt.Errorf("failed to download file: %w", err)
+	}
+	data, err := io.ReadAll(reader)
+	cleanup()
+	if err != nil {
+		return 0, fmt.Errorf("failed to read file: %w", err)
+	}
+
+	created, err := StoreDerivatives(ctx, q, store, folder, row.ID, source, data, opts)
+	return len(created), err
+}
@@ -0,0 +1,679 @@
+package file
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"sadbhavana/tree-project/pkgs/db"
+)
+
+// ErrNoImageMetadata is returned for images without EXIF or XMP metadata,
+// and for formats the reader does not understand
+var ErrNoImageMetadata = errors.New("no image metadata")
+
+// maxMetadataBytes bounds how much of an image is read looking for metadata.
+// JPEG and PNG keep it ahead of the pixel data, so this is rarely reached.
+const maxMetadataBytes = 4 << 20
+
+// ImageMetadata is what a photo's EXIF and XMP blocks say about when, where
+// and with what it was taken
+type ImageMetadata struct {
+	CapturedAt *time.Time `json:"captured_at,omitempty"`
+	Latitude   *float64   `json:"latitude,omitempty"`
+	Longitude  *float64   `json:"longitude,omitempty"`
+	Altitude   *float64   `json:"altitude,omitempty"`
+	Make       string     `json:"make,omitempty"`
+	Model      string     `json:"model,omitempty"`
+	Software   string     `json:"software,omitempty"`
+	// Tags holds every tag read, keyed like "EXIF:DateTimeOriginal" or
+	// "XMP:exif:GPSLatitude"
+	Tags map[string]string `json:"tags,omitempty"`
+}
+
+// HasLocation reports whether the photo carries GPS coordinates
+func (m *ImageMetadata) HasLocation() bool {
+	return m != nil && m.Latitude != nil && m.Longitude != nil
+}
+
+// Device is the camera or phone that took the photo, e.g. "Google Pixel 7"
+func (m *ImageMetadata) Device() string {
+	if m == nil {
+		return ""
+	}
+	if m.Make != "" && !strings.HasPrefix(strings.ToLower(m.Model), strings.ToLower(m.Make)) {
+		return strings.TrimSpace(m.Make + " " + m.Model)
+	}
+	return m.Model
+}
+
+// PropertyList is the form stored in photo property lists: the device plus
+// the raw tags
+func (m *ImageMetadata) PropertyList() map[string]any {
+	props := map[string]any{}
+	if m == nil {
+		return props
+	}
+	if device := m.Device(); device != "" {
+		props["device"] = device
+	}
+	if m.Software != "" {
+		props["software"] = m.Software
+	}
+	if m.Altitude != nil {
+		props["altitude"] = *m.Altitude
+	}
+	if len(m.Tags) > 0 {
+		props["image_tags"] = m.Tags
+	}
+	return props
+}
+
+// ApplyTo fills the photo fields of an UploadTreePhoto record
+func (m *ImageMetadata) ApplyTo(input *db.UploadTreePhotoInput) {
+	if m == nil {
+		return
+	}
+	if m.HasLocation() {
+		input.PhotoLatitude = m.Latitude
+		input.PhotoLongitude = m.Longitude
+	}
+	if m.CapturedAt != nil {
+		input.PhotoTs = m.CapturedAt.Format(time.RFC3339)
+	}
+	if input.PhotoPropertyList == nil {
+		input.PhotoPropertyList = map[string]any{}
+	}
+	for k, v := range m.PropertyList() {
+		input.PhotoPropertyList[k] = v
+	}
+}
+
+// ReadImageMetadata extracts EXIF and XMP metadata from a JPEG, PNG or TIFF
+// image. Capture times without a recorded UTC offset are taken as UTC.
+func ReadImageMetadata(data io.Reader) (*ImageMetadata, error) {
+	br := bufio.NewReader(io.LimitReader(data, maxMetadataBytes))
+	magic, err := br.Peek(8)
+	if err != nil && len(magic) < 4 {
+		return nil, ErrNoImageMetadata
+	}
+
+	meta := &ImageMetadata{Tags: map[string]string{}}
+	switch {
+	case bytes.HasPrefix(magic, []byte{0xFF, 0xD8}):
+		err = readJPEGMetadata(br, meta)
+	case bytes.HasPrefix(magic, []byte("\x89PNG\r\n\x1a\n")):
+		err = readPNGMetadata(br, meta)
+	case bytes.HasPrefix(magic, []byte("II*\x00")), bytes.HasPrefix(magic, []byte("MM\x00*")):
+		var raw []byte
+		raw, err = io.ReadAll(br)
+		if err == nil {
+			err = parseTIFF(raw, meta)
+		}
+	default:
+		return nil, ErrNoImageMetadata
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(meta.Tags) == 0 {
+		return nil, ErrNoImageMetadata
+	}
+
+	meta.derive()
+	return meta, nil
+}
+
+var (
+	exifHeader = []byte("Exif\x00\x00")
+	xmpHeader  = []byte("http://ns.adobe.com/xap/1.0/\x00")
+)
+
+// readJPEGMetadata walks the marker segments up to the start of the image
+// data, parsing APP1 EXIF and XMP blocks
+func readJPEGMetadata(r *bufio.Reader, meta *ImageMetadata) error {
+	if _, err := r.Discard(2); err != nil {
+		return err
+	}
+	for {
+		marker, err := r.ReadByte()
+		if err != nil {
+			return nil
+		}
+		if marker != 0xFF {
+			return fmt.Errorf("invalid JPEG marker 0x%02x", marker)
+		}
+		kind, err := r.ReadByte()
+		if err != nil {
+			return nil
+		}
+		switch {
+		case kind == 0xFF:
+			// Fill byte before a marker
+			r.UnreadByte()
+			continue
+		case kind == 0xD8 || kind == 0x01 || (kind >= 0xD0 && kind <= 0xD7):
+			// Markers without a length
+			continue
+		case kind == 0xDA || kind == 0xD9:
+			// Start of scan or end of image: no metadata follows
+			return nil
+		}
+
+		var length uint16
+		if err := binary.Read(r, binary.BigEndian, &length); err != nil || length < 2 {
+			return nil
+		}
+		segment := make([]byte, length-2)
+		if _, err := io.ReadFull(r, segment); err != nil {
+			return nil
+		}
+		if kind != 0xE1 {
+			continue
+		}
+
+		switch {
+		case bytes.HasPrefix(segment, exifHeader):
+			if err := parseTIFF(segment[len(exifHeader):], meta); err != nil {
+				return err
+			}
+		case bytes.HasPrefix(segment, xmpHeader):
+			parseXMP(segment[len(xmpHeader):], meta)
+		}
+	}
+}
+
+// readPNGMetadata reads the eXIf chunk and XMP stored in an iTXt chunk
+func readPNGMetadata(r *bufio.Reader, meta *ImageMetadata) error {
+	if _, err := r.Discard(8); err != nil {
+		return err
+	}
+	for {
+		var header struct {
+			Length uint32
+			Type   [4]byte
+		}
+		if err := binary.Read(r, binary.BigEndian, &header); err != nil {
+			return nil
+		}
+		kind := string(header.Type[:])
+		if kind == "IDAT" || kind == "IEND" {
+			return nil
+		}
+		if header.Length > maxMetadataBytes {
+			return nil
+		}
+		chunk := make([]byte, header.Length+4) // data plus CRC
+		if _, err := io.ReadFull(r, chunk); err != nil {
+			return nil
+		}
+		chunk = chunk[:header.Length]
+
+		switch kind {
+		case "eXIf":
+			if err := parseTIFF(chunk, meta); err != nil {
+				return err
+			}
+		case "iTXt":
+			// keyword \0 compression flag, method, language \0 translated keyword \0 text
+			parts := bytes.SplitN(chunk, []byte{0}, 2)
+			if len(parts) == 2 && string(parts[0]) == "XML:com.adobe.xmp" && len(parts[1]) > 2 && parts[1][0] == 0 {
+				rest := bytes.SplitN(parts[1][2:], []byte{0}, 3)
+				if len(rest) == 3 {
+					parseXMP(rest[2], meta)
+				}
+			}
+		}
+	}
+}
+
+// TIFF tag IDs that point to sub-IFDs
+const (
+	tagExifIFD = 0x8769
+	tagGPSIFD  = 0x8825
+)
+
+var ifd0TagNames = map[uint16]string{
+	0x010E: "ImageDescription",
+	0x010F: "Make",
+	0x0110: "Model",
+	0x0112: "Orientation",
+	0x011A: "XResolution",
+	0x011B: "YResolution",
+	0x0128: "ResolutionUnit",
+	0x0131: "Software",
+	0x0132: "DateTime",
+	0x013B: "Artist",
+	0x8298: "Copyright",
+}
+
+var exifTagNames = map[uint16]string{
+	0x829A: "ExposureTime",
+	0x829D: "FNumber",
+	0x8827: "ISOSpeedRatings",
+	0x9003: "DateTimeOriginal",
+	0x9004: "DateTimeDigitized",
+	0x9010: "OffsetTime",
+	0x9011: "OffsetTimeOriginal",
+	0x9012: "OffsetTimeDigitized",
+	0x9209: "Flash",
+	0x920A: "FocalLength",
+	0x9290: "SubSecTime",
+	0x9291: "SubSecTimeOriginal",
+	0xA002: "PixelXDimension",
+	0xA003: "PixelYDimension",
+	0xA402: "ExposureMode",
+	0xA403: "WhiteBalance",
+	0xA405: "FocalLengthIn35mmFilm",
+	0xA420: "ImageUniqueID",
+	0xA433: "LensMake",
+	0xA434: "LensModel",
+}
+
+var gpsTagNames = map[uint16]string{
+	0x0000: "GPSVersionID",
+	0x0001: "GPSLatitudeRef",
+	0x0002: "GPSLatitude",
+	0x0003: "GPSLongitudeRef",
+	0x0004: "GPSLongitude",
+	0x0005: "GPSAltitudeRef",
+	0x0006: "GPSAltitude",
+	0x0007: "GPSTimeStamp",
+	0x000C: "GPSSpeedRef",
+	0x000D: "GPSSpeed",
+	0x0010: "GPSImgDirectionRef",
+	0x0011: "GPSImgDirection",
+	0x0012: "GPSMapDatum",
+	0x001B: "GPSProcessingMethod",
+	0x001D: "GPSDateStamp",
+	0x001F: "GPSHPositioningError",
+}
+
+// parseTIFF reads IFD0 and the EXIF and GPS sub-IFDs of a TIFF structure
+func parseTIFF(raw []byte, meta *ImageMetadata) error {
+	if len(raw) < 8 {
+		return fmt.Errorf("EXIF block too short")
+	}
+	var order binary.ByteOrder
+	switch string(raw[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return fmt.Errorf("invalid EXIF byte order %q", raw[:2])
+	}
+	if order.Uint16(raw[2:]) != 42 {
+		return fmt.Errorf("invalid TIFF header")
+	}
+
+	t := tiff{raw: raw, order: order, meta: meta}
+	pointers := t.readIFD(order.Uint32(raw[4:]), "EXIF", ifd0TagNames)
+	if off, ok := pointers[tagExifIFD]; ok {
+		t.readIFD(off, "EXIF", exifTagNames)
+	}
+	if off, ok := pointers[tagGPSIFD]; ok {
+		t.readIFD(off, "EXIF", gpsTagNames)
+	}
+	return nil
+}
+
+type tiff struct {
+	raw   []byte
+	order binary.ByteOrder
+	meta  *ImageMetadata
+}
+
+// TIFF field types that can hold a sub-IFD offset
+const (
+	typeLong = 4
+	typeIFD  = 13
+)
+
+// typeSizes is the byte size of each TIFF field type
+var typeSizes = map[uint16]uint32{1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 6: 1, 7: 1, 8: 2, 9: 4, 10: 8, 11: 4, 12: 8, 13: 4}
+
+// readIFD stores the IFD's tags under prefix and returns the sub-IFD
+// pointers it holds. Malformed entries are skipped.
+func (t tiff) readIFD(offset uint32, prefix string, names map[uint16]string) map[uint16]uint32 {
+	pointers := map[uint16]uint32{}
+	if uint64(offset)+2 > uint64(len(t.raw)) {
+		return pointers
+	}
+	count := int(t.order.Uint16(t.raw[offset:]))
+	for i := 0; i < count; i++ {
+		entry := uint64(offset) + 2 + uint64(i)*12
+		if entry+12 > uint64(len(t.raw)) {
+			break
+		}
+		e := t.raw[entry : entry+12]
+		tag := t.order.Uint16(e)
+		typ := t.order.Uint16(e[2:])
+		n := t.order.Uint32(e[4:])
+
+		size, ok := typeSizes[typ]
+		if !ok || n == 0 || uint64(size)*uint64(n) > uint64(len(t.raw)) {
+			continue
+		}
+		value := e[8:12]
+		if total := size * n; total > 4 {
+			off := t.order.Uint32(e[8:])
+			if uint64(off)+uint64(total) > uint64(len(t.raw)) {
+				continue
+			}
+			value = t.raw[off : off+total]
+		} else {
+			value = value[:total]
+		}
+
+		if tag == tagExifIFD || tag == tagGPSIFD {
+			// A pointer is a single offset; anything else is corrupt
+			if (typ == typeLong || typ == typeIFD) && n == 1 && len(value) >= 4 {
+				pointers[tag] = t.order.Uint32(value)
+			}
+			continue
+		}
+		name, ok := names[tag]
+		if !ok {
+			name = fmt.Sprintf("0x%04X", tag)
+		}
+		if s, ok := t.format(typ, n, value); ok {
+			t.meta.Tags[prefix+":"+name] = s
+		}
+	}
+	return pointers
+}
+
+// format renders a field value as text. Numbers are space separated and
+// rationals are written as decimals.
+func (t tiff) format(typ uint16, n uint32, value []byte) (string, bool) {
+	switch typ {
+	case 2:
+		return strings.TrimSpace(strings.TrimRight(string(value), "\x00")), true
+	case 7:
+		if len(value) > 64 {
+			return "", false
+		}
+		// Character codes such as GPSProcessingMethod start with an 8-byte charset ID
+		if len(value) > 8 && bytes.HasPrefix(value, []byte("ASCII\x00\x00\x00")) {
+			return strings.TrimRight(string(value[8:]), "\x00 "), true
+		}
+		return hex.EncodeToString(value), true
+	}
+
+	parts := make([]string, 0, n)
+	for i := uint32(0); i < n; i++ {
+		switch typ {
+		case 1:
+			parts = append(parts, strconv.Itoa(int(value[i])))
+		case 6:
+			parts = append(parts, strconv.Itoa(int(int8(value[i]))))
+		case 3:
+			parts = append(parts, strconv.Itoa(int(t.order.Uint16(value[i*2:]))))
+		case 8:
+			parts = append(parts, strconv.Itoa(int(int16(t.order.Uint16(value[i*2:])))))
+		case 4, 13:
+			parts = append(parts, strconv.FormatUint(uint64(t.order.Uint32(value[i*4:])), 10))
+		case 9:
+			parts = append(parts, strconv.Itoa(int(int32(t.order.Uint32(value[i*4:])))))
+		case 5, 10:
+			num, den := t.order.Uint32(value[i*8:]), t.order.Uint32(value[i*8+4:])
+			if den == 0 {
+				parts = append(parts, "0")
+				continue
+			}
+			var f float64
+			if typ == 5 {
+				f = float64(num) / float64(den)
+			} else {
+				f = float64(int32(num)) / float64(int32(den))
+			}
+			parts = append(parts, strconv.FormatFloat(f, 'f', -1, 64))
+		case 11:
+			parts = append(parts, strconv.FormatFloat(float64(math.Float32frombits(t.order.Uint32(value[i*4:]))), 'f', -1, 32))
+		case 12:
+			parts = append(parts, strconv.FormatFloat(math.Float64frombits(t.order.Uint64(value[i*8:])), 'f', -1, 64))
+		}
+	}
+	return strings.Join(parts, " "), true
+}
+
+// xmpPrefixes maps XMP namespace URIs to their conventional prefixes
+var xmpPrefixes = map[string]string{
+	"http://ns.adobe.com/exif/1.0/":           "exif",
+	"http://ns.adobe.com/exif/1.0/aux/":       "aux",
+	"http://ns.adobe.com/tiff/1.0/":           "tiff",
+	"http://ns.adobe.com/xap/1.0/":            "xmp",
+	"http://ns.adobe.com/photoshop/1.0/":      "photoshop",
+	"http://purl.org/dc/elements/1.1/":        "dc",
+	"http://cipa.jp/exif/1.0/":                "exifEX",
+	"http://ns.google.com/photos/1.0/camera/": "GCamera",
+}
+
+const (
+	rdfNamespace = "http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+	xmlNamespace = "http://www.w3.org/XML/1998/namespace"
+)
+
+// parseXMP stores the properties of an XMP packet, written either as
+// attributes or as elements, under "XMP:<prefix>:<name>". Malformed XML is
+// read up to the first error.
+func parseXMP(packet []byte, meta *ImageMetadata) {
+	key := func(name xml.Name) string {
+		prefix, ok := xmpPrefixes[name.Space]
+		if !ok {
+			prefix = strings.TrimRight(name.Space, "/#")
+			if i := strings.LastIndexAny(prefix, "/#"); i >= 0 {
+				prefix = prefix[i+1:]
+			}
+		}
+		return "XMP:" + prefix + ":" + name.Local
+	}
+	set := func(k, v string) {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			return
+		}
+		if prev, ok := meta.Tags[k]; ok && prev != v {
+			v = prev + "; " + v
+		}
+		meta.Tags[k] = v
+	}
+
+	dec := xml.NewDecoder(bytes.NewReader(packet))
+	// The innermost property element, ignoring rdf containers
+	var stack []string
+	var text strings.Builder
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return
+		}
+		switch el := tok.(type) {
+		case xml.StartElement:
+			text.Reset()
+			for _, attr := range el.Attr {
+				if attr.Name.Space == "xmlns" || attr.Name.Local == "xmlns" || attr.Name.Space == rdfNamespace || attr.Name.Space == xmlNamespace || attr.Name.Space == "" {
+					continue
+				}
+				set(key(attr.Name), attr.Value)
+			}
+			if el.Name.Space == rdfNamespace || el.Name.Space == "adobe:ns:meta/" {
+				stack = append(stack, "")
+			} else {
+				stack = append(stack, key(el.Name))
+			}
+		case xml.CharData:
+			text.Write(el)
+		case xml.EndElement:
+			if len(stack) == 0 {
+				return
+			}
+			if el.Name.Space == rdfNamespace && el.Name.Local == "li" {
+				// List items belong to the enclosing property
+				for i := len(stack) - 2; i >= 0; i-- {
+					if stack[i] != "" {
+						set(stack[i], text.String())
+						break
+					}
+				}
+			} else if k := stack[len(stack)-1]; k != "" {
+				set(k, text.String())
+			}
+			text.Reset()
+			stack = stack[:len(stack)-1]
+		}
+	}
+}
+
+// derive fills the typed fields from the raw tags, preferring EXIF over XMP
+func (m *ImageMetadata) derive() {
+	m.Make = firstTag(m.Tags, "EXIF:Make", "XMP:tiff:Make")
+	m.Model = firstTag(m.Tags, "EXIF:Model", "XMP:tiff:Model")
+	m.Software = firstTag(m.Tags, "EXIF:Software", "XMP:xmp:CreatorTool", "XMP:tiff:Software")
+
+	if t, ok := exifTime(m.Tags["EXIF:DateTimeOriginal"], firstTag(m.Tags, "EXIF:OffsetTimeOriginal", "EXIF:OffsetTime"), m.Tags["EXIF:SubSecTimeOriginal"]); ok {
+		m.CapturedAt = &t
+	} else if t, ok := gpsTime(m.Tags["EXIF:GPSDateStamp"], m.Tags["EXIF:GPSTimeStamp"]); ok {
+		m.CapturedAt = &t
+	} else if t, ok := xmpTime(firstTag(m.Tags, "XMP:exif:DateTimeOriginal", "XMP:photoshop:DateCreated", "XMP:xmp:CreateDate")); ok {
+		m.CapturedAt = &t
+	} else if t, ok := exifTime(m.Tags["EXIF:DateTime"], m.Tags["EXIF:OffsetTime"], ""); ok {
+		m.CapturedAt = &t
+	}
+
+	lat, latOK := exifCoordinate(m.Tags["EXIF:GPSLatitude"], m.Tags["EXIF:GPSLatitudeRef"], "S")
+	lng, lngOK := exifCoordinate(m.Tags["EXIF:GPSLongitude"], m.Tags["EXIF:GPSLongitudeRef"], "W")
+	if !latOK || !lngOK {
+		lat, latOK = xmpCoordinate(m.Tags["XMP:exif:GPSLatitude"])
+		lng, lngOK = xmpCoordinate(m.Tags["XMP:exif:GPSLongitude"])
+	}
+	if latOK && lngOK && lat >= -90 && lat <= 90 && lng >= -180 && lng <= 180 && !(lat == 0 && lng == 0) {
+		m.Latitude, m.Longitude = &lat, &lng
+	}
+
+	if alt, err := strconv.ParseFloat(firstTag(m.Tags, "EXIF:GPSAltitude"), 64); err == nil {
+		if m.Tags["EXIF:GPSAltitudeRef"] == "1" {
+			alt = -alt
+		}
+		m.Altitude = &alt
+	}
+}
+
+func firstTag(tags map[string]string, keys ...string) string {
+	for _, k := range keys {
+		if v := tags[k]; v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// exifTime parses an EXIF "2006:01:02 15:04:05" time with its optional
+// "+05:30" offset and fractional seconds
+func exifTime(value, offset, subsec string) (time.Time, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" || strings.HasPrefix(value, "0000") {
+		return time.Time{}, false
+	}
+	if subsec = strings.TrimSpace(subsec); subsec != "" {
+		value += "." + subsec
+	}
+	layout := "2006:01:02 15:04:05"
+	if subsec != "" {
+		layout += ".999999999"
+	}
+	loc := time.UTC
+	if offset = strings.TrimSpace(offset); offset != "" {
+		if off, err := time.Parse("-07:00", offset); err == nil {
+			_, secs := off.Zone()
+			loc = time.FixedZone(offset, secs)
+		}
+	}
+	t, err := time.ParseInLocation(layout, value, loc)
+	return t, err == nil
+}
+
+// gpsTime combines GPSDateStamp "2006:01:02" and GPSTimeStamp "h m s", which
+// are always UTC
+func gpsTime(date, clock string) (time.Time, bool) {
+	d, err := time.Parse("2006:01:02", strings.TrimSpace(date))
+	if err != nil {
+		return time.Time{}, false
+	}
+	parts := strings.Fields(clock)
+	if len(parts) != 3 {
+		return time.Time{}, false
+	}
+	var hms [3]float64
+	for i, p := range parts {
+		if hms[i], err = strconv.ParseFloat(p, 64); err != nil {
+			return time.Time{}, false
+		}
+	}
+	secs := hms[0]*3600 + hms[1]*60 + hms[2]
+	return d.Add(time.Duration(secs * float64(time.Second))), true
+}
+
+// xmpTime parses the ISO 8601 dates used in XMP, with or without an offset
+func xmpTime(value string) (time.Time, bool) {
+	value = strings.TrimSpace(value)
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// exifCoordinate converts "deg min sec" and a hemisphere reference to
+// signed decimal degrees
+func exifCoordinate(value, ref, negativeRef string) (float64, bool) {
+	parts := strings.Fields(value)
+	if len(parts) == 0 || len(parts) > 3 {
+		return 0, false
+	}
+	var deg float64
+	for i, p := range parts {
+		f, err := strconv.ParseFloat(p, 64)
+		if err != nil {
+			return 0, false
+		}
+		deg += f / math.Pow(60, float64(i))
+	}
+	if ref = strings.TrimSpace(ref); ref != "" && strings.EqualFold(ref, negativeRef) {
+		deg = -deg
+	}
+	return deg, true
+}
+
+// xmpCoordinate converts the XMP "DDD,MM.mmk" or "DDD,MM,SSk" form, where k
+// is N, S, E or W
+func xmpCoordinate(value string) (float64, bool) {
+	value = strings.TrimSpace(value)
+	if len(value) < 2 {
+		return 0, false
+	}
+	hemisphere := strings.ToUpper(value[len(value)-1:])
+	if !strings.ContainsAny(hemisphere, "NSEW") {
+		f, err := strconv.ParseFloat(value, 64)
+		return f, err == nil
+	}
+	deg, ok := exifCoordinate(strings.ReplaceAll(value[:len(value)-1], ",", " "), "", "")
+	if !ok {
+		return 0, false
+	}
+	if hemisphere == "S" || hemisphere == "W" {
+		deg = -deg
+	}
+	return deg, true
+}
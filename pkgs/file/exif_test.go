@@ -0,0 +1,244 @@
+package file
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/jpeg"
+	"testing"
+	"time"
+
+	"sadbhavana/tree-project/pkgs/db"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type tiffEntry struct {
+	tag   uint16
+	typ   uint16
+	count uint32
+	data  []byte
+}
+
+func asciiEntry(tag uint16, s string) tiffEntry {
+	return tiffEntry{tag: tag, typ: 2, count: uint32(len(s) + 1), data: append([]byte(s), 0)}
+}
+
+func rationalEntry(tag uint16, values ...[2]uint32) tiffEntry {
+	data := make([]byte, 0, 8*len(values))
+	for _, v := range values {
+		data = binary.LittleEndian.AppendUint32(data, v[0])
+		data = binary.LittleEndian.AppendUint32(data, v[1])
+	}
+	return tiffEntry{tag: tag, typ: 5, count: uint32(len(values)), data: data}
+}
+
+func longEntry(tag uint16, v uint32) tiffEntry {
+	return tiffEntry{tag: tag, typ: 4, count: 1, data: binary.LittleEndian.AppendUint32(nil, v)}
+}
+
+// buildTIFF lays out a little-endian TIFF with IFD0 pointing at the EXIF and
+// GPS IFDs, followed by the out-of-line values
+func buildTIFF(ifd0, exif, gps []tiffEntry) []byte {
+	ifdSize := func(n int) int { return 2 + 12*n + 4 }
+	offExif := 8 + ifdSize(len(ifd0)+2)
+	offGPS := offExif + ifdSize(len(exif))
+	dataOff := offGPS + ifdSize(len(gps))
+	ifd0 = append(ifd0, longEntry(tagExifIFD, uint32(offExif)), longEntry(tagGPSIFD, uint32(offGPS)))
+
+	out := []byte("II*\x00")
+	out = binary.LittleEndian.AppendUint32(out, 8)
+	var data []byte
+	for _, ifd := range [][]tiffEntry{ifd0, exif, gps} {
+		out = binary.LittleEndian.AppendUint16(out, uint16(len(ifd)))
+		for _, e := range ifd {
+			out = binary.LittleEndian.AppendUint16(out, e.tag)
+			out = binary.LittleEndian.AppendUint16(out, e.typ)
+			out = binary.LittleEndian.AppendUint32(out, e.count)
+			if len(e.data) <= 4 {
+				out = append(out, append(e.data, make([]byte, 4-len(e.data))...)...)
+			} else {
+				out = binary.LittleEndian.AppendUint32(out, uint32(dataOff+len(data)))
+				data = append(data, e.data...)
+			}
+		}
+		out = binary.LittleEndian.AppendUint32(out, 0)
+	}
+	return append(out, data...)
+}
+
+// withAPP1 inserts APP1 segments after the SOI marker of a real JPEG
+func withAPP1(t *testing.T, segments ...[]byte) []byte {
+	t.Helper()
+	var img bytes.Buffer
+	if err := jpeg.Encode(&img, image.NewGray(image.Rect(0, 0, 8, 8)), nil); err != nil {
+		t.Fatalf("Failed to encode JPEG: %v", err)
+	}
+	out := []byte{0xFF, 0xD8}
+	for _, s := range segments {
+		out = append(out, 0xFF, 0xE1)
+		out = binary.BigEndian.AppendUint16(out, uint16(len(s)+2))
+		out = append(out, s...)
+	}
+	return append(out, img.Bytes()[2:]...)
+}
+
+func sampleTIFF() []byte {
+	return buildTIFF(
+		[]tiffEntry{
+			asciiEntry(0x010F, "Google"),
+			asciiEntry(0x0110, "Pixel 7"),
+		},
+		[]tiffEntry{
+			asciiEntry(0x9003, "2026:03:14 09:26:53"),
+			asciiEntry(0x9011, "+05:30"),
+		},
+		[]tiffEntry{
+			asciiEntry(0x0001, "N"),
+			rationalEntry(0x0002, [2]uint32{12, 1}, [2]uint32{58, 1}, [2]uint32{1800, 100}),
+			asciiEntry(0x0003, "E"),
+			rationalEntry(0x0004, [2]uint32{77, 1}, [2]uint32{35, 1}, [2]uint32{0, 1}),
+			{tag: 0x0005, typ: 1, count: 1, data: []byte{0}},
+			rationalEntry(0x0006, [2]uint32{9205, 10}),
+		},
+	)
+}
+
+func TestReadImageMetadata_JPEGExif(t *testing.T) {
+	img := withAPP1(t, append([]byte("Exif\x00\x00"), sampleTIFF()...))
+
+	meta, err := ReadImageMetadata(bytes.NewReader(img))
+	if err != nil {
+		t.Fatalf("ReadImageMetadata failed: %v", err)
+	}
+
+	if assert.NotNil(t, meta.CapturedAt) {
+		assert.True(t, meta.CapturedAt.Equal(time.Date(2026, 3, 14, 3, 56, 53, 0, time.UTC)))
+	}
+	if assert.True(t, meta.HasLocation()) {
+		assert.InDelta(t, 12.9716667, *meta.Latitude, 1e-6)
+		assert.InDelta(t, 77.5833333, *meta.Longitude, 1e-6)
+	}
+	if assert.NotNil(t, meta.Altitude) {
+		assert.InDelta(t, 920.5, *meta.Altitude, 1e-9)
+	}
+	assert.Equal(t, "Google Pixel 7", meta.Device())
+	assert.Equal(t, "N", meta.Tags["EXIF:GPSLatitudeRef"])
+	assert.Equal(t, "2026:03:14 09:26:53", meta.Tags["EXIF:DateTimeOriginal"])
+}
+
+func TestReadImageMetadata_TIFF(t *testing.T) {
+	meta, err := ReadImageMetadata(bytes.NewReader(sampleTIFF()))
+	if err != nil {
+		t.Fatalf("ReadImageMetadata failed: %v", err)
+	}
+	assert.True(t, meta.HasLocation())
+	assert.Equal(t, "Pixel 7", meta.Model)
+}
+
+func TestReadImageMetadata_XMP(t *testing.T) {
+	packet := `<x:xmpmeta xmlns:x="adobe:ns:meta/">
+ <rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+  <rdf:Description rdf:about=""
+    xmlns:exif="http://ns.adobe.com/exif/1.0/"
+    xmlns:tiff="http://ns.adobe.com/tiff/1.0/"
+    xmlns:dc="http://purl.org/dc/elements/1.1/"
+    exif:GPSLatitude="33,51.54S"
+    exif:GPSLongitude="151,12.6E"
+    tiff:Make="Apple">
+   <exif:DateTimeOriginal>2026-03-14T09:26:53+05:30</exif:DateTimeOriginal>
+   <tiff:Model>iPhone 15</tiff:Model>
+   <dc:creator><rdf:Seq><rdf:li>Asha Mehta</rdf:li></rdf:Seq></dc:creator>
+  </rdf:Description>
+ </rdf:RDF>
+</x:xmpmeta>`
+	img := withAPP1(t, append([]byte("http://ns.adobe.com/xap/1.0/\x00"), packet...))
+
+	meta, err := ReadImageMetadata(bytes.NewReader(img))
+	if err != nil {
+		t.Fatalf("ReadImageMetadata failed: %v", err)
+	}
+
+	if assert.NotNil(t, meta.CapturedAt) {
+		assert.True(t, meta.CapturedAt.Equal(time.Date(2026, 3, 14, 3, 56, 53, 0, time.UTC)))
+	}
+	if assert.True(t, meta.HasLocation()) {
+		assert.InDelta(t, -33.859, *meta.Latitude, 1e-9)
+		assert.InDelta(t, 151.21, *meta.Longitude, 1e-9)
+	}
+	assert.Equal(t, "Apple iPhone 15", meta.Device())
+	assert.Equal(t, "Asha Mehta", meta.Tags["XMP:dc:creator"])
+}
+
+func TestReadImageMetadata_None(t *testing.T) {
+	_, err := ReadImageMetadata(bytes.NewReader(withAPP1(t)))
+	assert.True(t, errors.Is(err, ErrNoImageMetadata))
+
+	_, err = ReadImageMetadata(bytes.NewReader([]byte("not an image")))
+	assert.True(t, errors.Is(err, ErrNoImageMetadata))
+}
+
+// buildIFD0 lays out a little-endian TIFF holding only IFD0, with values of
+// up to four bytes stored inline
+func buildIFD0(entries ...tiffEntry) []byte {
+	out := []byte("II*\x00")
+	out = binary.LittleEndian.AppendUint32(out, 8)
+	out = binary.LittleEndian.AppendUint16(out, uint16(len(entries)))
+	for _, e := range entries {
+		out = binary.LittleEndian.AppendUint16(out, e.tag)
+		out = binary.LittleEndian.AppendUint16(out, e.typ)
+		out = binary.LittleEndian.AppendUint32(out, e.count)
+		out = append(out, append(e.data, make([]byte, 4-len(e.data))...)...)
+	}
+	return binary.LittleEndian.AppendUint32(out, 0)
+}
+
+func TestParseTIFF_MalformedSubIFDPointers(t *testing.T) {
+	for name, pointer := range map[string]tiffEntry{
+		"byte":      {tag: tagExifIFD, typ: 1, count: 1, data: []byte{8}},
+		"short":     {tag: tagGPSIFD, typ: 3, count: 1, data: []byte{8, 0}},
+		"ascii":     {tag: tagGPSIFD, typ: 2, count: 2, data: []byte{8, 0}},
+		"two longs": {tag: tagExifIFD, typ: 4, count: 2, data: []byte{8, 0, 0, 0}},
+		"past end":  longEntry(tagGPSIFD, 1<<30),
+	} {
+		t.Run(name, func(t *testing.T) {
+			meta := &ImageMetadata{Tags: map[string]string{}}
+			assert.NotPanics(t, func() {
+				assert.NoError(t, parseTIFF(buildIFD0(asciiEntry(0x010F, "Go"), pointer), meta))
+			})
+			assert.Equal(t, "Go", meta.Tags["EXIF:Make"])
+		})
+	}
+
+	// The IFD type is as good as LONG for a pointer
+	raw := sampleTIFF()
+	binary.LittleEndian.PutUint16(raw[8+2+2*12+2:], typeIFD)
+	meta := &ImageMetadata{Tags: map[string]string{}}
+	assert.NoError(t, parseTIFF(raw, meta))
+	assert.Equal(t, "2026:03:14 09:26:53", meta.Tags["EXIF:DateTimeOriginal"])
+}
+
+func FuzzParseTIFF(f *testing.F) {
+	f.Add(sampleTIFF())
+	f.Add(buildIFD0(tiffEntry{tag: tagExifIFD, typ: 1, count: 1, data: []byte{8}}))
+	f.Add([]byte("MM\x00*\x00\x00\x00\x08"))
+	f.Fuzz(func(t *testing.T, raw []byte) {
+		parseTIFF(raw, &ImageMetadata{Tags: map[string]string{}})
+	})
+}
+
+func TestImageMetadata_ApplyTo(t *testing.T) {
+	meta, err := ReadImageMetadata(bytes.NewReader(sampleTIFF()))
+	if err != nil {
+		t.Fatalf("ReadImageMetadata failed: %v", err)
+	}
+
+	input := db.UploadTreePhotoInput{TreeId: "AB17", PhotoPropertyList: map[string]any{"source": "whatsapp"}}
+	meta.ApplyTo(&input)
+
+	assert.Equal(t, "2026-03-14T09:26:53+05:30", input.PhotoTs)
+	assert.Equal(t, meta.Latitude, input.PhotoLatitude)
+	assert.Equal(t, "whatsapp", input.PhotoPropertyList["source"])
+	assert.Equal(t, "Google Pixel 7", input.PhotoPropertyList["device"])
+}
@@ -2,71 +2,233 @@ package file
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
-	"sadbhavana/tree-project/pkgs/auth"
-	"sadbhavana/tree-project/pkgs/db"
-	"sadbhavana/tree-project/pkgs/providers"
+	"path"
+	"strings"
+	"sync"
+	"time"
 
 	"golang.org/x/oauth2"
-	"google.golang.org/api/drive/v2"
+	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/googleapi"
 	"google.golang.org/api/option"
 )
 
+const (
+	driveFolderMimeType = "application/vnd.google-apps.folder"
+	driveFileFields     = "id,name,size,mimeType,webContentLink,webViewLink"
+	// Files larger than one chunk are sent as a resumable upload
+	driveUploadChunkSize = 8 * 1024 * 1024
+	// driveChunkRetryDeadline bounds the retries of a single failed chunk
+	driveChunkRetryDeadline = 2 * time.Minute
+	driveListPageSize       = 100
+)
+
 type GoogleDriveFileStore struct {
 	Service *drive.Service
+	// ChunkSize is the size of each part of a resumable upload
+	ChunkSize int
+	// RetryDeadline is how long a failed chunk is retried for
+	RetryDeadline time.Duration
+
+	folders *driveFolderCache
 }
 
-func NewGoogleDriveFileStore(ctx context.Context, q *db.Queries) (*GoogleDriveFileStore, error) {
-	activeToken, err := auth.GetActiveToken(ctx, q, providers.GOOGLE_PROVIDER)
-	if err != nil {
+// driveFolderCache remembers the IDs of folders found by path. Holding the lock
+// while a path is resolved keeps concurrent uploads from creating a folder
+// twice.
+type driveFolderCache struct {
+	mu  sync.Mutex
+	ids map[string]string
+}
+
+func newDriveFolderCache() *driveFolderCache {
+	return &driveFolderCache{ids: map[string]string{}}
+}
+
+// clear forgets every folder, as another account's IDs mean nothing here
+func (c *driveFolderCache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	clear(c.ids)
+}
+
+// driveFolders is shared by the stores made for the Drive account, which are
+// opened afresh for each use. It is cleared when another account is connected.
+var driveFolders = newDriveFolderCache()
+
+// NewGoogleDriveFileStore opens the Drive account tokens are issued for, such
+// as auth.TokenManager.TokenSource for the google provider. Tokens are fetched
+// per request, so a long-lived store keeps working across refreshes.
+func NewGoogleDriveFileStore(ctx context.Context, tokens oauth2.TokenSource) (*GoogleDriveFileStore, error) {
+	// Fail here rather than on the first request if the account is not connected
+	if _, err := tokens.Token(); err != nil {
 		return nil, err
 	}
 
-	client := oauth2.NewClient(ctx, oauth2.StaticTokenSource(&activeToken))
-	service, err := drive.NewService(ctx, option.WithHTTPClient(client))
+	client := oauth2.NewClient(ctx, tokens)
+	return newGoogleDriveFileStore(ctx, driveFolders, option.WithHTTPClient(client))
+}
+
+func newGoogleDriveFileStore(ctx context.Context, folders *driveFolderCache, opts ...option.ClientOption) (*GoogleDriveFileStore, error) {
+	service, err := drive.NewService(ctx, opts...)
 	if err != nil {
 		return nil, err
 	}
 
 	return &GoogleDriveFileStore{
-		Service: service,
+		Service:       service,
+		ChunkSize:     driveUploadChunkSize,
+		RetryDeadline: driveChunkRetryDeadline,
+		folders:       folders,
 	}, nil
 }
 
-// ListFiles lists files in the given folder.
-func (g *GoogleDriveFileStore) ListFiles(ctx context.Context, folder FolderInfo) ([]FileInfo, error) {
-	// default to root if no folder id provided
-	folderID := folder.FolderId
-	if folderID == "" {
-		folderID = "root"
+// driveQuote quotes a value for use in a Drive search query
+func driveQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	return "'" + strings.ReplaceAll(s, "'", `\'`) + "'"
+}
+
+// cleanFolderPath normalises a folder path such as "project/AB/tree/AB000123/"
+func cleanFolderPath(p string) string {
+	p = strings.Trim(path.Clean("/"+p), "/")
+	if p == "." {
+		return ""
 	}
+	return p
+}
 
-	q := fmt.Sprintf("'%s' in parents and trashed=false", folderID)
-	// request a small set of fields
-	res, err := g.Service.Files.List().Q(q).Fields("items(id,title,fileSize,mimeType,webContentLink,alternateLink)").Do()
-	if err != nil {
-		return nil, err
+// resolveFolder returns the ID of the folder a FolderInfo names. A FolderId is
+// used as is; otherwise FolderPath is looked up from the root of the Drive,
+// one folder at a time. Missing folders are created when create is set, and
+// reported as "" otherwise.
+func (g *GoogleDriveFileStore) resolveFolder(ctx context.Context, folder FolderInfo, create bool) (string, error) {
+	if folder.FolderId != "" {
+		return folder.FolderId, nil
 	}
+	folderPath := cleanFolderPath(folder.FolderPath)
+	if folderPath == "" {
+		return "root", nil
+	}
+
+	g.folders.mu.Lock()
+	defer g.folders.mu.Unlock()
 
-	out := make([]FileInfo, 0, len(res.Items))
-	for _, it := range res.Items {
-		mt, err := FromGoogleMimeType(it.MimeType)
+	parentID := "root"
+	walked := ""
+	for _, name := range strings.Split(folderPath, "/") {
+		walked = path.Join(walked, name)
+		if id, ok := g.folders.ids[walked]; ok {
+			parentID = id
+			continue
+		}
+
+		id, err := g.findFolder(ctx, parentID, name)
 		if err != nil {
-			return nil, err
+			return "", fmt.Errorf("failed to look up folder %s: %w", walked, err)
 		}
-		// Use provided folder path when available as the FilePath
-		fi := FileInfo{
-			FileStore: "google",
-			FileID:    it.Id,
-			FileName:  it.Title,
-			FilePath:  folder.FolderPath,
-			FileURL:   firstNonEmpty(it.WebContentLink, it.AlternateLink),
-			Size:      it.FileSize,
-			MimeType:  mt,
+		if id == "" {
+			if !create {
+				return "", nil
+			}
+			created, err := g.Service.Files.Create(&drive.File{
+				Name:     name,
+				MimeType: driveFolderMimeType,
+				Parents:  []string{parentID},
+			}).Fields("id").Context(ctx).Do()
+			if err != nil {
+				return "", fmt.Errorf("failed to create folder %s: %w", walked, err)
+			}
+			id = created.Id
 		}
-		out = append(out, fi)
+		g.folders.ids[walked] = id
+		parentID = id
+	}
+	return parentID, nil
+}
+
+// findFolder returns the ID of the folder with the given name in a parent
+// folder, or "" if there is none
+func (g *GoogleDriveFileStore) findFolder(ctx context.Context, parentID, name string) (string, error) {
+	q := fmt.Sprintf("name = %s and %s in parents and mimeType = %s and trashed = false",
+		driveQuote(name), driveQuote(parentID), driveQuote(driveFolderMimeType))
+	res, err := g.Service.Files.List().Q(q).Fields("files(id)").PageSize(1).Context(ctx).Do()
+	if err != nil {
+		return "", err
+	}
+	if len(res.Files) == 0 {
+		return "", nil
+	}
+	return res.Files[0].Id, nil
+}
+
+// forgetFolder drops a cached folder and everything below it, after Drive
+// reports it gone
+func (g *GoogleDriveFileStore) forgetFolder(folderPath string) {
+	folderPath = cleanFolderPath(folderPath)
+	g.folders.mu.Lock()
+	defer g.folders.mu.Unlock()
+	for p := range g.folders.ids {
+		if p == folderPath || strings.HasPrefix(p, folderPath+"/") {
+			delete(g.folders.ids, p)
+		}
+	}
+}
+
+func isDriveNotFound(err error) bool {
+	var apiErr *googleapi.Error
+	return errors.As(err, &apiErr) && apiErr.Code == http.StatusNotFound
+}
+
+func driveFileInfo(f *drive.File, folderPath string) (FileInfo, error) {
+	mt, err := FromGoogleMimeType(f.MimeType)
+	if err != nil {
+		return FileInfo{}, err
+	}
+	return FileInfo{
+		FileStore: "google",
+		FileID:    f.Id,
+		FileName:  f.Name,
+		FilePath:  folderPath,
+		FileURL:   firstNonEmpty(f.WebContentLink, f.WebViewLink),
+		Size:      f.Size,
+		MimeType:  mt,
+	}, nil
+}
+
+// ListFiles lists files in the given folder, reading every page of results.
+// A folder path that does not exist holds no files.
+func (g *GoogleDriveFileStore) ListFiles(ctx context.Context, folder FolderInfo) ([]FileInfo, error) {
+	folderID, err := g.resolveFolder(ctx, folder, false)
+	if err != nil {
+		return nil, err
+	}
+	if folderID == "" {
+		return nil, nil
+	}
+	folderPath := cleanFolderPath(folder.FolderPath)
+
+	q := fmt.Sprintf("%s in parents and mimeType != %s and trashed = false", driveQuote(folderID), driveQuote(driveFolderMimeType))
+	var out []FileInfo
+	err = g.Service.Files.List().Q(q).
+		Fields(googleapi.Field("nextPageToken,files("+driveFileFields+")")).
+		PageSize(driveListPageSize).
+		Pages(ctx, func(res *drive.FileList) error {
+			for _, it := range res.Files {
+				fi, err := driveFileInfo(it, folderPath)
+				if err != nil {
+					return err
+				}
+				out = append(out, fi)
+			}
+			return nil
+		})
+	if err != nil {
+		return nil, err
 	}
 	return out, nil
 }
@@ -79,44 +241,46 @@ func firstNonEmpty(s1, s2 string) string {
 }
 
 // UploadFile uploads data to Google Drive and returns the created FileInfo.
+// The folder path is created if needed. Files larger than ChunkSize are sent
+// in chunks as a resumable upload, and a failed chunk is retried until
+// RetryDeadline passes.
 func (g *GoogleDriveFileStore) UploadFile(ctx context.Context, fileName string, fileType MimeType, folderInfo FolderInfo, data io.Reader) (FileInfo, error) {
-	// prepare drive file metadata
 	mimeStr, err := fileType.ToGoogleMimeType()
 	if err != nil {
 		return FileInfo{}, err
 	}
-	df := &drive.File{
-		Title:    fileName,
-		MimeType: mimeStr,
-	}
-
-	// ensure folder id
-	folderID := folderInfo.FolderId
-	if folderID == "" {
-		folderID = "root"
+	folderID, err := g.resolveFolder(ctx, folderInfo, true)
+	if err != nil {
+		return FileInfo{}, err
 	}
-	// set parent reference (drive v2 uses ParentReference)
-	df.Parents = []*drive.ParentReference{{Id: folderID}}
 
-	// insert with media
-	created, err := g.Service.Files.Insert(df).Media(data).Do()
+	// checksum the data on the way
+	hashed := newHashingReader(data)
+	created, err := g.Service.Files.Create(&drive.File{
+		Name:     fileName,
+		MimeType: mimeStr,
+		Parents:  []string{folderID},
+	}).Media(hashed,
+		googleapi.ContentType(mimeStr),
+		googleapi.ChunkSize(g.ChunkSize),
+		googleapi.ChunkRetryDeadline(g.RetryDeadline),
+	).Fields(driveFileFields).Context(ctx).Do()
 	if err != nil {
+		// A cached folder may have been deleted since it was looked up; the
+		// next upload looks it up again
+		if folderInfo.FolderId == "" && isDriveNotFound(err) {
+			g.forgetFolder(folderInfo.FolderPath)
+		}
 		return FileInfo{}, err
 	}
 
-	mt, err := FromGoogleMimeType(created.MimeType)
+	fi, err := driveFileInfo(created, cleanFolderPath(folderInfo.FolderPath))
 	if err != nil {
 		return FileInfo{}, err
 	}
-	return FileInfo{
-		FileStore: "google",
-		FileID:    created.Id,
-		FileName:  created.Title,
-		FilePath:  folderInfo.FolderPath,
-		FileURL:   firstNonEmpty(created.WebContentLink, created.AlternateLink),
-		Size:      created.FileSize,
-		MimeType:  mt,
-	}, nil
+	fi.Size = hashed.size
+	fi.SHA256 = hashed.Sum()
+	return fi, nil
 }
 
 // DownloadFile returns an io.Reader and a cleanup func (to be deferred) for the file contents.
@@ -127,11 +291,11 @@ func (g *GoogleDriveFileStore) DownloadFile(ctx context.Context, file FileInfo)
 
 	switch file.MimeType {
 	case MimeTypeGoogleDoc:
-		resp, err = g.Service.Files.Export(file.FileID, "application/pdf").Download()
+		resp, err = g.Service.Files.Export(file.FileID, "application/pdf").Context(ctx).Download()
 	case MimeTypeGoogleSheet:
-		resp, err = g.Service.Files.Export(file.FileID, "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet").Download()
+		resp, err = g.Service.Files.Export(file.FileID, "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet").Context(ctx).Download()
 	default:
-		resp, err = g.Service.Files.Get(file.FileID).Download()
+		resp, err = g.Service.Files.Get(file.FileID).Context(ctx).Download()
 	}
 	if err != nil {
 		return nil, nil, err
@@ -147,5 +311,5 @@ func (g *GoogleDriveFileStore) DownloadFile(ctx context.Context, file FileInfo)
 
 // DeleteFile deletes the file from Google Drive.
 func (g *GoogleDriveFileStore) DeleteFile(ctx context.Context, file FileInfo) error {
-	return g.Service.Files.Delete(file.FileID).Do()
+	return g.Service.Files.Delete(file.FileID).Context(ctx).Do()
 }
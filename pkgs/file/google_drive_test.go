@@ -0,0 +1,364 @@
+package file
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/option"
+)
+
+type fakeDriveFile struct {
+	ID       string   `json:"id"`
+	Name     string   `json:"name"`
+	MimeType string   `json:"mimeType"`
+	Parents  []string `json:"parents,omitempty"`
+	Size     int64    `json:"size,string,omitempty"`
+	data     []byte
+}
+
+// fakeDrive serves just enough of the Drive v3 API for GoogleDriveFileStore:
+// search queries of the forms the store makes, folder creation, multipart and
+// resumable uploads, downloads and deletes
+type fakeDrive struct {
+	mu       sync.Mutex
+	url      string
+	files    map[string]*fakeDriveFile
+	order    []string
+	sessions map[string]*fakeDriveFile
+	nextID   int
+	// failChunks makes the next resumable chunks fail with 503
+	failChunks int
+	requests   []string
+}
+
+func newFakeDrive(t *testing.T) (*fakeDrive, *GoogleDriveFileStore) {
+	f := &fakeDrive{files: map[string]*fakeDriveFile{}, sessions: map[string]*fakeDriveFile{}}
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	f.url = srv.URL
+	return f, newTestDriveStore(t, srv.URL)
+}
+
+func newTestDriveStore(t *testing.T, url string) *GoogleDriveFileStore {
+	store, err := newGoogleDriveFileStore(context.Background(), newDriveFolderCache(),
+		option.WithEndpoint(url+"/drive/v3/"), option.WithoutAuthentication())
+	if err != nil {
+		t.Fatalf("failed to create drive store: %v", err)
+	}
+	return store
+}
+
+func (f *fakeDrive) add(file *fakeDriveFile) *fakeDriveFile {
+	f.nextID++
+	file.ID = fmt.Sprintf("id-%d", f.nextID)
+	file.Size = int64(len(file.data))
+	f.files[file.ID] = file
+	f.order = append(f.order, file.ID)
+	return file
+}
+
+func (f *fakeDrive) count(kind string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n := 0
+	for _, r := range f.requests {
+		if r == kind {
+			n++
+		}
+	}
+	return n
+}
+
+func (f *fakeDrive) folders() []*fakeDriveFile {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var out []*fakeDriveFile
+	for _, id := range f.order {
+		if file, ok := f.files[id]; ok && file.MimeType == driveFolderMimeType {
+			out = append(out, file)
+		}
+	}
+	return out
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func (f *fakeDrive) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	q := r.URL.Query()
+	id, isFile := strings.CutPrefix(r.URL.Path, "/drive/v3/files/")
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/drive/v3/files":
+		f.requests = append(f.requests, "list")
+		f.list(w, q)
+	case r.Method == http.MethodPost && r.URL.Path == "/drive/v3/files":
+		f.requests = append(f.requests, "create")
+		var meta fakeDriveFile
+		json.NewDecoder(r.Body).Decode(&meta)
+		writeJSON(w, f.add(&meta))
+	case r.Method == http.MethodPost && r.URL.Path == "/upload/drive/v3/files" && q.Get("uploadType") == "multipart":
+		f.requests = append(f.requests, "upload-multipart")
+		meta, err := readMultipartUpload(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, f.add(meta))
+	case r.Method == http.MethodPost && r.URL.Path == "/upload/drive/v3/files" && q.Get("uploadType") == "resumable":
+		f.requests = append(f.requests, "upload-start")
+		var meta fakeDriveFile
+		json.NewDecoder(r.Body).Decode(&meta)
+		f.nextID++
+		session := strconv.Itoa(f.nextID)
+		f.sessions[session] = &meta
+		w.Header().Set("Location", f.url+"/upload/session/"+session)
+	case r.Method == http.MethodPost && strings.HasPrefix(r.URL.Path, "/upload/session/"):
+		f.requests = append(f.requests, "upload-chunk")
+		body, _ := io.ReadAll(r.Body)
+		if f.failChunks > 0 {
+			f.failChunks--
+			http.Error(w, "backend error", http.StatusServiceUnavailable)
+			return
+		}
+		meta := f.sessions[strings.TrimPrefix(r.URL.Path, "/upload/session/")]
+		meta.data = append(meta.data, body...)
+		total := r.Header.Get("Content-Range")[strings.LastIndex(r.Header.Get("Content-Range"), "/")+1:]
+		if total == "*" || total != strconv.Itoa(len(meta.data)) {
+			w.Header().Set("X-Http-Status-Code-Override", "308")
+			w.Header().Set("Range", fmt.Sprintf("bytes=0-%d", len(meta.data)-1))
+			return
+		}
+		writeJSON(w, f.add(meta))
+	case r.Method == http.MethodGet && isFile && q.Get("alt") == "media":
+		f.requests = append(f.requests, "download")
+		file, ok := f.files[id]
+		if !ok {
+			http.Error(w, `{"error":{"code":404,"message":"File not found"}}`, http.StatusNotFound)
+			return
+		}
+		w.Write(file.data)
+	case r.Method == http.MethodDelete && isFile:
+		f.requests = append(f.requests, "delete")
+		delete(f.files, id)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "unexpected request "+r.Method+" "+r.URL.String(), http.StatusNotImplemented)
+	}
+}
+
+func readMultipartUpload(r *http.Request) (*fakeDriveFile, error) {
+	_, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, err
+	}
+	mr := multipart.NewReader(r.Body, params["boundary"])
+	part, err := mr.NextPart()
+	if err != nil {
+		return nil, err
+	}
+	var meta fakeDriveFile
+	if err := json.NewDecoder(part).Decode(&meta); err != nil {
+		return nil, err
+	}
+	part, err = mr.NextPart()
+	if err != nil {
+		return nil, err
+	}
+	meta.data, err = io.ReadAll(part)
+	return &meta, err
+}
+
+var (
+	driveNameTerm    = regexp.MustCompile(`name = '((?:[^'\\]|\\.)*)'`)
+	driveParentTerm  = regexp.MustCompile(`'((?:[^'\\]|\\.)*)' in parents`)
+	driveMimeTerm    = regexp.MustCompile(`mimeType (!?=) '([^']*)'`)
+	driveUnescapeStr = strings.NewReplacer(`\'`, `'`, `\\`, `\`)
+)
+
+func (f *fakeDrive) list(w http.ResponseWriter, q map[string][]string) {
+	query := q["q"][0]
+	var matches []*fakeDriveFile
+	for _, id := range f.order {
+		file, ok := f.files[id]
+		if !ok {
+			continue
+		}
+		if m := driveNameTerm.FindStringSubmatch(query); m != nil && file.Name != driveUnescapeStr.Replace(m[1]) {
+			continue
+		}
+		if m := driveParentTerm.FindStringSubmatch(query); m != nil {
+			parent := driveUnescapeStr.Replace(m[1])
+			if len(file.Parents) != 1 || file.Parents[0] != parent {
+				continue
+			}
+		}
+		if m := driveMimeTerm.FindStringSubmatch(query); m != nil && (file.MimeType == m[2]) != (m[1] == "=") {
+			continue
+		}
+		matches = append(matches, file)
+	}
+
+	pageSize, _ := strconv.Atoi(firstValue(q["pageSize"]))
+	start, _ := strconv.Atoi(firstValue(q["pageToken"]))
+	end := len(matches)
+	res := map[string]any{}
+	if pageSize > 0 && start+pageSize < end {
+		end = start + pageSize
+		res["nextPageToken"] = strconv.Itoa(end)
+	}
+	res["files"] = matches[start:end]
+	writeJSON(w, res)
+}
+
+func firstValue(v []string) string {
+	if len(v) == 0 {
+		return ""
+	}
+	return v[0]
+}
+
+func TestGoogleDrive_UploadCreatesFolderPath(t *testing.T) {
+	fake, store := newFakeDrive(t)
+	ctx := context.Background()
+
+	fi, err := store.UploadFile(ctx, "photo.jpg", MimeTypeJPEG, FolderInfo{FolderPath: "project/AB/tree/AB000123/"}, strings.NewReader("tree photo"))
+	if err != nil {
+		t.Fatalf("UploadFile failed: %v", err)
+	}
+	assert.Equal(t, "google", fi.FileStore)
+	assert.Equal(t, "project/AB/tree/AB000123", fi.FilePath)
+	assert.Equal(t, "photo.jpg", fi.FileName)
+	assert.Equal(t, int64(10), fi.Size)
+	want := sha256.Sum256([]byte("tree photo"))
+	assert.Equal(t, hex.EncodeToString(want[:]), fi.SHA256)
+
+	folders := fake.folders()
+	if assert.Len(t, folders, 4) {
+		assert.Equal(t, []string{"root"}, folders[0].Parents)
+		for i, name := range []string{"project", "AB", "tree", "AB000123"} {
+			assert.Equal(t, name, folders[i].Name)
+			if i > 0 {
+				assert.Equal(t, []string{folders[i-1].ID}, folders[i].Parents)
+			}
+		}
+		assert.Equal(t, []string{folders[3].ID}, fake.files[fi.FileID].Parents)
+	}
+
+	// Folder IDs are cached, so a second upload makes no lookups
+	lookups := fake.count("list")
+	_, err = store.UploadFile(ctx, "second.jpg", MimeTypeJPEG, FolderInfo{FolderPath: "project/AB/tree/AB000123"}, strings.NewReader("another"))
+	assert.NoError(t, err)
+	assert.Equal(t, lookups, fake.count("list"))
+
+	// A store without the cache finds the existing folders rather than
+	// creating them again
+	other := newTestDriveStore(t, fake.url)
+	_, err = other.UploadFile(ctx, "third.jpg", MimeTypeJPEG, FolderInfo{FolderPath: "project/AB/tree/AB000124"}, strings.NewReader("third"))
+	assert.NoError(t, err)
+	assert.Len(t, fake.folders(), 5)
+}
+
+func TestGoogleDrive_ResumableUploadRetriesChunk(t *testing.T) {
+	fake, store := newFakeDrive(t)
+	store.ChunkSize = 256 * 1024
+	fake.failChunks = 1
+	ctx := context.Background()
+
+	data := bytes.Repeat([]byte("0123456789"), 60*1024)
+	fi, err := store.UploadFile(ctx, "big.jpg", MimeTypeJPEG, FolderInfo{}, bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("UploadFile failed: %v", err)
+	}
+	assert.Equal(t, 1, fake.count("upload-start"))
+	// Three chunks, one of them sent twice
+	assert.Equal(t, 4, fake.count("upload-chunk"))
+	assert.Equal(t, 0, fake.count("upload-multipart"))
+	assert.Equal(t, data, fake.files[fi.FileID].data)
+	assert.Equal(t, []string{"root"}, fake.files[fi.FileID].Parents)
+	assert.Equal(t, int64(len(data)), fi.Size)
+	want := sha256.Sum256(data)
+	assert.Equal(t, hex.EncodeToString(want[:]), fi.SHA256)
+}
+
+func TestGoogleDrive_ListFilesPaginates(t *testing.T) {
+	fake, store := newFakeDrive(t)
+	ctx := context.Background()
+
+	folder := FolderInfo{FolderPath: "whatsapp"}
+	if _, err := store.resolveFolder(ctx, folder, true); err != nil {
+		t.Fatalf("resolveFolder failed: %v", err)
+	}
+	parent := fake.folders()[0].ID
+	for i := range 2*driveListPageSize + 5 {
+		fake.add(&fakeDriveFile{Name: fmt.Sprintf("photo-%03d.jpg", i), MimeType: "image/jpeg", Parents: []string{parent}, data: []byte("x")})
+	}
+	// Subfolders are not listed as files
+	if _, err := store.resolveFolder(ctx, FolderInfo{FolderPath: "whatsapp/derived"}, true); err != nil {
+		t.Fatalf("resolveFolder failed: %v", err)
+	}
+
+	lookups := fake.count("list")
+	files, err := store.ListFiles(ctx, folder)
+	if err != nil {
+		t.Fatalf("ListFiles failed: %v", err)
+	}
+	assert.Len(t, files, 2*driveListPageSize+5)
+	// The folder is cached, so these are the three pages
+	assert.Equal(t, lookups+3, fake.count("list"))
+	assert.Equal(t, "photo-000.jpg", files[0].FileName)
+	assert.Equal(t, "whatsapp", files[0].FilePath)
+	assert.Equal(t, int64(1), files[0].Size)
+
+	files, err = store.ListFiles(ctx, FolderInfo{FolderPath: "missing/folder"})
+	assert.NoError(t, err)
+	assert.Empty(t, files)
+}
+
+func TestGoogleDrive_DownloadAndDelete(t *testing.T) {
+	fake, store := newFakeDrive(t)
+	ctx := context.Background()
+
+	fi, err := store.UploadFile(ctx, "photo.jpg", MimeTypeJPEG, FolderInfo{FolderPath: "whatsapp"}, strings.NewReader("tree photo"))
+	if err != nil {
+		t.Fatalf("UploadFile failed: %v", err)
+	}
+	reader, cleanup, err := store.DownloadFile(ctx, fi)
+	if err != nil {
+		t.Fatalf("DownloadFile failed: %v", err)
+	}
+	data, _ := io.ReadAll(reader)
+	cleanup()
+	assert.Equal(t, "tree photo", string(data))
+
+	assert.NoError(t, store.DeleteFile(ctx, fi))
+	assert.NotContains(t, fake.files, fi.FileID)
+	_, _, err = store.DownloadFile(ctx, fi)
+	assert.True(t, isDriveNotFound(err))
+}
+
+func TestDriveQuote(t *testing.T) {
+	assert.Equal(t, `'it\'s'`, driveQuote("it's"))
+	assert.Equal(t, `'a\\b'`, driveQuote(`a\b`))
+	assert.Equal(t, "project/AB", cleanFolderPath("/project//AB/"))
+	assert.Equal(t, "", cleanFolderPath("/"))
+}
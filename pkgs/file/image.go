@@ -0,0 +1,294 @@
+package file
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+
+	"sadbhavana/tree-project/pkgs/conf"
+	"sadbhavana/tree-project/pkgs/db"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/tiff"
+	_ "golang.org/x/image/webp"
+)
+
+// Image derivative variants
+const (
+	VariantThumbnail = "thumbnail"
+	VariantWeb       = "web"
+)
+
+// ErrUnsupportedImage is returned for images that cannot be decoded, such as
+// HEIC photos when no converter is installed
+var ErrUnsupportedImage = errors.New("unsupported image format")
+
+// ErrImageTooLarge is returned for images with more pixels than
+// ImageOptions.MaxPixels, which would take too much memory to decode
+var ErrImageTooLarge = errors.New("image too large")
+
+// ImageOptions controls the derivatives made of an image. Sizes are the
+// longest side in pixels.
+type ImageOptions struct {
+	ThumbnailSize int
+	WebSize       int
+	JPEGQuality   int
+	HEICConverter string
+	// MaxPixels is the most pixels an image may have to be decoded; 0 for
+	// no limit
+	MaxPixels int
+}
+
+// ImageOptionsFromConfig reads the derivative sizes from the app config
+func ImageOptionsFromConfig(cfg conf.ImageConfig) ImageOptions {
+	return ImageOptions{
+		ThumbnailSize: cfg.ThumbnailSize,
+		WebSize:       cfg.WebSize,
+		JPEGQuality:   cfg.JPEGQuality,
+		HEICConverter: cfg.HEICConverter,
+		MaxPixels:     cfg.MaxPixels,
+	}
+}
+
+func (o ImageOptions) sizes() map[string]int {
+	return map[string]int{
+		VariantThumbnail: o.ThumbnailSize,
+		VariantWeb:       o.WebSize,
+	}
+}
+
+// Derivative is a resized JPEG copy of an image
+type Derivative struct {
+	Variant string
+	Width   int
+	Height  int
+	Data    []byte
+}
+
+// MakeDerivatives decodes an image, turns it upright and encodes a JPEG of
+// each size in opts. Images are never enlarged. The copies are re-encoded
+// from pixels, so they carry none of the original's EXIF or XMP metadata.
+func MakeDerivatives(ctx context.Context, data []byte, mimeType MimeType, opts ImageOptions) ([]Derivative, error) {
+	img, err := DecodeImage(ctx, data, mimeType, opts)
+	if err != nil {
+		return nil, err
+	}
+	orientation := imageOrientation(data)
+
+	var derivatives []Derivative
+	for _, variant := range []string{VariantThumbnail, VariantWeb} {
+		size := opts.sizes()[variant]
+		if size <= 0 {
+			continue
+		}
+		resized := orient(resizeToFit(img, size), orientation)
+
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, resized, &jpeg.Options{Quality: opts.JPEGQuality}); err != nil {
+			return nil, fmt.Errorf("failed to encode %s image: %w", variant, err)
+		}
+		b := resized.Bounds()
+		derivatives = append(derivatives, Derivative{
+			Variant: variant,
+			Width:   b.Dx(),
+			Height:  b.Dy(),
+			Data:    buf.Bytes(),
+		})
+	}
+	return derivatives, nil
+}
+
+// DecodeImage decodes a JPEG, PNG, GIF, TIFF or WEBP image. HEIC images are
+// first converted to JPEG with the configured converter command. The image
+// size is read from its header first, so images over opts.MaxPixels are
+// refused before any pixels are allocated.
+func DecodeImage(ctx context.Context, data []byte, mimeType MimeType, opts ImageOptions) (image.Image, error) {
+	if mimeType == MimeTypeHEIC {
+		converted, err := convertHEIC(ctx, data, opts.HEICConverter)
+		if err != nil {
+			return nil, err
+		}
+		data = converted
+	}
+
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if errors.Is(err, image.ErrFormat) {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedImage, mimeType)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image size: %w", err)
+	}
+	if opts.MaxPixels > 0 && int64(cfg.Width)*int64(cfg.Height) > int64(opts.MaxPixels) {
+		return nil, fmt.Errorf("%w: %dx%d is over %d pixels", ErrImageTooLarge, cfg.Width, cfg.Height, opts.MaxPixels)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if errors.Is(err, image.ErrFormat) {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedImage, mimeType)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+	return img, nil
+}
+
+// convertHEIC runs an external converter, as there is no HEIC decoder in Go
+func convertHEIC(ctx context.Context, data []byte, converter string) ([]byte, error) {
+	if converter == "" {
+		return nil, fmt.Errorf("%w: no HEIC converter configured", ErrUnsupportedImage)
+	}
+	path, err := exec.LookPath(converter)
+	if err != nil {
+		return nil, fmt.Errorf("%w: HEIC converter %s not found", ErrUnsupportedImage, converter)
+	}
+
+	dir, err := os.MkdirTemp("", "heic-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	in, out := filepath.Join(dir, "in.heic"), filepath.Join(dir, "out.jpg")
+	if err := os.WriteFile(in, data, 0600); err != nil {
+		return nil, err
+	}
+	if output, err := exec.CommandContext(ctx, path, in, out).CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("failed to convert HEIC image: %w: %s", err, bytes.TrimSpace(output))
+	}
+	return os.ReadFile(out)
+}
+
+// imageOrientation is the EXIF orientation of an image, 1 (upright) if it
+// has none
+func imageOrientation(data []byte) int {
+	meta, err := ReadImageMetadata(bytes.NewReader(data))
+	if err != nil {
+		return 1
+	}
+	o, err := strconv.Atoi(meta.Tags["EXIF:Orientation"])
+	if err != nil || o < 1 || o > 8 {
+		return 1
+	}
+	return o
+}
+
+// resizeToFit scales an image down so its longest side is at most size,
+// flattening any transparency onto white since JPEG has no alpha
+func resizeToFit(img image.Image, size int) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w > size || h > size {
+		if w >= h {
+			w, h = size, max(1, h*size/b.Dx())
+		} else {
+			w, h = max(1, w*size/b.Dy()), size
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, b, draw.Over, nil)
+	return dst
+}
+
+// orient undoes an EXIF orientation, so the image displays upright once the
+// orientation tag is gone
+func orient(img image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			var sx, sy int
+			switch orientation {
+			case 2: // flip horizontally
+				sx, sy = w-1-x, y
+			case 3: // rotate 180°
+				sx, sy = w-1-x, h-1-y
+			case 4: // flip vertically
+				sx, sy = x, h-1-y
+			case 5: // transpose
+				sx, sy = y, x
+			case 6: // rotate 90° clockwise
+				sx, sy = y, h-1-x
+			case 7: // transverse
+				sx, sy = w-1-y, h-1-x
+			case 8: // rotate 90° counter-clockwise
+				sx, sy = w-1-y, x
+			}
+			dst.Set(x, y, img.At(b.Min.X+sx, b.Min.Y+sy))
+		}
+	}
+	return dst
+}
+
+// StoreDerivatives makes the derivatives of a stored image from its contents,
+// uploads them to the given folder and records them against the source file.
+// Variants that already exist are left alone. It returns the derivatives it
+// created.
+func StoreDerivatives(ctx context.Context, q *db.Queries, store FileStore, folder FolderInfo, sourceID string, source FileInfo, data []byte, opts ImageOptions) ([]FileInfo, error) {
+	existing, err := q.ListFileDerivatives(ctx, sourceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list derivatives of file %s: %w", sourceID, err)
+	}
+	have := map[string]bool{}
+	for _, d := range existing {
+		have[d.CoreFileDerivative.Variant] = true
+	}
+	if have[VariantThumbnail] && have[VariantWeb] {
+		return nil, nil
+	}
+
+	derivatives, err := MakeDerivatives(ctx, data, source.MimeType, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var created []FileInfo
+	for _, d := range derivatives {
+		if have[d.Variant] {
+			continue
+		}
+		name := fmt.Sprintf("%s-%s.jpg", GetFileName(source.FileName), d.Variant)
+		info, err := store.UploadFile(ctx, name, MimeTypeJPEG, folder, bytes.NewReader(d.Data))
+		if err != nil {
+			return created, fmt.Errorf("failed to upload %s image: %w", d.Variant, err)
+		}
+		fileID, _, err := info.SaveToDB(ctx, q)
+		if err != nil {
+			return created, err
+		}
+		err = q.UpsertFileDerivative(ctx, db.UpsertFileDerivativeParams{
+			SourceFileID: sourceID,
+			Variant:      d.Variant,
+			FileID:       fileID,
+			Width:        int32(d.Width),
+			Height:       int32(d.Height),
+		})
+		if err != nil {
+			return created, fmt.Errorf("failed to record %s image of file %s: %w", d.Variant, sourceID, err)
+		}
+		log.Printf("Stored %dx%d %s image %s for file %s", d.Width, d.Height, d.Variant, info.FileName, sourceID)
+		created = append(created, info)
+	}
+	return created, nil
+}
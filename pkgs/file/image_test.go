@@ -0,0 +1,160 @@
+package file
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// gradient is a w×h image that is red on the left and blue at the bottom, so
+// orientation changes are visible in its corners
+func gradient(w, h int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := color.NRGBA{A: 255}
+			if x < w/2 {
+				c.R = 255
+			}
+			if y >= h/2 {
+				c.B = 255
+			}
+			img.SetNRGBA(x, y, c)
+		}
+	}
+	return img
+}
+
+func encodePNG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("Failed to encode PNG: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// orientedJPEG encodes img as a JPEG carrying an EXIF orientation tag
+func orientedJPEG(t *testing.T, img image.Image, orientation uint16) []byte {
+	t.Helper()
+	var enc bytes.Buffer
+	if err := jpeg.Encode(&enc, img, &jpeg.Options{Quality: 95}); err != nil {
+		t.Fatalf("Failed to encode JPEG: %v", err)
+	}
+	tag := tiffEntry{tag: 0x0112, typ: 3, count: 1, data: binary.LittleEndian.AppendUint16(nil, orientation)}
+	segment := append([]byte("Exif\x00\x00"), buildTIFF([]tiffEntry{tag, asciiEntry(0x010F, "Google")}, nil, nil)...)
+
+	out := []byte{0xFF, 0xD8, 0xFF, 0xE1}
+	out = binary.BigEndian.AppendUint16(out, uint16(len(segment)+2))
+	out = append(out, segment...)
+	return append(out, enc.Bytes()[2:]...)
+}
+
+var testImageOptions = ImageOptions{ThumbnailSize: 40, WebSize: 100, JPEGQuality: 90}
+
+func TestMakeDerivatives_Sizes(t *testing.T) {
+	derivatives, err := MakeDerivatives(context.Background(), encodePNG(t, gradient(200, 100)), MimeTypePNG, testImageOptions)
+	if err != nil {
+		t.Fatalf("MakeDerivatives failed: %v", err)
+	}
+	if !assert.Len(t, derivatives, 2) {
+		return
+	}
+
+	assert.Equal(t, VariantThumbnail, derivatives[0].Variant)
+	assert.Equal(t, [2]int{40, 20}, [2]int{derivatives[0].Width, derivatives[0].Height})
+	assert.Equal(t, VariantWeb, derivatives[1].Variant)
+	assert.Equal(t, [2]int{100, 50}, [2]int{derivatives[1].Width, derivatives[1].Height})
+
+	for _, d := range derivatives {
+		img, format, err := image.Decode(bytes.NewReader(d.Data))
+		if assert.NoError(t, err) {
+			assert.Equal(t, "jpeg", format)
+			assert.Equal(t, d.Width, img.Bounds().Dx())
+		}
+	}
+}
+
+func TestMakeDerivatives_NoEnlarging(t *testing.T) {
+	derivatives, err := MakeDerivatives(context.Background(), encodePNG(t, gradient(30, 60)), MimeTypePNG, testImageOptions)
+	if err != nil {
+		t.Fatalf("MakeDerivatives failed: %v", err)
+	}
+	assert.Equal(t, [2]int{20, 40}, [2]int{derivatives[0].Width, derivatives[0].Height})
+	assert.Equal(t, [2]int{30, 60}, [2]int{derivatives[1].Width, derivatives[1].Height})
+}
+
+func TestMakeDerivatives_FlattensTransparency(t *testing.T) {
+	derivatives, err := MakeDerivatives(context.Background(), encodePNG(t, image.NewNRGBA(image.Rect(0, 0, 10, 10))), MimeTypePNG, testImageOptions)
+	if err != nil {
+		t.Fatalf("MakeDerivatives failed: %v", err)
+	}
+	img, err := jpeg.Decode(bytes.NewReader(derivatives[0].Data))
+	if err != nil {
+		t.Fatalf("Failed to decode JPEG: %v", err)
+	}
+	r, g, b, _ := img.At(5, 5).RGBA()
+	assert.Greater(t, r>>8, uint32(240))
+	assert.Greater(t, g>>8, uint32(240))
+	assert.Greater(t, b>>8, uint32(240))
+}
+
+func TestMakeDerivatives_OrientsAndStripsMetadata(t *testing.T) {
+	// Stored sideways: a phone held upright writes orientation 6
+	data := orientedJPEG(t, gradient(80, 40), 6)
+	meta, err := ReadImageMetadata(bytes.NewReader(data))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "6", meta.Tags["EXIF:Orientation"])
+	}
+
+	derivatives, err := MakeDerivatives(context.Background(), data, MimeTypeJPEG, testImageOptions)
+	if err != nil {
+		t.Fatalf("MakeDerivatives failed: %v", err)
+	}
+	web := derivatives[1]
+	assert.Equal(t, [2]int{40, 80}, [2]int{web.Width, web.Height})
+
+	img, err := jpeg.Decode(bytes.NewReader(web.Data))
+	if err != nil {
+		t.Fatalf("Failed to decode JPEG: %v", err)
+	}
+	// After turning clockwise, the red left half is on top and the blue
+	// bottom half is on the left
+	r, _, b, _ := img.At(30, 5).RGBA()
+	assert.Greater(t, r>>8, uint32(200))
+	assert.Less(t, b>>8, uint32(60))
+	r, _, b, _ = img.At(5, 70).RGBA()
+	assert.Less(t, r>>8, uint32(60))
+	assert.Greater(t, b>>8, uint32(200))
+
+	_, err = ReadImageMetadata(bytes.NewReader(web.Data))
+	assert.True(t, errors.Is(err, ErrNoImageMetadata))
+}
+
+func TestDecodeImage_Unsupported(t *testing.T) {
+	_, err := DecodeImage(context.Background(), []byte("not an image"), MimeTypeJPEG, ImageOptions{})
+	assert.True(t, errors.Is(err, ErrUnsupportedImage))
+
+	_, err = DecodeImage(context.Background(), []byte("ftypheic"), MimeTypeHEIC, ImageOptions{HEICConverter: "no-such-heic-converter"})
+	assert.True(t, errors.Is(err, ErrUnsupportedImage))
+}
+
+func TestDecodeImage_TooLarge(t *testing.T) {
+	data := encodePNG(t, gradient(200, 100))
+
+	_, err := DecodeImage(context.Background(), data, MimeTypePNG, ImageOptions{MaxPixels: 19999})
+	assert.True(t, errors.Is(err, ErrImageTooLarge))
+
+	img, err := DecodeImage(context.Background(), data, MimeTypePNG, ImageOptions{MaxPixels: 20000})
+	if assert.NoError(t, err) {
+		assert.Equal(t, 200, img.Bounds().Dx())
+	}
+}
@@ -2,10 +2,13 @@ package file
 
 import (
 	"context"
-	"fmt"
+	"errors"
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 )
 
 // LocalFileStore implements FileStore using the local filesystem
@@ -18,6 +21,16 @@ func (l *LocalFileStore) ensureRoot() error {
 	return os.MkdirAll(l.Root, 0755)
 }
 
+// relativePath is a file's path below the root. UploadFile records paths with
+// the root included, so both forms are accepted.
+func (l *LocalFileStore) relativePath(file FileInfo) string {
+	p := filepath.Clean(file.FilePath)
+	if rel, ok := strings.CutPrefix(p, filepath.Clean(l.Root)+string(filepath.Separator)); ok {
+		return rel
+	}
+	return p
+}
+
 // ListFiles lists files in a given folder
 func (l *LocalFileStore) ListFiles(ctx context.Context, folder FolderInfo) ([]FileInfo, error) {
 	if err := l.ensureRoot(); err != nil {
@@ -48,31 +61,52 @@ func (l *LocalFileStore) ListFiles(ctx context.Context, folder FolderInfo) ([]Fi
 	return files, nil
 }
 
-// UploadFile saves a file to the local filesystem
+// localBlobDir holds uploaded content, named by its SHA-256
+const localBlobDir = "blobs"
+
+// blobPath is where content with the given SHA-256 is kept, below the root
+func blobPath(sum string) string {
+	return filepath.Join(localBlobDir, sum[:2], sum[2:4], sum)
+}
+
+// UploadFile saves a file under the SHA-256 of its content, so identical
+// uploads share one blob. The folder does not affect where it is kept; the
+// file name is only recorded.
 func (l *LocalFileStore) UploadFile(ctx context.Context, fileName string, fileType MimeType, folderInfo FolderInfo, data io.Reader) (FileInfo, error) {
 	if err := l.ensureRoot(); err != nil {
 		return FileInfo{}, err
 	}
 
-	var filePath string
-	if folderInfo.FolderPath == "" {
-		filePath = fileName
-	} else {
-		filePath = filepath.Join(folderInfo.FolderPath, fileName)
-	}
-	fullPath := filepath.Join(l.Root, filePath)
-	if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+	// Write to a temporary file in the root, so it can be renamed into place
+	tmp, err := os.CreateTemp(l.Root, ".upload-*")
+	if err != nil {
 		return FileInfo{}, err
 	}
+	defer os.Remove(tmp.Name())
 
-	out, err := os.Create(fullPath)
+	hashed := newHashingReader(data)
+	_, err = io.Copy(tmp, hashed)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
 	if err != nil {
 		return FileInfo{}, err
 	}
-	defer out.Close()
 
-	n, err := io.Copy(out, data)
-	if err != nil {
+	sum := hashed.Sum()
+	filePath := blobPath(sum)
+	fullPath := filepath.Join(l.Root, filePath)
+	if _, err := os.Stat(fullPath); errors.Is(err, fs.ErrNotExist) {
+		if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+			return FileInfo{}, err
+		}
+		if err := os.Chmod(tmp.Name(), 0644); err != nil {
+			return FileInfo{}, err
+		}
+		if err := os.Rename(tmp.Name(), fullPath); err != nil {
+			return FileInfo{}, err
+		}
+	} else if err != nil {
 		return FileInfo{}, err
 	}
 
@@ -81,15 +115,22 @@ func (l *LocalFileStore) UploadFile(ctx context.Context, fileName string, fileTy
 		FilePath:  fullPath,
 		MimeType:  fileType,
 		FileName:  fileName,
-		Size:      n,
-		FileURL:   fmt.Sprintf("static/%s", filePath),
+		Size:      hashed.size,
+		SHA256:    sum,
+		FileURL:   localURLPrefix + filepath.ToSlash(filePath),
 	}
 	return file, nil
 }
 
+// ShareURL signs a link to a file for expiry. The link is a path on this
+// site (see LocalFilesPath), so the caller makes it absolute.
+func (l *LocalFileStore) ShareURL(ctx context.Context, file FileInfo, expiry time.Duration) (string, error) {
+	return DefaultURLSigner().SignFor(filepath.ToSlash(l.relativePath(file)), expiry), nil
+}
+
 // DownloadFile opens a file for reading
 func (l *LocalFileStore) DownloadFile(ctx context.Context, file FileInfo) (io.Reader, func(), error) {
-	fullPath := filepath.Join(l.Root, file.FilePath)
+	fullPath := filepath.Join(l.Root, l.relativePath(file))
 	f, err := os.Open(fullPath)
 	if err != nil {
 		return nil, nil, err
@@ -104,7 +145,7 @@ func (l *LocalFileStore) DownloadFile(ctx context.Context, file FileInfo) (io.Re
 
 // DeleteFile removes a file from the filesystem
 func (l *LocalFileStore) DeleteFile(ctx context.Context, file FileInfo) error {
-	fullPath := filepath.Join(l.Root, file.FilePath)
+	fullPath := filepath.Join(l.Root, l.relativePath(file))
 	return os.Remove(fullPath)
 }
 
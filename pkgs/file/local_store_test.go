@@ -0,0 +1,63 @@
+package file
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLocalFileStore_ContentAddressed(t *testing.T) {
+	store := &LocalFileStore{Root: t.TempDir()}
+	ctx := context.Background()
+
+	a, err := store.UploadFile(ctx, "a.jpg", MimeTypeJPEG, FolderInfo{FolderPath: "whatsapp"}, strings.NewReader("same photo"))
+	if err != nil {
+		t.Fatalf("UploadFile failed: %v", err)
+	}
+	b, err := store.UploadFile(ctx, "b.jpg", MimeTypeJPEG, FolderInfo{FolderPath: "elsewhere"}, strings.NewReader("same photo"))
+	if err != nil {
+		t.Fatalf("UploadFile failed: %v", err)
+	}
+
+	want := sha256.Sum256([]byte("same photo"))
+	assert.Equal(t, hex.EncodeToString(want[:]), a.SHA256)
+	assert.Equal(t, a.SHA256, b.SHA256)
+	assert.Equal(t, int64(10), a.Size)
+	assert.Equal(t, a.FilePath, b.FilePath)
+	assert.Equal(t, "a.jpg", a.FileName)
+	assert.Equal(t, "b.jpg", b.FileName)
+	assert.Equal(t, "static/"+filepath.ToSlash(blobPath(a.SHA256)), a.FileURL)
+
+	// One blob and no leftover temporary files
+	entries, err := os.ReadDir(store.Root)
+	if assert.NoError(t, err) && assert.Len(t, entries, 1) {
+		assert.Equal(t, localBlobDir, entries[0].Name())
+	}
+
+	sum, size, err := func() (string, int64, error) {
+		reader, cleanup, err := store.DownloadFile(ctx, b)
+		if err != nil {
+			return "", 0, err
+		}
+		defer cleanup()
+		return checksum(reader)
+	}()
+	if assert.NoError(t, err) {
+		assert.Equal(t, a.SHA256, sum)
+		assert.Equal(t, int64(10), size)
+	}
+}
+
+func TestLocalFileStore_RelativePath(t *testing.T) {
+	store := NewLocalFileStore()
+	assert.Equal(t, filepath.Join("whatsapp", "a.jpg"), store.relativePath(FileInfo{FilePath: "static/whatsapp/a.jpg"}))
+	assert.Equal(t, filepath.Join("whatsapp", "a.jpg"), store.relativePath(FileInfo{FilePath: "whatsapp/a.jpg"}))
+	assert.Equal(t, "", sourceFolder(store, FileInfo{FilePath: "static/a.jpg"}))
+	assert.Equal(t, "whatsapp", sourceFolder(store, FileInfo{FilePath: "static/whatsapp/a.jpg"}))
+}
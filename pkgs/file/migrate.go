@@ -0,0 +1,335 @@
+package file
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"sadbhavana/tree-project/pkgs/db"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const defaultMigrateBatchSize = 50
+
+// MigrateOptions controls a copy of files from one store to another
+type MigrateOptions struct {
+	From string
+	To   string
+	// Folder the copies are saved in. By default each file keeps its folder;
+	// content-addressed local files have none.
+	Folder string
+	// BatchSize is the number of file rows read at a time
+	BatchSize int
+	// Limit stops the run after this many files; 0 moves them all
+	Limit int
+	// DeleteSource removes the original once its row points at the copy
+	DeleteSource bool
+	// DryRun reads and checksums the source files without copying them
+	DryRun bool
+}
+
+// MigrateResult counts what a migration did
+type MigrateResult struct {
+	Copied  int
+	Failed  int
+	Deleted int
+	Bytes   int64
+}
+
+// MigrateFiles copies every file recorded in core.file from one store to
+// another. Each file is checked by SHA-256 after being read back from the
+// destination, and its core.file and stp.U_File rows are switched to the copy
+// in one transaction. Moved files no longer belong to the source store, so an
+// interrupted run resumes where it stopped when started again.
+func MigrateFiles(ctx context.Context, q *db.Queries, opts MigrateOptions) (MigrateResult, error) {
+	var result MigrateResult
+	if opts.From == opts.To {
+		return result, fmt.Errorf("source and destination store are both %s", opts.From)
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = defaultMigrateBatchSize
+	}
+
+	src, err := OpenFileStore(ctx, q, opts.From)
+	if err != nil {
+		return result, fmt.Errorf("failed to open source store %s: %w", opts.From, err)
+	}
+	var dst FileStore
+	if !opts.DryRun {
+		dst, err = OpenFileStore(ctx, q, opts.To)
+		if err != nil {
+			return result, fmt.Errorf("failed to open destination store %s: %w", opts.To, err)
+		}
+	}
+
+	// Files that fail stay in the source store, so the cursor moves past them
+	// rather than relying on moved rows dropping out of the listing
+	var afterID string
+	for opts.Limit == 0 || result.Copied+result.Failed < opts.Limit {
+		batchSize := opts.BatchSize
+		if opts.Limit > 0 {
+			batchSize = min(batchSize, opts.Limit-result.Copied-result.Failed)
+		}
+		rows, err := q.ListStoreFiles(ctx, db.ListStoreFilesParams{
+			FileStore: opts.From,
+			AfterID:   afterID,
+			RowLimit:  int32(batchSize),
+		})
+		if err != nil {
+			return result, fmt.Errorf("failed to list files in store %s: %w", opts.From, err)
+		}
+		if len(rows) == 0 {
+			break
+		}
+
+		for _, row := range rows {
+			if err := ctx.Err(); err != nil {
+				return result, err
+			}
+			afterID = row.ID
+
+			size, deleted, err := migrateFile(ctx, q, src, dst, row, opts)
+			if err != nil {
+				log.Printf("Failed to migrate file %s: %v", row.ID, err)
+				result.Failed++
+				continue
+			}
+			result.Copied++
+			result.Bytes += size
+			if deleted {
+				result.Deleted++
+			}
+		}
+	}
+	return result, nil
+}
+
+// migrateFile copies one file and points its rows at the copy
+func migrateFile(ctx context.Context, q *db.Queries, src, dst FileStore, row db.CoreFile, opts MigrateOptions) (int64, bool, error) {
+	source, err := ExtractFileInfoFromDB(row)
+	if err != nil {
+		return 0, false, err
+	}
+	folder := FolderInfo{FolderPath: opts.Folder}
+	if folder.FolderPath == "" {
+		folder.FolderPath = sourceFolder(src, source)
+	}
+
+	if opts.DryRun {
+		reader, cleanup, err := src.DownloadFile(ctx, source)
+		if err != nil {
+			return 0, false, fmt.Errorf("failed to download from %s: %w", opts.From, err)
+		}
+		sum, size, err := checksum(reader)
+		cleanup()
+		if err != nil {
+			return 0, false, fmt.Errorf("failed to read from %s: %w", opts.From, err)
+		}
+		log.Printf("Would copy file %s (%s, %d bytes, sha256 %s) to %s/%s", row.ID, source.FileName, size, sum, opts.To, folder.FolderPath)
+		return size, false, nil
+	}
+
+	copied, sum, err := CopyFile(ctx, src, dst, source, folder)
+	var unverified *UnverifiedCopyError
+	if errors.As(err, &unverified) {
+		removeCopy(ctx, q, dst, opts.To, row.ID, unverified.Copy, unverified.SHA256)
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	if err := recordMove(ctx, row.ID, opts.From, opts.To, source, copied); err != nil {
+		removeCopy(ctx, q, dst, opts.To, row.ID, copied, sum)
+		return 0, false, err
+	}
+	log.Printf("Copied file %s (%s, %d bytes, sha256 %s) to %s", row.ID, source.FileName, copied.Size, sum, opts.To)
+
+	if !opts.DeleteSource {
+		return copied.Size, false, nil
+	}
+	// The row already points at the copy, so a leftover original is only
+	// wasted space. Other files may still share its content.
+	shared, err := sharedContent(ctx, q, opts.From, sum)
+	if err != nil || shared {
+		return copied.Size, false, err
+	}
+	if err := src.DeleteFile(ctx, source); err != nil {
+		log.Printf("Failed to delete original of file %s from %s: %v", row.ID, opts.From, err)
+		return copied.Size, false, nil
+	}
+	return copied.Size, true, nil
+}
+
+// UnverifiedCopyError is returned by CopyFile when the copy read back from
+// the destination does not match the source. The copy is left in place, as a
+// content-addressed store may keep other files in the same blob.
+type UnverifiedCopyError struct {
+	Copy   FileInfo
+	SHA256 string
+	Err    error
+}
+
+func (e *UnverifiedCopyError) Error() string {
+	return "failed to verify copy: " + e.Err.Error()
+}
+
+func (e *UnverifiedCopyError) Unwrap() error {
+	return e.Err
+}
+
+// CopyFile copies a file between stores through a temporary file. The copy is
+// read back from the destination and must match the source's SHA-256, or an
+// *UnverifiedCopyError is returned. It returns the copy and its checksum.
+func CopyFile(ctx context.Context, src, dst FileStore, source FileInfo, folder FolderInfo) (FileInfo, string, error) {
+	reader, cleanup, err := src.DownloadFile(ctx, source)
+	if err != nil {
+		return FileInfo{}, "", fmt.Errorf("failed to download source: %w", err)
+	}
+	tmp, err := os.CreateTemp("", "file-copy-*")
+	if err != nil {
+		cleanup()
+		return FileInfo{}, "", err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	hashed := newHashingReader(reader)
+	size, err := io.Copy(tmp, hashed)
+	cleanup()
+	if err != nil {
+		return FileInfo{}, "", fmt.Errorf("failed to read source: %w", err)
+	}
+	sum := hashed.Sum()
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return FileInfo{}, "", err
+	}
+
+	copied, err := dst.UploadFile(ctx, source.FileName, source.MimeType, folder, tmp)
+	if err != nil {
+		return FileInfo{}, "", fmt.Errorf("failed to upload copy: %w", err)
+	}
+
+	reader, cleanup, err = dst.DownloadFile(ctx, copied)
+	if err == nil {
+		var copySum string
+		var copySize int64
+		copySum, copySize, err = checksum(reader)
+		cleanup()
+		if err == nil && (copySum != sum || copySize != size) {
+			err = fmt.Errorf("checksum mismatch: source %s (%d bytes), copy %s (%d bytes)", sum, size, copySum, copySize)
+		}
+	}
+	if err != nil {
+		return FileInfo{}, "", &UnverifiedCopyError{Copy: copied, SHA256: sum, Err: err}
+	}
+	copied.Size = size
+	copied.SHA256 = sum
+	return copied, sum, nil
+}
+
+// sourceFolder is the folder a file is kept in, so copies keep the layout of
+// the source store
+func sourceFolder(store FileStore, f FileInfo) string {
+	var dir string
+	switch s := store.(type) {
+	case *LocalFileStore:
+		// Content-addressed blobs have no folder of their own
+		rel := filepath.ToSlash(s.relativePath(f))
+		if strings.HasPrefix(rel, localBlobDir+"/") {
+			return ""
+		}
+		dir = path.Dir(rel)
+	case *S3FileStore:
+		key := strings.TrimPrefix(objectKey(f), strings.Trim(s.Config.Prefix, "/"))
+		dir = path.Dir(strings.TrimPrefix(key, "/"))
+	default:
+		// Drive records the folder path itself
+		dir = f.FilePath
+	}
+	if dir == "." {
+		return ""
+	}
+	return dir
+}
+
+// removeCopy deletes a copy that will not be used, unless other files in the
+// store share its content
+func removeCopy(ctx context.Context, q *db.Queries, dst FileStore, store, fileID string, copied FileInfo, sum string) {
+	cleanupCtx := context.WithoutCancel(ctx)
+	if shared, err := sharedContent(cleanupCtx, q, store, sum); err != nil || shared {
+		return
+	}
+	if err := dst.DeleteFile(cleanupCtx, copied); err != nil {
+		log.Printf("Failed to remove copy of file %s from %s: %v", fileID, store, err)
+	}
+}
+
+// sharedContent reports whether any file in a store has the given content,
+// which content-addressed stores keep as a single blob
+func sharedContent(ctx context.Context, q *db.Queries, store, sum string) (bool, error) {
+	n, err := q.CountStoreFilesWithChecksum(ctx, db.CountStoreFilesWithChecksumParams{
+		FileStore: store,
+		Sha256:    pgtype.Text{String: sum, Valid: true},
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to count files sharing content in %s: %w", store, err)
+	}
+	return n > 0, nil
+}
+
+// recordMove switches a file's core.file and stp.U_File rows to its copy in
+// one transaction
+func recordMove(ctx context.Context, fileID, from, to string, source, copied FileInfo) error {
+	q, tx, err := db.NewQueriesWithTx(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get database queries: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	params := db.MoveFileParams{
+		ToStore:     to,
+		FileStoreID: pgtype.Text{String: copied.FileID, Valid: copied.FileID != ""},
+		FilePath:    pgtype.Text{String: copied.FilePath, Valid: copied.FilePath != ""},
+		FileName:    pgtype.Text{String: copied.FileName, Valid: copied.FileName != ""},
+		FileUrl:     pgtype.Text{String: copied.FileURL, Valid: copied.FileURL != ""},
+		Sha256:      pgtype.Text{String: copied.SHA256, Valid: copied.SHA256 != ""},
+		SizeBytes:   pgtype.Int8{Int64: copied.Size, Valid: copied.SHA256 != ""},
+		ID:          fileID,
+		FromStore:   from,
+	}
+	if copied.Expiration != nil {
+		params.FileExpiration = pgtype.Timestamptz{Time: *copied.Expiration, Valid: true}
+	}
+	moved, err := q.MoveFile(ctx, params)
+	if err != nil {
+		return fmt.Errorf("failed to update file %s: %w", fileID, err)
+	}
+	if moved == 0 {
+		return fmt.Errorf("file %s is no longer in store %s", fileID, from)
+	}
+
+	_, err = q.MoveProviderFile(ctx, db.MoveProviderFileParams{
+		NewFileStoreID: copied.FileID,
+		NewFilePath:    copied.FilePath,
+		NewFileName:    copied.FileName,
+		FromStore:      from,
+		ToStore:        to,
+		FileStoreID:    source.FileID,
+		FilePath:       source.FilePath,
+		FileName:       source.FileName,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update provider file for %s: %w", fileID, err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package file
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// corruptingStore flips a byte of everything read back from it
+type corruptingStore struct {
+	*LocalFileStore
+}
+
+func (c corruptingStore) DownloadFile(ctx context.Context, file FileInfo) (io.Reader, func(), error) {
+	reader, cleanup, err := c.LocalFileStore.DownloadFile(ctx, file)
+	if err != nil {
+		return nil, nil, err
+	}
+	data, _ := io.ReadAll(reader)
+	data[0] ^= 0xFF
+	return bytes.NewReader(data), cleanup, nil
+}
+
+func TestCopyFile_LocalToS3(t *testing.T) {
+	fake, srv := newFakeS3(t)
+	dst := newTestS3Store(t, srv.URL)
+	src := &LocalFileStore{Root: filepath.Join(t.TempDir(), "static")}
+	ctx := context.Background()
+
+	source, err := src.UploadFile(ctx, "tree.jpg", MimeTypeJPEG, FolderInfo{FolderPath: "whatsapp"}, strings.NewReader("tree photo"))
+	if err != nil {
+		t.Fatalf("UploadFile failed: %v", err)
+	}
+	// Local files are content-addressed, so they have no folder to keep
+	assert.Equal(t, "", sourceFolder(src, source))
+
+	copied, sum, err := CopyFile(ctx, src, dst, source, FolderInfo{FolderPath: "whatsapp"})
+	if err != nil {
+		t.Fatalf("CopyFile failed: %v", err)
+	}
+	assert.Equal(t, "s3", copied.FileStore)
+	assert.Equal(t, "trees/whatsapp/tree.jpg", copied.FileID)
+	assert.Equal(t, int64(10), copied.Size)
+	assert.Equal(t, copied.SHA256, sum)
+	want := sha256.Sum256([]byte("tree photo"))
+	assert.Equal(t, hex.EncodeToString(want[:]), sum)
+	assert.Equal(t, "tree photo", string(fake.objects["trees/whatsapp/tree.jpg"]))
+	assert.Equal(t, "whatsapp", sourceFolder(dst, copied))
+}
+
+func TestCopyFile_ChecksumMismatch(t *testing.T) {
+	root := t.TempDir()
+	src := &LocalFileStore{Root: filepath.Join(root, "src")}
+	dst := corruptingStore{&LocalFileStore{Root: filepath.Join(root, "dst")}}
+	ctx := context.Background()
+
+	source, err := src.UploadFile(ctx, "tree.jpg", MimeTypeJPEG, FolderInfo{}, strings.NewReader("tree photo"))
+	if err != nil {
+		t.Fatalf("UploadFile failed: %v", err)
+	}
+
+	_, _, err = CopyFile(ctx, src, dst, source, FolderInfo{})
+	assert.ErrorContains(t, err, "checksum mismatch")
+
+	// The unverified copy is left for the caller, which knows whether other
+	// files share its blob
+	var unverified *UnverifiedCopyError
+	if !assert.True(t, errors.As(err, &unverified)) {
+		return
+	}
+	assert.Equal(t, source.SHA256, unverified.SHA256)
+	_, err = os.Stat(filepath.Join(root, "dst", blobPath(source.SHA256)))
+	assert.NoError(t, err)
+}
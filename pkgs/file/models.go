@@ -30,6 +30,8 @@ const (
 	MimeTypeMP4         MimeType = "mp4"
 	MimeTypeEml         MimeType = "eml"
 	MimeTypeGIF         MimeType = "gif"
+	MimeTypeWEBP        MimeType = "webp"
+	MimeTypeHEIC        MimeType = "heic"
 	MimeTypeUnknown     MimeType = "unknown"
 )
 
@@ -43,6 +45,10 @@ func (m MimeType) ToAmazonMimeType() (string, error) {
 		return "image/jpeg", nil
 	case MimeTypeGIF:
 		return "image/gif", nil
+	case MimeTypeWEBP:
+		return "image/webp", nil
+	case MimeTypeHEIC:
+		return "image/heic", nil
 	case MimeTypeTiff:
 		return "image/tiff", nil
 	case MimeTypePDF:
@@ -81,6 +87,10 @@ func (m MimeType) ToGoogleMimeType() (string, error) {
 		return "image/jpeg", nil
 	case MimeTypeGIF:
 		return "image/gif", nil
+	case MimeTypeWEBP:
+		return "image/webp", nil
+	case MimeTypeHEIC:
+		return "image/heic", nil
 	case MimeTypeTiff:
 		return "image/tiff", nil
 	case MimeTypePDF:
@@ -126,6 +136,10 @@ func FromGoogleMimeType(mimeType string) (MimeType, error) {
 		return MimeTypeJPEG, nil
 	case "image/gif":
 		return MimeTypeGIF, nil
+	case "image/webp":
+		return MimeTypeWEBP, nil
+	case "image/heic", "image/heif":
+		return MimeTypeHEIC, nil
 	case "image/tiff":
 		return MimeTypeTiff, nil
 	case "application/pdf", "pdf":
@@ -171,6 +185,10 @@ func FromAmazonMimeType(mimeType string) (MimeType, error) {
 		return MimeTypeJPEG, nil
 	case "image/gif":
 		return MimeTypeGIF, nil
+	case "image/webp":
+		return MimeTypeWEBP, nil
+	case "image/heic", "image/heif":
+		return MimeTypeHEIC, nil
 	case "image/tiff":
 		return MimeTypeTiff, nil
 	case "application/pdf", "pdf":
@@ -251,6 +269,10 @@ func FromExtension(ext string) (MimeType, error) {
 		return MimeTypeJPEG, nil
 	case "gif":
 		return MimeTypeGIF, nil
+	case "webp":
+		return MimeTypeWEBP, nil
+	case "heic", "heif":
+		return MimeTypeHEIC, nil
 	case "tiff":
 		return MimeTypeTiff, nil
 	case "pdf":
@@ -286,7 +308,7 @@ func FromExtension(ext string) (MimeType, error) {
 
 // FileInfo represents information about an uploaded file
 type FileInfo struct {
-	FileStore  string            `json:"file_store" validate:"required" oneof:"local google"`
+	FileStore  string            `json:"file_store" validate:"required" oneof:"local google s3"`
 	FileID     string            `json:"file_id" validate:"required"`
 	FilePath   string            `json:"file_path,omitempty"`
 	FileURL    string            `json:"file_url,omitempty"`
@@ -294,6 +316,7 @@ type FileInfo struct {
 	FileName   string            `json:"file_name" validate:"required"`
 	MimeType   MimeType          `json:"mime_type" validate:"required"`
 	Expiration *time.Time        `json:"expiration,omitempty"`
+	SHA256     string            `json:"sha256,omitempty"`
 	Metadata   map[string]string `json:"metadata,omitempty"`
 }
 
@@ -305,7 +328,7 @@ type FolderInfo struct {
 
 func (m MimeType) IsImage() bool {
 	switch m {
-	case MimeTypePNG, MimeTypeJPEG, MimeTypeGIF, MimeTypeTiff:
+	case MimeTypePNG, MimeTypeJPEG, MimeTypeGIF, MimeTypeTiff, MimeTypeWEBP, MimeTypeHEIC:
 		return true
 	default:
 		return false
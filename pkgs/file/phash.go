@@ -0,0 +1,153 @@
+package file
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"math"
+	"math/bits"
+	"sort"
+
+	"sadbhavana/tree-project/pkgs/db"
+
+	"github.com/jackc/pgx/v5"
+	"golang.org/x/image/draw"
+)
+
+// ImageHashes are perceptual hashes of an image. Copies of the same photo,
+// even resized, recompressed or photographed off a screen, have hashes a
+// small Hamming distance apart.
+type ImageHashes struct {
+	// DHash compares the brightness of neighbouring pixels
+	DHash uint64
+	// PHash compares low frequencies of the image's cosine transform
+	PHash uint64
+}
+
+// HashDistance is the number of bits that differ between two hashes
+func HashDistance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+// hashSourceSize bounds the image the hashes are computed from; both hashes
+// only look at a few dozen pixels
+const hashSourceSize = 256
+
+// HashImage decodes an image, turns it upright and computes its hashes
+func HashImage(ctx context.Context, data []byte, mimeType MimeType, opts ImageOptions) (ImageHashes, error) {
+	img, err := DecodeImage(ctx, data, mimeType, opts)
+	if err != nil {
+		return ImageHashes{}, err
+	}
+	img = orient(resizeToFit(img, hashSourceSize), imageOrientation(data))
+	return ImageHashes{DHash: dHash(img), PHash: pHash(img)}, nil
+}
+
+// grayscale scales an image to w×h grey levels
+func grayscale(img image.Image, w, h int) *image.Gray {
+	g := image.NewGray(image.Rect(0, 0, w, h))
+	draw.ApproxBiLinear.Scale(g, g.Bounds(), img, img.Bounds(), draw.Src, nil)
+	return g
+}
+
+// dHash sets a bit for each pixel of a 9×8 thumbnail that is brighter than
+// its right-hand neighbour
+func dHash(img image.Image) uint64 {
+	g := grayscale(img, 9, 8)
+	var hash uint64
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			hash <<= 1
+			if g.GrayAt(x, y).Y > g.GrayAt(x+1, y).Y {
+				hash |= 1
+			}
+		}
+	}
+	return hash
+}
+
+// pHash sets a bit for each of the 8×8 lowest frequencies of a 32×32
+// thumbnail's cosine transform that is above their median
+func pHash(img image.Image) uint64 {
+	const n, k = 32, 8
+	g := grayscale(img, n, n)
+
+	var cos [k][n]float64
+	for u := 0; u < k; u++ {
+		for x := 0; x < n; x++ {
+			cos[u][x] = math.Cos(float64(2*x+1) * float64(u) * math.Pi / (2 * n))
+		}
+	}
+
+	// Transform the rows, then the columns, keeping only the low frequencies
+	var rows [n][k]float64
+	for y := 0; y < n; y++ {
+		for u := 0; u < k; u++ {
+			var sum float64
+			for x := 0; x < n; x++ {
+				sum += float64(g.GrayAt(x, y).Y) * cos[u][x]
+			}
+			rows[y][u] = sum
+		}
+	}
+	coeffs := make([]float64, 0, k*k)
+	for v := 0; v < k; v++ {
+		for u := 0; u < k; u++ {
+			var sum float64
+			for y := 0; y < n; y++ {
+				sum += rows[y][u] * cos[v][y]
+			}
+			coeffs = append(coeffs, sum)
+		}
+	}
+
+	// The first coefficient is the average brightness, which says nothing
+	// about the picture, so it is left out of the median
+	sorted := append([]float64(nil), coeffs[1:]...)
+	sort.Float64s(sorted)
+	median := (sorted[len(sorted)/2-1] + sorted[len(sorted)/2]) / 2
+
+	var hash uint64
+	for _, c := range coeffs {
+		hash <<= 1
+		if c > median {
+			hash |= 1
+		}
+	}
+	return hash
+}
+
+// StoreImageHash computes the hashes of a stored image from its contents and
+// records them against the file, unless they have been recorded already
+func StoreImageHash(ctx context.Context, q *db.Queries, fileID string, fileInfo FileInfo, data []byte, opts ImageOptions) (ImageHashes, error) {
+	existing, err := q.GetFileHash(ctx, fileID)
+	if err == nil {
+		return ImageHashes{DHash: uint64(existing.Dhash), PHash: uint64(existing.Phash)}, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return ImageHashes{}, fmt.Errorf("failed to get hash of file %s: %w", fileID, err)
+	}
+
+	hashes, err := HashImage(ctx, data, fileInfo.MimeType, opts)
+	if err != nil {
+		return ImageHashes{}, err
+	}
+	if err := SaveImageHash(ctx, q, fileID, hashes); err != nil {
+		return ImageHashes{}, err
+	}
+	return hashes, nil
+}
+
+// SaveImageHash records the hashes of a file, replacing any it had
+func SaveImageHash(ctx context.Context, q *db.Queries, fileID string, hashes ImageHashes) error {
+	err := q.UpsertFileHash(ctx, db.UpsertFileHashParams{
+		FileID: fileID,
+		Dhash:  int64(hashes.DHash),
+		Phash:  int64(hashes.PHash),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record hash of file %s: %w", fileID, err)
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package file
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// scene draws a few overlapping shapes, so the hashes have some structure to
+// work with
+func scene(w, h int, seed int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			fx, fy := float64(x)/float64(w), float64(y)/float64(h)
+			c := color.NRGBA{R: uint8(200 * fx), G: uint8(180 * fy), B: 90, A: 255}
+			cx, cy := 0.3+0.1*float64(seed), 0.6-0.1*float64(seed)
+			if (fx-cx)*(fx-cx)+(fy-cy)*(fy-cy) < 0.04 {
+				c = color.NRGBA{R: 250, G: 250, B: 250, A: 255}
+			}
+			if fx > 0.7 && fy < 0.3+0.2*float64(seed) {
+				c = color.NRGBA{A: 255}
+			}
+			img.SetNRGBA(x, y, c)
+		}
+	}
+	return img
+}
+
+func encodeJPEG(t *testing.T, img image.Image, quality int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+		t.Fatalf("Failed to encode JPEG: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func hashOf(t *testing.T, data []byte, mimeType MimeType) ImageHashes {
+	t.Helper()
+	h, err := HashImage(context.Background(), data, mimeType, ImageOptions{})
+	if err != nil {
+		t.Fatalf("HashImage failed: %v", err)
+	}
+	return h
+}
+
+func TestHashImage_ResizedAndRecompressed(t *testing.T) {
+	original := hashOf(t, encodePNG(t, scene(640, 480, 0)), MimeTypePNG)
+	resent := hashOf(t, encodeJPEG(t, scene(320, 240, 0), 40), MimeTypeJPEG)
+
+	assert.LessOrEqual(t, HashDistance(original.PHash, resent.PHash), 4)
+	assert.LessOrEqual(t, HashDistance(original.DHash, resent.DHash), 6)
+}
+
+func TestHashImage_Rotated(t *testing.T) {
+	upright := hashOf(t, encodeJPEG(t, scene(400, 200, 0), 90), MimeTypeJPEG)
+
+	// The same photo stored sideways with an orientation tag
+	sideways := image.NewNRGBA(image.Rect(0, 0, 200, 400))
+	src := scene(400, 200, 0)
+	for y := 0; y < 400; y++ {
+		for x := 0; x < 200; x++ {
+			sideways.Set(x, y, src.At(399-y, x))
+		}
+	}
+	tagged := hashOf(t, orientedJPEG(t, sideways, 6), MimeTypeJPEG)
+
+	assert.LessOrEqual(t, HashDistance(upright.PHash, tagged.PHash), 4)
+}
+
+func TestHashImage_DifferentPhotos(t *testing.T) {
+	a := hashOf(t, encodePNG(t, scene(400, 300, 0)), MimeTypePNG)
+	b := hashOf(t, encodePNG(t, scene(400, 300, 2)), MimeTypePNG)
+
+	assert.Greater(t, HashDistance(a.PHash, b.PHash), 8)
+}
+
+func TestHashDistance(t *testing.T) {
+	assert.Equal(t, 0, HashDistance(0xF0F0, 0xF0F0))
+	assert.Equal(t, 64, HashDistance(0, ^uint64(0)))
+	assert.Equal(t, 2, HashDistance(0b1010, 0b0110))
+}
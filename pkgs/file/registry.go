@@ -0,0 +1,189 @@
+package file
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"sadbhavana/tree-project/pkgs/auth"
+	"sadbhavana/tree-project/pkgs/conf"
+	"sadbhavana/tree-project/pkgs/db"
+	"sadbhavana/tree-project/pkgs/providers"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ProviderConfig holds the settings a file store is built from, taken from
+// the stp.U_Provider row of the same name. Nested JSON values are kept as
+// their JSON text.
+type ProviderConfig struct {
+	Name        string
+	AuthConfig  map[string]string
+	TokenConfig map[string]string
+}
+
+// Settings merges the auth and token config, token values taking precedence
+func (p ProviderConfig) Settings() map[string]string {
+	settings := make(map[string]string, len(p.AuthConfig)+len(p.TokenConfig))
+	for k, v := range p.AuthConfig {
+		settings[k] = v
+	}
+	for k, v := range p.TokenConfig {
+		settings[k] = v
+	}
+	return settings
+}
+
+// StoreFactory builds a file store from its provider's settings. q is nil when
+// the store is built without a database.
+type StoreFactory func(ctx context.Context, q *db.Queries, provider ProviderConfig) (FileStore, error)
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]StoreFactory{}
+)
+
+// RegisterFileStore makes a file store available under a provider name. The
+// name is recorded against every file the store saves, so it must not change
+// once files have been stored.
+func RegisterFileStore(name string, factory StoreFactory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if factory == nil {
+		panic("file: RegisterFileStore factory is nil")
+	}
+	if _, dup := registry[name]; dup {
+		panic("file: RegisterFileStore called twice for " + name)
+	}
+	registry[name] = factory
+}
+
+// FileStores lists the registered provider names
+func FileStores() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func lookupFileStore(name string) (StoreFactory, error) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	factory, ok := registry[name]
+	if !ok {
+		return nil, fmt.Errorf("unsupported file store type: %s", name)
+	}
+	return factory, nil
+}
+
+// OpenFileStore builds the file store registered under name, configured from
+// its stp.U_Provider row. A store without a provider row gets empty settings
+// and falls back to its defaults.
+func OpenFileStore(ctx context.Context, q *db.Queries, name string) (FileStore, error) {
+	factory, err := lookupFileStore(name)
+	if err != nil {
+		return nil, err
+	}
+	provider, err := GetProviderConfig(ctx, q, name)
+	if err != nil {
+		return nil, err
+	}
+	return factory(ctx, q, provider)
+}
+
+// GetProviderConfig reads a provider's settings from stp.U_Provider. Without
+// a database the settings are empty.
+func GetProviderConfig(ctx context.Context, q *db.Queries, name string) (ProviderConfig, error) {
+	provider := ProviderConfig{Name: name}
+	if q == nil {
+		return provider, nil
+	}
+	row, err := q.GetFileStoreProvider(ctx, name)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return provider, nil
+	}
+	if err != nil {
+		return provider, fmt.Errorf("failed to get provider %s: %w", name, err)
+	}
+	// Secrets are stored encrypted; only the auth package can open them
+	authConfig, err := auth.OpenProviderSettings(row.Authconfig)
+	if err != nil {
+		return provider, fmt.Errorf("invalid auth config for provider %s: %w", name, err)
+	}
+	tokenConfig, err := auth.OpenProviderSettings(row.Tokenconfig)
+	if err != nil {
+		return provider, fmt.Errorf("invalid token config for provider %s: %w", name, err)
+	}
+	if provider.AuthConfig, err = decodeProviderSettings(authConfig); err != nil {
+		return provider, fmt.Errorf("invalid auth config for provider %s: %w", name, err)
+	}
+	if provider.TokenConfig, err = decodeProviderSettings(tokenConfig); err != nil {
+		return provider, fmt.Errorf("invalid token config for provider %s: %w", name, err)
+	}
+	return provider, nil
+}
+
+// decodeProviderSettings flattens a JSON object into strings, so settings can
+// be written as "use_path_style": true as well as "true"
+func decodeProviderSettings(data []byte) (map[string]string, error) {
+	if len(data) == 0 {
+		return map[string]string{}, nil
+	}
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	settings := make(map[string]string, len(raw))
+	for k, v := range raw {
+		if string(v) == "null" {
+			continue
+		}
+		var s string
+		if err := json.Unmarshal(v, &s); err == nil {
+			settings[k] = s
+		} else {
+			settings[k] = string(v)
+		}
+	}
+	return settings, nil
+}
+
+func init() {
+	RegisterFileStore("local", func(ctx context.Context, q *db.Queries, provider ProviderConfig) (FileStore, error) {
+		store := NewLocalFileStore()
+		if root := provider.Settings()["root"]; root != "" {
+			store.Root = root
+		}
+		return store, nil
+	})
+	RegisterFileStore("google", func(ctx context.Context, q *db.Queries, provider ProviderConfig) (FileStore, error) {
+		if q == nil {
+			return nil, fmt.Errorf("google file store needs the database for its token")
+		}
+		tokens, err := auth.DefaultTokenManager()
+		if err != nil {
+			return nil, err
+		}
+		return NewGoogleDriveFileStore(ctx, tokens.TokenSource(ctx, providers.GOOGLE_PROVIDER))
+	})
+	auth.OnConnect(providers.GOOGLE_PROVIDER, driveFolders.clear)
+	RegisterFileStore("s3", func(ctx context.Context, q *db.Queries, provider ProviderConfig) (FileStore, error) {
+		// Without a provider row the store uses the S3 settings from the environment
+		settings := provider.Settings()
+		if len(settings) == 0 {
+			return NewS3FileStore(S3ConfigFromConfig(conf.GetConfig().S3))
+		}
+		s3Config, err := S3ConfigFromMap(settings)
+		if err != nil {
+			return nil, err
+		}
+		return NewS3FileStore(s3Config)
+	})
+}
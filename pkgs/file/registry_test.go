@@ -0,0 +1,73 @@
+package file
+
+import (
+	"context"
+	"testing"
+
+	"sadbhavana/tree-project/pkgs/db"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodeProviderSettings(t *testing.T) {
+	settings, err := decodeProviderSettings([]byte(`{"bucket":"tree-photos","use_path_style":true,"part_size":10485760,"tags":{"a":1},"prefix":null}`))
+	if assert.NoError(t, err) {
+		assert.Equal(t, map[string]string{
+			"bucket":         "tree-photos",
+			"use_path_style": "true",
+			"part_size":      "10485760",
+			"tags":           `{"a":1}`,
+		}, settings)
+	}
+
+	_, err = decodeProviderSettings([]byte(`[1,2]`))
+	assert.Error(t, err)
+}
+
+func TestProviderConfig_Settings(t *testing.T) {
+	p := ProviderConfig{
+		AuthConfig:  map[string]string{"bucket": "photos", "access_key_id": "old"},
+		TokenConfig: map[string]string{"access_key_id": "new"},
+	}
+	assert.Equal(t, map[string]string{"bucket": "photos", "access_key_id": "new"}, p.Settings())
+}
+
+func TestNewFileStore(t *testing.T) {
+	store, err := NewFileStore("local", map[string]string{"root": "/tmp/photos"})
+	if assert.NoError(t, err) {
+		assert.Equal(t, "/tmp/photos", store.(*LocalFileStore).Root)
+	}
+
+	store, err = NewFileStore("s3", map[string]string{"bucket": "photos", "endpoint": "http://minio:9000"})
+	if assert.NoError(t, err) {
+		assert.Equal(t, "photos", store.(*S3FileStore).Config.Bucket)
+	}
+
+	_, err = NewFileStore("google", nil)
+	assert.Error(t, err)
+	_, err = NewFileStore("dropbox", nil)
+	assert.ErrorContains(t, err, "unsupported file store type: dropbox")
+}
+
+func TestRegisterFileStore(t *testing.T) {
+	RegisterFileStore("test-memory", func(ctx context.Context, q *db.Queries, provider ProviderConfig) (FileStore, error) {
+		return &LocalFileStore{Root: provider.Settings()["root"]}, nil
+	})
+	defer func() {
+		registryMu.Lock()
+		delete(registry, "test-memory")
+		registryMu.Unlock()
+	}()
+
+	assert.Contains(t, FileStores(), "test-memory")
+	assert.Panics(t, func() {
+		RegisterFileStore("test-memory", func(ctx context.Context, q *db.Queries, provider ProviderConfig) (FileStore, error) {
+			return nil, nil
+		})
+	})
+
+	store, err := OpenFileStore(context.Background(), nil, "test-memory")
+	if assert.NoError(t, err) {
+		assert.IsType(t, &LocalFileStore{}, store)
+	}
+}
@@ -0,0 +1,463 @@
+package file
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"sadbhavana/tree-project/pkgs/conf"
+	"sadbhavana/tree-project/pkgs/db"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+const (
+	// s3MinPartSize is the smallest part S3 accepts in a multipart upload,
+	// other than the last
+	s3MinPartSize = 5 << 20
+	// s3DefaultPartSize is used when no part size is configured
+	s3DefaultPartSize = 8 << 20
+	// s3MaxPresignExpiry is the longest a SigV4 presigned URL can be valid
+	s3MaxPresignExpiry = 7 * 24 * time.Hour
+	// s3ProbeKey is presigned to learn where keys start in this store's links
+	s3ProbeKey = "probe"
+)
+
+// S3Config locates a bucket on AWS S3 or an S3-compatible server such as
+// MinIO
+type S3Config struct {
+	// Endpoint is the server's base URL; empty for AWS
+	Endpoint        string
+	Region          string
+	Bucket          string
+	AccessKeyID     string
+	SecretAccessKey string
+	// UsePathStyle addresses objects as endpoint/bucket/key rather than
+	// bucket.endpoint/key, which most self-hosted servers need
+	UsePathStyle bool
+	// Prefix is prepended to every object key
+	Prefix string
+	// PresignExpiry is how long download URLs stay valid
+	PresignExpiry time.Duration
+	// PartSize is the size of each part of a multipart upload. Files smaller
+	// than one part are uploaded in a single request.
+	PartSize int64
+}
+
+// S3ConfigFromConfig reads the S3 settings from the app config
+func S3ConfigFromConfig(cfg conf.S3Config) S3Config {
+	return S3Config{
+		Endpoint:        cfg.Endpoint,
+		Region:          cfg.Region,
+		Bucket:          cfg.Bucket,
+		AccessKeyID:     cfg.AccessKeyID,
+		SecretAccessKey: cfg.SecretAccessKey,
+		UsePathStyle:    cfg.UsePathStyle,
+		Prefix:          cfg.Prefix,
+		PresignExpiry:   cfg.PresignExpiry,
+		PartSize:        cfg.PartSize,
+	}
+}
+
+// S3ConfigFromMap reads S3 settings given as strings, as passed to
+// NewFileStore: endpoint, region, bucket, access_key_id, secret_access_key,
+// use_path_style, prefix, presign_expiry (e.g. "1h") and part_size (bytes)
+func S3ConfigFromMap(m map[string]string) (S3Config, error) {
+	cfg := S3Config{
+		Endpoint:        m["endpoint"],
+		Region:          m["region"],
+		Bucket:          m["bucket"],
+		AccessKeyID:     m["access_key_id"],
+		SecretAccessKey: m["secret_access_key"],
+		Prefix:          m["prefix"],
+	}
+	if v := m["use_path_style"]; v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return S3Config{}, fmt.Errorf("invalid use_path_style %q: %w", v, err)
+		}
+		cfg.UsePathStyle = b
+	}
+	if v := m["presign_expiry"]; v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return S3Config{}, fmt.Errorf("invalid presign_expiry %q: %w", v, err)
+		}
+		cfg.PresignExpiry = d
+	}
+	if v := m["part_size"]; v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return S3Config{}, fmt.Errorf("invalid part_size %q: %w", v, err)
+		}
+		cfg.PartSize = n
+	}
+	return cfg, nil
+}
+
+// S3FileStore implements FileStore on an S3 bucket. Files are identified by
+// their object key.
+type S3FileStore struct {
+	Client  *s3.Client
+	Presign *s3.PresignClient
+	Config  S3Config
+}
+
+// NewS3FileStore creates a store for the configured bucket. Without an access
+// key, requests are sent unsigned, which only suits public buckets and fakes.
+func NewS3FileStore(cfg S3Config) (*S3FileStore, error) {
+	if cfg.Bucket == "" {
+		return nil, errors.New("s3 bucket is required")
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	if cfg.PresignExpiry <= 0 {
+		cfg.PresignExpiry = time.Hour
+	}
+	if cfg.PresignExpiry > s3MaxPresignExpiry {
+		cfg.PresignExpiry = s3MaxPresignExpiry
+	}
+	if cfg.PartSize <= 0 {
+		cfg.PartSize = s3DefaultPartSize
+	}
+	if cfg.PartSize < s3MinPartSize {
+		return nil, fmt.Errorf("s3 part size must be at least %d bytes", s3MinPartSize)
+	}
+
+	var creds aws.CredentialsProvider = aws.AnonymousCredentials{}
+	if cfg.AccessKeyID != "" {
+		creds = credentials.NewStaticCredentialsProvider(cfg.AccessKeyID, cfg.SecretAccessKey, "")
+	}
+
+	client := s3.New(s3.Options{
+		Region:       cfg.Region,
+		Credentials:  creds,
+		UsePathStyle: cfg.UsePathStyle,
+		BaseEndpoint: nilIfEmpty(cfg.Endpoint),
+		// Checksums are only sent where S3 requires them; many S3-compatible
+		// servers reject the trailing checksums the SDK adds by default
+		RequestChecksumCalculation: aws.RequestChecksumCalculationWhenRequired,
+		ResponseChecksumValidation: aws.ResponseChecksumValidationWhenRequired,
+	})
+
+	return &S3FileStore{
+		Client:  client,
+		Presign: s3.NewPresignClient(client),
+		Config:  cfg,
+	}, nil
+}
+
+func nilIfEmpty(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+// key is the object key for a path within the store
+func (s *S3FileStore) key(p string) string {
+	return strings.TrimPrefix(path.Join(s.Config.Prefix, p), "/")
+}
+
+// ListFiles lists the objects directly inside a folder
+func (s *S3FileStore) ListFiles(ctx context.Context, folder FolderInfo) ([]FileInfo, error) {
+	prefix := s.key(folder.FolderPath)
+	if prefix != "" {
+		prefix += "/"
+	}
+
+	var files []FileInfo
+	paginator := s3.NewListObjectsV2Paginator(s.Client, &s3.ListObjectsV2Input{
+		Bucket:    aws.String(s.Config.Bucket),
+		Prefix:    aws.String(prefix),
+		Delimiter: aws.String("/"),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list s3 objects under %s: %w", prefix, err)
+		}
+		for _, obj := range page.Contents {
+			key := aws.ToString(obj.Key)
+			name := path.Base(key)
+			mime, _ := FromExtension(path.Ext(name))
+			files = append(files, FileInfo{
+				FileStore: "s3",
+				FileID:    key,
+				FilePath:  key,
+				FileName:  name,
+				Size:      aws.ToInt64(obj.Size),
+				MimeType:  mime,
+			})
+		}
+	}
+	return files, nil
+}
+
+// UploadFile stores data under folder/fileName. Data larger than one part is
+// sent as a multipart upload, so large files are never held in memory whole.
+// The returned FileURL is a presigned download URL valid until Expiration;
+// pages show the object through ServeURL, which presigns it again.
+func (s *S3FileStore) UploadFile(ctx context.Context, fileName string, fileType MimeType, folderInfo FolderInfo, data io.Reader) (FileInfo, error) {
+	key := s.key(path.Join(folderInfo.FolderPath, fileName))
+	contentType, err := fileType.ToAmazonMimeType()
+	if err != nil {
+		contentType = "application/octet-stream"
+	}
+
+	hashed := newHashingReader(data)
+	first := make([]byte, s.Config.PartSize)
+	n, err := io.ReadFull(hashed, first)
+	var size int64
+	switch {
+	case errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF):
+		size = int64(n)
+		_, err = s.Client.PutObject(ctx, &s3.PutObjectInput{
+			Bucket:        aws.String(s.Config.Bucket),
+			Key:           aws.String(key),
+			Body:          bytes.NewReader(first[:n]),
+			ContentLength: aws.Int64(size),
+			ContentType:   aws.String(contentType),
+		})
+		if err != nil {
+			return FileInfo{}, fmt.Errorf("failed to upload s3 object %s: %w", key, err)
+		}
+	case err != nil:
+		return FileInfo{}, err
+	default:
+		size, err = s.uploadMultipart(ctx, key, contentType, first, hashed)
+		if err != nil {
+			return FileInfo{}, err
+		}
+	}
+
+	link, expiration, err := s.PresignURL(ctx, key)
+	if err != nil {
+		return FileInfo{}, err
+	}
+	return FileInfo{
+		FileStore:  "s3",
+		FileID:     key,
+		FilePath:   key,
+		FileURL:    link,
+		Expiration: &expiration,
+		Size:       size,
+		SHA256:     hashed.Sum(),
+		FileName:   fileName,
+		MimeType:   fileType,
+	}, nil
+}
+
+// uploadMultipart sends first and the rest of data as the parts of a
+// multipart upload, aborting the upload if any part fails
+func (s *S3FileStore) uploadMultipart(ctx context.Context, key, contentType string, first []byte, data io.Reader) (int64, error) {
+	created, err := s.Client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
+		Bucket:      aws.String(s.Config.Bucket),
+		Key:         aws.String(key),
+		ContentType: aws.String(contentType),
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to start multipart upload of %s: %w", key, err)
+	}
+	uploadID := created.UploadId
+
+	abort := func(cause error) (int64, error) {
+		// Use a fresh context so a cancelled upload is still cleaned up
+		_, err := s.Client.AbortMultipartUpload(context.WithoutCancel(ctx), &s3.AbortMultipartUploadInput{
+			Bucket:   aws.String(s.Config.Bucket),
+			Key:      aws.String(key),
+			UploadId: uploadID,
+		})
+		if err != nil {
+			return 0, fmt.Errorf("%w (and failed to abort the upload: %v)", cause, err)
+		}
+		return 0, cause
+	}
+
+	var parts []types.CompletedPart
+	var size int64
+	buf := first
+	for partNumber := int32(1); ; partNumber++ {
+		out, err := s.Client.UploadPart(ctx, &s3.UploadPartInput{
+			Bucket:        aws.String(s.Config.Bucket),
+			Key:           aws.String(key),
+			UploadId:      uploadID,
+			PartNumber:    aws.Int32(partNumber),
+			Body:          bytes.NewReader(buf),
+			ContentLength: aws.Int64(int64(len(buf))),
+		})
+		if err != nil {
+			return abort(fmt.Errorf("failed to upload part %d of %s: %w", partNumber, key, err))
+		}
+		parts = append(parts, types.CompletedPart{ETag: out.ETag, PartNumber: aws.Int32(partNumber)})
+		size += int64(len(buf))
+
+		if len(buf) < len(first) {
+			break
+		}
+		buf = first[:cap(first)]
+		n, err := io.ReadFull(data, buf)
+		if n == 0 && (errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)) {
+			break
+		}
+		if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+			return abort(fmt.Errorf("failed to read part %d of %s: %w", partNumber+1, key, err))
+		}
+		buf = buf[:n]
+	}
+
+	_, err = s.Client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(s.Config.Bucket),
+		Key:             aws.String(key),
+		UploadId:        uploadID,
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: parts},
+	})
+	if err != nil {
+		return abort(fmt.Errorf("failed to complete multipart upload of %s: %w", key, err))
+	}
+	return size, nil
+}
+
+// PresignURL returns a URL anyone can download the object from until the
+// returned expiration
+func (s *S3FileStore) PresignURL(ctx context.Context, key string) (string, time.Time, error) {
+	return s.presign(ctx, key, s.Config.PresignExpiry)
+}
+
+// ShareURL presigns a link to a file for up to expiry, capped at the 7 days
+// S3 allows
+func (s *S3FileStore) ShareURL(ctx context.Context, file FileInfo, expiry time.Duration) (string, error) {
+	url, _, err := s.presign(ctx, objectKey(file), min(expiry, s3MaxPresignExpiry))
+	return url, err
+}
+
+func (s *S3FileStore) presign(ctx context.Context, key string, expiry time.Duration) (string, time.Time, error) {
+	expiration := time.Now().Add(expiry)
+	req, err := s.Presign.PresignGetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.Config.Bucket),
+		Key:    aws.String(key),
+	}, s3.WithPresignExpires(expiry))
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to presign s3 object %s: %w", key, err)
+	}
+	return req.URL, expiration, nil
+}
+
+// ServeURL presigns a link to an object in this store afresh, so a recorded
+// FileURL keeps working after it expires. Other URLs are returned unchanged.
+func (s *S3FileStore) ServeURL(ctx context.Context, fileURL string) (string, error) {
+	key, ok := s.objectKeyFromURL(ctx, fileURL)
+	if !ok {
+		return fileURL, nil
+	}
+	link, _, err := s.PresignURL(ctx, key)
+	return link, err
+}
+
+// objectKeyFromURL returns the key of the object a presigned link made by
+// this store points at
+func (s *S3FileStore) objectKeyFromURL(ctx context.Context, fileURL string) (string, bool) {
+	u, err := url.Parse(fileURL)
+	if err != nil || u.Query().Get("X-Amz-Signature") == "" {
+		return "", false
+	}
+	// Presigning is done locally, and a link to a known key shows how the
+	// endpoint, bucket and addressing style lay out this store's links
+	probe, _, err := s.presign(ctx, s3ProbeKey, time.Minute)
+	if err != nil {
+		return "", false
+	}
+	p, err := url.Parse(probe)
+	if err != nil || u.Scheme != p.Scheme || u.Host != p.Host {
+		return "", false
+	}
+	key, ok := strings.CutPrefix(u.Path, strings.TrimSuffix(p.Path, s3ProbeKey))
+	return key, ok && key != ""
+}
+
+// isPresignedS3URL reports whether a URL carries an S3 signature
+func isPresignedS3URL(fileURL string) bool {
+	u, err := url.Parse(fileURL)
+	return err == nil && u.Query().Get("X-Amz-Signature") != ""
+}
+
+var (
+	servingS3StoreMu sync.Mutex
+	servingS3Store   *S3FileStore
+)
+
+// ServingS3Store is the s3 store as the registry opens it, from its
+// stp.U_Provider row or else the environment. It is opened once and kept to
+// presign links when pages are rendered.
+func ServingS3Store(ctx context.Context) (*S3FileStore, error) {
+	servingS3StoreMu.Lock()
+	defer servingS3StoreMu.Unlock()
+	if servingS3Store != nil {
+		return servingS3Store, nil
+	}
+
+	q, err := db.NewQueries(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get database queries: %w", err)
+	}
+	store, err := OpenFileStore(ctx, q, "s3")
+	if err != nil {
+		return nil, err
+	}
+	s3Store, ok := store.(*S3FileStore)
+	if !ok {
+		return nil, fmt.Errorf("s3 file store is a %T", store)
+	}
+	servingS3Store = s3Store
+	return servingS3Store, nil
+}
+
+// objectKey is the key of a stored file; files from ListFiles and
+// UploadFile carry it in both FileID and FilePath
+func objectKey(file FileInfo) string {
+	if file.FileID != "" {
+		return file.FileID
+	}
+	return file.FilePath
+}
+
+// DownloadFile opens an object for reading
+func (s *S3FileStore) DownloadFile(ctx context.Context, file FileInfo) (io.Reader, func(), error) {
+	key := objectKey(file)
+	out, err := s.Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.Config.Bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to download s3 object %s: %w", key, err)
+	}
+	closeFn := func() {
+		_ = out.Body.Close()
+	}
+	return out.Body, closeFn, nil
+}
+
+// DeleteFile removes an object from the bucket
+func (s *S3FileStore) DeleteFile(ctx context.Context, file FileInfo) error {
+	key := objectKey(file)
+	_, err := s.Client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.Config.Bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete s3 object %s: %w", key, err)
+	}
+	return nil
+}
@@ -0,0 +1,276 @@
+package file
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeS3 serves just enough of the S3 API, path-style, for S3FileStore
+type fakeS3 struct {
+	mu       sync.Mutex
+	objects  map[string][]byte
+	uploads  map[string]map[int][]byte
+	nextID   int
+	requests []string
+}
+
+func newFakeS3(t *testing.T) (*fakeS3, *httptest.Server) {
+	f := &fakeS3{objects: map[string][]byte{}, uploads: map[string]map[int][]byte{}}
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	return f, srv
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	q := r.URL.Query()
+	body, _ := io.ReadAll(r.Body)
+
+	switch {
+	case r.Method == http.MethodGet && key == "" && q.Get("list-type") == "2":
+		f.requests = append(f.requests, "list")
+		f.list(w, bucket, q.Get("prefix"))
+	case r.Method == http.MethodPost && q.Has("uploads"):
+		f.requests = append(f.requests, "create-multipart")
+		f.nextID++
+		id := strconv.Itoa(f.nextID)
+		f.uploads[id] = map[int][]byte{}
+		fmt.Fprintf(w, `<InitiateMultipartUploadResult><Bucket>%s</Bucket><Key>%s</Key><UploadId>%s</UploadId></InitiateMultipartUploadResult>`, bucket, key, id)
+	case r.Method == http.MethodPut && q.Has("partNumber"):
+		f.requests = append(f.requests, "upload-part")
+		n, _ := strconv.Atoi(q.Get("partNumber"))
+		f.uploads[q.Get("uploadId")][n] = body
+		w.Header().Set("ETag", fmt.Sprintf(`"part-%d"`, n))
+	case r.Method == http.MethodPost && q.Has("uploadId"):
+		f.requests = append(f.requests, "complete-multipart")
+		parts := f.uploads[q.Get("uploadId")]
+		numbers := make([]int, 0, len(parts))
+		for n := range parts {
+			numbers = append(numbers, n)
+		}
+		sort.Ints(numbers)
+		var all []byte
+		for _, n := range numbers {
+			all = append(all, parts[n]...)
+		}
+		f.objects[key] = all
+		delete(f.uploads, q.Get("uploadId"))
+		fmt.Fprintf(w, `<CompleteMultipartUploadResult><Key>%s</Key><ETag>"done"</ETag></CompleteMultipartUploadResult>`, key)
+	case r.Method == http.MethodDelete && q.Has("uploadId"):
+		f.requests = append(f.requests, "abort-multipart")
+		delete(f.uploads, q.Get("uploadId"))
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPut:
+		f.requests = append(f.requests, "put")
+		f.objects[key] = body
+		w.Header().Set("ETag", `"put"`)
+	case r.Method == http.MethodGet:
+		data, ok := f.objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `<Error><Code>NoSuchKey</Code></Error>`)
+			return
+		}
+		w.Write(data)
+	case r.Method == http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusNotImplemented)
+	}
+}
+
+func (f *fakeS3) list(w http.ResponseWriter, bucket, prefix string) {
+	type content struct {
+		Key  string
+		Size int
+	}
+	result := struct {
+		XMLName  xml.Name `xml:"ListBucketResult"`
+		Name     string
+		Prefix   string
+		KeyCount int
+		Contents []content
+	}{Name: bucket, Prefix: prefix}
+	keys := make([]string, 0, len(f.objects))
+	for k := range f.objects {
+		if strings.HasPrefix(k, prefix) && !strings.Contains(k[len(prefix):], "/") {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		result.Contents = append(result.Contents, content{Key: k, Size: len(f.objects[k])})
+	}
+	result.KeyCount = len(keys)
+	xml.NewEncoder(w).Encode(result)
+}
+
+func newTestS3Store(t *testing.T, endpoint string) *S3FileStore {
+	t.Helper()
+	store, err := NewS3FileStore(S3Config{
+		Endpoint:        endpoint,
+		Bucket:          "photos",
+		AccessKeyID:     "test",
+		SecretAccessKey: "secret",
+		UsePathStyle:    true,
+		Prefix:          "trees",
+		PresignExpiry:   15 * time.Minute,
+		PartSize:        s3MinPartSize,
+	})
+	if err != nil {
+		t.Fatalf("NewS3FileStore failed: %v", err)
+	}
+	return store
+}
+
+func TestS3FileStore_UploadDownloadDelete(t *testing.T) {
+	fake, srv := newFakeS3(t)
+	store := newTestS3Store(t, srv.URL)
+	ctx := context.Background()
+
+	info, err := store.UploadFile(ctx, "ab17.jpg", MimeTypeJPEG, FolderInfo{FolderPath: "whatsapp"}, strings.NewReader("jpeg bytes"))
+	if err != nil {
+		t.Fatalf("UploadFile failed: %v", err)
+	}
+	assert.Equal(t, "s3", info.FileStore)
+	assert.Equal(t, "trees/whatsapp/ab17.jpg", info.FileID)
+	assert.Equal(t, int64(10), info.Size)
+	assert.Equal(t, []string{"put"}, fake.requests)
+
+	// The record gets a presigned link, which ServeURL presigns again
+	u, err := url.Parse(info.FileURL)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "/photos/trees/whatsapp/ab17.jpg", u.Path)
+		assert.Equal(t, "900", u.Query().Get("X-Amz-Expires"))
+		assert.NotEmpty(t, u.Query().Get("X-Amz-Signature"))
+	}
+	if assert.NotNil(t, info.Expiration) {
+		assert.WithinDuration(t, time.Now().Add(15*time.Minute), *info.Expiration, time.Minute)
+	}
+
+	link, err := store.ServeURL(ctx, info.FileURL)
+	if assert.NoError(t, err) {
+		u, err := url.Parse(link)
+		if assert.NoError(t, err) {
+			assert.Equal(t, "/photos/trees/whatsapp/ab17.jpg", u.Path)
+			assert.NotEmpty(t, u.Query().Get("X-Amz-Signature"))
+		}
+	}
+	// Links sent out of the site last longer, up to the 7 days S3 allows
+	for expiry, want := range map[time.Duration]string{72 * time.Hour: "259200", 30 * 24 * time.Hour: "604800"} {
+		link, err := store.ShareURL(ctx, info, expiry)
+		if assert.NoError(t, err) {
+			u, err := url.Parse(link)
+			if assert.NoError(t, err) {
+				assert.Equal(t, "/photos/trees/whatsapp/ab17.jpg", u.Path)
+				assert.Equal(t, want, u.Query().Get("X-Amz-Expires"))
+			}
+		}
+	}
+	// Links to other buckets or hosts are not this store's to presign
+	for _, other := range []string{
+		"https://example.com/tree.jpg",
+		strings.Replace(info.FileURL, "/photos/", "/other-bucket/", 1),
+		"https://example.com/photos/trees/ab17.jpg?X-Amz-Signature=abc",
+	} {
+		link, err = store.ServeURL(ctx, other)
+		if assert.NoError(t, err) {
+			assert.Equal(t, other, link)
+		}
+	}
+
+	files, err := store.ListFiles(ctx, FolderInfo{FolderPath: "whatsapp"})
+	if assert.NoError(t, err) && assert.Len(t, files, 1) {
+		assert.Equal(t, "ab17.jpg", files[0].FileName)
+		assert.Equal(t, MimeTypeJPEG, files[0].MimeType)
+	}
+
+	reader, cleanup, err := store.DownloadFile(ctx, info)
+	if err != nil {
+		t.Fatalf("DownloadFile failed: %v", err)
+	}
+	data, _ := io.ReadAll(reader)
+	cleanup()
+	assert.Equal(t, "jpeg bytes", string(data))
+
+	assert.NoError(t, store.DeleteFile(ctx, info))
+	_, _, err = store.DownloadFile(ctx, info)
+	assert.Error(t, err)
+}
+
+func TestS3FileStore_MultipartUpload(t *testing.T) {
+	fake, srv := newFakeS3(t)
+	store := newTestS3Store(t, srv.URL)
+
+	data := bytes.Repeat([]byte("0123456789"), s3MinPartSize/10*2+7)
+	info, err := store.UploadFile(context.Background(), "big.mp4", MimeTypeMP4, FolderInfo{}, bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("UploadFile failed: %v", err)
+	}
+
+	assert.Equal(t, int64(len(data)), info.Size)
+	assert.Equal(t, []string{"create-multipart", "upload-part", "upload-part", "upload-part", "complete-multipart"}, fake.requests)
+	assert.True(t, bytes.Equal(data, fake.objects["trees/big.mp4"]))
+}
+
+type failingReader struct{ n int }
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	if r.n <= 0 {
+		return 0, fmt.Errorf("connection reset")
+	}
+	n := min(len(p), r.n)
+	r.n -= n
+	return n, nil
+}
+
+func TestS3FileStore_MultipartAbort(t *testing.T) {
+	fake, srv := newFakeS3(t)
+	store := newTestS3Store(t, srv.URL)
+
+	_, err := store.UploadFile(context.Background(), "big.mp4", MimeTypeMP4, FolderInfo{}, &failingReader{n: s3MinPartSize + 10})
+	assert.ErrorContains(t, err, "connection reset")
+	assert.Equal(t, []string{"create-multipart", "upload-part", "abort-multipart"}, fake.requests)
+	assert.Empty(t, fake.uploads)
+	assert.Empty(t, fake.objects)
+}
+
+func TestS3ConfigFromMap(t *testing.T) {
+	cfg, err := S3ConfigFromMap(map[string]string{
+		"endpoint":       "http://minio:9000",
+		"bucket":         "photos",
+		"use_path_style": "true",
+		"presign_expiry": "30m",
+		"part_size":      "10485760",
+	})
+	if assert.NoError(t, err) {
+		assert.Equal(t, "http://minio:9000", cfg.Endpoint)
+		assert.True(t, cfg.UsePathStyle)
+		assert.Equal(t, 30*time.Minute, cfg.PresignExpiry)
+		assert.Equal(t, int64(10<<20), cfg.PartSize)
+	}
+
+	_, err = S3ConfigFromMap(map[string]string{"presign_expiry": "soon"})
+	assert.Error(t, err)
+
+	_, err = NewS3FileStore(S3Config{Bucket: "photos", PartSize: 1024})
+	assert.Error(t, err)
+}
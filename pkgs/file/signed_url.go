@@ -0,0 +1,154 @@
+package file
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"log"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"sadbhavana/tree-project/pkgs/conf"
+)
+
+// LocalFilesPath is where the web server serves locally stored files to
+// holders of a signed link
+const LocalFilesPath = "/files/"
+
+// localURLPrefix starts the FileURL recorded for locally stored files. It is
+// a locator, not a link: the files are not publicly served.
+const localURLPrefix = "static/"
+
+var (
+	ErrURLExpired   = errors.New("link has expired")
+	ErrURLSignature = errors.New("link signature is invalid")
+)
+
+// URLSigner makes and checks expiring links to locally stored files. A link
+// is signed with HMAC-SHA256 over the file's path below the store root and
+// the link's expiry time.
+type URLSigner struct {
+	secret []byte
+	expiry time.Duration
+	now    func() time.Time
+}
+
+func NewURLSigner(secret []byte, expiry time.Duration) *URLSigner {
+	return &URLSigner{secret: secret, expiry: expiry, now: time.Now}
+}
+
+// URLSignerFromConfig builds a signer from the configured secret, or from a
+// random one when none is set
+func URLSignerFromConfig(cfg conf.FileURLConfig) *URLSigner {
+	secret := []byte(cfg.Secret)
+	if len(secret) == 0 {
+		log.Println("Warning: FILE_URL_SECRET is not set; photo links will stop working on restart")
+		secret = make([]byte, 32)
+		rand.Read(secret)
+	}
+	return NewURLSigner(secret, cfg.Expiry)
+}
+
+var (
+	defaultSignerOnce sync.Once
+	defaultSigner     *URLSigner
+)
+
+// DefaultURLSigner is the signer built from the loaded config
+func DefaultURLSigner() *URLSigner {
+	defaultSignerOnce.Do(func() {
+		defaultSigner = URLSignerFromConfig(conf.GetConfig().FileURL)
+	})
+	return defaultSigner
+}
+
+func (s *URLSigner) signature(relPath string, expires int64) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(relPath))
+	mac.Write([]byte{0})
+	mac.Write([]byte(strconv.FormatInt(expires, 10)))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Sign returns a link to the file at relPath, below the local store root.
+// Expiry times are rounded up to the minute, so a page shows the same link
+// for a while and browsers can cache the photo.
+func (s *URLSigner) Sign(relPath string) string {
+	return s.SignFor(relPath, s.expiry)
+}
+
+// SignFor is Sign with a link that lasts for expiry instead of the signer's
+// default, for links sent out of the site
+func (s *URLSigner) SignFor(relPath string, expiry time.Duration) string {
+	relPath = strings.TrimPrefix(path.Clean("/"+relPath), "/")
+	expires := s.now().Add(expiry).Truncate(time.Minute).Add(time.Minute).Unix()
+	q := url.Values{}
+	q.Set("expires", strconv.FormatInt(expires, 10))
+	q.Set("signature", s.signature(relPath, expires))
+	return LocalFilesPath + (&url.URL{Path: relPath}).EscapedPath() + "?" + q.Encode()
+}
+
+// Verify checks a link's signature and that it has not expired, returning
+// when it expires
+func (s *URLSigner) Verify(relPath, expires, signature string) (time.Time, error) {
+	exp, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return time.Time{}, ErrURLSignature
+	}
+	want := s.signature(relPath, exp)
+	if !hmac.Equal([]byte(want), []byte(signature)) {
+		return time.Time{}, ErrURLSignature
+	}
+	expiresAt := time.Unix(exp, 0)
+	if !s.now().Before(expiresAt) {
+		return expiresAt, ErrURLExpired
+	}
+	return expiresAt, nil
+}
+
+// ServeURL turns a recorded FileURL into a link a browser can load. Locally
+// stored files get a signed, expiring link and S3 objects are presigned
+// again; other stores' URLs are returned unchanged, as are S3 links that
+// cannot be presigned.
+func ServeURL(fileURL string) string {
+	if isPresignedS3URL(fileURL) {
+		ctx := context.Background()
+		store, err := ServingS3Store(ctx)
+		if err != nil {
+			log.Printf("Failed to open S3 store to presign a link: %v", err)
+			return fileURL
+		}
+		link, err := store.ServeURL(ctx, fileURL)
+		if err != nil {
+			log.Printf("Failed to presign a link: %v", err)
+			return fileURL
+		}
+		return link
+	}
+	if _, ok := localURLPath(fileURL); !ok {
+		return fileURL
+	}
+	return DefaultURLSigner().ServeURL(fileURL)
+}
+
+// ServeURL is ServeURL using this signer
+func (s *URLSigner) ServeURL(fileURL string) string {
+	rel, ok := localURLPath(fileURL)
+	if !ok {
+		return fileURL
+	}
+	return s.Sign(rel)
+}
+
+// localURLPath returns the path below the local store root of a locally
+// stored file's FileURL
+func localURLPath(fileURL string) (string, bool) {
+	return strings.CutPrefix(strings.TrimPrefix(fileURL, "/"), localURLPrefix)
+}
@@ -0,0 +1,88 @@
+package file
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestSigner(now time.Time) *URLSigner {
+	s := NewURLSigner([]byte("test secret"), time.Hour)
+	s.now = func() time.Time { return now }
+	return s
+}
+
+// parseSigned splits a signed link into the path and query Verify takes
+func parseSigned(t *testing.T, link string) (string, string, string) {
+	t.Helper()
+	u, err := url.Parse(link)
+	if err != nil {
+		t.Fatalf("invalid link %q: %v", link, err)
+	}
+	rel, ok := strings.CutPrefix(u.Path, LocalFilesPath)
+	if !ok {
+		t.Fatalf("link %q is not below %s", link, LocalFilesPath)
+	}
+	return rel, u.Query().Get("expires"), u.Query().Get("signature")
+}
+
+func TestURLSigner_SignAndVerify(t *testing.T) {
+	now := time.Date(2026, 10, 17, 12, 0, 30, 0, time.UTC)
+	s := newTestSigner(now)
+
+	link := s.Sign("blobs/ab/cd/abcd")
+	rel, expires, signature := parseSigned(t, link)
+	assert.Equal(t, "blobs/ab/cd/abcd", rel)
+
+	expiresAt, err := s.Verify(rel, expires, signature)
+	assert.NoError(t, err)
+	// Rounded up to the minute so the link stays the same for a while
+	assert.Equal(t, time.Date(2026, 10, 17, 13, 1, 0, 0, time.UTC), expiresAt.UTC())
+	assert.Equal(t, link, newTestSigner(now.Add(20*time.Second)).Sign("blobs/ab/cd/abcd"))
+}
+
+func TestURLSigner_Expired(t *testing.T) {
+	now := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+	rel, expires, signature := parseSigned(t, newTestSigner(now).Sign("whatsapp/tree.jpg"))
+
+	_, err := newTestSigner(now.Add(2*time.Hour)).Verify(rel, expires, signature)
+	assert.ErrorIs(t, err, ErrURLExpired)
+}
+
+func TestURLSigner_Tampered(t *testing.T) {
+	now := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+	s := newTestSigner(now)
+	rel, expires, signature := parseSigned(t, s.Sign("whatsapp/tree.jpg"))
+
+	_, err := s.Verify("whatsapp/other.jpg", expires, signature)
+	assert.ErrorIs(t, err, ErrURLSignature)
+
+	_, err = s.Verify(rel, strconv.FormatInt(time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC).Unix(), 10), signature)
+	assert.ErrorIs(t, err, ErrURLSignature)
+
+	_, err = s.Verify(rel, "not a time", signature)
+	assert.ErrorIs(t, err, ErrURLSignature)
+
+	other := NewURLSigner([]byte("other secret"), time.Hour)
+	other.now = s.now
+	_, err = other.Verify(rel, expires, signature)
+	assert.ErrorIs(t, err, ErrURLSignature)
+}
+
+func TestServeURL(t *testing.T) {
+	s := newTestSigner(time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC))
+
+	assert.Equal(t, "", ServeURL(""))
+	assert.Equal(t, "https://example.com/tree.jpg", ServeURL("https://example.com/tree.jpg"))
+
+	for _, fileURL := range []string{"static/blobs/ab/cd/abcd", "/static/blobs/ab/cd/abcd"} {
+		rel, expires, signature := parseSigned(t, s.ServeURL(fileURL))
+		assert.Equal(t, "blobs/ab/cd/abcd", rel)
+		_, err := s.Verify(rel, expires, signature)
+		assert.NoError(t, err)
+	}
+}
@@ -2,8 +2,10 @@ package file
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"time"
 
 	"sadbhavana/tree-project/pkgs/db"
 )
@@ -15,32 +17,61 @@ type FileStore interface {
 	DeleteFile(ctx context.Context, file FileInfo) error
 }
 
-func DownloadFile(ctx context.Context, q *db.Queries, fileInfo FileInfo) (io.Reader, func(), error) {
-	var store FileStore
-	var err error
-	switch fileInfo.FileStore {
-	case "local":
-		store = NewLocalFileStore()
-	case "google":
-		store, err = NewGoogleDriveFileStore(ctx, q)
-		if err != nil {
-			return nil, nil, err
-		}
+// SharingFileStore is a store that can link to a file for people outside the
+// site, such as donors, for a set time
+type SharingFileStore interface {
+	ShareURL(ctx context.Context, file FileInfo, expiry time.Duration) (string, error)
+}
+
+// ErrNotShareable is returned for files in stores that cannot make links
+var ErrNotShareable = errors.New("file store cannot share links")
+
+// ShareURL links to a stored file for up to expiry through the store it was
+// saved to
+func ShareURL(ctx context.Context, q *db.Queries, fileInfo FileInfo, expiry time.Duration) (string, error) {
+	store, err := OpenFileStore(ctx, q, fileInfo.FileStore)
+	if err != nil {
+		return "", err
 	}
-	if store == nil {
-		return nil, nil, fmt.Errorf("no file store available for type %s", fileInfo.FileStore)
+	sharing, ok := store.(SharingFileStore)
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrNotShareable, fileInfo.FileStore)
+	}
+	return sharing.ShareURL(ctx, fileInfo, expiry)
+}
+
+// DownloadFile reads a file from the store it was saved to
+func DownloadFile(ctx context.Context, q *db.Queries, fileInfo FileInfo) (io.Reader, func(), error) {
+	store, err := OpenFileStore(ctx, q, fileInfo.FileStore)
+	if err != nil {
+		return nil, nil, err
 	}
 	return store.DownloadFile(ctx, fileInfo)
 }
 
+// ReadFile downloads a file from its store into memory, for callers that
+// need its contents more than once
+func ReadFile(ctx context.Context, q *db.Queries, fileInfo FileInfo) ([]byte, error) {
+	reader, cleanup, err := DownloadFile(ctx, q, fileInfo)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download file: %w", err)
+	}
+	defer cleanup()
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	return data, nil
+}
+
+// NewFileStore builds a registered file store from the given settings instead
+// of its stp.U_Provider row. Stores that need the database, such as google,
+// must be opened with OpenFileStore.
 func NewFileStore(storeType string, config map[string]string) (FileStore, error) {
-	switch storeType {
-	case "local":
-		return NewLocalFileStore(), nil
-	case "google":
-		// Caller should use NewGoogleDriveFileStore directly when DB Queries are required.
-		return nil, fmt.Errorf("google file store must be created with NewGoogleDriveFileStore(ctx, q)")
-	default:
-		return nil, fmt.Errorf("unsupported file store type: %s", storeType)
+	factory, err := lookupFileStore(storeType)
+	if err != nil {
+		return nil, err
 	}
+	return factory(context.Background(), nil, ProviderConfig{Name: storeType, AuthConfig: config})
 }
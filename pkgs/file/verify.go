@@ -0,0 +1,189 @@
+package file
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"sadbhavana/tree-project/pkgs/db"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// VerifyStatus is the outcome of checking one stored file
+type VerifyStatus string
+
+const (
+	VerifyOK VerifyStatus = "ok"
+	// VerifyMissing files could not be read from their store
+	VerifyMissing VerifyStatus = "missing"
+	// VerifyCorrupted files no longer match their recorded checksum or size
+	VerifyCorrupted VerifyStatus = "corrupted"
+	// VerifyUnchecked files were stored before checksums were kept
+	VerifyUnchecked VerifyStatus = "unchecked"
+)
+
+// VerifyOptions controls an integrity scan
+type VerifyOptions struct {
+	// Stores to scan; all registered stores when empty
+	Stores []string
+	// BatchSize is the number of file rows read at a time
+	BatchSize int
+	// Limit stops each store's scan after this many files; 0 checks them all
+	Limit int
+	// Backfill records the checksum of unchecked files
+	Backfill bool
+}
+
+// VerifyReport describes a file that is not ok
+type VerifyReport struct {
+	FileID   string
+	Store    string
+	FileName string
+	Status   VerifyStatus
+	Expected string
+	Actual   string
+	Err      error
+}
+
+// VerifyResult counts the files an integrity scan checked
+type VerifyResult struct {
+	Checked    int
+	OK         int
+	Missing    int
+	Corrupted  int
+	Unchecked  int
+	Backfilled int
+}
+
+// VerifyFiles re-reads the files recorded in core.file and compares their
+// SHA-256 and size with the recorded ones. Files that are not ok are passed to
+// report as they are found.
+func VerifyFiles(ctx context.Context, q *db.Queries, opts VerifyOptions, report func(VerifyReport)) (VerifyResult, error) {
+	var result VerifyResult
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = defaultMigrateBatchSize
+	}
+	stores := opts.Stores
+	if len(stores) == 0 {
+		stores = FileStores()
+	}
+
+	for _, name := range stores {
+		store, err := OpenFileStore(ctx, q, name)
+		if err != nil {
+			// Registered stores that are not set up hold no files to check
+			if len(opts.Stores) == 0 {
+				log.Printf("Skipping file store %s: %v", name, err)
+				continue
+			}
+			return result, fmt.Errorf("failed to open store %s: %w", name, err)
+		}
+		if err := verifyStore(ctx, q, store, name, opts, report, &result); err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+func verifyStore(ctx context.Context, q *db.Queries, store FileStore, name string, opts VerifyOptions, report func(VerifyReport), result *VerifyResult) error {
+	var afterID string
+	checked := 0
+	for opts.Limit == 0 || checked < opts.Limit {
+		batchSize := opts.BatchSize
+		if opts.Limit > 0 {
+			batchSize = min(batchSize, opts.Limit-checked)
+		}
+		rows, err := q.ListStoreFiles(ctx, db.ListStoreFilesParams{
+			FileStore: name,
+			AfterID:   afterID,
+			RowLimit:  int32(batchSize),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to list files in store %s: %w", name, err)
+		}
+		if len(rows) == 0 {
+			return nil
+		}
+
+		for _, row := range rows {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			afterID = row.ID
+			checked++
+			result.Checked++
+
+			r := verifyFile(ctx, store, row)
+			switch r.Status {
+			case VerifyOK:
+				result.OK++
+				continue
+			case VerifyMissing:
+				result.Missing++
+			case VerifyCorrupted:
+				result.Corrupted++
+			case VerifyUnchecked:
+				result.Unchecked++
+				if opts.Backfill {
+					err := q.SetFileChecksum(ctx, db.SetFileChecksumParams{
+						Sha256:    pgtype.Text{String: r.Actual, Valid: true},
+						SizeBytes: pgtype.Int8{Int64: r.size, Valid: true},
+						ID:        row.ID,
+					})
+					if err != nil {
+						return fmt.Errorf("failed to record checksum of file %s: %w", row.ID, err)
+					}
+					result.Backfilled++
+				}
+			}
+			report(r.VerifyReport)
+		}
+	}
+	return nil
+}
+
+type verifiedFile struct {
+	VerifyReport
+	size int64
+}
+
+// verifyFile reads one file back from its store and checks its content
+func verifyFile(ctx context.Context, store FileStore, row db.CoreFile) verifiedFile {
+	r := verifiedFile{VerifyReport: VerifyReport{
+		FileID:   row.ID,
+		Store:    row.FileStore,
+		FileName: row.FileName.String,
+		Expected: row.Sha256.String,
+	}}
+	fileInfo, err := ExtractFileInfoFromDB(row)
+	if err != nil {
+		r.Status, r.Err = VerifyMissing, err
+		return r
+	}
+
+	reader, cleanup, err := store.DownloadFile(ctx, fileInfo)
+	if err != nil {
+		r.Status, r.Err = VerifyMissing, err
+		return r
+	}
+	r.Actual, r.size, err = checksum(reader)
+	cleanup()
+	if err != nil {
+		r.Status, r.Err = VerifyMissing, err
+		return r
+	}
+
+	switch {
+	case !row.Sha256.Valid:
+		r.Status = VerifyUnchecked
+	case r.Actual != row.Sha256.String:
+		r.Status = VerifyCorrupted
+	case row.SizeBytes.Valid && r.size != row.SizeBytes.Int64:
+		r.Status = VerifyCorrupted
+		r.Err = fmt.Errorf("size is %d bytes, recorded %d", r.size, row.SizeBytes.Int64)
+	default:
+		r.Status = VerifyOK
+	}
+	return r
+}
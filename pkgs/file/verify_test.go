@@ -0,0 +1,56 @@
+package file
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+
+	"sadbhavana/tree-project/pkgs/db"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerifyFile(t *testing.T) {
+	store := &LocalFileStore{Root: t.TempDir()}
+	ctx := context.Background()
+	stored, err := store.UploadFile(ctx, "tree.jpg", MimeTypeJPEG, FolderInfo{}, strings.NewReader("tree photo"))
+	if err != nil {
+		t.Fatalf("UploadFile failed: %v", err)
+	}
+
+	row := func(sum string, size int64) db.CoreFile {
+		return db.CoreFile{
+			ID:        "FIL_1",
+			FileStore: "local",
+			FilePath:  pgtype.Text{String: stored.FilePath, Valid: true},
+			FileName:  pgtype.Text{String: "tree.jpg", Valid: true},
+			FileType:  pgtype.Text{String: "image/jpeg", Valid: true},
+			Sha256:    pgtype.Text{String: sum, Valid: sum != ""},
+			SizeBytes: pgtype.Int8{Int64: size, Valid: size > 0},
+		}
+	}
+
+	r := verifyFile(ctx, store, row(stored.SHA256, 10))
+	assert.Equal(t, VerifyOK, r.Status)
+
+	r = verifyFile(ctx, store, row("", 0))
+	assert.Equal(t, VerifyUnchecked, r.Status)
+	assert.Equal(t, stored.SHA256, r.Actual)
+	assert.Equal(t, int64(10), r.size)
+
+	r = verifyFile(ctx, store, row(strings.Repeat("0", 64), 10))
+	assert.Equal(t, VerifyCorrupted, r.Status)
+
+	r = verifyFile(ctx, store, row(stored.SHA256, 11))
+	assert.Equal(t, VerifyCorrupted, r.Status)
+	assert.ErrorContains(t, r.Err, "size is 10 bytes, recorded 11")
+
+	if err := os.Remove(stored.FilePath); err != nil {
+		t.Fatalf("Failed to remove blob: %v", err)
+	}
+	r = verifyFile(ctx, store, row(stored.SHA256, 10))
+	assert.Equal(t, VerifyMissing, r.Status)
+	assert.Error(t, r.Err)
+}
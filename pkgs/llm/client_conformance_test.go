@@ -0,0 +1,217 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sadbhavana/tree-project/pkgs/file"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeProvider is an in-process stand-in for a provider's HTTP API. Each
+// Client implementation is run against its own fake by the conformance suite.
+type fakeProvider struct {
+	server *httptest.Server
+
+	mu         sync.Mutex
+	reply      string
+	failStatus int
+	lastPrompt string
+}
+
+// failWith makes subsequent prompts fail with the given HTTP status
+func (f *fakeProvider) failWith(status int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.failStatus = status
+}
+
+func (f *fakeProvider) state(prompt []byte) (string, int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.lastPrompt = string(prompt)
+	return f.reply, f.failStatus
+}
+
+func (f *fakeProvider) prompt() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.lastPrompt
+}
+
+func writeFakeError(w http.ResponseWriter, status int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, `{"error":{"code":%d,"message":"fake failure","status":"%s"}}`, status, http.StatusText(status))
+}
+
+// newFakeGemini serves the subset of the Gemini API used by geminiClient:
+// resumable file upload and generateContent. It runs over TLS because
+// Prompt only accepts https file URIs.
+func newFakeGemini(t *testing.T) *fakeProvider {
+	f := &fakeProvider{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/upload/v1beta/files", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Goog-Upload-URL", f.server.URL+"/upload-session")
+		w.WriteHeader(http.StatusOK)
+	})
+	mux.HandleFunc("/upload-session", func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		w.Header().Set("X-Goog-Upload-Status", "final")
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"file":{"name":"files/fake-1","uri":"%s/v1beta/files/fake-1","mimeType":"image/jpeg","displayName":"photo.jpg","expirationTime":"2030-01-01T00:00:00Z"}}`, f.server.URL)
+	})
+	mux.HandleFunc("/v1beta/models/", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		reply, failStatus := f.state(body)
+		if failStatus != 0 {
+			writeFakeError(w, failStatus)
+			return
+		}
+		resp := map[string]any{
+			"candidates": []any{map[string]any{
+				"content": map[string]any{"role": "model", "parts": []any{map[string]any{"text": reply}}},
+			}},
+			"usageMetadata": map[string]any{"promptTokenCount": 11, "candidatesTokenCount": 7, "totalTokenCount": 18},
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	})
+	f.server = httptest.NewTLSServer(mux)
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+// newFakeOpenAI serves /chat/completions the way OpenAI-compatible servers do
+func newFakeOpenAI(t *testing.T) *fakeProvider {
+	f := &fakeProvider{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/chat/completions", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		reply, failStatus := f.state(body)
+		if failStatus != 0 {
+			writeFakeError(w, failStatus)
+			return
+		}
+		resp := map[string]any{
+			"choices": []any{map[string]any{
+				"index":   0,
+				"message": map[string]any{"role": "assistant", "content": reply},
+			}},
+			"usage": map[string]any{"prompt_tokens": 11, "completion_tokens": 7, "total_tokens": 18},
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	})
+	f.server = httptest.NewServer(mux)
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+type conformanceCase struct {
+	name      string
+	newClient func(t *testing.T) (Client, *fakeProvider)
+}
+
+var conformanceCases = []conformanceCase{
+	{
+		name: GEMINI_PROVIDER_NAME,
+		newClient: func(t *testing.T) (Client, *fakeProvider) {
+			fake := newFakeGemini(t)
+			client, err := NewClient(context.Background(), GEMINI_PROVIDER_NAME, string(Gemini25Flash),
+				WithBaseURL(fake.server.URL), WithAPIKey("test-key"), WithHTTPClient(fake.server.Client()))
+			if err != nil {
+				t.Fatalf("Failed to create Gemini client: %v", err)
+			}
+			return client, fake
+		},
+	},
+	{
+		name: OPENAI_PROVIDER_NAME,
+		newClient: func(t *testing.T) (Client, *fakeProvider) {
+			fake := newFakeOpenAI(t)
+			client, err := NewClient(context.Background(), OPENAI_PROVIDER_NAME, "llava",
+				WithBaseURL(fake.server.URL+"/v1"), WithAPIKey("test-key"), WithHTTPClient(fake.server.Client()))
+			if err != nil {
+				t.Fatalf("Failed to create OpenAI client: %v", err)
+			}
+			return client, fake
+		},
+	},
+}
+
+func TestClientConformance(t *testing.T) {
+	for _, tc := range conformanceCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Run("UploadFile", func(t *testing.T) {
+				client, _ := tc.newClient(t)
+				info, err := client.UploadFile(context.Background(), "photo.jpg", file.MimeTypeJPEG, bytes.NewReader([]byte("jpeg-bytes")))
+				if err != nil {
+					t.Fatalf("UploadFile failed: %v", err)
+				}
+				assert.NotEmpty(t, info.FileURL)
+				assert.Equal(t, file.MimeTypeJPEG, info.MimeType)
+			})
+
+			t.Run("PromptText", func(t *testing.T) {
+				client, fake := tc.newClient(t)
+				fake.reply = "hello there"
+				resp, err := client.Prompt(context.Background(), &Request{Messages: []Message{
+					{Role: RoleSystem, Content: MessageContent{Type: ContentTypeText, Text: &TextContent{Text: "be brief"}}},
+					{Role: RoleUser, Content: MessageContent{Type: ContentTypeText, Text: &TextContent{Text: "say hello"}}},
+				}})
+				if err != nil {
+					t.Fatalf("Prompt failed: %v", err)
+				}
+				assert.Equal(t, "hello there", resp.Content)
+				assert.Equal(t, TokenUsage{PromptTokens: 11, CompletionTokens: 7, TotalTokens: 18}, resp.Usage)
+				assert.Contains(t, fake.prompt(), "say hello")
+			})
+
+			t.Run("PromptWithFile", func(t *testing.T) {
+				client, fake := tc.newClient(t)
+				fake.reply = `{"tree_id":"AB12"}`
+				info, err := client.UploadFile(context.Background(), "photo.jpg", file.MimeTypeJPEG, bytes.NewReader([]byte("jpeg-bytes")))
+				if err != nil {
+					t.Fatalf("UploadFile failed: %v", err)
+				}
+				resp, err := client.Prompt(context.Background(), &Request{Messages: []Message{
+					{Role: RoleUser, Content: MessageContent{Type: ContentTypeText, Text: &TextContent{Text: "read the sign"}}},
+					{Role: RoleUser, Content: MessageContent{Type: ContentTypeFile, File: &FileContent{FileID: info.FileURL, MimeType: file.MimeTypeJPEG}}},
+				}})
+				if err != nil {
+					t.Fatalf("Prompt failed: %v", err)
+				}
+				assert.Equal(t, `{"tree_id":"AB12"}`, resp.Content)
+				assert.True(t, strings.Contains(fake.prompt(), info.FileURL), "file reference should reach the provider")
+			})
+
+			for status, want := range map[int]error{
+				http.StatusUnauthorized:        ErrAuthentication,
+				http.StatusForbidden:           ErrPermissionDenied,
+				http.StatusTooManyRequests:     ErrRateLimit,
+				http.StatusInternalServerError: ErrServerError,
+			} {
+				t.Run(fmt.Sprintf("Error%d", status), func(t *testing.T) {
+					client, fake := tc.newClient(t)
+					fake.failWith(status)
+					_, err := client.Prompt(context.Background(), &Request{Messages: []Message{
+						{Role: RoleUser, Content: MessageContent{Type: ContentTypeText, Text: &TextContent{Text: "hi"}}},
+					}})
+					if !errors.Is(err, want) {
+						t.Fatalf("expected %v, got %v", want, err)
+					}
+				})
+			}
+		})
+	}
+}
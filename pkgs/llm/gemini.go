@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"net/http"
 	"sadbhavana/tree-project/pkgs/conf"
 	"sadbhavana/tree-project/pkgs/file"
 	"sadbhavana/tree-project/pkgs/utils"
@@ -31,7 +32,9 @@ const (
 type Option func(*ClientConfig)
 
 type ClientConfig struct {
-	BaseURL string
+	BaseURL    string
+	APIKey     string
+	HTTPClient *http.Client
 }
 
 func WithBaseURL(url string) Option {
@@ -40,6 +43,18 @@ func WithBaseURL(url string) Option {
 	}
 }
 
+func WithAPIKey(key string) Option {
+	return func(c *ClientConfig) {
+		c.APIKey = key
+	}
+}
+
+func WithHTTPClient(client *http.Client) Option {
+	return func(c *ClientConfig) {
+		c.HTTPClient = client
+	}
+}
+
 // Validate Gemini models
 func isValidGeminiModel(model GeminiModel) bool {
 	switch model {
@@ -57,10 +72,6 @@ type geminiClient struct {
 
 // Factory function for Gemini client
 func NewGeminiClient(ctx context.Context, model GeminiModel, opts ...Option) (Client, error) {
-	apiKey := conf.GetConfig().GeminiConfig.APIKey
-	if apiKey == "" {
-		return nil, fmt.Errorf("API key is required")
-	}
 	if !isValidGeminiModel(model) {
 		return nil, fmt.Errorf("invalid Gemini model: %s", model)
 	}
@@ -73,9 +84,18 @@ func NewGeminiClient(ctx context.Context, model GeminiModel, opts ...Option) (Cl
 		opt(config)
 	}
 
+	if config.APIKey == "" {
+		config.APIKey = conf.GetConfig().GeminiConfig.APIKey
+	}
+	if config.APIKey == "" {
+		return nil, fmt.Errorf("API key is required")
+	}
+
 	client, err := genai.NewClient(ctx, &genai.ClientConfig{
-		APIKey:  apiKey,
-		Backend: genai.BackendGeminiAPI,
+		APIKey:      config.APIKey,
+		Backend:     genai.BackendGeminiAPI,
+		HTTPClient:  config.HTTPClient,
+		HTTPOptions: genai.HTTPOptions{BaseURL: config.BaseURL},
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to create Gemini client: %w", err)
@@ -142,6 +162,18 @@ func (c *geminiClient) Prompt(ctx context.Context, req *Request) (*Response, err
 		config.TopP = &topP
 	}
 
+	if req.Config.ResponseSchema != nil {
+		schema, err := toGeminiSchema(req.Config.ResponseSchema)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrUnsupportedSchema, err)
+		}
+		config.ResponseSchema = schema
+		config.ResponseMIMEType = "application/json"
+	}
+	if req.Config.ResponseMIMEType != "" {
+		config.ResponseMIMEType = req.Config.ResponseMIMEType
+	}
+
 	resp, err := c.client.Models.GenerateContent(ctx, c.model, contents, config)
 	if err != nil {
 		return nil, c.handleError(err)
@@ -169,6 +201,11 @@ func (c *geminiClient) Prompt(ctx context.Context, req *Request) (*Response, err
 	return &output, nil
 }
 
+// SupportsResponseSchema reports that Gemini enforces ResponseSchema natively
+func (c *geminiClient) SupportsResponseSchema() bool {
+	return true
+}
+
 func (c *geminiClient) convertToGeminiContents(messages []Message) ([]*genai.Content, error) {
 	var contents []*genai.Content
 
@@ -230,22 +267,30 @@ func (c *geminiClient) handleError(err error) error {
 		return nil
 	}
 
+	// Prefer the HTTP status when the SDK surfaces one
+	var apiErr genai.APIError
+	if errors.As(err, &apiErr) {
+		if mapped := errorForStatus(apiErr.Code); mapped != nil {
+			return fmt.Errorf("%w: %w", mapped, err)
+		}
+	}
+
 	errStr := err.Error()
 
 	// Check common error patterns in the error message
 	switch {
 	case utils.StringContains(errStr, "unauthorized", "authentication", "api key"):
-		return errors.Annotatef(err, "authentication failed")
+		return fmt.Errorf("%w: %w", ErrAuthentication, err)
 	case utils.StringContains(errStr, "rate limit", "quota"):
-		return errors.Annotatef(err, "rate limit exceeded")
+		return fmt.Errorf("%w: %w", ErrRateLimit, err)
 	case utils.StringContains(errStr, "bad request", "invalid"):
-		return errors.Annotatef(err, "invalid input")
+		return fmt.Errorf("%w: %w", ErrInvalidInput, err)
 	case utils.StringContains(errStr, "not found"):
-		return errors.Annotatef(err, "resource not found")
-	case utils.StringContains(errStr, "forbidden", "quota exceeded"):
-		return errors.Annotatef(err, "quota exceeded")
+		return fmt.Errorf("%w: %w", ErrNotFound, err)
+	case utils.StringContains(errStr, "forbidden", "permission denied"):
+		return fmt.Errorf("%w: %w", ErrPermissionDenied, err)
 	case utils.StringContains(errStr, "server error", "internal error"):
-		return errors.Annotatef(err, "server error")
+		return fmt.Errorf("%w: %w", ErrServerError, err)
 	default:
 		return errors.Annotatef(err, "request failed")
 	}
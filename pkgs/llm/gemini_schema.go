@@ -0,0 +1,95 @@
+package llm
+
+import (
+	"fmt"
+
+	"github.com/invopop/jsonschema"
+	"google.golang.org/genai"
+)
+
+// toGeminiSchema converts a reflected JSON schema into Gemini's OpenAPI
+// subset. Constructs Gemini cannot express (references, oneOf/allOf, maps)
+// are reported as errors so the caller can fall back to prompting.
+func toGeminiSchema(s *jsonschema.Schema) (*genai.Schema, error) {
+	if s == nil {
+		return nil, fmt.Errorf("schema is nil")
+	}
+	if s.Ref != "" || len(s.OneOf) > 0 || len(s.AllOf) > 0 || s.Not != nil || len(s.PatternProperties) > 0 {
+		return nil, fmt.Errorf("schema uses constructs not supported by Gemini")
+	}
+
+	out := &genai.Schema{
+		Title:       s.Title,
+		Description: s.Description,
+		Pattern:     s.Pattern,
+	}
+
+	for _, v := range s.Enum {
+		out.Enum = append(out.Enum, fmt.Sprint(v))
+	}
+
+	if len(s.AnyOf) > 0 {
+		for _, sub := range s.AnyOf {
+			converted, err := toGeminiSchema(sub)
+			if err != nil {
+				return nil, err
+			}
+			out.AnyOf = append(out.AnyOf, converted)
+		}
+		return out, nil
+	}
+
+	switch s.Type {
+	case "string":
+		out.Type = genai.TypeString
+		// Gemini only accepts the enum and date-time string formats
+		if s.Format == "date-time" {
+			out.Format = s.Format
+		}
+		if len(out.Enum) > 0 {
+			out.Format = "enum"
+		}
+	case "integer":
+		out.Type = genai.TypeInteger
+	case "number":
+		out.Type = genai.TypeNumber
+	case "boolean":
+		out.Type = genai.TypeBoolean
+	case "null":
+		out.Type = genai.TypeNULL
+	case "array":
+		out.Type = genai.TypeArray
+		if s.Items == nil {
+			return nil, fmt.Errorf("array schema without items")
+		}
+		items, err := toGeminiSchema(s.Items)
+		if err != nil {
+			return nil, err
+		}
+		out.Items = items
+	case "object":
+		out.Type = genai.TypeObject
+		if s.AdditionalProperties != nil && s.AdditionalProperties != jsonschema.FalseSchema {
+			return nil, fmt.Errorf("object schema with additional properties")
+		}
+		if s.Properties == nil || s.Properties.Len() == 0 {
+			return nil, fmt.Errorf("object schema without properties")
+		}
+		out.Properties = make(map[string]*genai.Schema, s.Properties.Len())
+		for pair := s.Properties.Oldest(); pair != nil; pair = pair.Next() {
+			prop, err := toGeminiSchema(pair.Value)
+			if err != nil {
+				return nil, fmt.Errorf("property %s: %w", pair.Key, err)
+			}
+			out.Properties[pair.Key] = prop
+			out.PropertyOrdering = append(out.PropertyOrdering, pair.Key)
+		}
+		out.Required = s.Required
+	case "":
+		return nil, fmt.Errorf("schema without a type")
+	default:
+		return nil, fmt.Errorf("unsupported schema type %q", s.Type)
+	}
+
+	return out, nil
+}
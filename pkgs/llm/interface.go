@@ -3,7 +3,11 @@ package llm
 import (
 	"context"
 	"errors"
+	"fmt"
 	"io"
+	"net/http"
+	"sadbhavana/tree-project/pkgs/conf"
+	"sadbhavana/tree-project/pkgs/db"
 	"sadbhavana/tree-project/pkgs/file"
 
 	"time"
@@ -15,14 +19,24 @@ type Client interface {
 	Prompt(ctx context.Context, req *Request) (*Response, error)
 }
 
+// SchemaClient is implemented by clients whose provider can enforce
+// Config.ResponseSchema itself, so the schema need not be spelled out in
+// the prompt
+type SchemaClient interface {
+	SupportsResponseSchema() bool
+}
+
 // Common error types
 var (
-	ErrRateLimit      = errors.New("rate limit exceeded")
-	ErrInvalidInput   = errors.New("invalid input")
-	ErrAuthentication = errors.New("authentication failed")
-	ErrQuotaExceeded  = errors.New("quota exceeded")
-	ErrNotFound       = errors.New("resource not found")
-	ErrServerError    = errors.New("server error")
+	ErrRateLimit        = errors.New("rate limit exceeded")
+	ErrInvalidInput     = errors.New("invalid input")
+	ErrAuthentication   = errors.New("authentication failed")
+	ErrPermissionDenied = errors.New("permission denied")
+	ErrQuotaExceeded    = errors.New("quota exceeded")
+	ErrNotFound         = errors.New("resource not found")
+	ErrServerError      = errors.New("server error")
+	// ErrUnsupportedSchema means the provider cannot express a response schema
+	ErrUnsupportedSchema = errors.New("unsupported response schema")
 )
 
 type AIFileInfo struct {
@@ -33,11 +47,51 @@ type AIFileInfo struct {
 	MimeType   file.MimeType
 }
 
-func NewClient(ctx context.Context, providerName, modelName string) (Client, error) {
+// errorForStatus maps an HTTP status code from a provider to one of the
+// common error types, or nil if there is no specific mapping
+func errorForStatus(code int) error {
+	switch {
+	case code == http.StatusUnauthorized:
+		return ErrAuthentication
+	case code == http.StatusForbidden:
+		return ErrPermissionDenied
+	case code == http.StatusTooManyRequests:
+		return ErrRateLimit
+	case code == http.StatusBadRequest || code == http.StatusUnprocessableEntity:
+		return ErrInvalidInput
+	case code == http.StatusNotFound:
+		return ErrNotFound
+	case code >= 500:
+		return ErrServerError
+	default:
+		return nil
+	}
+}
+
+func NewClient(ctx context.Context, providerName, modelName string, opts ...Option) (Client, error) {
 	switch providerName {
-	case "GEMINI":
-		return NewGeminiClient(ctx, GeminiModel(modelName))
+	case GEMINI_PROVIDER_NAME:
+		return NewGeminiClient(ctx, GeminiModel(modelName), opts...)
+	case OPENAI_PROVIDER_NAME:
+		return NewOpenAIClient(ctx, modelName, opts...)
 	default:
 		return nil, errors.New("unsupported provider")
 	}
 }
+
+// NewClientFromConfig creates the client selected by LLM_PROVIDER and LLM_MODEL,
+// with its calls recorded in the usage ledger and held to the daily budget
+func NewClientFromConfig(ctx context.Context, opts ...Option) (Client, error) {
+	cfg := conf.GetConfig().LLMConfig
+	client, err := NewClient(ctx, cfg.Provider, cfg.Model, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	q, err := db.NewQueries(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get database queries: %w", err)
+	}
+
+	return NewUsageClient(client, q, cfg.Provider, cfg.Model, cfg), nil
+}
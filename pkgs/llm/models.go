@@ -1,6 +1,10 @@
 package llm
 
-import "sadbhavana/tree-project/pkgs/file"
+import (
+	"sadbhavana/tree-project/pkgs/file"
+
+	"github.com/invopop/jsonschema"
+)
 
 // Role represents the role of a message sender
 type Role string
@@ -55,6 +59,11 @@ type Config struct {
 	Temperature *float64 `json:"temperature,omitempty" validate:"omitempty,min=0,max=2"`
 	MaxTokens   *int     `json:"max_tokens,omitempty" validate:"omitempty,min=1"`
 	TopP        *float64 `json:"top_p,omitempty" validate:"omitempty,min=0,max=1"`
+
+	// ResponseSchema constrains the reply to a JSON schema on providers that
+	// support it natively (see SchemaClient); others ignore it
+	ResponseSchema   *jsonschema.Schema `json:"-"`
+	ResponseMIMEType string             `json:"response_mime_type,omitempty"`
 }
 
 // Response represents the response from an LLM
@@ -69,3 +78,10 @@ type TokenUsage struct {
 	CompletionTokens int `json:"completion_tokens"`
 	TotalTokens      int `json:"total_tokens"`
 }
+
+// Add accumulates usage from another call, e.g. a structured output retry
+func (u *TokenUsage) Add(other TokenUsage) {
+	u.PromptTokens += other.PromptTokens
+	u.CompletionTokens += other.CompletionTokens
+	u.TotalTokens += other.TotalTokens
+}
@@ -0,0 +1,234 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sadbhavana/tree-project/pkgs/conf"
+	"sadbhavana/tree-project/pkgs/file"
+	"strings"
+	"time"
+)
+
+const OPENAI_PROVIDER_NAME string = "OPENAI"
+
+// openAIClient talks to any server implementing the OpenAI chat completions
+// API, e.g. OpenAI itself, llama.cpp's server or Ollama
+type openAIClient struct {
+	model  string
+	config *ClientConfig
+}
+
+// Factory function for OpenAI-compatible client. The base URL and API key
+// default to the OPENAI_* configuration; local servers usually need no key.
+func NewOpenAIClient(ctx context.Context, model string, opts ...Option) (Client, error) {
+	if model == "" {
+		return nil, fmt.Errorf("model is required")
+	}
+
+	config := &ClientConfig{}
+	for _, opt := range opts {
+		opt(config)
+	}
+
+	if config.BaseURL == "" || config.APIKey == "" {
+		cfg := conf.GetConfig().OpenAIConfig
+		if config.BaseURL == "" {
+			config.BaseURL = cfg.BaseURL
+		}
+		if config.APIKey == "" {
+			config.APIKey = cfg.APIKey
+		}
+	}
+	if config.HTTPClient == nil {
+		config.HTTPClient = &http.Client{Timeout: 5 * time.Minute}
+	}
+
+	return &openAIClient{
+		model:  model,
+		config: config,
+	}, nil
+}
+
+// UploadFile inlines the file as a base64 data URL. The chat completions API
+// has no file store for vision inputs, so the URL is sent with each prompt.
+func (c *openAIClient) UploadFile(ctx context.Context, filename string, mimeType file.MimeType, data io.Reader) (*file.FileInfo, error) {
+	mimeTypeStr, err := mimeType.ToGoogleMimeType()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get MIME type: %w", err)
+	}
+
+	raw, err := io.ReadAll(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+
+	return &file.FileInfo{
+		FileID:   filename,
+		FileURL:  "data:" + mimeTypeStr + ";base64," + base64.StdEncoding.EncodeToString(raw),
+		FileName: filename,
+		MimeType: mimeType,
+	}, nil
+}
+
+func (c *openAIClient) Prompt(ctx context.Context, req *Request) (*Response, error) {
+	messages, err := c.convertToOpenAIMessages(req.Messages)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert messages: %w", err)
+	}
+
+	chatReq := openAIChatRequest{
+		Model:       c.model,
+		Messages:    messages,
+		Temperature: req.Config.Temperature,
+		MaxTokens:   req.Config.MaxTokens,
+		TopP:        req.Config.TopP,
+	}
+
+	body, err := json.Marshal(chatReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode request: %w", err)
+	}
+
+	endpoint := strings.TrimRight(c.config.BaseURL, "/") + "/chat/completions"
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if c.config.APIKey != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+c.config.APIKey)
+	}
+
+	resp, err := c.config.HTTPClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, c.handleError(resp.StatusCode, respBody)
+	}
+
+	var chatResp openAIChatResponse
+	if err := json.Unmarshal(respBody, &chatResp); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	if len(chatResp.Choices) == 0 || chatResp.Choices[0].Message.Content == "" {
+		return nil, fmt.Errorf("no response content: %w", ErrServerError)
+	}
+
+	output := Response{
+		Content: chatResp.Choices[0].Message.Content,
+		Usage: TokenUsage{
+			PromptTokens:     chatResp.Usage.PromptTokens,
+			CompletionTokens: chatResp.Usage.CompletionTokens,
+			TotalTokens:      chatResp.Usage.TotalTokens,
+		},
+	}
+
+	return &output, nil
+}
+
+func (c *openAIClient) convertToOpenAIMessages(messages []Message) ([]openAIMessage, error) {
+	var converted []openAIMessage
+
+	for _, msg := range messages {
+		var part openAIContentPart
+
+		switch msg.Content.Type {
+		case ContentTypeText:
+			part = openAIContentPart{Type: "text", Text: msg.Content.Text.Text}
+		case ContentTypeFile:
+			if !strings.HasPrefix(msg.Content.File.FileID, "data:") && !strings.HasPrefix(msg.Content.File.FileID, "http") {
+				return nil, fmt.Errorf("file id must be a data or http(s) URL")
+			}
+			part = openAIContentPart{Type: "image_url", ImageURL: &openAIImageURL{URL: msg.Content.File.FileID}}
+		default:
+			return nil, fmt.Errorf("unsupported content type: %s", msg.Content.Type)
+		}
+
+		// Merge with the previous message when the role repeats, so a prompt
+		// and its attachments arrive as one multi-part message
+		role := string(msg.Role)
+		if len(converted) > 0 && converted[len(converted)-1].Role == role {
+			converted[len(converted)-1].Content = append(converted[len(converted)-1].Content, part)
+		} else {
+			converted = append(converted, openAIMessage{Role: role, Content: []openAIContentPart{part}})
+		}
+	}
+
+	return converted, nil
+}
+
+func (c *openAIClient) handleError(status int, body []byte) error {
+	message := strings.TrimSpace(string(body))
+	var apiErr openAIErrorResponse
+	if json.Unmarshal(body, &apiErr) == nil && apiErr.Error.Message != "" {
+		message = apiErr.Error.Message
+	}
+
+	// A spent quota also arrives as 429 but will not clear by retrying
+	if status == http.StatusTooManyRequests && apiErr.Error.Code == "insufficient_quota" {
+		return fmt.Errorf("%w: status %d: %s", ErrQuotaExceeded, status, message)
+	}
+	if mapped := errorForStatus(status); mapped != nil {
+		return fmt.Errorf("%w: status %d: %s", mapped, status, message)
+	}
+	return fmt.Errorf("request failed, status %d: %s", status, message)
+}
+
+type openAIChatRequest struct {
+	Model       string          `json:"model"`
+	Messages    []openAIMessage `json:"messages"`
+	Temperature *float64        `json:"temperature,omitempty"`
+	MaxTokens   *int            `json:"max_tokens,omitempty"`
+	TopP        *float64        `json:"top_p,omitempty"`
+}
+
+type openAIMessage struct {
+	Role    string              `json:"role"`
+	Content []openAIContentPart `json:"content"`
+}
+
+type openAIContentPart struct {
+	Type     string          `json:"type"`
+	Text     string          `json:"text,omitempty"`
+	ImageURL *openAIImageURL `json:"image_url,omitempty"`
+}
+
+type openAIImageURL struct {
+	URL string `json:"url"`
+}
+
+type openAIChatResponse struct {
+	Choices []struct {
+		Message struct {
+			Role    string `json:"role"`
+			Content string `json:"content"`
+		} `json:"message"`
+	} `json:"choices"`
+	Usage struct {
+		PromptTokens     int `json:"prompt_tokens"`
+		CompletionTokens int `json:"completion_tokens"`
+		TotalTokens      int `json:"total_tokens"`
+	} `json:"usage"`
+}
+
+type openAIErrorResponse struct {
+	Error struct {
+		Message string `json:"message"`
+		Type    string `json:"type"`
+		Code    string `json:"code"`
+	} `json:"error"`
+}
@@ -0,0 +1,310 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sadbhavana/tree-project/pkgs/file"
+	"strings"
+	"sync"
+)
+
+// RecordEnvVar switches NewFixtureClient from replaying to recording
+const RecordEnvVar = "LLM_RECORD"
+
+// ErrNoRecording is returned by a replay client for a request that is not in
+// its fixture. Re-record the fixture after changing prompts or inputs.
+var ErrNoRecording = errors.New("no recorded interaction")
+
+// Cassette is the fixture file format shared by the recording and replay
+// clients. File references in requests are replaced by the SHA-256 of the
+// uploaded content, so fixtures do not depend on provider file IDs.
+type Cassette struct {
+	ResponseSchema bool                     `json:"response_schema"`
+	Uploads        []RecordedUpload         `json:"uploads"`
+	Interactions   []RecordedPrompt         `json:"interactions"`
+	fileRefs       map[string]string        // provider file ID/URL -> content ref
+	uploads        map[string]file.FileInfo // content ref -> returned file info
+}
+
+// RecordedUpload is one UploadFile call
+type RecordedUpload struct {
+	SHA256   string        `json:"sha256"`
+	FileName string        `json:"file_name"`
+	MimeType file.MimeType `json:"mime_type"`
+	FileID   string        `json:"file_id"`
+	FileURL  string        `json:"file_url"`
+}
+
+// RecordedPrompt is one Prompt call. Key identifies the normalised request.
+type RecordedPrompt struct {
+	Key      string          `json:"key"`
+	Request  json.RawMessage `json:"request"`
+	Response *Response       `json:"response,omitempty"`
+	Error    string          `json:"error,omitempty"`
+	ErrorIs  string          `json:"error_is,omitempty"`
+}
+
+// sentinelErrors are preserved across record/replay so errors.Is still works
+var sentinelErrors = map[string]error{
+	"rate_limit":         ErrRateLimit,
+	"invalid_input":      ErrInvalidInput,
+	"authentication":     ErrAuthentication,
+	"permission_denied":  ErrPermissionDenied,
+	"quota_exceeded":     ErrQuotaExceeded,
+	"not_found":          ErrNotFound,
+	"server_error":       ErrServerError,
+	"unsupported_schema": ErrUnsupportedSchema,
+}
+
+func contentRef(sum string) string {
+	return "sha256:" + sum
+}
+
+func (c *Cassette) init() {
+	c.fileRefs = make(map[string]string)
+	c.uploads = make(map[string]file.FileInfo)
+	for _, u := range c.Uploads {
+		ref := contentRef(u.SHA256)
+		if u.FileID != "" {
+			c.fileRefs[u.FileID] = ref
+		}
+		if u.FileURL != "" {
+			c.fileRefs[u.FileURL] = ref
+		}
+		c.uploads[ref] = file.FileInfo{FileID: u.FileID, FileURL: u.FileURL, FileName: u.FileName, MimeType: u.MimeType}
+	}
+}
+
+// requestKey normalises a request and hashes it. The normalised form is
+// also stored in the fixture to make diffs readable.
+func (c *Cassette) requestKey(req *Request) (string, json.RawMessage, error) {
+	normalised := Request{Config: req.Config, Messages: make([]Message, len(req.Messages))}
+	for i, msg := range req.Messages {
+		if msg.Content.File != nil {
+			f := *msg.Content.File
+			if ref, ok := c.fileRefs[f.FileID]; ok {
+				f.FileID = ref
+			}
+			msg.Content.File = &f
+		}
+		normalised.Messages[i] = msg
+	}
+
+	body, err := json.Marshal(normalised)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to encode request: %w", err)
+	}
+	h := sha256.New()
+	h.Write(body)
+	if req.Config.ResponseSchema != nil {
+		// The schema is not part of Config's JSON, but changes the reply
+		schema, err := json.Marshal(req.Config.ResponseSchema)
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to encode response schema: %w", err)
+		}
+		h.Write(schema)
+	}
+	return hex.EncodeToString(h.Sum(nil)), body, nil
+}
+
+// LoadCassette reads a fixture written by a recording client
+func LoadCassette(path string) (*Cassette, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var c Cassette
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("failed to decode fixture %s: %w", path, err)
+	}
+	c.init()
+	return &c, nil
+}
+
+// Save writes the fixture, creating its directory if needed
+func (c *Cassette) Save(path string) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode fixture: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// hashReader reads data fully and returns it with its SHA-256
+func hashReader(data io.Reader) ([]byte, string, error) {
+	raw, err := io.ReadAll(data)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read file: %w", err)
+	}
+	sum := sha256.Sum256(raw)
+	return raw, hex.EncodeToString(sum[:]), nil
+}
+
+// RecordingClient passes calls through to a live client and writes every
+// upload and prompt to a fixture file after each call
+type RecordingClient struct {
+	inner    Client
+	path     string
+	mu       sync.Mutex
+	cassette *Cassette
+}
+
+// NewRecordingClient wraps a live client, recording into a new fixture at path
+func NewRecordingClient(inner Client, path string) *RecordingClient {
+	cassette := &Cassette{}
+	if sc, ok := inner.(SchemaClient); ok {
+		cassette.ResponseSchema = sc.SupportsResponseSchema()
+	}
+	cassette.init()
+	return &RecordingClient{inner: inner, path: path, cassette: cassette}
+}
+
+func (r *RecordingClient) SupportsResponseSchema() bool {
+	return r.cassette.ResponseSchema
+}
+
+func (r *RecordingClient) UploadFile(ctx context.Context, filename string, mimeType file.MimeType, data io.Reader) (*file.FileInfo, error) {
+	raw, sum, err := hashReader(data)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := r.inner.UploadFile(ctx, filename, mimeType, bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cassette.Uploads = append(r.cassette.Uploads, RecordedUpload{
+		SHA256:   sum,
+		FileName: filename,
+		MimeType: mimeType,
+		FileID:   info.FileID,
+		FileURL:  info.FileURL,
+	})
+	r.cassette.init()
+	return info, r.cassette.Save(r.path)
+}
+
+func (r *RecordingClient) Prompt(ctx context.Context, req *Request) (*Response, error) {
+	resp, callErr := r.inner.Prompt(ctx, req)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key, body, err := r.cassette.requestKey(req)
+	if err != nil {
+		return nil, err
+	}
+	interaction := RecordedPrompt{Key: key, Request: body, Response: resp}
+	if callErr != nil {
+		interaction.Error = callErr.Error()
+		for name, sentinel := range sentinelErrors {
+			if errors.Is(callErr, sentinel) {
+				interaction.ErrorIs = name
+				break
+			}
+		}
+	}
+	r.cassette.Interactions = append(r.cassette.Interactions, interaction)
+	if err := r.cassette.Save(r.path); err != nil {
+		return nil, fmt.Errorf("failed to save fixture: %w", err)
+	}
+
+	return resp, callErr
+}
+
+// ReplayClient serves recorded interactions without network access. Repeated
+// identical requests are answered in recorded order, the last one repeating.
+type ReplayClient struct {
+	mu       sync.Mutex
+	cassette *Cassette
+	served   map[string]int
+}
+
+// NewReplayClient loads the fixture at path
+func NewReplayClient(path string) (*ReplayClient, error) {
+	cassette, err := LoadCassette(path)
+	if err != nil {
+		return nil, err
+	}
+	return &ReplayClient{cassette: cassette, served: make(map[string]int)}, nil
+}
+
+func (r *ReplayClient) SupportsResponseSchema() bool {
+	return r.cassette.ResponseSchema
+}
+
+func (r *ReplayClient) UploadFile(ctx context.Context, filename string, mimeType file.MimeType, data io.Reader) (*file.FileInfo, error) {
+	_, sum, err := hashReader(data)
+	if err != nil {
+		return nil, err
+	}
+
+	info, ok := r.cassette.uploads[contentRef(sum)]
+	if !ok {
+		return nil, fmt.Errorf("%w: upload of %s with sha256 %s", ErrNoRecording, filename, sum)
+	}
+	return &info, nil
+}
+
+func (r *ReplayClient) Prompt(ctx context.Context, req *Request) (*Response, error) {
+	key, _, err := r.cassette.requestKey(req)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var matches []RecordedPrompt
+	for _, interaction := range r.cassette.Interactions {
+		if interaction.Key == key {
+			matches = append(matches, interaction)
+		}
+	}
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("%w: prompt %s", ErrNoRecording, key)
+	}
+
+	n := r.served[key]
+	r.served[key] = n + 1
+	if n >= len(matches) {
+		n = len(matches) - 1
+	}
+	interaction := matches[n]
+
+	if interaction.Error != "" {
+		if sentinel, ok := sentinelErrors[interaction.ErrorIs]; ok {
+			return nil, fmt.Errorf("%w: %s", sentinel, strings.TrimPrefix(interaction.Error, sentinel.Error()+": "))
+		}
+		return nil, errors.New(interaction.Error)
+	}
+	resp := *interaction.Response
+	return &resp, nil
+}
+
+// NewFixtureClient replays the fixture at path, or, when LLM_RECORD is set,
+// records a new one from the client returned by live. Tests use it to run
+// offline against real captured outputs.
+func NewFixtureClient(path string, live func() (Client, error)) (Client, error) {
+	if os.Getenv(RecordEnvVar) == "" {
+		return NewReplayClient(path)
+	}
+
+	client, err := live()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create live client for recording: %w", err)
+	}
+	return NewRecordingClient(client, path), nil
+}
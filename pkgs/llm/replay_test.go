@@ -0,0 +1,94 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"sadbhavana/tree-project/pkgs/file"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	fake := newFakeGemini(t)
+	fake.reply = `{"message":"recorded","count":7}`
+	live, err := NewGeminiClient(context.Background(), Gemini25Flash,
+		WithBaseURL(fake.server.URL), WithAPIKey("test-key"), WithHTTPClient(fake.server.Client()))
+	if err != nil {
+		t.Fatalf("Failed to create Gemini client: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "fixture.json")
+	image := []byte("jpeg-bytes")
+
+	run := func(client Client) (*TestSimple, error) {
+		info, err := client.UploadFile(context.Background(), "photo.jpg", file.MimeTypeJPEG, bytes.NewReader(image))
+		if err != nil {
+			return nil, err
+		}
+		result, err := SimpleStructuredOutputWithFile[TestSimple](context.Background(), client, Config{}, "Read the sign", "",
+			[]FileContent{{FileID: info.FileURL, MimeType: file.MimeTypeJPEG}})
+		return result, err
+	}
+
+	recorded, err := run(NewRecordingClient(live, path))
+	if err != nil {
+		t.Fatalf("Recording failed: %v", err)
+	}
+
+	// Replay must not touch the network
+	fake.server.Close()
+
+	replay, err := NewReplayClient(path)
+	if err != nil {
+		t.Fatalf("Failed to load fixture: %v", err)
+	}
+	assert.True(t, replay.SupportsResponseSchema())
+
+	replayed, err := run(replay)
+	if err != nil {
+		t.Fatalf("Replay failed: %v", err)
+	}
+	assert.Equal(t, recorded, replayed)
+
+	// A different image is not in the fixture
+	_, err = replay.UploadFile(context.Background(), "other.jpg", file.MimeTypeJPEG, bytes.NewReader([]byte("other")))
+	assert.True(t, errors.Is(err, ErrNoRecording))
+
+	// Nor is a different prompt
+	_, err = replay.Prompt(context.Background(), &Request{Messages: []Message{
+		{Role: RoleUser, Content: MessageContent{Type: ContentTypeText, Text: &TextContent{Text: "something else"}}},
+	}})
+	assert.True(t, errors.Is(err, ErrNoRecording))
+}
+
+func TestReplayPreservesErrors(t *testing.T) {
+	fake := newFakeOpenAI(t)
+	fake.failWith(http.StatusTooManyRequests)
+	live, err := NewOpenAIClient(context.Background(), "llava",
+		WithBaseURL(fake.server.URL+"/v1"), WithAPIKey("test-key"), WithHTTPClient(fake.server.Client()))
+	if err != nil {
+		t.Fatalf("Failed to create OpenAI client: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "fixture.json")
+	req := &Request{Messages: []Message{
+		{Role: RoleUser, Content: MessageContent{Type: ContentTypeText, Text: &TextContent{Text: "hi"}}},
+	}}
+
+	if _, err := NewRecordingClient(live, path).Prompt(context.Background(), req); !errors.Is(err, ErrRateLimit) {
+		t.Fatalf("Expected ErrRateLimit while recording, got %v", err)
+	}
+
+	replay, err := NewReplayClient(path)
+	if err != nil {
+		t.Fatalf("Failed to load fixture: %v", err)
+	}
+	assert.False(t, replay.SupportsResponseSchema())
+	if _, err := replay.Prompt(context.Background(), req); !errors.Is(err, ErrRateLimit) {
+		t.Fatalf("Expected ErrRateLimit on replay, got %v", err)
+	}
+}
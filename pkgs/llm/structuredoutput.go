@@ -3,6 +3,7 @@ package llm
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"reflect"
@@ -19,22 +20,76 @@ var MaxStructuredOutputRetries = 3
 // It automatically generates JSON schema from type T and parses the response
 // Retries up to MaxStructuredOutputRetries times if JSON parsing fails
 func SimpleStructuredOutput[T any](ctx context.Context, client Client, cfg Config, systemMessage string, userMessage string) (result *T, err error) {
-	return structuredOutputWithOptionalFile[T](ctx, client, cfg, systemMessage, userMessage, nil)
+	result, _, err = StructuredOutput[T](ctx, client, cfg, systemMessage, userMessage, nil)
+	return result, err
 }
 
 // SimpleStructuredOutputWithFile calls an LLM with a structured output requirement and includes a file
 // It automatically generates JSON schema from type T and parses the response
 // Retries up to MaxStructuredOutputRetries times if JSON parsing fails
 func SimpleStructuredOutputWithFile[T any](ctx context.Context, client Client, cfg Config, systemMessage string, userMessage string, fileContents []FileContent) (result *T, err error) {
-	return structuredOutputWithOptionalFile[T](ctx, client, cfg, systemMessage, userMessage, fileContents)
+	result, _, err = StructuredOutput[T](ctx, client, cfg, systemMessage, userMessage, fileContents)
+	return result, err
+}
+
+// StructuredOutput calls an LLM with a structured output requirement for type T,
+// optionally including files. Clients implementing SchemaClient receive the
+// reflected schema as Config.ResponseSchema; if the provider cannot express
+// it (ErrUnsupportedSchema), or for any other client, the schema is embedded
+// in the prompt and the reply parsed instead. Other errors, including
+// ErrInvalidInput, are returned as they are. The returned usage is summed over every call made,
+// including failed attempts, and is returned even when err is non-nil.
+func StructuredOutput[T any](ctx context.Context, client Client, cfg Config, systemMessage string, userMessage string, fileContents []FileContent) (result *T, usage TokenUsage, err error) {
+	if sc, ok := client.(SchemaClient); ok && sc.SupportsResponseSchema() {
+		var nativeUsage TokenUsage
+		result, nativeUsage, err = nativeStructuredOutput[T](ctx, client, cfg, systemMessage, userMessage, fileContents)
+		usage.Add(nativeUsage)
+		if err == nil || !errors.Is(err, ErrUnsupportedSchema) {
+			return result, usage, err
+		}
+		log.Printf("Native structured output unavailable for %s, falling back to prompting: %v", getTypeName[T](), err)
+	}
+
+	var promptUsage TokenUsage
+	result, promptUsage, err = structuredOutputWithOptionalFile[T](ctx, client, cfg, systemMessage, userMessage, fileContents)
+	usage.Add(promptUsage)
+	return result, usage, err
+}
+
+// nativeStructuredOutput lets the provider enforce the schema. Replies can
+// still be cut short (e.g. by MaxTokens), so parsing is retried as well.
+func nativeStructuredOutput[T any](ctx context.Context, client Client, cfg Config, systemMessage string, userMessage string, fileContents []FileContent) (result *T, usage TokenUsage, err error) {
+	cfg.ResponseSchema = reflectSchema[T]()
+	cfg.ResponseMIMEType = "application/json"
+
+	messages := buildMessagesArray(systemMessage, userMessage, fileContents)
+
+	var lastErr error
+	for attempt := 0; attempt < MaxStructuredOutputRetries; attempt++ {
+		response, err := client.Prompt(withAttempt(ctx, attempt+1), &Request{Messages: messages, Config: cfg})
+		if err != nil {
+			return nil, usage, fmt.Errorf("failed to call LLM on attempt %d: %w", attempt+1, err)
+		}
+		usage.Add(response.Usage)
+
+		result, err := ParseJSONResponse[T](response.Content)
+		if err != nil {
+			lastErr = fmt.Errorf("attempt %d - %w", attempt+1, err)
+			continue
+		}
+
+		return result, usage, nil
+	}
+
+	return nil, usage, fmt.Errorf("failed after %d attempts, last error: %w", MaxStructuredOutputRetries, lastErr)
 }
 
 // structuredOutputWithOptionalFile is the common implementation for both structured output functions
-func structuredOutputWithOptionalFile[T any](ctx context.Context, client Client, cfg Config, systemMessage string, userMessage string, fileContents []FileContent) (result *T, err error) {
+func structuredOutputWithOptionalFile[T any](ctx context.Context, client Client, cfg Config, systemMessage string, userMessage string, fileContents []FileContent) (result *T, usage TokenUsage, err error) {
 	// Generate enhanced system message with JSON schema
 	enhancedSystemMessage, err := generateEnhancedSystemMessage[T](systemMessage)
 	if err != nil {
-		return nil, err
+		return nil, usage, err
 	}
 
 	// Execute retry loop with structured output parsing
@@ -50,10 +105,11 @@ func structuredOutputWithOptionalFile[T any](ctx context.Context, client Client,
 
 		// Call LLM
 		request := &Request{Messages: messages, Config: cfg}
-		response, err := client.Prompt(ctx, request)
+		response, err := client.Prompt(withAttempt(ctx, attempt+1), request)
 		if err != nil {
-			return nil, fmt.Errorf("failed to call LLM on attempt %d: %w", attempt+1, err)
+			return nil, usage, fmt.Errorf("failed to call LLM on attempt %d: %w", attempt+1, err)
 		}
+		usage.Add(response.Usage)
 
 		lastResponse = response.Content
 
@@ -65,23 +121,27 @@ func structuredOutputWithOptionalFile[T any](ctx context.Context, client Client,
 		}
 
 		// Success!
-		return result, nil
+		return result, usage, nil
 	}
 
 	// All retries exhausted
-	return nil, fmt.Errorf("failed after %d attempts, last error: %w", MaxStructuredOutputRetries, lastErr)
+	return nil, usage, fmt.Errorf("failed after %d attempts, last error: %w", MaxStructuredOutputRetries, lastErr)
 }
 
-// generateEnhancedSystemMessage creates system message with JSON schema and formatting requirements
-func generateEnhancedSystemMessage[T any](systemMessage string) (string, error) {
-	// Generate JSON schema from type T
+// reflectSchema generates the JSON schema for type T
+func reflectSchema[T any]() *jsonschema.Schema {
 	var zero T
 	reflector := jsonschema.Reflector{
 		AllowAdditionalProperties: false,
 		DoNotReference:            true,
 	}
+	return reflector.Reflect(zero)
+}
 
-	schema := reflector.Reflect(zero)
+// generateEnhancedSystemMessage creates system message with JSON schema and formatting requirements
+func generateEnhancedSystemMessage[T any](systemMessage string) (string, error) {
+	// Generate JSON schema from type T
+	schema := reflectSchema[T]()
 	schemaBytes, err := json.MarshalIndent(schema, "", "  ")
 	if err != nil {
 		return "", fmt.Errorf("failed to marshal JSON schema: %w", err)
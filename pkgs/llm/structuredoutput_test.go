@@ -2,6 +2,7 @@ package llm
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"sadbhavana/tree-project/pkgs/file"
@@ -437,3 +438,132 @@ func BenchmarkSimpleStructuredOutput(b *testing.B) {
 		}
 	}
 }
+
+// schemaMockClient claims native schema support but rejects every schema,
+// exercising the fallback to prompt-and-parse. schemaErr defaults to
+// ErrUnsupportedSchema.
+type schemaMockClient struct {
+	mockClient
+	schemaCalls int
+	schemaErr   error
+}
+
+func (m *schemaMockClient) SupportsResponseSchema() bool {
+	return true
+}
+
+func (m *schemaMockClient) Prompt(ctx context.Context, req *Request) (*Response, error) {
+	if req.Config.ResponseSchema != nil {
+		m.schemaCalls++
+		if m.schemaErr != nil {
+			return nil, m.schemaErr
+		}
+		return nil, fmt.Errorf("%w: mock", ErrUnsupportedSchema)
+	}
+	return m.mockClient.Prompt(ctx, req)
+}
+
+func TestStructuredOutput_SumsUsageAcrossRetries(t *testing.T) {
+	client := &mockClient{
+		responses: []string{
+			"not json",
+			"```json\n{\"message\":\"ok\",\"count\":1}\n```",
+		},
+	}
+
+	result, usage, err := StructuredOutput[TestSimple](context.Background(), client, Config{}, "You are helpful", "Create a simple object", nil)
+	if err != nil {
+		t.Fatalf("Expected success, got error: %v", err)
+	}
+	if result.Message != "ok" {
+		t.Errorf("Expected message ok, got %s", result.Message)
+	}
+	if usage != (TokenUsage{PromptTokens: 200, CompletionTokens: 100, TotalTokens: 300}) {
+		t.Errorf("Expected usage summed over 2 calls, got %+v", usage)
+	}
+}
+
+func TestStructuredOutput_FallsBackWhenSchemaUnsupported(t *testing.T) {
+	client := &schemaMockClient{mockClient: mockClient{
+		responses: []string{"```json\n{\"message\":\"fallback\",\"count\":2}\n```"},
+	}}
+
+	result, usage, err := StructuredOutput[TestSimple](context.Background(), client, Config{}, "You are helpful", "Create a simple object", nil)
+	if err != nil {
+		t.Fatalf("Expected success, got error: %v", err)
+	}
+	if client.schemaCalls != 1 {
+		t.Errorf("Expected 1 native attempt, got %d", client.schemaCalls)
+	}
+	if result.Message != "fallback" || usage.TotalTokens != 150 {
+		t.Errorf("Unexpected result %+v with usage %+v", result, usage)
+	}
+}
+
+func TestStructuredOutput_NoFallbackOnInvalidInput(t *testing.T) {
+	client := &schemaMockClient{
+		mockClient: mockClient{responses: []string{"```json\n{\"message\":\"fallback\",\"count\":2}\n```"}},
+		schemaErr:  fmt.Errorf("%w: bad image", ErrInvalidInput),
+	}
+
+	_, _, err := StructuredOutput[TestSimple](context.Background(), client, Config{}, "You are helpful", "Create a simple object", nil)
+	if !errors.Is(err, ErrInvalidInput) {
+		t.Fatalf("Expected ErrInvalidInput, got %v", err)
+	}
+	if client.callCount != 0 {
+		t.Errorf("Expected no prompt-and-parse attempt, got %d", client.callCount)
+	}
+}
+
+func TestStructuredOutput_GeminiNativeSchema(t *testing.T) {
+	fake := newFakeGemini(t)
+	fake.reply = `{"message":"native","count":3}`
+	client, err := NewGeminiClient(context.Background(), Gemini25Flash,
+		WithBaseURL(fake.server.URL), WithAPIKey("test-key"), WithHTTPClient(fake.server.Client()))
+	if err != nil {
+		t.Fatalf("Failed to create Gemini client: %v", err)
+	}
+
+	result, usage, err := StructuredOutput[TestSimple](context.Background(), client, Config{}, "You are helpful", "Create a simple object", nil)
+	if err != nil {
+		t.Fatalf("Expected success, got error: %v", err)
+	}
+	if result.Message != "native" || result.Count != 3 {
+		t.Errorf("Unexpected result %+v", result)
+	}
+	if usage.TotalTokens != 18 {
+		t.Errorf("Expected 18 total tokens, got %d", usage.TotalTokens)
+	}
+
+	sent := fake.prompt()
+	if !strings.Contains(sent, `"responseMimeType":"application/json"`) || !strings.Contains(sent, `"responseSchema"`) {
+		t.Errorf("Expected native schema in request, got %s", sent)
+	}
+	if strings.Contains(sent, "STRICT FORMATTING REQUIREMENTS") {
+		t.Errorf("Schema should not be embedded in the prompt in native mode")
+	}
+}
+
+func TestToGeminiSchema(t *testing.T) {
+	schema, err := toGeminiSchema(reflectSchema[TestPerson]())
+	if err != nil {
+		t.Fatalf("Failed to convert schema: %v", err)
+	}
+
+	if schema.Type != "OBJECT" {
+		t.Errorf("Expected OBJECT, got %s", schema.Type)
+	}
+	if strings.Join(schema.PropertyOrdering, ",") != "name,age,email,skills,active" {
+		t.Errorf("Unexpected property ordering %v", schema.PropertyOrdering)
+	}
+	if schema.Properties["skills"].Type != "ARRAY" || schema.Properties["skills"].Items.Type != "STRING" {
+		t.Errorf("Unexpected skills schema %+v", schema.Properties["skills"])
+	}
+	if schema.Properties["age"].Type != "INTEGER" {
+		t.Errorf("Expected INTEGER age, got %s", schema.Properties["age"].Type)
+	}
+
+	if _, err := toGeminiSchema(reflectSchema[map[string]any]()); err == nil {
+		t.Errorf("Expected maps to be rejected")
+	}
+}
@@ -0,0 +1,165 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"sadbhavana/tree-project/pkgs/conf"
+	"sadbhavana/tree-project/pkgs/db"
+	"sadbhavana/tree-project/pkgs/file"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// UnknownAction is recorded for calls made without WithAction
+const UnknownAction = "unknown"
+
+type actionKey struct{}
+type attemptKey struct{}
+
+// WithAction tags LLM calls made with ctx, e.g. "ExtractTreeId", so the usage
+// ledger can report spend per action
+func WithAction(ctx context.Context, action string) context.Context {
+	return context.WithValue(ctx, actionKey{}, action)
+}
+
+func actionFromContext(ctx context.Context) string {
+	if action, ok := ctx.Value(actionKey{}).(string); ok && action != "" {
+		return action
+	}
+	return UnknownAction
+}
+
+// withAttempt records which retry of a structured output call this is
+func withAttempt(ctx context.Context, attempt int) context.Context {
+	return context.WithValue(ctx, attemptKey{}, attempt)
+}
+
+func attemptFromContext(ctx context.Context) int {
+	if attempt, ok := ctx.Value(attemptKey{}).(int); ok && attempt > 0 {
+		return attempt
+	}
+	return 1
+}
+
+// UsageStore persists the usage ledger; *db.Queries implements it
+type UsageStore interface {
+	RecordLlmUsage(ctx context.Context, arg db.RecordLlmUsageParams) error
+	GetLlmTokensUsedSince(ctx context.Context, since pgtype.Timestamptz) (int64, error)
+}
+
+// usageClient records every Prompt to the usage ledger and enforces the
+// daily token budget before calling the wrapped client
+type usageClient struct {
+	inner    Client
+	store    UsageStore
+	provider string
+	model    string
+	cfg      conf.LLMConfig
+	now      func() time.Time
+}
+
+// NewUsageClient wraps a client so its calls are recorded in the usage
+// ledger. Budget and prices come from cfg.
+func NewUsageClient(inner Client, store UsageStore, provider, model string, cfg conf.LLMConfig) Client {
+	return &usageClient{
+		inner:    inner,
+		store:    store,
+		provider: provider,
+		model:    model,
+		cfg:      cfg,
+		now:      time.Now,
+	}
+}
+
+func (c *usageClient) UploadFile(ctx context.Context, filename string, mimeType file.MimeType, data io.Reader) (*file.FileInfo, error) {
+	return c.inner.UploadFile(ctx, filename, mimeType, data)
+}
+
+// SupportsResponseSchema passes through the wrapped client's capability
+func (c *usageClient) SupportsResponseSchema() bool {
+	sc, ok := c.inner.(SchemaClient)
+	return ok && sc.SupportsResponseSchema()
+}
+
+func (c *usageClient) Prompt(ctx context.Context, req *Request) (*Response, error) {
+	if err := c.checkBudget(ctx); err != nil {
+		c.record(ctx, TokenUsage{}, 0, err)
+		return nil, err
+	}
+
+	start := c.now()
+	resp, err := c.inner.Prompt(ctx, req)
+	latency := c.now().Sub(start)
+
+	var usage TokenUsage
+	if resp != nil {
+		usage = resp.Usage
+	}
+	c.record(ctx, usage, latency, err)
+
+	return resp, err
+}
+
+// checkBudget fails fast once today's (UTC) tokens reach the budget. A
+// ledger that cannot be read does not block calls.
+func (c *usageClient) checkBudget(ctx context.Context) error {
+	if c.cfg.DailyTokenBudget <= 0 {
+		return nil
+	}
+
+	startOfDay := c.now().UTC().Truncate(24 * time.Hour)
+	used, err := c.store.GetLlmTokensUsedSince(ctx, pgtype.Timestamptz{Time: startOfDay, Valid: true})
+	if err != nil {
+		log.Printf("Failed to read LLM usage for budget check: %v", err)
+		return nil
+	}
+
+	if used >= c.cfg.DailyTokenBudget {
+		return fmt.Errorf("%w: daily token budget of %d reached (%d used)", ErrQuotaExceeded, c.cfg.DailyTokenBudget, used)
+	}
+	return nil
+}
+
+// record appends the call to the ledger. Failures are logged rather than
+// returned so that bookkeeping never fails an otherwise good call.
+func (c *usageClient) record(ctx context.Context, usage TokenUsage, latency time.Duration, callErr error) {
+	params := db.RecordLlmUsageParams{
+		Provider:         c.provider,
+		Model:            c.model,
+		Action:           actionFromContext(ctx),
+		Attempt:          int32(attemptFromContext(ctx)),
+		PromptTokens:     int32(usage.PromptTokens),
+		CompletionTokens: int32(usage.CompletionTokens),
+		TotalTokens:      int32(usage.TotalTokens),
+		LatencyMs:        int32(latency.Milliseconds()),
+		Success:          callErr == nil,
+		CostUsd:          c.cost(usage),
+	}
+	if callErr != nil {
+		params.Error = pgtype.Text{String: callErr.Error(), Valid: true}
+	}
+
+	// Record even if the caller has given up on the call
+	if err := c.store.RecordLlmUsage(context.WithoutCancel(ctx), params); err != nil {
+		log.Printf("Failed to record LLM usage: %v", err)
+	}
+}
+
+// cost prices the call using the configured per-million-token rates
+func (c *usageClient) cost(usage TokenUsage) float64 {
+	return (float64(usage.PromptTokens)*c.cfg.PromptTokenPrice +
+		float64(usage.CompletionTokens)*c.cfg.CompletionTokenPrice) / 1e6
+}
+
+// UsageReportSince returns the start of the UTC day days-1 days ago, so a
+// report over 1 day covers today only
+func UsageReportSince(days int) pgtype.Timestamptz {
+	if days < 1 {
+		days = 1
+	}
+	start := time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, -(days - 1))
+	return pgtype.Timestamptz{Time: start, Valid: true}
+}
@@ -0,0 +1,76 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"sadbhavana/tree-project/pkgs/conf"
+	"sadbhavana/tree-project/pkgs/db"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeUsageStore struct {
+	used    int64
+	records []db.RecordLlmUsageParams
+}
+
+func (s *fakeUsageStore) RecordLlmUsage(ctx context.Context, arg db.RecordLlmUsageParams) error {
+	s.records = append(s.records, arg)
+	s.used += int64(arg.TotalTokens)
+	return nil
+}
+
+func (s *fakeUsageStore) GetLlmTokensUsedSince(ctx context.Context, since pgtype.Timestamptz) (int64, error) {
+	return s.used, nil
+}
+
+func TestUsageClient_RecordsEveryAttempt(t *testing.T) {
+	store := &fakeUsageStore{}
+	inner := &mockClient{responses: []string{"not json", `{"message":"ok","count":1}`}}
+	client := NewUsageClient(inner, store, OPENAI_PROVIDER_NAME, "llava", conf.LLMConfig{
+		PromptTokenPrice:     1,
+		CompletionTokenPrice: 2,
+	})
+
+	ctx := WithAction(context.Background(), "ExtractTreeId")
+	_, usage, err := StructuredOutput[TestSimple](ctx, client, Config{}, "You are helpful", "Create a simple object", nil)
+	if err != nil {
+		t.Fatalf("Expected success, got error: %v", err)
+	}
+
+	if len(store.records) != 2 {
+		t.Fatalf("Expected 2 ledger rows, got %d", len(store.records))
+	}
+	assert.Equal(t, 300, usage.TotalTokens)
+
+	first, second := store.records[0], store.records[1]
+	assert.Equal(t, "ExtractTreeId", first.Action)
+	assert.Equal(t, "llava", first.Model)
+	assert.Equal(t, int32(1), first.Attempt)
+	assert.Equal(t, int32(2), second.Attempt)
+	assert.True(t, second.Success)
+	assert.Equal(t, int32(150), second.TotalTokens)
+	// 100 prompt tokens at $1/M plus 50 completion tokens at $2/M
+	assert.InDelta(t, 0.0002, second.CostUsd, 1e-9)
+}
+
+func TestUsageClient_DailyBudget(t *testing.T) {
+	store := &fakeUsageStore{used: 1000}
+	inner := &mockClient{responses: []string{"hello"}}
+	client := NewUsageClient(inner, store, GEMINI_PROVIDER_NAME, string(Gemini25Pro), conf.LLMConfig{DailyTokenBudget: 1000})
+
+	_, err := client.Prompt(context.Background(), &Request{Messages: []Message{
+		{Role: RoleUser, Content: MessageContent{Type: ContentTypeText, Text: &TextContent{Text: "hi"}}},
+	}})
+	if !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("Expected ErrQuotaExceeded, got %v", err)
+	}
+	assert.Equal(t, 0, inner.callCount, "provider should not be called once the budget is spent")
+
+	if assert.Len(t, store.records, 1) {
+		assert.False(t, store.records[0].Success)
+		assert.Equal(t, UnknownAction, store.records[0].Action)
+	}
+}
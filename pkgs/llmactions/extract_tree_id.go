@@ -3,23 +3,61 @@ package llmactions
 import (
 	"context"
 	"fmt"
+	"io"
 	"sadbhavana/tree-project/pkgs/db"
 	"sadbhavana/tree-project/pkgs/file"
 	"sadbhavana/tree-project/pkgs/llm"
+	"sort"
+	"strings"
 )
 
 type ExtractTreeIdOutput struct {
+	TreeID     string            `json:"tree_id"`
+	Confidence float64           `json:"confidence"`
+	Candidates []TreeIdCandidate `json:"candidates"`
+	DonorName  string            `json:"donor_name"`
+	// Usage is the tokens spent on the extraction, including retries
+	Usage llm.TokenUsage `json:"-"`
+}
+
+// TreeIdCandidate is one possible reading of the ID on the sign
+type TreeIdCandidate struct {
 	TreeID     string  `json:"tree_id"`
 	Confidence float64 `json:"confidence"`
 }
 
+// RankedCandidates returns every reading, best first, including the primary
+// tree_id if the model did not repeat it in candidates
+func (o ExtractTreeIdOutput) RankedCandidates() []TreeIdCandidate {
+	candidates := append([]TreeIdCandidate(nil), o.Candidates...)
+	if o.TreeID != "" {
+		found := false
+		for _, c := range candidates {
+			if strings.EqualFold(c.TreeID, o.TreeID) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			candidates = append(candidates, TreeIdCandidate{TreeID: o.TreeID, Confidence: o.Confidence})
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].Confidence > candidates[j].Confidence
+	})
+	return candidates
+}
+
 const ExtractTreeIdPrompt string = `Attached is a photo containing a sign near the center of the photo with text in red ink. On the first line, there is an id which consists of 2 characters followed by an integer, on the second, the name of the donor, and then non-english text on the rest.
+Handwriting can be ambiguous (for example 0 and O, 1 and 7, 5 and S), so also list the other plausible readings of the id, most likely first.
 You should output the following JSON in the following format:
 
 ` + "```" + `json
 {
-"tree_id": "the extracted identifier (string). Example: 'AB1234'",
-"confidence": "A score from 0.0 to 1.0 indicating confidence in the extracted ID (float)"
+"tree_id": "the most likely identifier (string). Example: 'AB1234'",
+"confidence": "A score from 0.0 to 1.0 indicating confidence in the extracted ID (float)",
+"candidates": [{"tree_id": "each plausible reading, including the most likely one (string)", "confidence": "score from 0.0 to 1.0 (float)"}],
+"donor_name": "the donor name on the second line, as written (string, empty if unreadable)"
 }` + "```"
 
 func ExtractTreeId(ctx context.Context, q *db.Queries, client llm.Client, fileInfo file.FileInfo) (ExtractTreeIdOutput, error) {
@@ -29,7 +67,15 @@ func ExtractTreeId(ctx context.Context, q *db.Queries, client llm.Client, fileIn
 	}
 	defer cleanup()
 
-	geminiFileInfo, err := client.UploadFile(ctx, fileInfo.FileName, fileInfo.MimeType, reader)
+	return ExtractTreeIdFromImage(ctx, client, fileInfo, reader)
+}
+
+// ExtractTreeIdFromImage runs the extraction on image data that has already
+// been fetched, which lets tests supply the image directly
+func ExtractTreeIdFromImage(ctx context.Context, client llm.Client, fileInfo file.FileInfo, data io.Reader) (ExtractTreeIdOutput, error) {
+	ctx = llm.WithAction(ctx, "ExtractTreeId")
+
+	geminiFileInfo, err := client.UploadFile(ctx, fileInfo.FileName, fileInfo.MimeType, data)
 	if err != nil {
 		return ExtractTreeIdOutput{}, fmt.Errorf("failed to upload file to LLM: %w", err)
 	}
@@ -42,10 +88,11 @@ func ExtractTreeId(ctx context.Context, q *db.Queries, client llm.Client, fileIn
 		},
 	}
 
-	llmOutput, err := llm.SimpleStructuredOutputWithFile[ExtractTreeIdOutput](ctx, client, llm.Config{}, ExtractTreeIdPrompt, "", fileContents)
+	llmOutput, usage, err := llm.StructuredOutput[ExtractTreeIdOutput](ctx, client, llm.Config{}, ExtractTreeIdPrompt, "", fileContents)
 	if err != nil {
-		return ExtractTreeIdOutput{}, fmt.Errorf("failed to get LLM output: %w", err)
+		return ExtractTreeIdOutput{Usage: usage}, fmt.Errorf("failed to get LLM output: %w", err)
 	}
 
+	llmOutput.Usage = usage
 	return *llmOutput, nil
 }
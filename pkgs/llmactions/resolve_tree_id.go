@@ -0,0 +1,330 @@
+package llmactions
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"sadbhavana/tree-project/pkgs/db"
+)
+
+// Resolver thresholds. A match below MinTreeMatchScore is not trusted, and
+// one within TreeMatchAmbiguityMargin of a different tree is ambiguous.
+const (
+	MinTreeMatchScore        = 0.6
+	TreeMatchAmbiguityMargin = 0.05
+)
+
+// Per-edit penalties applied to a candidate's confidence. Letter/digit
+// lookalikes in the wrong position are cheap; swapping one digit for another
+// is a real misread and costs more.
+const (
+	lookalikePenalty = 0.95
+	misreadPenalty   = 0.8
+)
+
+// letterForDigit fixes digits read where the project code's letters belong
+var letterForDigit = map[rune]rune{'0': 'O', '1': 'I', '2': 'Z', '5': 'S', '6': 'G', '8': 'B'}
+
+// digitForLetter fixes letters read where the tree number's digits belong
+var digitForLetter = map[rune]rune{'O': '0', 'D': '0', 'Q': '0', 'I': '1', 'L': '1', 'Z': '2', 'S': '5', 'G': '6', 'B': '8', 'T': '7'}
+
+// digitMisreads lists digits commonly confused in handwriting
+var digitMisreads = map[rune][]rune{
+	'0': {'8', '6', '9'},
+	'1': {'7', '4'},
+	'3': {'8'},
+	'4': {'1', '9'},
+	'5': {'6'},
+	'6': {'5', '0', '8'},
+	'7': {'1'},
+	'8': {'3', '0', '6'},
+	'9': {'4', '0'},
+}
+
+// TreeResolverStore is the subset of queries the resolver needs
+type TreeResolverStore interface {
+	ListProjectTreeRanges(ctx context.Context) ([]db.ListProjectTreeRangesRow, error)
+	ListTreesByProjectCodesAndNumbers(ctx context.Context, arg db.ListTreesByProjectCodesAndNumbersParams) ([]db.ListTreesByProjectCodesAndNumbersRow, error)
+}
+
+// TreeMatch is an existing tree that one of the candidates may refer to
+type TreeMatch struct {
+	TreeID      string  `json:"tree_id"`
+	ProjectCode string  `json:"project_code"`
+	TreeNumber  int32   `json:"tree_number"`
+	ReadAs      string  `json:"read_as"`
+	Edits       int     `json:"edits"`
+	NameScore   float64 `json:"name_score"`
+	Score       float64 `json:"score"`
+}
+
+// Label is the tree's canonical ID, e.g. AB000123
+func (m TreeMatch) Label() string {
+	return FormatTreeLabel(m.ProjectCode, m.TreeNumber)
+}
+
+// FormatTreeLabel writes a tree ID the way P_CreateTreeBulk assigns it: the
+// project code followed by the tree number padded to six digits
+func FormatTreeLabel(projectCode string, treeNumber int32) string {
+	return fmt.Sprintf("%s%06d", projectCode, treeNumber)
+}
+
+// TreeResolution is the outcome of matching candidates against known trees
+type TreeResolution struct {
+	// Best is set only when a match is confident and unambiguous
+	Best *TreeMatch
+	// Matches holds every tree considered, best first
+	Matches []TreeMatch
+	// Ambiguous is set when the top two matches are different trees with
+	// nearly the same score
+	Ambiguous bool
+}
+
+// ResolveTreeID validates the extracted candidates against existing project
+// codes, tree-number ranges and donor/credit names, allowing for misread
+// characters, and picks the tree the photo most likely belongs to.
+func ResolveTreeID(ctx context.Context, q TreeResolverStore, extracted ExtractTreeIdOutput) (TreeResolution, error) {
+	ranges, err := q.ListProjectTreeRanges(ctx)
+	if err != nil {
+		return TreeResolution{}, fmt.Errorf("failed to list project tree ranges: %w", err)
+	}
+
+	readings := candidateReadings(extracted.RankedCandidates(), ranges)
+	if len(readings) == 0 {
+		return TreeResolution{}, nil
+	}
+
+	params := db.ListTreesByProjectCodesAndNumbersParams{}
+	seenCodes := map[string]bool{}
+	seenNumbers := map[int32]bool{}
+	for _, r := range readings {
+		if !seenCodes[r.projectCode] {
+			seenCodes[r.projectCode] = true
+			params.ProjectCodes = append(params.ProjectCodes, r.projectCode)
+		}
+		if !seenNumbers[r.treeNumber] {
+			seenNumbers[r.treeNumber] = true
+			params.TreeNumbers = append(params.TreeNumbers, r.treeNumber)
+		}
+	}
+
+	trees, err := q.ListTreesByProjectCodesAndNumbers(ctx, params)
+	if err != nil {
+		return TreeResolution{}, fmt.Errorf("failed to list candidate trees: %w", err)
+	}
+
+	return rankTreeMatches(readings, trees, extracted.DonorName), nil
+}
+
+// reading is one normalised interpretation of a candidate ID
+type reading struct {
+	projectCode string
+	treeNumber  int32
+	readAs      string
+	confidence  float64
+	lookalikes  int
+	misreads    int
+}
+
+func (r reading) key() string {
+	return fmt.Sprintf("%s%d", r.projectCode, r.treeNumber)
+}
+
+func (r reading) score() float64 {
+	return r.confidence * math.Pow(lookalikePenalty, float64(r.lookalikes)) * math.Pow(misreadPenalty, float64(r.misreads))
+}
+
+// candidateReadings expands each candidate into the plausible IDs it could
+// stand for and keeps those inside a known project's tree-number range. When
+// several candidates lead to the same ID the best-scoring reading wins.
+func candidateReadings(candidates []TreeIdCandidate, ranges []db.ListProjectTreeRangesRow) []reading {
+	known := make(map[string]db.ListProjectTreeRangesRow, len(ranges))
+	for _, r := range ranges {
+		known[strings.TrimSpace(r.ProjectCode)] = r
+	}
+
+	best := map[string]reading{}
+	var order []string
+	for _, c := range candidates {
+		for _, r := range expandCandidate(c) {
+			rng, ok := known[r.projectCode]
+			if !ok || r.treeNumber < rng.MinTreeNumber || r.treeNumber > rng.MaxTreeNumber {
+				continue
+			}
+			prev, seen := best[r.key()]
+			if !seen {
+				order = append(order, r.key())
+			}
+			if !seen || r.score() > prev.score() {
+				best[r.key()] = r
+			}
+		}
+	}
+
+	readings := make([]reading, 0, len(order))
+	for _, k := range order {
+		readings = append(readings, best[k])
+	}
+	return readings
+}
+
+// expandCandidate normalises a raw ID such as "a8 1O7" into its exact reading
+// plus variants with lookalike and misread characters corrected
+func expandCandidate(c TreeIdCandidate) []reading {
+	raw := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToUpper(r)
+		}
+		return -1
+	}, c.TreeID)
+	runes := []rune(raw)
+	if len(runes) < 3 {
+		return nil
+	}
+
+	base := reading{readAs: c.TreeID, confidence: c.Confidence}
+
+	code := make([]rune, 2)
+	for i, r := range runes[:2] {
+		if unicode.IsDigit(r) {
+			fixed, ok := letterForDigit[r]
+			if !ok {
+				return nil
+			}
+			r = fixed
+			base.lookalikes++
+		}
+		code[i] = r
+	}
+	base.projectCode = string(code)
+
+	digits := make([]rune, 0, len(runes)-2)
+	for _, r := range runes[2:] {
+		if !unicode.IsDigit(r) {
+			fixed, ok := digitForLetter[r]
+			if !ok {
+				return nil
+			}
+			r = fixed
+			base.lookalikes++
+		}
+		digits = append(digits, r)
+	}
+
+	var out []reading
+	addNumber := func(r reading, ds []rune) {
+		n, err := strconv.Atoi(string(ds))
+		if err != nil || n <= 0 || n > math.MaxInt32 {
+			return
+		}
+		r.treeNumber = int32(n)
+		out = append(out, r)
+	}
+
+	addNumber(base, digits)
+	// Allow a single misread digit; more would match almost anything
+	for i, d := range digits {
+		for _, alt := range digitMisreads[d] {
+			variant := append([]rune(nil), digits...)
+			variant[i] = alt
+			r := base
+			r.misreads++
+			addNumber(r, variant)
+		}
+	}
+	return out
+}
+
+// rankTreeMatches scores each existing tree against the readings that lead to
+// it and the donor name read from the sign
+func rankTreeMatches(readings []reading, trees []db.ListTreesByProjectCodesAndNumbersRow, donorName string) TreeResolution {
+	byKey := make(map[string]reading, len(readings))
+	for _, r := range readings {
+		byKey[r.key()] = r
+	}
+
+	var matches []TreeMatch
+	for _, t := range trees {
+		code := strings.TrimSpace(t.ProjectCode)
+		r, ok := byKey[fmt.Sprintf("%s%d", code, t.TreeNumber)]
+		if !ok {
+			continue
+		}
+
+		m := TreeMatch{
+			TreeID:      t.ID,
+			ProjectCode: code,
+			TreeNumber:  t.TreeNumber,
+			ReadAs:      r.readAs,
+			Edits:       r.lookalikes + r.misreads,
+			Score:       r.score(),
+		}
+		if strings.TrimSpace(donorName) != "" {
+			m.NameScore = math.Max(nameSimilarity(donorName, t.DonorName), nameSimilarity(donorName, t.CreditName))
+			// A matching name confirms the reading; a clashing one halves it
+			m.Score *= 0.5 + 0.5*m.NameScore
+		}
+		matches = append(matches, m)
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].Score > matches[j].Score
+	})
+
+	res := TreeResolution{Matches: matches}
+	if len(matches) == 0 || matches[0].Score < MinTreeMatchScore {
+		return res
+	}
+	if len(matches) > 1 && matches[0].Score-matches[1].Score < TreeMatchAmbiguityMargin {
+		res.Ambiguous = true
+		return res
+	}
+	res.Best = &matches[0]
+	return res
+}
+
+// nameSimilarity compares two names ignoring case, punctuation and word
+// order, returning 1 for identical and 0 for nothing in common
+func nameSimilarity(a, b string) float64 {
+	a, b = normaliseName(a), normaliseName(b)
+	if a == "" || b == "" {
+		return 0
+	}
+	longest := math.Max(float64(len([]rune(a))), float64(len([]rune(b))))
+	return 1 - float64(levenshtein(a, b))/longest
+}
+
+func normaliseName(s string) string {
+	fields := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	sort.Strings(fields)
+	return strings.Join(fields, " ")
+}
+
+// levenshtein returns the edit distance between a and b
+func levenshtein(a, b string) int {
+	ar, br := []rune(a), []rune(b)
+	prev := make([]int, len(br)+1)
+	curr := make([]int, len(br)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ar); i++ {
+		curr[0] = i
+		for j := 1; j <= len(br); j++ {
+			cost := 1
+			if ar[i-1] == br[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(br)]
+}
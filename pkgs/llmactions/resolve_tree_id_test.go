@@ -0,0 +1,143 @@
+package llmactions
+
+import (
+	"context"
+	"testing"
+
+	"sadbhavana/tree-project/pkgs/db"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeTreeStore struct {
+	trees []db.ListTreesByProjectCodesAndNumbersRow
+}
+
+func (f *fakeTreeStore) ListProjectTreeRanges(ctx context.Context) ([]db.ListProjectTreeRangesRow, error) {
+	var out []db.ListProjectTreeRangesRow
+	index := map[string]int{}
+	for _, t := range f.trees {
+		i, ok := index[t.ProjectCode]
+		if !ok {
+			index[t.ProjectCode] = len(out)
+			out = append(out, db.ListProjectTreeRangesRow{ProjectCode: t.ProjectCode, MinTreeNumber: t.TreeNumber, MaxTreeNumber: t.TreeNumber})
+			continue
+		}
+		out[i].MinTreeNumber = min(out[i].MinTreeNumber, t.TreeNumber)
+		out[i].MaxTreeNumber = max(out[i].MaxTreeNumber, t.TreeNumber)
+	}
+	return out, nil
+}
+
+func (f *fakeTreeStore) ListTreesByProjectCodesAndNumbers(ctx context.Context, arg db.ListTreesByProjectCodesAndNumbersParams) ([]db.ListTreesByProjectCodesAndNumbersRow, error) {
+	var out []db.ListTreesByProjectCodesAndNumbersRow
+	for _, t := range f.trees {
+		if contains(arg.ProjectCodes, t.ProjectCode) && containsNumber(arg.TreeNumbers, t.TreeNumber) {
+			out = append(out, t)
+		}
+	}
+	return out, nil
+}
+
+func contains(values []string, v string) bool {
+	for _, x := range values {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
+
+func containsNumber(values []int32, v int32) bool {
+	for _, x := range values {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
+
+var resolverTrees = &fakeTreeStore{trees: []db.ListTreesByProjectCodesAndNumbersRow{
+	{ID: "TRE-AB10", ProjectCode: "AB", TreeNumber: 10, DonorName: "Ravi Kumar"},
+	{ID: "TRE-AB11", ProjectCode: "AB", TreeNumber: 11, DonorName: "Ravi Kumar"},
+	{ID: "TRE-AB17", ProjectCode: "AB", TreeNumber: 17, DonorName: "Asha Mehta"},
+	{ID: "TRE-AB18", ProjectCode: "AB", TreeNumber: 18, DonorName: "Sunil Rao", CreditName: "In memory of Kamala Rao"},
+	{ID: "TRE-AB107", ProjectCode: "AB", TreeNumber: 107, DonorName: "Priya Shah"},
+}}
+
+func resolve(t *testing.T, out ExtractTreeIdOutput) TreeResolution {
+	t.Helper()
+	res, err := ResolveTreeID(context.Background(), resolverTrees, out)
+	if err != nil {
+		t.Fatalf("ResolveTreeID failed: %v", err)
+	}
+	return res
+}
+
+func TestResolveTreeID_ExactMatch(t *testing.T) {
+	res := resolve(t, ExtractTreeIdOutput{TreeID: "AB107", Confidence: 0.9})
+	if assert.NotNil(t, res.Best) {
+		assert.Equal(t, "TRE-AB107", res.Best.TreeID)
+		assert.Equal(t, 0, res.Best.Edits)
+	}
+}
+
+func TestResolveTreeID_LookalikeCharacters(t *testing.T) {
+	// Letter O read in place of zero, and lower case project code
+	res := resolve(t, ExtractTreeIdOutput{TreeID: "ab 1O7", Confidence: 0.9})
+	if assert.NotNil(t, res.Best) {
+		assert.Equal(t, "AB000107", res.Best.Label())
+		assert.Equal(t, 1, res.Best.Edits)
+	}
+}
+
+func TestResolveTreeID_DonorNameBreaksMisreadDigit(t *testing.T) {
+	// The model read 11, but the sign carries AB17's donor name
+	res := resolve(t, ExtractTreeIdOutput{TreeID: "AB11", Confidence: 0.9, DonorName: "ASHA MEHTA"})
+	if assert.NotNil(t, res.Best) {
+		assert.Equal(t, "TRE-AB17", res.Best.TreeID)
+		assert.Equal(t, 1.0, res.Best.NameScore)
+	}
+}
+
+func TestResolveTreeID_CreditName(t *testing.T) {
+	res := resolve(t, ExtractTreeIdOutput{
+		Candidates: []TreeIdCandidate{{TreeID: "AB10", Confidence: 0.7}, {TreeID: "AB18", Confidence: 0.7}},
+		DonorName:  "Kamala Rao in memory of",
+	})
+	if assert.NotNil(t, res.Best) {
+		assert.Equal(t, "TRE-AB18", res.Best.TreeID)
+	}
+}
+
+func TestResolveTreeID_Ambiguous(t *testing.T) {
+	res := resolve(t, ExtractTreeIdOutput{
+		Candidates: []TreeIdCandidate{{TreeID: "AB10", Confidence: 0.8}, {TreeID: "AB18", Confidence: 0.8}},
+	})
+	assert.Nil(t, res.Best)
+	assert.True(t, res.Ambiguous)
+	assert.Len(t, res.Matches, 2)
+}
+
+func TestResolveTreeID_NoMatch(t *testing.T) {
+	for _, id := range []string{"ZZ10", "AB999", "A", ""} {
+		res := resolve(t, ExtractTreeIdOutput{TreeID: id, Confidence: 0.95})
+		assert.Nil(t, res.Best, id)
+		assert.Empty(t, res.Matches, id)
+	}
+}
+
+func TestRankedCandidates(t *testing.T) {
+	out := ExtractTreeIdOutput{
+		TreeID:     "AB17",
+		Confidence: 0.9,
+		Candidates: []TreeIdCandidate{{TreeID: "AB11", Confidence: 0.4}},
+	}
+	assert.Equal(t, []TreeIdCandidate{{TreeID: "AB17", Confidence: 0.9}, {TreeID: "AB11", Confidence: 0.4}}, out.RankedCandidates())
+}
+
+func TestNameSimilarity(t *testing.T) {
+	assert.Equal(t, 1.0, nameSimilarity("Mehta, Asha", "asha mehta"))
+	assert.Less(t, nameSimilarity("Ravi Kumar", "Asha Mehta"), 0.5)
+	assert.Equal(t, 0.0, nameSimilarity("", "Asha Mehta"))
+}
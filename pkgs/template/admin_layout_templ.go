@@ -0,0 +1,76 @@
+// Code generated by templ - DO NOT EDIT.
+
+// templ: version: v0.3.960
+package template
+
+//lint:file-ignore SA4006 This context is only used if a nested component is present.
+
+import "github.com/a-h/templ"
+import templruntime "github.com/a-h/templ/runtime"
+
+// AdminLayout wraps secondary admin pages (reports, queues) in the same look
+// as the main admin page.
+func AdminLayout(title string) templ.Component {
+	return templruntime.GeneratedTemplate(func(templ_7745c5c3_Input templruntime.GeneratedComponentInput) (templ_7745c5c3_Err error) {
+		templ_7745c5c3_W, ctx := templ_7745c5c3_Input.Writer, templ_7745c5c3_Input.Context
+		if templ_7745c5c3_CtxErr := ctx.Err(); templ_7745c5c3_CtxErr != nil {
+			return templ_7745c5c3_CtxErr
+		}
+		templ_7745c5c3_Buffer, templ_7745c5c3_IsBuffer := templruntime.GetBuffer(templ_7745c5c3_W)
+		if !templ_7745c5c3_IsBuffer {
+			defer func() {
+				templ_7745c5c3_BufErr := templruntime.ReleaseBuffer(templ_7745c5c3_Buffer)
+				if templ_7745c5c3_Err == nil {
+					templ_7745c5c3_Err = templ_7745c5c3_BufErr
+				}
+			}()
+		}
+		ctx = templ.InitializeContext(ctx)
+		templ_7745c5c3_Var1 := templ.GetChildren(ctx)
+		if templ_7745c5c3_Var1 == nil {
+			templ_7745c5c3_Var1 = templ.NopComponent
+		}
+		ctx = templ.ClearChildren(ctx)
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 1, "<!doctype html><html lang=\"en\"><head><meta charset=\"UTF-8\"><meta name=\"viewport\" content=\"width=device-width, initial-scale=1.0\"><title>")
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		var templ_7745c5c3_Var2 string
+		templ_7745c5c3_Var2, templ_7745c5c3_Err = templ.JoinStringErrs(title)
+		if templ_7745c5c3_Err != nil {
+			return templ.Error{Err: templ_7745c5c3_Err, FileName: `pkgs/template/admin_layout.templ`, Line: 11, Col: 17}
+		}
+		_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString(templ.EscapeString(templ_7745c5c3_Var2))
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 2, " - Sadbhavana Admin</title><script src=\"https://unpkg.com/htmx.org@1.9.10\"></script><style>\n\t\t\t\t* {\n\t\t\t\t\tmargin: 0;\n\t\t\t\t\tpadding: 0;\n\t\t\t\t\tbox-sizing: border-box;\n\t\t\t\t}\n\n\t\t\t\tbody {\n\t\t\t\t\tfont-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, Oxygen, Ubuntu, Cantarell, sans-serif;\n\t\t\t\t\tbackground: linear-gradient(135deg, #667eea 0%, #764ba2 100%);\n\t\t\t\t\tmin-height: 100vh;\n\t\t\t\t\tpadding: 2rem;\n\t\t\t\t}\n\n\t\t\t\t.container {\n\t\t\t\t\tmax-width: 1200px;\n\t\t\t\t\tmargin: 0 auto;\n\t\t\t\t}\n\n\t\t\t\th1 {\n\t\t\t\t\ttext-align: center;\n\t\t\t\t\tcolor: white;\n\t\t\t\t\tfont-size: 2rem;\n\t\t\t\t\tmargin-bottom: 2rem;\n\t\t\t\t\ttext-shadow: 2px 2px 4px rgba(0,0,0,0.2);\n\t\t\t\t}\n\n\t\t\t\t.back-link {\n\t\t\t\t\tdisplay: inline-block;\n\t\t\t\t\tcolor: white;\n\t\t\t\t\tmargin-bottom: 1rem;\n\t\t\t\t\ttext-decoration: none;\n\t\t\t\t\tfont-weight: 600;\n\t\t\t\t}\n\n\t\t\t\t.card {\n\t\t\t\t\tbackground: white;\n\t\t\t\t\tborder-radius: 12px;\n\t\t\t\t\tbox-shadow: 0 10px 30px rgba(0,0,0,0.2);\n\t\t\t\t\tpadding: 1.5rem;\n\t\t\t\t\toverflow-x: auto;\n\t\t\t\t}\n\n\t\t\t\ttable {\n\t\t\t\t\twidth: 100%;\n\t\t\t\t\tborder-collapse: collapse;\n\t\t\t\t\tfont-size: 0.9rem;\n\t\t\t\t}\n\n\t\t\t\tth, td {\n\t\t\t\t\ttext-align: left;\n\t\t\t\t\tpadding: 0.6rem 0.75rem;\n\t\t\t\t\tborder-bottom: 1px solid #e0e0e0;\n\t\t\t\t\tvertical-align: top;\n\t\t\t\t}\n\n\t\t\t\tth {\n\t\t\t\t\tcolor: #667eea;\n\t\t\t\t\tfont-weight: 600;\n\t\t\t\t}\n\n\t\t\t\t.muted {\n\t\t\t\t\tcolor: #666;\n\t\t\t\t}\n\n\t\t\t\t.error-text {\n\t\t\t\t\tcolor: #991b1b;\n\t\t\t\t\tfont-family: monospace;\n\t\t\t\t\tfont-size: 0.8rem;\n\t\t\t\t}\n\n\t\t\t\t.btn {\n\t\t\t\t\tbackground: #667eea;\n\t\t\t\t\tcolor: white;\n\t\t\t\t\tborder: none;\n\t\t\t\t\tpadding: 0.4rem 0.8rem;\n\t\t\t\t\tborder-radius: 6px;\n\t\t\t\t\tcursor: pointer;\n\t\t\t\t\tfont-size: 0.85rem;\n\t\t\t\t}\n\n\t\t\t\t.btn:hover {\n\t\t\t\t\tbackground: #5568d3;\n\t\t\t\t}\n\n\t\t\t\t.btn-danger {\n\t\t\t\t\tbackground: #ef4444;\n\t\t\t\t}\n\n\t\t\t\t.btn-danger:hover {\n\t\t\t\t\tbackground: #dc2626;\n\t\t\t\t}\n\n\t\t\t\t.notice {\n\t\t\t\t\tbackground: #d1fae5;\n\t\t\t\t\tcolor: #065f46;\n\t\t\t\t\tborder: 1px solid #6ee7b7;\n\t\t\t\t\tborder-radius: 8px;\n\t\t\t\t\tpadding: 0.75rem 1rem;\n\t\t\t\t\tmargin-bottom: 1rem;\n\t\t\t\t}\n\n\t\t\t\t.review-nav {\n\t\t\t\t\tdisplay: flex;\n\t\t\t\t\tgap: 1rem;\n\t\t\t\t\talign-items: center;\n\t\t\t\t\tmargin-bottom: 1rem;\n\t\t\t\t}\n\n\t\t\t\t.review-photo {\n\t\t\t\t\tmax-width: 160px;\n\t\t\t\t\tmax-height: 160px;\n\t\t\t\t\tborder-radius: 6px;\n\t\t\t\t}\n\n\t\t\t\ttd form {\n\t\t\t\t\tmargin-bottom: 0.4rem;\n\t\t\t\t}\n\n\t\t\t\t.empty {\n\t\t\t\t\ttext-align: center;\n\t\t\t\t\tcolor: #666;\n\t\t\t\t\tpadding: 2rem;\n\t\t\t\t}\n\t\t\t</style></head><body><div class=\"container\"><a class=\"back-link\" href=\"/admin\">&larr; Admin</a><h1>")
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		var templ_7745c5c3_Var3 string
+		templ_7745c5c3_Var3, templ_7745c5c3_Err = templ.JoinStringErrs(title)
+		if templ_7745c5c3_Err != nil {
+			return templ.Error{Err: templ_7745c5c3_Err, FileName: `pkgs/template/admin_layout.templ`, Line: 142, Col: 15}
+		}
+		_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString(templ.EscapeString(templ_7745c5c3_Var3))
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 3, "</h1><div class=\"card\">")
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		templ_7745c5c3_Err = templ_7745c5c3_Var1.Render(ctx, templ_7745c5c3_Buffer)
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 4, "</div></div></body></html>")
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		return nil
+	})
+}
+
+var _ = templruntime.GeneratedTemplate
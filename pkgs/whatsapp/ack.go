@@ -0,0 +1,50 @@
+package whatsapp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"sadbhavana/tree-project/pkgs/conf"
+)
+
+// acknowledgeOutcome replies to the volunteer who sent a photo with the result
+// of the tree-ID extraction. Sending is best effort: a failed acknowledgement
+// must not cause the ingestion to be retried.
+func acknowledgeOutcome(ctx context.Context, msg ParsedMessage, treeID string, outcome error) {
+	text, ok := ackText(treeID, outcome)
+	if !ok {
+		return
+	}
+
+	var opts []SenderOption
+	if msg.PhoneNumberID != "" {
+		opts = append(opts, WithPhoneNumberID(msg.PhoneNumberID))
+	}
+	sender, err := NewSender(conf.GetConfig().WhatsappConfig, opts...)
+	if err != nil {
+		log.Printf("Failed to create WhatsApp sender for acknowledgement: %v", err)
+		return
+	}
+
+	if _, err := sender.SendText(ctx, msg.From, text, WithReplyTo(msg.ID)); err != nil {
+		log.Printf("Failed to acknowledge message %s to %s: %v", msg.ID, msg.From, err)
+	}
+}
+
+// ackText picks the reply for an extraction outcome. It returns false for
+// outcomes that should not be acknowledged, such as transient failures that
+// will be retried.
+func ackText(treeID string, outcome error) (string, bool) {
+	switch {
+	case outcome == nil && treeID != "":
+		return fmt.Sprintf("Thank you! Your photo has been added to tree %s.", treeID), true
+	case errors.Is(outcome, ErrUnknownTree):
+		return fmt.Sprintf("We read the tree ID %s from your photo but could not find that tree. Please check the tag and send the photo again.", treeID), true
+	case errors.Is(outcome, ErrUnreadableTreeID):
+		return "We could not read the tree ID in your photo. Please retake it with the tag clearly visible and in focus.", true
+	default:
+		return "", false
+	}
+}
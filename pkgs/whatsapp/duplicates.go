@@ -0,0 +1,58 @@
+package whatsapp
+
+import (
+	"context"
+	"log"
+
+	"sadbhavana/tree-project/pkgs/conf"
+	"sadbhavana/tree-project/pkgs/db"
+	"sadbhavana/tree-project/pkgs/file"
+
+	"github.com/juju/errors"
+)
+
+// checkDuplicates flags a newly linked photo that looks like a photo already
+// linked to the same tree (a resend) or to another tree (a photo reused, or
+// photographed off a screen). Flagging does not undo the link: the pair is
+// recorded for the duplicates report and left to a person to judge.
+func checkDuplicates(ctx context.Context, q *db.Queries, treeID, fileID string, fileInfo file.FileInfo, data []byte) error {
+	if !fileInfo.MimeType.IsImage() {
+		return nil
+	}
+	cfg := conf.GetConfig().Image
+	hashes, err := file.HashImage(ctx, data, fileInfo.MimeType, file.ImageOptionsFromConfig(cfg))
+	if err != nil {
+		// Without a hash there is nothing to compare; the link itself is fine
+		log.Printf("Failed to hash file %s: %v", fileID, err)
+		return nil
+	}
+	if err := file.SaveImageHash(ctx, q, fileID, hashes); err != nil {
+		return err
+	}
+
+	similar, err := q.FindSimilarTreePhotos(ctx, db.FindSimilarTreePhotosParams{
+		Phash:       int64(hashes.PHash),
+		Dhash:       int64(hashes.DHash),
+		FileID:      fileID,
+		MaxDistance: int32(cfg.DuplicateMaxDistance),
+	})
+	if err != nil {
+		return errors.Annotatef(err, "failed to find photos similar to file %s", fileID)
+	}
+
+	for _, s := range similar {
+		err := q.RecordPhotoDuplicate(ctx, db.RecordPhotoDuplicateParams{
+			FileID:          fileID,
+			TreeID:          treeID,
+			DuplicateFileID: s.FileID,
+			DuplicateTreeID: s.TreeID,
+			PhashDistance:   s.PhashDistance,
+			DhashDistance:   s.DhashDistance,
+		})
+		if err != nil {
+			return errors.Annotatef(err, "failed to flag file %s as a duplicate of %s", fileID, s.FileID)
+		}
+		log.Printf("Photo %s of tree %s looks like photo %s of tree %s (pHash distance %d)", fileID, treeID, s.FileID, s.TreeID, s.PhashDistance)
+	}
+	return nil
+}
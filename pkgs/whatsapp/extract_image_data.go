@@ -1,69 +1,208 @@
 package whatsapp
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
+	"log"
+	"path"
+
+	"sadbhavana/tree-project/pkgs/conf"
 	"sadbhavana/tree-project/pkgs/db"
+	"sadbhavana/tree-project/pkgs/file"
 	"sadbhavana/tree-project/pkgs/llm"
 	"sadbhavana/tree-project/pkgs/llmactions"
-	"strconv"
 
+	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/juju/errors"
 )
 
-func extractImageData(ctx context.Context, q *db.Queries, msg ParsedMessage) error {
+// ErrImageRejected marks images that can never be linked to a tree (unreadable
+// or unknown tree ID). Retrying them would produce the same result.
+var ErrImageRejected = errors.New("image rejected")
+
+var (
+	ErrUnreadableTreeID = fmt.Errorf("%w: tree ID could not be read", ErrImageRejected)
+	ErrUnknownTree      = fmt.Errorf("%w: tree not found", ErrImageRejected)
+)
+
+// receivedImage is a photo saved while processing a message, with its
+// contents, for the work done once the message's transaction commits
+type receivedImage struct {
+	FileID string
+	Info   file.FileInfo
+	Data   []byte
+}
+
+// extractImageData links a received photo to its tree. It returns the saved
+// photo, nil if it had already been processed, and the tree ID the photo was
+// linked to, or was read as when it was rejected, for the work done once the
+// transaction commits.
+func extractImageData(ctx context.Context, q *db.Queries, msg ParsedMessage) (*receivedImage, string, error) {
 	if msg.Type != ParsedMessageTypeImage || msg.File == nil {
-		return nil
+		return nil, "", nil
 	}
+	return linkImageToTree(ctx, q, msg)
+}
+
+// newLLMClient creates the client used for tree-ID extraction. Tests replace
+// it with a replay client (see llm.NewFixtureClient) to run offline.
+var newLLMClient = func(ctx context.Context) (llm.Client, error) {
+	return llm.NewClientFromConfig(ctx)
+}
 
+// linkImageToTree extracts the tree ID from the image and records a tree
+// update for it. It returns the saved image and the tree ID it was linked to,
+// or nil and an empty string if the image had already been processed. The
+// image is downloaded once and its contents reused for every step. Rejected
+// images are queued for manual review before the rejection is returned.
+func linkImageToTree(ctx context.Context, q *db.Queries, msg ParsedMessage) (*receivedImage, string, error) {
 	fileID, wasUpdated, err := msg.File.SaveToDB(ctx, q)
 	if err != nil {
-		return errors.Annotatef(err, "failed to save image file to database")
+		return nil, "", errors.Annotatef(err, "failed to save image file to database")
 	}
 	if wasUpdated {
 		// Already processed
-		return nil
+		return nil, "", nil
+	}
+
+	data, err := file.ReadFile(ctx, q, *msg.File)
+	if err != nil {
+		return nil, "", errors.Annotatef(err, "failed to read image file")
 	}
+	img := &receivedImage{FileID: fileID, Info: *msg.File, Data: data}
 
-	client, err := llm.NewGeminiClient(ctx, llm.Gemini25Pro)
+	imageData, resolution, err := extractAndResolve(ctx, q, *msg.File, bytes.NewReader(data))
 	if err != nil {
-		return errors.Annotatef(err, "failed to create Gemini client")
+		return nil, "", err
+	}
+
+	tree, label, err := chooseTree(imageData, resolution)
+	if errors.Is(err, ErrImageRejected) {
+		if qerr := queueForReview(ctx, q, fileID, msg, imageData, resolution, err); qerr != nil {
+			return nil, "", qerr
+		}
+		return img, label, err
+	}
+
+	if err := createTreeUpdate(ctx, q, tree.TreeID, fileID, *msg.File, data); err != nil {
+		return nil, "", errors.Annotatef(err, "failed to create tree update for tree ID %s", label)
 	}
 
-	imageData, err := llmactions.ExtractTreeId(ctx, q, client, *msg.File)
+	return img, label, nil
+}
+
+// createTreeUpdate links a photo to a tree, recording the capture time,
+// location and tags from the photo's EXIF/XMP metadata when it has any
+func createTreeUpdate(ctx context.Context, q *db.Queries, treeID, fileID string, fileInfo file.FileInfo, data []byte) error {
+	params := db.CreateTreeUpdateParams{
+		TreeID:       treeID,
+		FileID:       fileID,
+		PropertyList: []byte("{}"),
+	}
+
+	meta, err := file.ReadImageMetadata(bytes.NewReader(data))
+	switch {
+	case err == nil:
+		if meta.CapturedAt != nil {
+			params.PhotoTs = pgtype.Timestamptz{Time: *meta.CapturedAt, Valid: true}
+		}
+		if meta.HasLocation() {
+			params.PhotoLatitude = pgtype.Float8{Float64: *meta.Latitude, Valid: true}
+			params.PhotoLongitude = pgtype.Float8{Float64: *meta.Longitude, Valid: true}
+		}
+		props, err := json.Marshal(meta.PropertyList())
+		if err != nil {
+			return errors.Annotatef(err, "failed to encode photo metadata")
+		}
+		params.PropertyList = props
+	case errors.Is(err, file.ErrNoImageMetadata):
+		// WhatsApp strips metadata from photos sent as images
+	default:
+		// Metadata is informational; never hold up the link for it
+		log.Printf("Failed to read metadata of file %s: %v", fileID, err)
+	}
+
+	if _, err := q.CreateTreeUpdate(ctx, params); err != nil {
+		return err
+	}
+	if err := checkGeofence(ctx, q, treeID, fileID); err != nil {
+		return err
+	}
+	return checkDuplicates(ctx, q, treeID, fileID, fileInfo, data)
+}
+
+// storeImageCopies makes the thumbnail and web-size copies that pages show
+// in place of a newly saved photo, and records its hashes for later duplicate
+// checks. It runs once the photo's transaction has committed, outside any
+// transaction, so a failure cannot undo the link and a rollback cannot leave
+// copies of a file that was never saved. "files derivatives" makes copies that
+// are missing and linking a photo hashes it again, so failures are only logged.
+func storeImageCopies(ctx context.Context, img *receivedImage) {
+	if !img.Info.MimeType.IsImage() {
+		return
+	}
+	q, err := db.NewQueries(ctx)
 	if err != nil {
-		return errors.Annotatef(err, "failed to extract tree ID from image")
+		log.Printf("Failed to get database queries for file %s: %v", img.FileID, err)
+		return
 	}
+	cfg := conf.GetConfig()
+	opts := file.ImageOptionsFromConfig(cfg.Image)
 
-	if imageData.Confidence < 0.7 {
-		return fmt.Errorf("low confidence (%f) in extracted tree ID %s", imageData.Confidence, imageData.TreeID)
+	if _, err := file.StoreImageHash(ctx, q, img.FileID, img.Info, img.Data, opts); err != nil {
+		log.Printf("Failed to hash file %s: %v", img.FileID, err)
 	}
 
-	if len(imageData.TreeID) < 3 {
-		return fmt.Errorf("extracted tree ID %s is too short", imageData.TreeID)
+	store, err := file.OpenFileStore(ctx, q, cfg.WhatsappConfig.MediaStore)
+	if err != nil {
+		log.Printf("Failed to initialize file store for derivatives of file %s: %v", img.FileID, err)
+		return
 	}
+	folder := file.FolderInfo{FolderPath: path.Join(cfg.WhatsappConfig.MediaFolder, "derived")}
+	if _, err := file.StoreDerivatives(ctx, q, store, folder, img.FileID, img.Info, img.Data, opts); err != nil {
+		log.Printf("Failed to store derivatives of file %s: %v", img.FileID, err)
+	}
+}
 
-	projectCode := imageData.TreeID[:2]
-	treeNumber, err := strconv.Atoi(imageData.TreeID[2:])
+// extractAndResolve reads the tree ID from the image data and matches it
+// against existing trees
+func extractAndResolve(ctx context.Context, trees llmactions.TreeResolverStore, fileInfo file.FileInfo, data io.Reader) (llmactions.ExtractTreeIdOutput, llmactions.TreeResolution, error) {
+	client, err := newLLMClient(ctx)
 	if err != nil {
-		return errors.Annotatef(err, "failed to parse tree number from extracted tree ID %s", imageData.TreeID)
+		return llmactions.ExtractTreeIdOutput{}, llmactions.TreeResolution{}, errors.Annotatef(err, "failed to create LLM client")
 	}
 
-	tree, err := q.GetTreeByProjectCodeAndNumber(ctx, db.GetTreeByProjectCodeAndNumberParams{
-		ProjectCode: projectCode,
-		TreeNumber:  int32(treeNumber),
-	})
+	imageData, err := llmactions.ExtractTreeIdFromImage(ctx, client, fileInfo, data)
 	if err != nil {
-		return errors.Annotatef(err, "failed to get tree by extracted tree ID %s", imageData.TreeID)
+		return llmactions.ExtractTreeIdOutput{}, llmactions.TreeResolution{}, errors.Annotatef(err, "failed to extract tree ID from image")
 	}
+	log.Printf("Extracted tree ID %q from file %s (%d tokens)", imageData.TreeID, fileInfo.FileName, imageData.Usage.TotalTokens)
 
-	_, err = q.CreateTreeUpdate(ctx, db.CreateTreeUpdateParams{
-		TreeID: tree.ID,
-		FileID: fileID,
-	})
+	resolution, err := llmactions.ResolveTreeID(ctx, trees, imageData)
 	if err != nil {
-		return errors.Annotatef(err, "failed to create tree update for tree ID %s", imageData.TreeID)
+		return imageData, llmactions.TreeResolution{}, errors.Annotatef(err, "failed to resolve extracted tree ID %s", imageData.TreeID)
 	}
+	return imageData, resolution, nil
+}
 
-	return nil
+// chooseTree picks the tree to link, or explains with an ErrImageRejected
+// error why none can be. The returned label is the tree ID to report back.
+func chooseTree(imageData llmactions.ExtractTreeIdOutput, resolution llmactions.TreeResolution) (*llmactions.TreeMatch, string, error) {
+	tree := resolution.Best
+	switch {
+	case tree != nil:
+		log.Printf("Resolved tree %s (read as %q, score %.2f, %d edits)", tree.Label(), tree.ReadAs, tree.Score, tree.Edits)
+		return tree, tree.Label(), nil
+	case resolution.Ambiguous:
+		return nil, "", fmt.Errorf("%w: extracted tree ID %s matches several trees (%s, %s)", ErrUnreadableTreeID, imageData.TreeID, resolution.Matches[0].Label(), resolution.Matches[1].Label())
+	case len(resolution.Matches) > 0:
+		return nil, "", fmt.Errorf("%w: low confidence (%f) in best match %s for extracted tree ID %s", ErrUnreadableTreeID, resolution.Matches[0].Score, resolution.Matches[0].Label(), imageData.TreeID)
+	case imageData.TreeID == "":
+		return nil, "", fmt.Errorf("%w: no tree ID found in image", ErrUnreadableTreeID)
+	default:
+		return nil, imageData.TreeID, fmt.Errorf("%w: no tree found for extracted tree ID %s", ErrUnknownTree, imageData.TreeID)
+	}
 }
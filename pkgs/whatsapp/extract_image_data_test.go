@@ -0,0 +1,80 @@
+package whatsapp
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"testing"
+
+	"sadbhavana/tree-project/pkgs/db"
+	"sadbhavana/tree-project/pkgs/file"
+	"sadbhavana/tree-project/pkgs/llm"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// The synthetic sign image and hand-written model answer are shared with the
+// llmactions tests
+const (
+	sampleSignImage   = "../llmactions/testdata/synthetic_sign.jpg"
+	extractTreeIdData = "../llmactions/testdata/extract_tree_id_stub.json"
+)
+
+// fakeTrees holds a single project with trees AB100 to AB110
+type fakeTrees struct{}
+
+func (fakeTrees) ListProjectTreeRanges(ctx context.Context) ([]db.ListProjectTreeRangesRow, error) {
+	return []db.ListProjectTreeRangesRow{{ProjectCode: "AB", MinTreeNumber: 100, MaxTreeNumber: 110}}, nil
+}
+
+func (fakeTrees) ListTreesByProjectCodesAndNumbers(ctx context.Context, arg db.ListTreesByProjectCodesAndNumbersParams) ([]db.ListTreesByProjectCodesAndNumbersRow, error) {
+	var out []db.ListTreesByProjectCodesAndNumbersRow
+	for _, n := range arg.TreeNumbers {
+		if n < 100 || n > 110 {
+			continue
+		}
+		row := db.ListTreesByProjectCodesAndNumbersRow{ID: fmt.Sprintf("TRE-AB%d", n), ProjectCode: "AB", TreeNumber: n, DonorName: "Someone Else"}
+		if n == 107 {
+			row.DonorName = "Priya Shah"
+		}
+		out = append(out, row)
+	}
+	return out, nil
+}
+
+// stubLLMClient answers from the hand-written fixture instead of a model
+func stubLLMClient(t *testing.T) {
+	t.Helper()
+	orig := newLLMClient
+	newLLMClient = func(ctx context.Context) (llm.Client, error) {
+		return llm.NewReplayClient(extractTreeIdData)
+	}
+	t.Cleanup(func() { newLLMClient = orig })
+}
+
+func TestExtractAndResolve(t *testing.T) {
+	stubLLMClient(t)
+	image, err := os.ReadFile(sampleSignImage)
+	require.NoError(t, err)
+
+	fileInfo := file.FileInfo{FileName: "tree_sign.jpg", MimeType: file.MimeTypeJPEG}
+	imageData, resolution, err := extractAndResolve(context.Background(), fakeTrees{}, fileInfo, bytes.NewReader(image))
+	require.NoError(t, err)
+	assert.Equal(t, "AB107", imageData.TreeID)
+
+	tree, label, err := chooseTree(imageData, resolution)
+	require.NoError(t, err)
+	assert.Equal(t, "TRE-AB107", tree.TreeID)
+	assert.Equal(t, "AB000107", label)
+}
+
+func TestExtractAndResolve_UnknownImage(t *testing.T) {
+	stubLLMClient(t)
+
+	// Only the synthetic sign is in the fixture
+	fileInfo := file.FileInfo{FileName: "other.jpg", MimeType: file.MimeTypeJPEG}
+	_, _, err := extractAndResolve(context.Background(), fakeTrees{}, fileInfo, bytes.NewReader([]byte("other")))
+	assert.ErrorIs(t, err, llm.ErrNoRecording)
+}
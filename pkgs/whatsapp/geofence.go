@@ -0,0 +1,42 @@
+package whatsapp
+
+import (
+	"context"
+	"log"
+
+	"sadbhavana/tree-project/pkgs/db"
+
+	"github.com/juju/errors"
+)
+
+// Geofence statuses recorded on a tree update
+const (
+	GeofenceStatusOK    = "ok"
+	GeofenceStatusFar   = "far"
+	GeofenceStatusNoGPS = "no_gps"
+)
+
+// defaultGeofenceRadiusM applies when the PhotoGeofence config has no radius
+// for the tree's project and no default of its own
+const defaultGeofenceRadiusM = 100
+
+// checkGeofence compares where a linked photo was taken with where its tree
+// is, and records the outcome on the tree update. Flagged photos stay linked;
+// they are listed on the photo QA report for someone to look at.
+func checkGeofence(ctx context.Context, q *db.Queries, treeID, fileID string) error {
+	res, err := q.CheckTreeUpdateGeofence(ctx, db.CheckTreeUpdateGeofenceParams{
+		DefaultRadiusM: defaultGeofenceRadiusM,
+		FileID:         fileID,
+	})
+	if err != nil {
+		return errors.Annotatef(err, "failed to check geofence of file %s", fileID)
+	}
+
+	switch res.TuGeofenceStatus {
+	case GeofenceStatusFar:
+		log.Printf("Photo %s of tree %s was taken %.0fm from the tree (allowed %.0fm)", fileID, treeID, res.DistanceM.Float64, res.TuGeofenceRadiusM)
+	case GeofenceStatusNoGPS:
+		log.Printf("Photo %s of tree %s has no location to check against the tree", fileID, treeID)
+	}
+	return nil
+}
@@ -15,7 +15,8 @@ type WebhookVerifyOutput struct {
 
 // Webhook event structures
 type WebhookInput struct {
-	Body WebhookPayload
+	Body    WebhookPayload
+	RawBody []byte
 }
 
 type WebhookPayload struct {
@@ -66,6 +67,16 @@ type Message struct {
 	Document  *MediaMsg `json:"document,omitempty"`
 }
 
+// mediaSHA256 returns the hash Meta reports for the attached media, if any
+func (m Message) mediaSHA256() string {
+	for _, media := range []*MediaMsg{m.Image, m.Video, m.Audio, m.Document} {
+		if media != nil {
+			return media.SHA256
+		}
+	}
+	return ""
+}
+
 type TextMsg struct {
 	Body string `json:"body"`
 }
@@ -102,8 +113,81 @@ const (
 )
 
 type ParsedMessage struct {
-	From string            `json:"from"`
-	Type ParsedMessageType `json:"type"`
-	Text *string           `json:"content,omitempty"` // Text body or local file path
-	File *file.FileInfo    `json:"file,omitempty"`    // For media messages
+	ID            string            `json:"id"`
+	MediaSHA256   string            `json:"media_sha256,omitempty"`
+	From          string            `json:"from"`
+	PhoneNumberID string            `json:"phone_number_id"` // Business number the message was sent to
+	Type          ParsedMessageType `json:"type"`
+	Text          *string           `json:"content,omitempty"` // Text body or local file path
+	File          *file.FileInfo    `json:"file,omitempty"`    // For media messages
+}
+
+// Outbound message structures for the Graph API messages endpoint
+type OutboundMessage struct {
+	MessagingProduct string            `json:"messaging_product"`
+	RecipientType    string            `json:"recipient_type"`
+	To               string            `json:"to"`
+	Type             string            `json:"type"`
+	Context          *MessageContext   `json:"context,omitempty"`
+	Text             *OutboundText     `json:"text,omitempty"`
+	Template         *OutboundTemplate `json:"template,omitempty"`
+	Image            *OutboundMedia    `json:"image,omitempty"`
+}
+
+type MessageContext struct {
+	MessageID string `json:"message_id"`
+}
+
+type OutboundText struct {
+	Body       string `json:"body"`
+	PreviewURL bool   `json:"preview_url"`
+}
+
+type OutboundMedia struct {
+	ID      string `json:"id,omitempty"`   // Uploaded media ID
+	Link    string `json:"link,omitempty"` // Public URL
+	Caption string `json:"caption,omitempty"`
+}
+
+type OutboundTemplate struct {
+	Name       string              `json:"name"`
+	Language   TemplateLanguage    `json:"language"`
+	Components []TemplateComponent `json:"components,omitempty"`
+}
+
+type TemplateLanguage struct {
+	Code string `json:"code"`
+}
+
+type TemplateComponent struct {
+	Type       string              `json:"type"` // "header", "body" or "button"
+	Parameters []TemplateParameter `json:"parameters"`
+}
+
+type TemplateParameter struct {
+	Type  string         `json:"type"` // "text" or "image"
+	Text  string         `json:"text,omitempty"`
+	Image *OutboundMedia `json:"image,omitempty"`
+}
+
+// SendMessageResponse is returned by the messages endpoint on success
+type SendMessageResponse struct {
+	MessagingProduct string `json:"messaging_product"`
+	Contacts         []struct {
+		Input string `json:"input"`
+		WaID  string `json:"wa_id"`
+	} `json:"contacts"`
+	Messages []struct {
+		ID string `json:"id"`
+	} `json:"messages"`
+}
+
+// GraphErrorResponse is the error envelope returned by the Graph API
+type GraphErrorResponse struct {
+	Error struct {
+		Message   string `json:"message"`
+		Type      string `json:"type"`
+		Code      int    `json:"code"`
+		FbtraceID string `json:"fbtrace_id"`
+	} `json:"error"`
 }
@@ -0,0 +1,285 @@
+package whatsapp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"sadbhavana/tree-project/pkgs/db"
+	"sadbhavana/tree-project/pkgs/file"
+	"sadbhavana/tree-project/pkgs/llmactions"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/juju/errors"
+)
+
+// Photo review statuses
+const (
+	ReviewStatusPending  = "pending"
+	ReviewStatusAssigned = "assigned"
+	ReviewStatusRejected = "rejected"
+)
+
+var (
+	// ErrReviewNotPending is returned when acting on a review that has
+	// already been decided, or does not exist
+	ErrReviewNotPending = errors.New("photo review is not pending")
+	// ErrInvalidTreeLabel is returned for a tree ID that is not a project
+	// code followed by a tree number, e.g. AB17
+	ErrInvalidTreeLabel = errors.New("invalid tree ID")
+)
+
+// queueForReview records a rejected photo, with the model's readings and the
+// resolver's matches, so that a reviewer can decide what to do with it
+func queueForReview(ctx context.Context, q *db.Queries, fileID string, msg ParsedMessage, imageData llmactions.ExtractTreeIdOutput, resolution llmactions.TreeResolution, reason error) error {
+	extracted, matches, err := encodeGuesses(imageData, resolution)
+	if err != nil {
+		return err
+	}
+
+	err = q.CreatePhotoReview(ctx, db.CreatePhotoReviewParams{
+		FileID:    fileID,
+		MessageID: pgtype.Text{String: msg.ID, Valid: msg.ID != ""},
+		Sender:    pgtype.Text{String: msg.From, Valid: msg.From != ""},
+		Reason:    reason.Error(),
+		Extracted: extracted,
+		Matches:   matches,
+	})
+	if err != nil {
+		return errors.Annotatef(err, "failed to queue file %s for review", fileID)
+	}
+	log.Printf("Queued file %s from message %s for review: %v", fileID, msg.ID, reason)
+	return nil
+}
+
+func encodeGuesses(imageData llmactions.ExtractTreeIdOutput, resolution llmactions.TreeResolution) ([]byte, []byte, error) {
+	extracted, err := json.Marshal(imageData)
+	if err != nil {
+		return nil, nil, errors.Annotatef(err, "failed to encode extracted tree ID")
+	}
+	treeMatches := resolution.Matches
+	if treeMatches == nil {
+		treeMatches = []llmactions.TreeMatch{}
+	}
+	matches, err := json.Marshal(treeMatches)
+	if err != nil {
+		return nil, nil, errors.Annotatef(err, "failed to encode tree matches")
+	}
+	return extracted, matches, nil
+}
+
+// ParseTreeLabel splits a tree ID as written on signs, e.g. "ab 17", into its
+// project code and tree number
+func ParseTreeLabel(label string) (string, int32, error) {
+	raw := strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) || r == '-' {
+			return -1
+		}
+		return unicode.ToUpper(r)
+	}, label)
+	if len(raw) < 3 {
+		return "", 0, fmt.Errorf("%w: %q", ErrInvalidTreeLabel, label)
+	}
+
+	code := raw[:2]
+	for _, r := range code {
+		if r < 'A' || r > 'Z' {
+			return "", 0, fmt.Errorf("%w: %q", ErrInvalidTreeLabel, label)
+		}
+	}
+	n, err := strconv.ParseInt(raw[2:], 10, 32)
+	if err != nil || n <= 0 {
+		return "", 0, fmt.Errorf("%w: %q", ErrInvalidTreeLabel, label)
+	}
+	return code, int32(n), nil
+}
+
+// AssignReview links a pending photo to the tree with the given label and
+// records the reviewer's decision. It returns the normalised tree label.
+func AssignReview(ctx context.Context, q *db.Queries, reviewID, treeLabel, reviewer string) (string, error) {
+	review, err := q.GetPhotoReview(ctx, reviewID)
+	if err != nil {
+		return "", errors.Annotatef(err, "failed to get photo review %s", reviewID)
+	}
+	if review.CorePhotoReview.Status != ReviewStatusPending {
+		return "", fmt.Errorf("%w: %s is %s", ErrReviewNotPending, reviewID, review.CorePhotoReview.Status)
+	}
+
+	code, number, err := ParseTreeLabel(treeLabel)
+	if err != nil {
+		return "", err
+	}
+	label := llmactions.FormatTreeLabel(code, number)
+	tree, err := q.GetTreeByProjectCodeAndNumber(ctx, db.GetTreeByProjectCodeAndNumberParams{
+		ProjectCode: code,
+		TreeNumber:  number,
+	})
+	if err != nil {
+		return "", errors.Annotatef(err, "failed to find tree %s", label)
+	}
+
+	if err := linkReviewedPhoto(ctx, q, review, tree.ID, reviewer, nil); err != nil {
+		return "", err
+	}
+	return label, nil
+}
+
+// RejectReview marks a pending photo as not belonging to any tree
+func RejectReview(ctx context.Context, q *db.Queries, reviewID, reviewer string) error {
+	n, err := q.DecidePhotoReview(ctx, db.DecidePhotoReviewParams{
+		Status:    ReviewStatusRejected,
+		DecidedBy: pgtype.Text{String: reviewer, Valid: true},
+		ID:        reviewID,
+	})
+	if err != nil {
+		return errors.Annotatef(err, "failed to reject photo review %s", reviewID)
+	}
+	if n == 0 {
+		return fmt.Errorf("%w: %s", ErrReviewNotPending, reviewID)
+	}
+	return nil
+}
+
+// RequestRerun queues a pending photo to have tree-ID extraction run again.
+// The model call is too slow for a page request, so the WhatsApp workers
+// pick the request up (see RerunNextReview).
+func RequestRerun(ctx context.Context, q *db.Queries, reviewID, reviewer string) error {
+	n, err := q.RequestPhotoReviewRerun(ctx, db.RequestPhotoReviewRerunParams{
+		RequestedBy: pgtype.Text{String: reviewer, Valid: true},
+		ID:          reviewID,
+	})
+	if err != nil {
+		return errors.Annotatef(err, "failed to queue re-run of photo review %s", reviewID)
+	}
+	if n == 0 {
+		return fmt.Errorf("%w: %s", ErrReviewNotPending, reviewID)
+	}
+	return nil
+}
+
+// RerunNextReview runs extraction again on the photo of the oldest queued
+// re-run. It reports whether a re-run was claimed so the caller can skip the
+// poll delay while busy.
+func RerunNextReview(ctx context.Context) (bool, error) {
+	if ctx.Err() != nil {
+		return false, nil
+	}
+
+	q, err := db.NewQueries(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to get database queries: %w", err)
+	}
+	claim, err := q.ClaimPhotoReviewRerun(ctx)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, errors.Annotatef(err, "failed to claim photo review re-run")
+	}
+
+	// The request is used up either way; the reviewer can queue it again
+	if err := rerunReview(ctx, q, claim.ID, claim.RerunRequestedBy.String); err != nil {
+		return true, errors.Annotatef(err, "re-run of photo review %s for %s failed", claim.ID, claim.RerunRequestedBy.String)
+	}
+	return true, nil
+}
+
+// rerunReview reads the tree ID from a pending photo again. If it now
+// resolves to a tree the photo is linked and the review is assigned on behalf
+// of the reviewer who asked; otherwise the review keeps its place in the
+// queue with refreshed guesses. Only the outcome is written in a transaction,
+// not the model call.
+func rerunReview(ctx context.Context, q *db.Queries, reviewID, reviewer string) error {
+	review, err := q.GetPhotoReview(ctx, reviewID)
+	if err != nil {
+		return errors.Annotatef(err, "failed to get photo review %s", reviewID)
+	}
+	if review.CorePhotoReview.Status != ReviewStatusPending {
+		return fmt.Errorf("%w: %s is %s", ErrReviewNotPending, reviewID, review.CorePhotoReview.Status)
+	}
+
+	fileInfo, err := file.ExtractFileInfoFromDB(review.CoreFile)
+	if err != nil {
+		return err
+	}
+	data, err := file.ReadFile(ctx, q, fileInfo)
+	if err != nil {
+		return errors.Annotatef(err, "failed to read file of photo review %s", reviewID)
+	}
+
+	imageData, resolution, err := extractAndResolve(ctx, q, fileInfo, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	tree, label, chooseErr := chooseTree(imageData, resolution)
+
+	tq, tx, err := db.NewQueriesWithTx(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if errors.Is(chooseErr, ErrImageRejected) {
+		extracted, matches, err := encodeGuesses(imageData, resolution)
+		if err != nil {
+			return err
+		}
+		_, err = tq.UpdatePhotoReviewExtraction(ctx, db.UpdatePhotoReviewExtractionParams{
+			Reason:    chooseErr.Error(),
+			Extracted: extracted,
+			Matches:   matches,
+			ID:        reviewID,
+		})
+		if err != nil {
+			return errors.Annotatef(err, "failed to update photo review %s", reviewID)
+		}
+		log.Printf("Re-ran extraction for photo review %s; it still needs review", reviewID)
+	} else {
+		if err := linkReviewedPhoto(ctx, tq, review, tree.TreeID, reviewer, data); err != nil {
+			return err
+		}
+		log.Printf("Re-ran extraction for photo review %s; linked to tree %s", reviewID, label)
+	}
+
+	return tx.Commit(ctx)
+}
+
+// linkReviewedPhoto records the tree update for a reviewed photo and marks
+// the review as assigned. The photo is downloaded unless its contents are
+// given.
+func linkReviewedPhoto(ctx context.Context, q *db.Queries, review db.GetPhotoReviewRow, treeID, reviewer string, data []byte) error {
+	fileInfo, err := file.ExtractFileInfoFromDB(review.CoreFile)
+	if err != nil {
+		return err
+	}
+	if data == nil {
+		data, err = file.ReadFile(ctx, q, fileInfo)
+		if err != nil {
+			return errors.Annotatef(err, "failed to read file of photo review %s", review.CorePhotoReview.ID)
+		}
+	}
+	if err := createTreeUpdate(ctx, q, treeID, review.CoreFile.ID, fileInfo, data); err != nil {
+		return errors.Annotatef(err, "failed to create tree update for tree %s", treeID)
+	}
+
+	id := review.CorePhotoReview.ID
+	n, err := q.DecidePhotoReview(ctx, db.DecidePhotoReviewParams{
+		Status:    ReviewStatusAssigned,
+		TreeID:    pgtype.Text{String: treeID, Valid: true},
+		DecidedBy: pgtype.Text{String: reviewer, Valid: true},
+		ID:        id,
+	})
+	if err != nil {
+		return errors.Annotatef(err, "failed to assign photo review %s", id)
+	}
+	if n == 0 {
+		return fmt.Errorf("%w: %s", ErrReviewNotPending, id)
+	}
+	return nil
+}
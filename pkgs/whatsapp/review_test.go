@@ -0,0 +1,27 @@
+package whatsapp
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTreeLabel(t *testing.T) {
+	code, number, err := ParseTreeLabel(" ab 17")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "AB", code)
+		assert.Equal(t, int32(17), number)
+	}
+
+	code, number, err = ParseTreeLabel("CD-1204")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "CD", code)
+		assert.Equal(t, int32(1204), number)
+	}
+
+	for _, label := range []string{"", "AB", "A17", "AB0", "ABx7", "1B17"} {
+		_, _, err := ParseTreeLabel(label)
+		assert.True(t, errors.Is(err, ErrInvalidTreeLabel), label)
+	}
+}
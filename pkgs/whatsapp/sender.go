@@ -0,0 +1,176 @@
+package whatsapp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"sadbhavana/tree-project/pkgs/conf"
+)
+
+// Options for sender configuration
+type SenderOption func(*SenderConfig)
+
+type SenderConfig struct {
+	BaseURL       string
+	APIVersion    string
+	AccessToken   string
+	PhoneNumberID string
+	HTTPClient    *http.Client
+}
+
+func WithSenderBaseURL(url string) SenderOption {
+	return func(c *SenderConfig) {
+		c.BaseURL = url
+	}
+}
+
+func WithPhoneNumberID(id string) SenderOption {
+	return func(c *SenderConfig) {
+		c.PhoneNumberID = id
+	}
+}
+
+func WithHTTPClient(client *http.Client) SenderOption {
+	return func(c *SenderConfig) {
+		c.HTTPClient = client
+	}
+}
+
+// Sender posts outbound messages to the Graph API messages endpoint
+type Sender struct {
+	config *SenderConfig
+}
+
+// NewSender creates a sender from the WhatsApp configuration. The phone
+// number ID can be overridden per sender, e.g. with the number a webhook
+// was delivered to.
+func NewSender(cfg conf.WhatsappConfig, opts ...SenderOption) (*Sender, error) {
+	config := &SenderConfig{
+		BaseURL:       cfg.GraphBaseURL,
+		APIVersion:    cfg.GraphVersion,
+		AccessToken:   cfg.AccessToken,
+		PhoneNumberID: cfg.PhoneNumberID,
+		HTTPClient:    &http.Client{Timeout: 30 * time.Second},
+	}
+
+	for _, opt := range opts {
+		opt(config)
+	}
+
+	if config.AccessToken == "" {
+		return nil, fmt.Errorf("access token is required")
+	}
+	if config.PhoneNumberID == "" {
+		return nil, fmt.Errorf("phone number ID is required")
+	}
+	if config.BaseURL == "" {
+		config.BaseURL = "https://graph.facebook.com"
+	}
+	if config.APIVersion == "" {
+		config.APIVersion = "v18.0"
+	}
+
+	return &Sender{config: config}, nil
+}
+
+// MessageOption adjusts an outbound message before it is sent
+type MessageOption func(*OutboundMessage)
+
+// WithReplyTo threads the message as a reply to an inbound message ID
+func WithReplyTo(messageID string) MessageOption {
+	return func(m *OutboundMessage) {
+		if messageID != "" {
+			m.Context = &MessageContext{MessageID: messageID}
+		}
+	}
+}
+
+// SendText sends a plain text message
+func (s *Sender) SendText(ctx context.Context, to string, body string, opts ...MessageOption) (string, error) {
+	msg := OutboundMessage{
+		Type: "text",
+		Text: &OutboundText{Body: body},
+	}
+	return s.send(ctx, to, msg, opts...)
+}
+
+// SendTemplate sends a pre-approved message template, required when
+// messaging a user outside the 24-hour customer service window
+func (s *Sender) SendTemplate(ctx context.Context, to string, template OutboundTemplate, opts ...MessageOption) (string, error) {
+	msg := OutboundMessage{
+		Type:     "template",
+		Template: &template,
+	}
+	return s.send(ctx, to, msg, opts...)
+}
+
+// SendImage sends an image by public link or previously uploaded media ID,
+// with an optional caption
+func (s *Sender) SendImage(ctx context.Context, to string, image OutboundMedia, opts ...MessageOption) (string, error) {
+	if image.Link == "" && image.ID == "" {
+		return "", fmt.Errorf("image link or media ID is required")
+	}
+	msg := OutboundMessage{
+		Type:  "image",
+		Image: &image,
+	}
+	return s.send(ctx, to, msg, opts...)
+}
+
+// send posts the message and returns the WhatsApp message ID assigned to it
+func (s *Sender) send(ctx context.Context, to string, msg OutboundMessage, opts ...MessageOption) (string, error) {
+	msg.MessagingProduct = "whatsapp"
+	msg.RecipientType = "individual"
+	msg.To = to
+	for _, opt := range opts {
+		opt(&msg)
+	}
+
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode message: %w", err)
+	}
+
+	endpoint := fmt.Sprintf("%s/%s/%s/messages", strings.TrimRight(s.config.BaseURL, "/"), s.config.APIVersion, s.config.PhoneNumberID)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+s.config.AccessToken)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.config.HTTPClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to send message: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var apiErr GraphErrorResponse
+		if json.Unmarshal(respBody, &apiErr) == nil && apiErr.Error.Message != "" {
+			return "", fmt.Errorf("failed to send message, status: %d, code: %d, error: %s", resp.StatusCode, apiErr.Error.Code, apiErr.Error.Message)
+		}
+		return "", fmt.Errorf("failed to send message, status: %d, body: %s", resp.StatusCode, string(respBody))
+	}
+
+	var sendResp SendMessageResponse
+	if err := json.Unmarshal(respBody, &sendResp); err != nil {
+		return "", fmt.Errorf("failed to decode send response: %w", err)
+	}
+	if len(sendResp.Messages) == 0 {
+		return "", fmt.Errorf("send response contained no message ID")
+	}
+
+	return sendResp.Messages[0].ID, nil
+}
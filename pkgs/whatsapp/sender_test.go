@@ -0,0 +1,116 @@
+package whatsapp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"sadbhavana/tree-project/pkgs/conf"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestSender starts a Graph API stand-in that records the last request
+// and answers with the given status and body.
+func newTestSender(t *testing.T, status int, response string) (*Sender, *OutboundMessage, *http.Request) {
+	t.Helper()
+	var received OutboundMessage
+	var lastReq http.Request
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lastReq = *r
+		if err := json.NewDecoder(r.Body).Decode(&received); err != nil {
+			t.Errorf("failed to decode request body: %v", err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		fmt.Fprint(w, response)
+	}))
+	t.Cleanup(server.Close)
+
+	sender, err := NewSender(conf.WhatsappConfig{AccessToken: "test-token", PhoneNumberID: "106540352242922"},
+		WithSenderBaseURL(server.URL))
+	if err != nil {
+		t.Fatalf("failed to create sender: %v", err)
+	}
+	return sender, &received, &lastReq
+}
+
+const okResponse = `{"messaging_product":"whatsapp","contacts":[{"input":"16505551234","wa_id":"16505551234"}],"messages":[{"id":"wamid.OUTBOUND"}]}`
+
+func TestSender_SendTextReply(t *testing.T) {
+	sender, received, req := newTestSender(t, http.StatusOK, okResponse)
+
+	id, err := sender.SendText(context.Background(), "16505551234", "Thank you!", WithReplyTo("wamid.INBOUND"))
+	assert.NoError(t, err)
+	assert.Equal(t, "wamid.OUTBOUND", id)
+
+	assert.Equal(t, "/v18.0/106540352242922/messages", req.URL.Path)
+	assert.Equal(t, "Bearer test-token", req.Header.Get("Authorization"))
+	assert.Equal(t, "whatsapp", received.MessagingProduct)
+	assert.Equal(t, "16505551234", received.To)
+	assert.Equal(t, "text", received.Type)
+	assert.Equal(t, "Thank you!", received.Text.Body)
+	assert.Equal(t, "wamid.INBOUND", received.Context.MessageID)
+}
+
+func TestSender_SendTemplate(t *testing.T) {
+	sender, received, _ := newTestSender(t, http.StatusOK, okResponse)
+
+	_, err := sender.SendTemplate(context.Background(), "16505551234", OutboundTemplate{
+		Name:     "tree_update",
+		Language: TemplateLanguage{Code: "en"},
+		Components: []TemplateComponent{{
+			Type:       "body",
+			Parameters: []TemplateParameter{{Type: "text", Text: "AB000123"}},
+		}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "template", received.Type)
+	assert.Equal(t, "tree_update", received.Template.Name)
+	assert.Equal(t, "AB000123", received.Template.Components[0].Parameters[0].Text)
+	assert.Nil(t, received.Context)
+}
+
+func TestSender_SendImageWithCaption(t *testing.T) {
+	sender, received, _ := newTestSender(t, http.StatusOK, okResponse)
+
+	_, err := sender.SendImage(context.Background(), "16505551234", OutboundMedia{
+		Link:    "https://example.org/tree.jpg",
+		Caption: "Tree AB000123",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "image", received.Type)
+	assert.Equal(t, "https://example.org/tree.jpg", received.Image.Link)
+	assert.Equal(t, "Tree AB000123", received.Image.Caption)
+
+	_, err = sender.SendImage(context.Background(), "16505551234", OutboundMedia{Caption: "no image"})
+	assert.Error(t, err)
+}
+
+func TestSender_GraphError(t *testing.T) {
+	sender, _, _ := newTestSender(t, http.StatusBadRequest,
+		`{"error":{"message":"(#131030) Recipient phone number not in allowed list","type":"OAuthException","code":131030,"fbtrace_id":"Az8or2yhqkZfEZ-_4Qn_Bam"}}`)
+
+	_, err := sender.SendText(context.Background(), "16505551234", "hello")
+	assert.ErrorContains(t, err, "131030")
+}
+
+func TestAckText(t *testing.T) {
+	text, ok := ackText("AB000123", nil)
+	assert.True(t, ok)
+	assert.Contains(t, text, "AB000123")
+
+	text, ok = ackText("AB999999", fmt.Errorf("%w: no tree", ErrUnknownTree))
+	assert.True(t, ok)
+	assert.Contains(t, text, "AB999999")
+
+	_, ok = ackText("", fmt.Errorf("%w: low confidence", ErrUnreadableTreeID))
+	assert.True(t, ok)
+
+	_, ok = ackText("", fmt.Errorf("gemini unavailable"))
+	assert.False(t, ok)
+}
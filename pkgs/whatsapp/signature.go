@@ -0,0 +1,87 @@
+package whatsapp
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"sadbhavana/tree-project/pkgs/db"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// SignatureHeader is the header Meta signs webhook deliveries with
+const SignatureHeader = "X-Hub-Signature-256"
+
+const signaturePrefix = "sha256="
+
+// MaxWebhookBodyBytes caps the webhook deliveries read from the request.
+// Meta's deliveries are a few kilobytes; media is fetched separately.
+const MaxWebhookBodyBytes = 1 << 20
+
+// rejectionPayloadBytes is how much of a rejected delivery is kept for
+// auditing, enough to see what was sent without storing whatever a forger
+// chooses to post
+const rejectionPayloadBytes = 4 << 10
+
+var (
+	ErrMissingSignature = errors.New("missing webhook signature")
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+)
+
+// VerifySignature checks the X-Hub-Signature-256 header value against the
+// HMAC-SHA256 of the raw request body keyed with the app secret.
+func VerifySignature(body []byte, signature string, appSecret string) error {
+	if signature == "" {
+		return ErrMissingSignature
+	}
+	hexDigest, ok := strings.CutPrefix(signature, signaturePrefix)
+	if !ok {
+		return fmt.Errorf("%w: expected %s prefix", ErrInvalidSignature, signaturePrefix)
+	}
+	got, err := hex.DecodeString(hexDigest)
+	if err != nil {
+		return fmt.Errorf("%w: malformed digest", ErrInvalidSignature)
+	}
+
+	mac := hmac.New(sha256.New, []byte(appSecret))
+	mac.Write(body)
+	if !hmac.Equal(got, mac.Sum(nil)) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// RecordRejection stores a delivery that failed verification for auditing,
+// keeping only the start of its payload. Failures are only logged; the
+// request is rejected either way.
+func RecordRejection(ctx context.Context, reason error, signature string, remoteAddr string, body []byte) {
+	log.Printf("Rejected webhook from %s: %v", remoteAddr, reason)
+
+	q, err := db.NewQueries(ctx)
+	if err != nil {
+		log.Printf("Failed to get database queries to record webhook rejection: %v", err)
+		return
+	}
+	err = q.RecordWebhookRejection(ctx, db.RecordWebhookRejectionParams{
+		Reason:     reason.Error(),
+		Signature:  pgtype.Text{String: signature, Valid: signature != ""},
+		RemoteAddr: pgtype.Text{String: remoteAddr, Valid: remoteAddr != ""},
+		Payload:    truncatePayload(body),
+	})
+	if err != nil {
+		log.Printf("Failed to record webhook rejection: %v", err)
+	}
+}
+
+func truncatePayload(body []byte) []byte {
+	if len(body) > rejectionPayloadBytes {
+		return body[:rejectionPayloadBytes]
+	}
+	return body
+}
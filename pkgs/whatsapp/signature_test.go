@@ -0,0 +1,68 @@
+package whatsapp
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testAppSecret = "test_app_secret"
+
+// Signatures captured alongside the payloads in testdata, signed with testAppSecret
+var sampleSignatures = map[string]string{
+	"testdata/image_message.json": "sha256=b6231e44b1226dc63c4b53cdeaf7d63b4dbc38ef2fa944a2dee02783f5b47f43",
+	"testdata/text_message.json":  "sha256=bac7a2b1c51da055f5a5c454939450a63a17298b8874ab3dd76dc47e2a4eca65",
+}
+
+func loadSample(t *testing.T, path string) []byte {
+	body, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read sample payload %s: %v", path, err)
+	}
+	return body
+}
+
+func TestVerifySignature_ValidSamples(t *testing.T) {
+	for path, signature := range sampleSignatures {
+		body := loadSample(t, path)
+		assert.NoError(t, VerifySignature(body, signature, testAppSecret), path)
+
+		var payload WebhookPayload
+		assert.NoError(t, json.Unmarshal(body, &payload), path)
+		assert.Equal(t, "whatsapp_business_account", payload.Object, path)
+	}
+}
+
+func TestVerifySignature_TamperedBody(t *testing.T) {
+	body := loadSample(t, "testdata/image_message.json")
+	signature := sampleSignatures["testdata/image_message.json"]
+
+	tampered := append([]byte{}, body...)
+	tampered[len(tampered)-2] = ' '
+	assert.ErrorIs(t, VerifySignature(tampered, signature, testAppSecret), ErrInvalidSignature)
+}
+
+func TestVerifySignature_WrongSecret(t *testing.T) {
+	body := loadSample(t, "testdata/text_message.json")
+	signature := sampleSignatures["testdata/text_message.json"]
+
+	assert.ErrorIs(t, VerifySignature(body, signature, "another_secret"), ErrInvalidSignature)
+}
+
+func TestVerifySignature_MalformedHeader(t *testing.T) {
+	body := loadSample(t, "testdata/text_message.json")
+
+	assert.ErrorIs(t, VerifySignature(body, "", testAppSecret), ErrMissingSignature)
+	assert.ErrorIs(t, VerifySignature(body, "sha1=abcdef", testAppSecret), ErrInvalidSignature)
+	assert.ErrorIs(t, VerifySignature(body, "sha256=not-hex", testAppSecret), ErrInvalidSignature)
+}
+
+func TestTruncatePayload(t *testing.T) {
+	small := []byte(`{"object":"whatsapp_business_account"}`)
+	assert.Equal(t, small, truncatePayload(small))
+
+	large := make([]byte, rejectionPayloadBytes*3)
+	assert.Len(t, truncatePayload(large), rejectionPayloadBytes)
+}
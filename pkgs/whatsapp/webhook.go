@@ -3,6 +3,7 @@ package whatsapp
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -10,111 +11,185 @@ import (
 	"sadbhavana/tree-project/pkgs/conf"
 	"sadbhavana/tree-project/pkgs/db"
 	"sadbhavana/tree-project/pkgs/file"
+	"strings"
 	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
 )
 
+// HandleWebhookEvent persists the delivery in the webhook inbox and returns
+// immediately so Meta gets its 200 well within the delivery timeout. The
+// ingestion workers pick the payload up from there.
 func HandleWebhookEvent(ctx context.Context, input *WebhookInput) (*WebhookOutput, error) {
-	payload := input.Body
+	payload := input.RawBody
+	if len(payload) == 0 {
+		var err error
+		payload, err = json.Marshal(input.Body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode webhook payload: %w", err)
+		}
+	}
 
-	log.Printf("Received webhook: %+v", payload)
-	q, tx, err := db.NewQueriesWithTx(ctx)
+	q, err := db.NewQueries(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get database queries: %w", err)
 	}
-	defer tx.Rollback(ctx)
 
-	// Process each entry
+	id, err := q.EnqueueWebhook(ctx, payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to enqueue webhook: %w", err)
+	}
+	log.Printf("Webhook queued as %s", id)
+
+	// Must return 200 OK to Meta
+	return &WebhookOutput{Body: "EVENT_RECEIVED"}, nil
+}
+
+// ProcessWebhookPayload runs the ingestion pipeline for one webhook delivery.
+// Each message is ingested in its own transaction, so a message that fails,
+// such as one whose media cannot be downloaded, does not hold up the others.
+// The failures are returned together so the caller can retry the delivery;
+// messages already ingested are skipped on the retry.
+func ProcessWebhookPayload(ctx context.Context, payload WebhookPayload) error {
+	var errs []error
 	for _, entry := range payload.Entry {
 		for _, change := range entry.Changes {
-			if change.Field == "messages" {
-				msgs, err := processMessages(change.Value)
-				if err != nil {
-					log.Printf("Failed to process messages: %v", err)
-					continue
-				}
-				for _, msg := range msgs {
-					err = extractImageData(ctx, q, msg)
-					if err != nil {
-						log.Printf("Failed to extract image data: %v", err)
-						continue
-					}
+			if change.Field != "messages" {
+				continue
+			}
+			for _, message := range change.Value.Messages {
+				if err := processMessage(ctx, change.Value, message); err != nil {
+					errs = append(errs, fmt.Errorf("message %s: %w", message.ID, err))
 				}
 			}
 		}
 	}
+	return errors.Join(errs...)
+}
+
+// processMessage ingests a single message, skipping it if it is already
+// claimed in the ledger
+func processMessage(ctx context.Context, value Value, message Message) error {
+	msg, dataID, err := parseMessage(value, message)
+	if err != nil {
+		return err
+	}
+
+	q, tx, err := db.NewQueriesWithTx(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get database queries: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	claimed, err := claimMessage(ctx, q, msg)
+	if err != nil {
+		return err
+	}
+	if !claimed {
+		log.Printf("Message %s already processed, skipping duplicate delivery", msg.ID)
+		return nil
+	}
+
+	if dataID != "" {
+		msg.File, err = downloadMedia(ctx, q, dataID)
+		if err != nil {
+			return fmt.Errorf("failed to download media ID %s: %w", dataID, err)
+		}
+		log.Printf("Media downloaded and saved: %+v", msg.File)
+	}
+
+	img, treeID, outcome := extractImageData(ctx, q, msg)
+	if errors.Is(outcome, ErrImageRejected) {
+		log.Printf("Image from %s rejected: %v", msg.From, outcome)
+	} else if outcome != nil {
+		return fmt.Errorf("failed to extract image data: %w", outcome)
+	}
+
 	if err := tx.Commit(ctx); err != nil {
-		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+		return fmt.Errorf("failed to commit transaction: %w", err)
 	}
 
-	// Must return 200 OK to Meta
-	return &WebhookOutput{Body: "EVENT_RECEIVED"}, nil
+	// Only tell the volunteer what happened to their photo once it is saved,
+	// so a rolled-back or retried attempt sends nothing
+	acknowledgeOutcome(ctx, msg, treeID, outcome)
+	if img != nil {
+		storeImageCopies(ctx, img)
+	}
+	return nil
 }
 
-// Process incoming messages
-func processMessages(value Value) ([]ParsedMessage, error) {
-	parsedMessages := make([]ParsedMessage, 0, len(value.Messages))
-	var err error
+// parseMessage reads a webhook message, returning the ID of its media if it
+// has any
+func parseMessage(value Value, message Message) (ParsedMessage, string, error) {
+	log.Printf("Message from %s, Type: %s", message.From, message.Type)
 
-	for _, message := range value.Messages {
-		log.Printf("Message from %s, Type: %s", message.From, message.Type)
+	var dataID string
+	msg := ParsedMessage{
+		ID:            message.ID,
+		MediaSHA256:   message.mediaSHA256(),
+		From:          message.From,
+		PhoneNumberID: value.Metadata.PhoneNumberID,
+		Type:          ParsedMessageType(message.Type),
+	}
 
-		var dataID string
-		msg := ParsedMessage{
-			From: message.From,
-			Type: ParsedMessageType(message.Type),
+	switch message.Type {
+	case "text":
+		if message.Text == nil {
+			return msg, "", fmt.Errorf("text message missing text data")
 		}
-
-		switch message.Type {
-		case "text":
-			if message.Text == nil {
-				return nil, fmt.Errorf("text message missing text data")
-			}
-			msg.Text = &message.Text.Body
-		case "image":
-			if message.Image == nil {
-				return nil, fmt.Errorf("image message missing image data")
-			}
-			log.Printf("Image received - ID: %s, MimeType: %s", message.Image.ID, message.Image.MimeType)
-			dataID = message.Image.ID
-		case "video":
-			if message.Video == nil {
-				return nil, fmt.Errorf("video message missing video data")
-			}
-			log.Printf("Video received - ID: %s, MimeType: %s", message.Video.ID, message.Video.MimeType)
-			dataID = message.Video.ID
-		case "audio":
-			if message.Audio == nil {
-				return nil, fmt.Errorf("audio message missing audio data")
-			}
-			log.Printf("Audio received - ID: %s, MimeType: %s", message.Audio.ID, message.Audio.MimeType)
-			dataID = message.Audio.ID
-		case "document":
-			if message.Document == nil {
-				return nil, fmt.Errorf("document message missing document data")
-			}
-			log.Printf("Document received - ID: %s, MimeType: %s", message.Document.ID, message.Document.MimeType)
-			dataID = message.Document.ID
+		msg.Text = &message.Text.Body
+	case "image":
+		if message.Image == nil {
+			return msg, "", fmt.Errorf("image message missing image data")
 		}
-		if dataID != "" {
-			msg.File, err = downloadMedia(dataID)
-			if err != nil {
-				log.Printf("Failed to download media ID %s: %v", dataID, err)
-				continue
-			}
-			log.Printf("Media downloaded and saved: %+v", msg.File)
+		log.Printf("Image received - ID: %s, MimeType: %s", message.Image.ID, message.Image.MimeType)
+		dataID = message.Image.ID
+	case "video":
+		if message.Video == nil {
+			return msg, "", fmt.Errorf("video message missing video data")
+		}
+		log.Printf("Video received - ID: %s, MimeType: %s", message.Video.ID, message.Video.MimeType)
+		dataID = message.Video.ID
+	case "audio":
+		if message.Audio == nil {
+			return msg, "", fmt.Errorf("audio message missing audio data")
+		}
+		log.Printf("Audio received - ID: %s, MimeType: %s", message.Audio.ID, message.Audio.MimeType)
+		dataID = message.Audio.ID
+	case "document":
+		if message.Document == nil {
+			return msg, "", fmt.Errorf("document message missing document data")
 		}
-		parsedMessages = append(parsedMessages, msg)
+		log.Printf("Document received - ID: %s, MimeType: %s", message.Document.ID, message.Document.MimeType)
+		dataID = message.Document.ID
 	}
-	return parsedMessages, nil
+	return msg, dataID, nil
 }
 
-// downloadMedia downloads media from WhatsApp and saves it to local file store
-func downloadMedia(mediaID string) (*file.FileInfo, error) {
-	ctx := context.Background()
+// claimMessage adds the message to the ledger before it is ingested, and
+// reports false if it was already there. The claim is part of the ingestion
+// transaction: a concurrent redelivery waits on it and is skipped once it
+// commits, and a failed attempt releases it for the retry.
+func claimMessage(ctx context.Context, q *db.Queries, msg ParsedMessage) (bool, error) {
+	n, err := q.ClaimWhatsappMessage(ctx, db.ClaimWhatsappMessageParams{
+		MessageID:   msg.ID,
+		MediaSha256: pgtype.Text{String: msg.MediaSHA256, Valid: msg.MediaSHA256 != ""},
+		Sender:      msg.From,
+		MessageType: string(msg.Type),
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to claim message %s: %w", msg.ID, err)
+	}
+	return n > 0, nil
+}
 
+// downloadMedia downloads media from WhatsApp and saves it to the configured
+// media file store
+func downloadMedia(ctx context.Context, q *db.Queries, mediaID string) (*file.FileInfo, error) {
 	// Step 1: Get the media URL from WhatsApp
-	accessToken := conf.GetConfig().WhatsappConfig.AccessToken
-	mediaURLEndpoint := fmt.Sprintf("https://graph.facebook.com/v18.0/%s", mediaID)
+	waCfg := conf.GetConfig().WhatsappConfig
+	accessToken := waCfg.AccessToken
+	mediaURLEndpoint := fmt.Sprintf("%s/%s/%s", strings.TrimRight(waCfg.GraphBaseURL, "/"), waCfg.GraphVersion, mediaID)
 
 	req, err := http.NewRequest("GET", mediaURLEndpoint, nil)
 	if err != nil {
@@ -171,11 +246,11 @@ func downloadMedia(mediaID string) (*file.FileInfo, error) {
 	filename := fmt.Sprintf("whatsapp-%s-%s.%s", mediaID, timestamp, string(mimeType))
 
 	folderInfo := file.FolderInfo{
-		FolderPath: "whatsapp",
+		FolderPath: waCfg.MediaFolder,
 	}
 
-	// Step 6: Save to local file store
-	fileStore, err := file.NewFileStore("local", nil)
+	// Step 6: Save to the media file store
+	fileStore, err := file.OpenFileStore(ctx, q, waCfg.MediaStore)
 	if err != nil {
 		return nil, fmt.Errorf("failed to initialize file store: %w", err)
 	}
@@ -0,0 +1,34 @@
+package whatsapp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMessage(t *testing.T) {
+	value := Value{Metadata: Metadata{PhoneNumberID: "1555"}}
+
+	msg, dataID, err := parseMessage(value, Message{
+		ID:    "wamid.1",
+		From:  "919800000000",
+		Type:  "image",
+		Image: &MediaMsg{ID: "media-1", SHA256: "abc"},
+	})
+	if assert.NoError(t, err) {
+		assert.Equal(t, "media-1", dataID)
+		assert.Equal(t, "abc", msg.MediaSHA256)
+		assert.Equal(t, "1555", msg.PhoneNumberID)
+		assert.Equal(t, ParsedMessageTypeImage, msg.Type)
+	}
+
+	msg, dataID, err = parseMessage(value, Message{ID: "wamid.2", Type: "text", Text: &TextMsg{Body: "AB17"}})
+	if assert.NoError(t, err) {
+		assert.Empty(t, dataID)
+		assert.Equal(t, "AB17", *msg.Text)
+	}
+
+	// A malformed message fails on its own
+	_, _, err = parseMessage(value, Message{ID: "wamid.3", Type: "image"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,213 @@
+package whatsapp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"sadbhavana/tree-project/pkgs/conf"
+	"sadbhavana/tree-project/pkgs/db"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Webhook inbox statuses, mirrored from the core.webhook_inbox check constraint
+const (
+	InboxStatusPending    = "pending"
+	InboxStatusProcessing = "processing"
+	InboxStatusDone       = "done"
+	InboxStatusDead       = "dead"
+)
+
+// WorkerPool drains core.webhook_inbox with a fixed number of workers.
+type WorkerPool struct {
+	cfg conf.WhatsappConfig
+	wg  sync.WaitGroup
+}
+
+// StartWorkers launches the ingestion workers. They stop once ctx is
+// cancelled; call Wait to block until in-flight deliveries have finished.
+func StartWorkers(ctx context.Context, cfg conf.WhatsappConfig) *WorkerPool {
+	pool := &WorkerPool{cfg: cfg}
+	for i := 0; i < cfg.WorkerConcurrency; i++ {
+		pool.wg.Add(1)
+		go func(workerID int) {
+			defer pool.wg.Done()
+			pool.run(ctx, workerID)
+		}(i + 1)
+	}
+	pool.wg.Add(1)
+	go func() {
+		defer pool.wg.Done()
+		pool.rerunReviews(ctx)
+	}()
+	if cfg.LedgerRetention > 0 {
+		pool.wg.Add(1)
+		go func() {
+			defer pool.wg.Done()
+			pool.cleanupLedger(ctx)
+		}()
+	}
+	log.Printf("Started %d WhatsApp ingestion workers", cfg.WorkerConcurrency)
+	return pool
+}
+
+// Wait blocks until every worker has exited.
+func (p *WorkerPool) Wait() {
+	p.wg.Wait()
+}
+
+func (p *WorkerPool) run(ctx context.Context, workerID int) {
+	for {
+		claimed, err := p.processNext(ctx)
+		if err != nil {
+			log.Printf("WhatsApp worker %d: %v", workerID, err)
+		}
+		if claimed && err == nil {
+			// More work may be waiting, go straight back to the inbox
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(p.cfg.PollInterval):
+		}
+	}
+}
+
+// rerunReviews works through photo reviews queued for another extraction
+// run from the review page
+func (p *WorkerPool) rerunReviews(ctx context.Context) {
+	for {
+		claimed, err := RerunNextReview(ctx)
+		if err != nil {
+			log.Printf("Photo review re-run: %v", err)
+		}
+		if claimed {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(p.cfg.PollInterval):
+		}
+	}
+}
+
+// ledgerCleanupInterval is how often expired processed-message entries are purged
+const ledgerCleanupInterval = time.Hour
+
+// cleanupLedger periodically drops processed-message entries older than the
+// retention window. Meta stops redelivering long before then.
+func (p *WorkerPool) cleanupLedger(ctx context.Context) {
+	ticker := time.NewTicker(ledgerCleanupInterval)
+	defer ticker.Stop()
+	for {
+		q, err := db.NewQueries(ctx)
+		if err == nil {
+			cutoff := pgtype.Timestamptz{Time: time.Now().Add(-p.cfg.LedgerRetention), Valid: true}
+			var n int64
+			n, err = q.DeleteWhatsappMessagesBefore(ctx, cutoff)
+			if err == nil && n > 0 {
+				log.Printf("Removed %d expired entries from the WhatsApp message ledger", n)
+			}
+		}
+		if err != nil && ctx.Err() == nil {
+			log.Printf("WhatsApp message ledger cleanup failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// processNext claims a single inbox row and processes it. It reports whether
+// a row was claimed so the caller can skip the poll delay while busy.
+func (p *WorkerPool) processNext(ctx context.Context) (bool, error) {
+	if ctx.Err() != nil {
+		return false, nil
+	}
+
+	q, err := db.NewQueries(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to get database queries: %w", err)
+	}
+
+	staleBefore := pgtype.Timestamptz{Time: time.Now().Add(-p.cfg.LockTimeout), Valid: true}
+	item, err := q.ClaimWebhookInbox(ctx, staleBefore)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to claim webhook inbox item: %w", err)
+	}
+
+	procErr := processInboxItem(ctx, item)
+	if procErr == nil {
+		if err := q.CompleteWebhookInbox(ctx, item.ID); err != nil {
+			return true, fmt.Errorf("failed to complete webhook inbox item %s: %w", item.ID, err)
+		}
+		return true, nil
+	}
+
+	// Record the failure even if we are shutting down, otherwise the row sits
+	// in processing until the lock times out.
+	failCtx := context.WithoutCancel(ctx)
+	params := db.FailWebhookInboxParams{
+		ID:        item.ID,
+		Status:    InboxStatusPending,
+		LastError: pgtype.Text{String: procErr.Error(), Valid: true},
+		NextAttemptAt: pgtype.Timestamptz{
+			Time:  time.Now().Add(retryDelay(int(item.Attempts), p.cfg.RetryBaseDelay, p.cfg.RetryMaxDelay)),
+			Valid: true,
+		},
+	}
+	if int(item.Attempts) >= p.cfg.MaxAttempts {
+		params.Status = InboxStatusDead
+	}
+	if err := q.FailWebhookInbox(failCtx, params); err != nil {
+		return true, fmt.Errorf("failed to record failure for webhook inbox item %s: %w", item.ID, err)
+	}
+
+	return true, fmt.Errorf("webhook inbox item %s attempt %d failed (now %s): %w", item.ID, item.Attempts, params.Status, procErr)
+}
+
+// processInboxItem runs one delivery. Each message is ingested in its own
+// transaction, so a failed attempt leaves nothing half-written behind for the
+// retry.
+func processInboxItem(ctx context.Context, item db.CoreWebhookInbox) error {
+	var payload WebhookPayload
+	if err := json.Unmarshal(item.Payload, &payload); err != nil {
+		return fmt.Errorf("failed to decode webhook payload: %w", err)
+	}
+	return ProcessWebhookPayload(ctx, payload)
+}
+
+// retryDelay returns the exponential backoff before the next attempt, given
+// the number of attempts made so far.
+func retryDelay(attempts int, base, maxDelay time.Duration) time.Duration {
+	if attempts < 1 {
+		attempts = 1
+	}
+	delay := base
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= maxDelay {
+			return maxDelay
+		}
+	}
+	if delay > maxDelay {
+		return maxDelay
+	}
+	return delay
+}
@@ -0,0 +1,20 @@
+package whatsapp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryDelay(t *testing.T) {
+	base := 30 * time.Second
+	maxDelay := 10 * time.Minute
+
+	assert.Equal(t, 30*time.Second, retryDelay(0, base, maxDelay))
+	assert.Equal(t, 30*time.Second, retryDelay(1, base, maxDelay))
+	assert.Equal(t, 60*time.Second, retryDelay(2, base, maxDelay))
+	assert.Equal(t, 4*time.Minute, retryDelay(4, base, maxDelay))
+	assert.Equal(t, maxDelay, retryDelay(6, base, maxDelay))
+	assert.Equal(t, maxDelay, retryDelay(100, base, maxDelay))
+}
@@ -0,0 +1,62 @@
+package web
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/danielgtaylor/huma/v2"
+)
+
+// adminRealm is shown by the browser when it asks for admin credentials
+const adminRealm = `Basic realm="Tree Project Admin", charset="UTF-8"`
+
+type adminUserKey struct{}
+
+// checkAdmin matches HTTP Basic credentials against ADMIN_USERS
+func checkAdmin(users map[string]string, name, password string, ok bool) bool {
+	if !ok {
+		return false
+	}
+	want, found := users[name]
+	// Compare even for unknown names so they take as long as a wrong password
+	match := subtle.ConstantTimeCompare([]byte(password), []byte(want)) == 1
+	return match && found && want != ""
+}
+
+// requireAdmin lets a request through only with the credentials of one of
+// users, recording who signed in for adminUser
+func requireAdmin(users map[string]string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			name, password, ok := r.BasicAuth()
+			if !checkAdmin(users, name, password, ok) {
+				w.Header().Set("WWW-Authenticate", adminRealm)
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), adminUserKey{}, name)))
+		})
+	}
+}
+
+// requireAdminOperation is requireAdmin for huma operations
+func requireAdminOperation(api huma.API, users map[string]string) func(huma.Context, func(huma.Context)) {
+	return func(ctx huma.Context, next func(huma.Context)) {
+		r := http.Request{Header: http.Header{"Authorization": {ctx.Header("Authorization")}}}
+		name, password, ok := r.BasicAuth()
+		if !checkAdmin(users, name, password, ok) {
+			ctx.SetHeader("WWW-Authenticate", adminRealm)
+			huma.WriteErr(api, ctx, http.StatusUnauthorized, "Sign in as an admin to continue")
+			return
+		}
+		next(huma.WithValue(ctx, adminUserKey{}, name))
+	}
+}
+
+// adminUser is the name the admin signed in with, for recording who made a
+// decision
+func adminUser(ctx context.Context) string {
+	name, _ := ctx.Value(adminUserKey{}).(string)
+	return name
+}
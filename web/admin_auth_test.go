@@ -0,0 +1,66 @@
+package web
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/danielgtaylor/huma/v2/humatest"
+	"github.com/stretchr/testify/assert"
+)
+
+var testAdmins = map[string]string{"asha": "first-password", "ravi": "second-password"}
+
+func TestCheckAdmin(t *testing.T) {
+	assert.True(t, checkAdmin(testAdmins, "asha", "first-password", true))
+	assert.False(t, checkAdmin(testAdmins, "asha", "second-password", true))
+	assert.False(t, checkAdmin(testAdmins, "nobody", "", true))
+	assert.False(t, checkAdmin(testAdmins, "", "", false))
+	assert.False(t, checkAdmin(nil, "asha", "first-password", true))
+}
+
+func TestRequireAdmin(t *testing.T) {
+	handler := requireAdmin(testAdmins)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(adminUser(r.Context())))
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/auth/google/start", nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Contains(t, rec.Header().Get("WWW-Authenticate"), "Basic")
+
+	req.SetBasicAuth("ravi", "second-password")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "ravi", rec.Body.String())
+}
+
+func TestRequireAdminOperation(t *testing.T) {
+	_, api := humatest.New(t)
+	type whoAmI struct {
+		Body string
+	}
+	huma.Register(api, huma.Operation{
+		OperationID: "who-am-i",
+		Method:      http.MethodGet,
+		Path:        "/who",
+		Middlewares: huma.Middlewares{requireAdminOperation(api, testAdmins)},
+	}, func(ctx context.Context, input *struct{}) (*whoAmI, error) {
+		return &whoAmI{Body: adminUser(ctx)}, nil
+	})
+
+	// A reviewer name in the request is not enough to act as that reviewer
+	resp := api.Get("/who?reviewer=asha")
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+	assert.Contains(t, resp.Header().Get("WWW-Authenticate"), "Basic")
+
+	req := httptest.NewRequest(http.MethodGet, "/who", nil)
+	req.SetBasicAuth("asha", "first-password")
+	resp = api.Get("/who", "Authorization: "+req.Header.Get("Authorization"))
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Contains(t, resp.Body.String(), "asha")
+}
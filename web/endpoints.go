@@ -3,13 +3,23 @@ package web
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
+	"sadbhavana/tree-project/pkgs/auth"
+	"sadbhavana/tree-project/pkgs/cache"
 	"sadbhavana/tree-project/pkgs/conf"
 	"sadbhavana/tree-project/pkgs/db"
+	"sadbhavana/tree-project/pkgs/file"
 	"sadbhavana/tree-project/pkgs/html"
+	"sadbhavana/tree-project/pkgs/providers"
 	"sadbhavana/tree-project/pkgs/template"
 	"sadbhavana/tree-project/pkgs/whatsapp"
 
@@ -92,6 +102,12 @@ func RegisterMapHandlers(api huma.API) error {
 }
 
 func RegisterWhatsappHandlers(mux chi.Router) error {
+	// Without the app secret no delivery could be verified, so refuse to start
+	appSecret := conf.GetConfig().WhatsappConfig.AppSecret
+	if appSecret == "" {
+		return errors.New("WHATSAPP_APP_SECRET is not set; webhook signatures cannot be verified")
+	}
+
 	// GET for webhook verification
 	mux.Get("/whatsapp/webhook", func(w http.ResponseWriter, r *http.Request) {
 		mode := r.URL.Query().Get("hub.mode")
@@ -116,32 +132,209 @@ func RegisterWhatsappHandlers(mux chi.Router) error {
 	})
 
 	// POST for webhook events
-	mux.Post("/whatsapp/webhook", func(w http.ResponseWriter, r *http.Request) {
+	mux.Post("/whatsapp/webhook", webhookEventHandler(appSecret, whatsapp.RecordRejection, whatsapp.HandleWebhookEvent))
+
+	return nil
+}
+
+// webhookEventHandler verifies a webhook delivery's signature and queues it.
+// Rejected deliveries are passed to reject for auditing.
+func webhookEventHandler(
+	appSecret string,
+	reject func(ctx context.Context, reason error, signature, remoteAddr string, body []byte),
+	handle func(ctx context.Context, input *whatsapp.WebhookInput) (*whatsapp.WebhookOutput, error),
+) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, whatsapp.MaxWebhookBodyBytes))
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			log.Printf("Rejected webhook from %s: body over %d bytes", r.RemoteAddr, tooLarge.Limit)
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			w.Write([]byte("Request Entity Too Large"))
+			return
+		}
+		if err != nil {
+			log.Printf("Error reading webhook payload: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("Bad Request"))
+			return
+		}
+
+		// Reject anything not signed by Meta with our app secret
+		signature := r.Header.Get(whatsapp.SignatureHeader)
+		if err := whatsapp.VerifySignature(body, signature, appSecret); err != nil {
+			reject(r.Context(), err, signature, r.RemoteAddr, body)
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte("Unauthorized"))
+			return
+		}
+
 		var payload whatsapp.WebhookPayload
-		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		if err := json.Unmarshal(body, &payload); err != nil {
 			log.Printf("Error decoding webhook payload: %v", err)
 			w.WriteHeader(http.StatusBadRequest)
 			w.Write([]byte("Bad Request"))
 			return
 		}
 
-		// Call your handler function
-		input := &whatsapp.WebhookInput{Body: payload}
-		output, err := whatsapp.HandleWebhookEvent(r.Context(), input)
+		// Queue the delivery; the ingestion workers do the heavy lifting
+		input := &whatsapp.WebhookInput{Body: payload, RawBody: body}
+		output, err := handle(r.Context(), input)
 		if err != nil {
+			// Non-2xx makes Meta redeliver, which is what we want if the inbox is unavailable
 			log.Printf("Error handling webhook event: %v", err)
-		} else if output != nil {
-			w.Write([]byte(output.Body))
+			w.WriteHeader(http.StatusInternalServerError)
+			return
 		}
 
 		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(output.Body))
+	}
+}
+
+const oauthStateCookie = "oauth_state"
+
+// RegisterAuthHandlers lets an admin connect their own provider account, such
+// as a personal Google Drive, through the provider's consent page. Both steps
+// need admin credentials; browsers resend them on the provider's redirect
+// back to the callback.
+func RegisterAuthHandlers(mux chi.Router) error {
+	states, err := cache.NewRedisFromEnv[auth.AuthCodeState]()
+	if err != nil {
+		return fmt.Errorf("failed to connect to redis for oauth state: %w", err)
+	}
+	tokens, err := auth.DefaultTokenManager()
+	if err != nil {
+		return fmt.Errorf("failed to set up provider tokens: %w", err)
+	}
+
+	adminUsers := conf.GetConfig().Admin.Users
+	if len(adminUsers) == 0 {
+		log.Println("ADMIN_USERS is not set; connecting provider accounts is disabled")
+	}
+	mux = mux.With(requireAdmin(adminUsers))
+
+	mux.Get("/auth/{provider}/start", func(w http.ResponseWriter, r *http.Request) {
+		provider := providers.ProviderType(chi.URLParam(r, "provider"))
+		cfg := conf.GetConfig().OAuth
+
+		authURL, state, err := auth.StartAuthCodeFlow(r.Context(), states, provider, cfg)
+		if err != nil {
+			log.Printf("Error starting oauth for provider %s: %v", provider, err)
+			http.Error(w, "Could not start sign-in for "+string(provider), http.StatusBadRequest)
+			return
+		}
+
+		// The state is also kept in a cookie, so the callback only completes in
+		// the browser that started it
+		http.SetCookie(w, &http.Cookie{
+			Name:     oauthStateCookie,
+			Value:    state,
+			Path:     "/auth/",
+			MaxAge:   int(cfg.StateExpiry.Seconds()),
+			HttpOnly: true,
+			Secure:   strings.HasPrefix(cfg.RedirectBaseURL, "https://"),
+			SameSite: http.SameSiteLaxMode,
+		})
+		http.Redirect(w, r, authURL, http.StatusFound)
+	})
+
+	mux.Get("/auth/{provider}/callback", func(w http.ResponseWriter, r *http.Request) {
+		provider := providers.ProviderType(chi.URLParam(r, "provider"))
+		query := r.URL.Query()
+		state := query.Get("state")
+
+		cookie, err := r.Cookie(oauthStateCookie)
+		http.SetCookie(w, &http.Cookie{Name: oauthStateCookie, Path: "/auth/", MaxAge: -1})
+		if err != nil || cookie.Value != state {
+			http.Error(w, "Sign-in was not started in this browser", http.StatusForbidden)
+			return
+		}
+		if reason := query.Get("error"); reason != "" {
+			// Still use up the state so it cannot be replayed
+			auth.ConsumeState(r.Context(), states, provider, state)
+			http.Error(w, "Sign-in was not completed: "+reason, http.StatusBadRequest)
+			return
+		}
+
+		q, err := db.NewQueries(r.Context())
+		if err != nil {
+			log.Printf("Error initializing database queries: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		err = auth.FinishAuthCodeFlow(r.Context(), q, states, tokens, provider, state, query.Get("code"), conf.GetConfig().OAuth)
+		if errors.Is(err, auth.ErrInvalidState) {
+			http.Error(w, "Sign-in has expired, please start again", http.StatusForbidden)
+			return
+		}
+		if err != nil {
+			log.Printf("Error completing oauth for provider %s: %v", provider, err)
+			http.Error(w, "Could not connect "+string(provider), http.StatusBadGateway)
+			return
+		}
+
+		log.Printf("Connected account for provider %s on behalf of %s", provider, adminUser(r.Context()))
+		http.Redirect(w, r, "/admin", http.StatusSeeOther)
+	})
 
+	return nil
+}
+
+// RegisterFileHandlers serves locally stored files to holders of a link made
+// by file.ServeURL. The store's folder is not served publicly.
+func RegisterFileHandlers(mux chi.Router) error {
+	signer := file.DefaultURLSigner()
+	root := file.NewLocalFileStore().Root
+
+	mux.Get(file.LocalFilesPath+"*", func(w http.ResponseWriter, r *http.Request) {
+		relPath := chi.URLParam(r, "*")
+		if !filepath.IsLocal(relPath) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		query := r.URL.Query()
+		expiresAt, err := signer.Verify(relPath, query.Get("expires"), query.Get("signature"))
+		if err != nil {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte("Forbidden"))
+			return
+		}
+
+		f, err := os.Open(filepath.Join(root, filepath.FromSlash(relPath)))
+		if err != nil {
+			if !errors.Is(err, os.ErrNotExist) {
+				log.Printf("Error opening file %s: %v", relPath, err)
+			}
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		defer f.Close()
+		info, err := f.Stat()
+		if err != nil || info.IsDir() {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		// Browsers may keep the file until the link expires, but shared caches
+		// must not hand it to anyone without the link
+		maxAge := int(time.Until(expiresAt).Seconds())
+		w.Header().Set("Cache-Control", fmt.Sprintf("private, max-age=%d", max(maxAge, 0)))
+		http.ServeContent(w, r, info.Name(), info.ModTime(), f)
 	})
 
 	return nil
 }
 
 func RegisterAdminHandlers(api huma.API) error {
+	// Review decisions are recorded against the admin who signed in
+	adminUsers := conf.GetConfig().Admin.Users
+	if len(adminUsers) == 0 {
+		log.Println("ADMIN_USERS is not set; photo review actions are disabled")
+	}
+	adminOnly := huma.Middlewares{requireAdminOperation(api, adminUsers)}
+
 	huma.Register(api, huma.Operation{
 		OperationID: "get-admin-page",
 		Method:      "GET",
@@ -184,5 +377,95 @@ func RegisterAdminHandlers(api huma.API) error {
 		Summary:     "Create a new tree",
 	}, CreateTree)
 
+	huma.Register(api, huma.Operation{
+		OperationID: "get-failed-donor-updates-page",
+		Method:      "GET",
+		Path:        "/admin/donor-updates/failed",
+		Summary:     "List donor notifications that permanently failed",
+	}, GetFailedDonorUpdatesPage)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "get-whatsapp-inbox-stats",
+		Method:      "GET",
+		Path:        "/api/whatsapp/inbox/stats",
+		Summary:     "Get WhatsApp ingestion queue depth by status",
+		Tags:        []string{"whatsapp"},
+		Middlewares: adminOnly,
+	}, GetWhatsappInboxStats)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "list-whatsapp-inbox",
+		Method:      "GET",
+		Path:        "/api/whatsapp/inbox",
+		Summary:     "List WhatsApp inbox items by status",
+		Tags:        []string{"whatsapp"},
+		Middlewares: adminOnly,
+	}, ListWhatsappInbox)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "requeue-whatsapp-inbox",
+		Method:      "POST",
+		Path:        "/api/whatsapp/inbox/{id}/requeue",
+		Summary:     "Requeue a dead-lettered WhatsApp inbox item",
+		Tags:        []string{"whatsapp"},
+		Middlewares: adminOnly,
+	}, RequeueWhatsappInbox)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "get-llm-usage-report",
+		Method:      "GET",
+		Path:        "/api/llm/usage",
+		Summary:     "Summarise LLM token spend by day and action",
+		Tags:        []string{"llm"},
+	}, GetLlmUsageReport)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "get-photo-reviews-page",
+		Method:      "GET",
+		Path:        "/admin/photo-reviews",
+		Summary:     "List tree photos waiting for manual review",
+		Middlewares: adminOnly,
+	}, GetPhotoReviewsPage)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "assign-photo-review",
+		Method:      "POST",
+		Path:        "/api/photo-reviews/{id}/assign",
+		Summary:     "Assign a reviewed photo to a tree",
+		Middlewares: adminOnly,
+	}, AssignPhotoReview)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "reject-photo-review",
+		Method:      "POST",
+		Path:        "/api/photo-reviews/{id}/reject",
+		Summary:     "Reject a reviewed photo",
+		Middlewares: adminOnly,
+	}, RejectPhotoReview)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "rerun-photo-review",
+		Method:      "POST",
+		Path:        "/api/photo-reviews/{id}/rerun",
+		Summary:     "Queue tree-ID extraction to run again on a reviewed photo",
+		Middlewares: adminOnly,
+	}, RerunPhotoReview)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "get-photo-qa-page",
+		Method:      "GET",
+		Path:        "/admin/photo-qa",
+		Summary:     "List tree photos taken away from their tree or without GPS",
+		Middlewares: adminOnly,
+	}, GetPhotoQAPage)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "get-photo-duplicates-page",
+		Method:      "GET",
+		Path:        "/admin/photo-duplicates",
+		Summary:     "List tree photos that look like an earlier photo",
+		Middlewares: adminOnly,
+	}, GetPhotoDuplicatesPage)
+
 	return nil
 }
@@ -0,0 +1,87 @@
+package web
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"sadbhavana/tree-project/pkgs/whatsapp"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testAppSecret = "test_app_secret"
+
+type webhookRecorder struct {
+	rejected [][]byte
+	reasons  []error
+	queued   []*whatsapp.WebhookInput
+}
+
+func (rec *webhookRecorder) reject(ctx context.Context, reason error, signature, remoteAddr string, body []byte) {
+	rec.rejected = append(rec.rejected, body)
+	rec.reasons = append(rec.reasons, reason)
+}
+
+func (rec *webhookRecorder) handle(ctx context.Context, input *whatsapp.WebhookInput) (*whatsapp.WebhookOutput, error) {
+	rec.queued = append(rec.queued, input)
+	return &whatsapp.WebhookOutput{Body: "EVENT_RECEIVED"}, nil
+}
+
+func sign(body string) string {
+	mac := hmac.New(sha256.New, []byte(testAppSecret))
+	mac.Write([]byte(body))
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func postWebhook(rec *webhookRecorder, body, signature string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/whatsapp/webhook", strings.NewReader(body))
+	if signature != "" {
+		req.Header.Set(whatsapp.SignatureHeader, signature)
+	}
+	w := httptest.NewRecorder()
+	webhookEventHandler(testAppSecret, rec.reject, rec.handle).ServeHTTP(w, req)
+	return w
+}
+
+func TestWebhookEventHandler_Unsigned(t *testing.T) {
+	rec := &webhookRecorder{}
+	w := postWebhook(rec, `{"object":"whatsapp_business_account"}`, "")
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Empty(t, rec.queued)
+	if assert.Len(t, rec.reasons, 1) {
+		assert.ErrorIs(t, rec.reasons[0], whatsapp.ErrMissingSignature)
+	}
+
+	w = postWebhook(rec, `{"object":"whatsapp_business_account"}`, sign("something else"))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Empty(t, rec.queued)
+}
+
+func TestWebhookEventHandler_Signed(t *testing.T) {
+	rec := &webhookRecorder{}
+	body := `{"object":"whatsapp_business_account","entry":[]}`
+	w := postWebhook(rec, body, sign(body))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "EVENT_RECEIVED", w.Body.String())
+	if assert.Len(t, rec.queued, 1) {
+		assert.Equal(t, body, string(rec.queued[0].RawBody))
+	}
+}
+
+func TestWebhookEventHandler_TooLarge(t *testing.T) {
+	rec := &webhookRecorder{}
+	body := strings.Repeat("x", whatsapp.MaxWebhookBodyBytes+1)
+	w := postWebhook(rec, body, sign(body))
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	assert.Empty(t, rec.queued)
+	assert.Empty(t, rec.rejected, "oversized bodies are not stored")
+}
@@ -3,6 +3,7 @@ package web
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"math"
 	"net/url"
@@ -10,11 +11,16 @@ import (
 	"time"
 
 	"sadbhavana/tree-project/pkgs/db"
+	"sadbhavana/tree-project/pkgs/file"
 	"sadbhavana/tree-project/pkgs/html"
+	"sadbhavana/tree-project/pkgs/llm"
+	"sadbhavana/tree-project/pkgs/llmactions"
 	"sadbhavana/tree-project/pkgs/template"
 	"sadbhavana/tree-project/pkgs/utils"
+	"sadbhavana/tree-project/pkgs/whatsapp"
 
 	"github.com/a-h/templ"
+	"github.com/danielgtaylor/huma/v2"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgtype"
 )
@@ -163,9 +169,16 @@ func (h *Handlers) GetTreeDetail(ctx context.Context, treeID string) (*template.
 	if err != nil && err != pgx.ErrNoRows {
 		return nil, fmt.Errorf("failed to get latest tree update file: %w", err)
 	}
-	if err == nil && latestTreeUpdate.FileUrl.Valid && latestTreeUpdate.UpdateDate.Valid {
-		output.ImageURL = &latestTreeUpdate.FileUrl.String
+	// Only the web-size copy is shown, as the original keeps its EXIF and GPS.
+	// Photos without one appear once "files derivatives" has made it.
+	if err == nil && latestTreeUpdate.WebUrl.Valid && latestTreeUpdate.UpdateDate.Valid {
+		imageURL := file.ServeURL(latestTreeUpdate.WebUrl.String)
+		output.ImageURL = &imageURL
 		output.ImageTakenAt = &latestTreeUpdate.UpdateDate.Time
+		if latestTreeUpdate.PhotoTs.Valid {
+			output.ImageTakenAt = &latestTreeUpdate.PhotoTs.Time
+		}
+		output.ImageWarning = geofenceWarning(latestTreeUpdate.GeofenceStatus.String, latestTreeUpdate.DistanceM)
 	}
 
 	if tree.PlantedAt.Valid {
@@ -178,6 +191,25 @@ func (h *Handlers) GetTreeDetail(ctx context.Context, treeID string) (*template.
 	return &output, nil
 }
 
+// geofenceWarning describes a failed geofence check for display, or returns
+// "" when the photo passed or was never checked
+func geofenceWarning(status string, distance pgtype.Float8) string {
+	switch status {
+	case whatsapp.GeofenceStatusFar:
+		return fmt.Sprintf("This photo was taken %s from the tree's recorded location", formatDistance(distance.Float64))
+	case whatsapp.GeofenceStatusNoGPS:
+		return "This photo has no location, so it could not be checked against the tree's recorded location"
+	}
+	return ""
+}
+
+func formatDistance(m float64) string {
+	if m >= 1000 {
+		return fmt.Sprintf("%.1f km", m/1000)
+	}
+	return fmt.Sprintf("%.0f m", m)
+}
+
 func (h *Handlers) GetClusterDetail(ctx context.Context, projectCode string) (*template.ClusterDetail, error) {
 	output := &template.ClusterDetail{}
 
@@ -418,3 +450,335 @@ func CreateTree(ctx context.Context, input *FormInput) (*RedirectResponse, error
 		HXRedirect: "/admin?banner_msg=" + url.QueryEscape(msg),
 	}, nil
 }
+
+// GET /api/whatsapp/inbox/stats - Queue depth per status and age of the oldest item
+func GetWhatsappInboxStats(ctx context.Context, input *struct{}) (*WhatsappInboxStatsResponse, error) {
+	q, err := db.NewQueries(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize database queries: %w", err)
+	}
+
+	stats, err := q.GetWebhookInboxStats(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get webhook inbox stats: %w", err)
+	}
+
+	return &WhatsappInboxStatsResponse{Body: stats}, nil
+}
+
+// GET /api/whatsapp/inbox - Lists inbox items by status, dead letters by default
+func ListWhatsappInbox(ctx context.Context, input *WhatsappInboxListInput) (*WhatsappInboxListResponse, error) {
+	q, err := db.NewQueries(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize database queries: %w", err)
+	}
+
+	items, err := q.ListWebhookInboxByStatus(ctx, db.ListWebhookInboxByStatusParams{
+		Status:   input.Status,
+		RowLimit: input.Limit,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhook inbox: %w", err)
+	}
+
+	return &WhatsappInboxListResponse{Body: items}, nil
+}
+
+// POST /api/whatsapp/inbox/{id}/requeue - Sends a dead-lettered item back to the workers
+func RequeueWhatsappInbox(ctx context.Context, input *WhatsappInboxRequeueInput) (*WhatsappInboxRequeueResponse, error) {
+	q, err := db.NewQueries(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize database queries: %w", err)
+	}
+
+	n, err := q.RequeueWebhookInbox(ctx, input.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to requeue webhook inbox item: %w", err)
+	}
+	if n == 0 {
+		return nil, huma.Error404NotFound("No dead-lettered inbox item with id " + input.ID)
+	}
+
+	resp := &WhatsappInboxRequeueResponse{}
+	resp.Body.ID = input.ID
+	resp.Body.Status = whatsapp.InboxStatusPending
+	return resp, nil
+}
+
+// GET /admin/donor-updates/failed - Donor notifications abandoned after the maximum number of attempts
+func GetFailedDonorUpdatesPage(ctx context.Context, input *FailedDonorUpdatesInput) (*html.HTMLResponse, error) {
+	q, err := db.NewQueries(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize database queries: %w", err)
+	}
+
+	failed, err := db.GetDonorUpdateFailed(ctx, q, db.GetDonorUpdateFailedInput{Limit: input.Limit})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get failed donor updates: %w", err)
+	}
+
+	updates := make([]template.FailedDonorUpdate, 0, len(failed))
+	for _, f := range failed {
+		updates = append(updates, template.FailedDonorUpdate{
+			Idn:         f.Idn,
+			TreeID:      f.TreeId,
+			DonorName:   f.DonorName,
+			DonorEmail:  f.DonorEmail,
+			DonorMobile: f.DonorMobile,
+			UploadTs:    f.UploadTs,
+			AttemptCnt:  f.AttemptCnt,
+			LastError:   f.LastError,
+		})
+	}
+
+	return html.CreateHTMLResponse(ctx, template.FailedDonorUpdatesPage(updates))
+}
+
+// GET /api/llm/usage - Summarises LLM token spend by day, action and model
+func GetLlmUsageReport(ctx context.Context, input *LlmUsageReportInput) (*LlmUsageReportResponse, error) {
+	q, err := db.NewQueries(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize database queries: %w", err)
+	}
+
+	rows, err := q.GetLlmUsageReport(ctx, llm.UsageReportSince(input.Days))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get LLM usage report: %w", err)
+	}
+
+	return &LlmUsageReportResponse{Body: rows}, nil
+}
+
+// GET /admin/photo-reviews - Photos the WhatsApp pipeline could not link to a tree on its own
+func GetPhotoReviewsPage(ctx context.Context, input *PhotoReviewsInput) (*html.HTMLResponse, error) {
+	q, err := db.NewQueries(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize database queries: %w", err)
+	}
+
+	rows, err := q.ListPhotoReviews(ctx, db.ListPhotoReviewsParams{
+		Status:   input.Status,
+		RowLimit: input.Limit,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list photo reviews: %w", err)
+	}
+
+	reviews := make([]template.PhotoReview, 0, len(rows))
+	for _, r := range rows {
+		reviews = append(reviews, photoReviewView(r))
+	}
+
+	return html.CreateHTMLResponse(ctx, template.PhotoReviewsPage(input.Status, reviews, input.BannerMsg))
+}
+
+// GET /admin/photo-qa - Photos that failed the geofence check when linked to a tree
+func GetPhotoQAPage(ctx context.Context, input *PhotoQAInput) (*html.HTMLResponse, error) {
+	q, err := db.NewQueries(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize database queries: %w", err)
+	}
+
+	statuses := []string{whatsapp.GeofenceStatusFar, whatsapp.GeofenceStatusNoGPS}
+	if input.Status != "all" {
+		statuses = []string{input.Status}
+	}
+	since := time.Now().AddDate(0, 0, -input.Days)
+	rows, err := q.ListGeofenceFlaggedTreeUpdates(ctx, db.ListGeofenceFlaggedTreeUpdatesParams{
+		Statuses: statuses,
+		Since:    pgtype.Timestamptz{Time: since, Valid: true},
+		RowLimit: input.Limit,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list flagged tree photos: %w", err)
+	}
+
+	photos := make([]template.PhotoQARow, 0, len(rows))
+	for _, r := range rows {
+		row := template.PhotoQARow{
+			TreeID:    r.TreeID,
+			TreeLabel: llmactions.FormatTreeLabel(r.ProjectCode, r.TreeNumber),
+			DonorName: r.DonorName,
+			ImageURL:  file.ServeURL(r.FileUrl.String),
+			ThumbURL:  file.ServeURL(r.FileUrl.String),
+			LinkedAt:  r.UpdateDate.Time.Format("2006-01-02 15:04"),
+			Status:    r.GeofenceStatus,
+			Warning:   geofenceWarning(r.GeofenceStatus, r.DistanceM),
+		}
+		if r.ThumbnailUrl.Valid {
+			row.ThumbURL = file.ServeURL(r.ThumbnailUrl.String)
+		}
+		if r.PhotoTs.Valid {
+			row.TakenAt = r.PhotoTs.Time.Format("2006-01-02 15:04")
+		}
+		if r.DistanceM.Valid {
+			row.Distance = formatDistance(r.DistanceM.Float64)
+		}
+		if r.GeofenceRadiusM.Valid {
+			row.Radius = formatDistance(r.GeofenceRadiusM.Float64)
+		}
+		photos = append(photos, row)
+	}
+
+	return html.CreateHTMLResponse(ctx, template.PhotoQAPage(input.Status, input.Days, photos))
+}
+
+// GET /admin/photo-duplicates - Linked photos that look like an earlier photo of the same or another tree
+func GetPhotoDuplicatesPage(ctx context.Context, input *PhotoDuplicatesInput) (*html.HTMLResponse, error) {
+	q, err := db.NewQueries(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize database queries: %w", err)
+	}
+
+	since := time.Now().AddDate(0, 0, -input.Days)
+	rows, err := q.ListPhotoDuplicates(ctx, db.ListPhotoDuplicatesParams{
+		Since:    pgtype.Timestamptz{Time: since, Valid: true},
+		Scope:    input.Scope,
+		RowLimit: input.Limit,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list duplicate photos: %w", err)
+	}
+
+	duplicates := make([]template.PhotoDuplicate, 0, len(rows))
+	for _, r := range rows {
+		d := template.PhotoDuplicate{
+			TreeID:             r.TreeID,
+			TreeLabel:          r.TreeLabel,
+			ImageURL:           file.ServeURL(r.FileUrl.String),
+			ThumbURL:           file.ServeURL(r.FileUrl.String),
+			DuplicateTreeID:    r.DuplicateTreeID,
+			DuplicateTreeLabel: r.DuplicateTreeLabel,
+			DuplicateImageURL:  file.ServeURL(r.DuplicateFileUrl.String),
+			DuplicateThumbURL:  file.ServeURL(r.DuplicateFileUrl.String),
+			SameTree:           r.TreeID == r.DuplicateTreeID,
+			PHashDistance:      r.PhashDistance,
+			DHashDistance:      r.DhashDistance,
+			FlaggedAt:          r.CreatedAt.Time.Format("2006-01-02 15:04"),
+		}
+		if r.ThumbnailUrl.Valid {
+			d.ThumbURL = file.ServeURL(r.ThumbnailUrl.String)
+		}
+		if r.DuplicateThumbnailUrl.Valid {
+			d.DuplicateThumbURL = file.ServeURL(r.DuplicateThumbnailUrl.String)
+		}
+		duplicates = append(duplicates, d)
+	}
+
+	return html.CreateHTMLResponse(ctx, template.PhotoDuplicatesPage(input.Scope, input.Days, duplicates))
+}
+
+func photoReviewView(r db.ListPhotoReviewsRow) template.PhotoReview {
+	pr := r.CorePhotoReview
+	view := template.PhotoReview{
+		ID:          pr.ID,
+		ImageURL:    file.ServeURL(r.CoreFile.FileUrl.String),
+		ThumbURL:    file.ServeURL(r.CoreFile.FileUrl.String),
+		Sender:      pr.Sender.String,
+		ReceivedAt:  pr.CreatedAt.Time.Format("2006-01-02 15:04"),
+		Reason:      pr.Reason,
+		Status:      pr.Status,
+		TreeLabel:   r.TreeLabel,
+		DecidedBy:   pr.DecidedBy.String,
+		RerunQueued: pr.RerunRequestedAt.Valid,
+	}
+	if r.ThumbnailUrl.Valid {
+		view.ThumbURL = file.ServeURL(r.ThumbnailUrl.String)
+	}
+	if pr.DecidedAt.Valid {
+		view.DecidedAt = pr.DecidedAt.Time.Format("2006-01-02 15:04")
+	}
+
+	// The guesses are informational; a malformed column just shows nothing
+	var extracted llmactions.ExtractTreeIdOutput
+	if err := json.Unmarshal(pr.Extracted, &extracted); err == nil {
+		view.DonorName = extracted.DonorName
+		for _, c := range extracted.RankedCandidates() {
+			view.Candidates = append(view.Candidates, template.PhotoReviewGuess{
+				Label: c.TreeID,
+				Score: fmt.Sprintf("%.0f%%", c.Confidence*100),
+			})
+		}
+	}
+	var matches []llmactions.TreeMatch
+	if err := json.Unmarshal(pr.Matches, &matches); err == nil {
+		for _, m := range matches {
+			view.Matches = append(view.Matches, template.PhotoReviewGuess{
+				Label: m.Label(),
+				Score: fmt.Sprintf("%.2f", m.Score),
+			})
+		}
+	}
+	return view
+}
+
+// decidePhotoReview parses a review form and runs decide in a transaction on
+// behalf of the signed-in admin, redirecting back to the queue with the
+// message it returns
+func decidePhotoReview(ctx context.Context, input *PhotoReviewFormInput, decide func(q *db.Queries, form *PhotoReviewFormParsed, reviewer string) (string, error)) (*RedirectResponse, error) {
+	reviewer := adminUser(ctx)
+	if reviewer == "" {
+		return nil, huma.Error401Unauthorized("Sign in as an admin to review photos")
+	}
+	form, err := html.ParseForm[PhotoReviewFormParsed](&input.RawBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse form input: %w", err)
+	}
+
+	q, tx, err := db.NewQueriesWithTx(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get database queries: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	msg, err := decide(q, form, reviewer)
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		return nil, huma.Error404NotFound("Photo review or tree not found")
+	case errors.Is(err, whatsapp.ErrReviewNotPending):
+		return nil, huma.Error409Conflict("Photo review " + input.ID + " has already been decided")
+	case errors.Is(err, whatsapp.ErrInvalidTreeLabel):
+		return nil, huma.Error422UnprocessableEntity(err.Error())
+	case err != nil:
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit photo review: %w", err)
+	}
+
+	return &RedirectResponse{
+		HXRedirect: "/admin/photo-reviews?banner_msg=" + url.QueryEscape(msg),
+	}, nil
+}
+
+// POST /api/photo-reviews/{id}/assign - Link a reviewed photo to a tree
+func AssignPhotoReview(ctx context.Context, input *PhotoReviewFormInput) (*RedirectResponse, error) {
+	return decidePhotoReview(ctx, input, func(q *db.Queries, form *PhotoReviewFormParsed, reviewer string) (string, error) {
+		label, err := whatsapp.AssignReview(ctx, q, input.ID, form.TreeID, reviewer)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("Photo added to tree %s", label), nil
+	})
+}
+
+// POST /api/photo-reviews/{id}/reject - Reject a reviewed photo
+func RejectPhotoReview(ctx context.Context, input *PhotoReviewFormInput) (*RedirectResponse, error) {
+	return decidePhotoReview(ctx, input, func(q *db.Queries, form *PhotoReviewFormParsed, reviewer string) (string, error) {
+		if err := whatsapp.RejectReview(ctx, q, input.ID, reviewer); err != nil {
+			return "", err
+		}
+		return "Photo rejected", nil
+	})
+}
+
+// POST /api/photo-reviews/{id}/rerun - Queue tree-ID extraction to run again on a reviewed photo
+func RerunPhotoReview(ctx context.Context, input *PhotoReviewFormInput) (*RedirectResponse, error) {
+	return decidePhotoReview(ctx, input, func(q *db.Queries, form *PhotoReviewFormParsed, reviewer string) (string, error) {
+		if err := whatsapp.RequestRerun(ctx, q, input.ID, reviewer); err != nil {
+			return "", err
+		}
+		return "Extraction queued to run again; refresh in a minute to see the result", nil
+	})
+}
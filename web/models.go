@@ -2,6 +2,7 @@ package web
 
 import (
 	"mime/multipart"
+	"sadbhavana/tree-project/pkgs/db"
 	"sadbhavana/tree-project/pkgs/template"
 	"time"
 )
@@ -132,3 +133,72 @@ type CreateTreeInputParsed struct {
 	MetadataKeys   []string `form:"metadata-key[]"`
 	MetadataValues []string `form:"metadata-value[]"`
 }
+
+// Request/Response types for donor updates
+
+type FailedDonorUpdatesInput struct {
+	Limit int `query:"limit" default:"100" minimum:"1" maximum:"1000"`
+}
+
+// Request/Response types for the WhatsApp inbox
+
+type WhatsappInboxStatsResponse struct {
+	Body []db.GetWebhookInboxStatsRow
+}
+
+type WhatsappInboxListInput struct {
+	Status string `query:"status" default:"dead" enum:"pending,processing,done,dead"`
+	Limit  int32  `query:"limit" default:"50" minimum:"1" maximum:"500"`
+}
+
+type WhatsappInboxListResponse struct {
+	Body []db.ListWebhookInboxByStatusRow
+}
+
+type WhatsappInboxRequeueInput struct {
+	ID string `path:"id" minLength:"21" maxLength:"21"`
+}
+
+type WhatsappInboxRequeueResponse struct {
+	Body struct {
+		ID     string `json:"id"`
+		Status string `json:"status"`
+	}
+}
+
+type LlmUsageReportInput struct {
+	Days int `query:"days" default:"30" minimum:"1" maximum:"365" doc:"Number of UTC days to include, counting today"`
+}
+
+type LlmUsageReportResponse struct {
+	Body []db.GetLlmUsageReportRow
+}
+
+// Request/Response types for the photo review queue
+
+type PhotoReviewsInput struct {
+	Status    string `query:"status" default:"pending" enum:"pending,assigned,rejected"`
+	Limit     int32  `query:"limit" default:"50" minimum:"1" maximum:"500"`
+	BannerMsg string `query:"banner_msg"`
+}
+
+type PhotoQAInput struct {
+	Status string `query:"status" default:"all" enum:"all,far,no_gps"`
+	Days   int    `query:"days" default:"30" minimum:"1" maximum:"3650"`
+	Limit  int32  `query:"limit" default:"200" minimum:"1" maximum:"1000"`
+}
+
+type PhotoDuplicatesInput struct {
+	Scope string `query:"scope" default:"all" enum:"all,same_tree,other_tree"`
+	Days  int    `query:"days" default:"30" minimum:"1" maximum:"3650"`
+	Limit int32  `query:"limit" default:"200" minimum:"1" maximum:"1000"`
+}
+
+type PhotoReviewFormInput struct {
+	ID      string `path:"id" minLength:"21" maxLength:"21"`
+	RawBody multipart.Form
+}
+
+type PhotoReviewFormParsed struct {
+	TreeID string `form:"tree_id"`
+}